@@ -0,0 +1,65 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"vibe-certificados/models"
+	"vibe-certificados/services"
+	"vibe-certificados/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateAPIKey handles POST /api/keys. The response holds the key, which
+// is not shown again.
+func (h *Handlers) CreateAPIKey(c *gin.Context) {
+	var req models.CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	created, err := h.organizationService.CreateAPIKey(organizationID(c), &req)
+	if err != nil {
+		respondAPIKeyError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, created)
+}
+
+// GetAPIKeys handles GET /api/keys
+func (h *Handlers) GetAPIKeys(c *gin.Context) {
+	keys, err := h.organizationService.GetAPIKeys(organizationID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, keys)
+}
+
+// RevokeAPIKey handles DELETE /api/keys/{id}
+func (h *Handlers) RevokeAPIKey(c *gin.Context) {
+	key, err := h.organizationService.RevokeAPIKey(organizationID(c), c.Param("id"))
+	if err != nil {
+		respondAPIKeyError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, key)
+}
+
+// respondAPIKeyError maps API key errors to HTTP responses
+func respondAPIKeyError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, storage.ErrAPIKeyNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+	case errors.Is(err, services.ErrInvalidRole), errors.Is(err, services.ErrAPIKeyNameMissing):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrAPIKeyRevoked), errors.Is(err, services.ErrLastAdminKey):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
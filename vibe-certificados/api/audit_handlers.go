@@ -0,0 +1,88 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"vibe-certificados/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Number of audit entries listed when the request sets no limit, and the
+// most a JSON listing returns
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// GetAuditLog handles GET /api/audit. Entries can be filtered by actor,
+// action, target_type, target_id, since and until. The JSON listing holds
+// the newest entries first, up to limit; with format=jsonl every matching
+// entry is exported as JSON Lines, oldest first.
+func (h *Handlers) GetAuditLog(c *gin.Context) {
+	export := c.Query("format") == "jsonl"
+	if format := c.Query("format"); format != "" && format != "json" && !export {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json or jsonl"})
+		return
+	}
+
+	filter, err := auditFilter(c, export)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	entries, err := h.auditService.GetEntries(organizationID(c), filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !export {
+		c.JSON(http.StatusOK, entries)
+		return
+	}
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Content-Disposition", "attachment; filename=audit.jsonl")
+	c.Status(http.StatusOK)
+	encoder := json.NewEncoder(c.Writer)
+	for i := len(entries) - 1; i >= 0; i-- {
+		if err := encoder.Encode(entries[i]); err != nil {
+			// Headers are already sent; the client sees a truncated file
+			c.Error(err)
+			return
+		}
+	}
+}
+
+// auditFilter reads the audit filters of a request. Exports have no
+// default limit.
+func auditFilter(c *gin.Context, export bool) (*models.AuditFilter, error) {
+	filter := &models.AuditFilter{
+		ActorID:    c.Query("actor"),
+		Action:     c.Query("action"),
+		TargetType: c.Query("target_type"),
+		TargetID:   c.Query("target_id"),
+	}
+
+	var err error
+	if filter.Since, _, err = timeParam(c.Query("since")); err != nil {
+		return nil, errors.New("since must be an RFC 3339 time or a YYYY-MM-DD date")
+	}
+	if filter.Until, _, err = timeParam(c.Query("until")); err != nil {
+		return nil, errors.New("until must be an RFC 3339 time or a YYYY-MM-DD date")
+	}
+
+	if value := c.Query("limit"); value != "" {
+		filter.Limit, err = strconv.Atoi(value)
+		if err != nil || filter.Limit < 1 || (!export && filter.Limit > maxAuditLimit) {
+			return nil, errors.New("limit must be a number between 1 and " + strconv.Itoa(maxAuditLimit))
+		}
+	} else if !export {
+		filter.Limit = defaultAuditLimit
+	}
+	return filter, nil
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"net/http"
+	"vibe-certificados/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireRole is the middleware allowing only requests whose API key has
+// one of roles; admin keys are always allowed. It runs after
+// ResolveOrganization, which has already refused unknown keys.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := requestAPIKey(c)
+		if key == nil {
+			c.Header("WWW-Authenticate", APIKeyHeader)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "API key required in the " + APIKeyHeader + " header"})
+			return
+		}
+		if !key.Allows(roles...) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "API key role " + key.Role + " is not allowed to do this"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// requireDefaultOrganization allows only keys of the default organization,
+// which manages the other organizations. It runs after RequireRole.
+func requireDefaultOrganization(c *gin.Context) {
+	if requestAPIKey(c).OrganizationID != models.DefaultOrganizationID {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "only keys of the " + models.DefaultOrganizationID + " organization manage organizations"})
+		return
+	}
+	c.Next()
+}
+
+// requestActor returns who makes the request, as recorded in the audit log
+func requestActor(c *gin.Context) models.Actor {
+	if key := requestAPIKey(c); key != nil {
+		return models.Actor{ID: key.ID, Name: key.Name}
+	}
+	return models.Actor{ID: "anonymous"}
+}
+
+// requestAPIKey returns the API key of the request, or nil for anonymous
+// requests
+func requestAPIKey(c *gin.Context) *models.APIKey {
+	if value, ok := c.Get(apiKeyKey); ok {
+		return value.(*models.APIKey)
+	}
+	return nil
+}
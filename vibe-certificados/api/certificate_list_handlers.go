@@ -0,0 +1,103 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"vibe-certificados/models"
+	"vibe-certificados/services"
+	"vibe-certificados/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListCertificates handles GET /api/certificates. Certificates can be
+// filtered by course, template_id, name (substring), status and the
+// completed_from/completed_to and created_from/created_to ranges, which
+// include both ends. sort names a field, prefixed with "-" for descending
+// order; the next page is read by passing next_cursor as cursor.
+func (h *Handlers) ListCertificates(c *gin.Context) {
+	query, err := certificateQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := h.certificateService.ListCertificates(organizationID(c), query)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidCertificateQuery) || errors.Is(err, storage.ErrInvalidCursor) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// certificateQuery reads the filters, sort order and page of a request
+func certificateQuery(c *gin.Context) (*models.CertificateQuery, error) {
+	query := &models.CertificateQuery{
+		Course:     c.Query("course"),
+		TemplateID: c.Query("template_id"),
+		Name:       c.Query("name"),
+		Status:     c.Query("status"),
+		Cursor:     c.Query("cursor"),
+	}
+
+	if sort := c.Query("sort"); sort != "" {
+		query.Sort = strings.TrimPrefix(sort, "-")
+		query.Descending = strings.HasPrefix(sort, "-")
+	}
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			return nil, errors.New("limit must be a positive number")
+		}
+		query.Limit = limit
+	}
+
+	for _, param := range []struct {
+		name        string
+		from, until *time.Time
+	}{
+		{"completed", &query.CompletedFrom, &query.CompletedUntil},
+		{"created", &query.CreatedFrom, &query.CreatedUntil},
+	} {
+		from, _, err := timeParam(c.Query(param.name + "_from"))
+		if err != nil {
+			return nil, errors.New(param.name + "_from must be an RFC 3339 time or a YYYY-MM-DD date")
+		}
+		to, date, err := timeParam(c.Query(param.name + "_to"))
+		if err != nil {
+			return nil, errors.New(param.name + "_to must be an RFC 3339 time or a YYYY-MM-DD date")
+		}
+
+		// The storage excludes the end of ranges; a date includes its day
+		*param.from = from
+		switch {
+		case to.IsZero():
+		case date:
+			*param.until = to.AddDate(0, 0, 1)
+		default:
+			*param.until = to.Add(time.Nanosecond)
+		}
+	}
+	return query, nil
+}
+
+// timeParam parses a time query parameter, given as an RFC 3339 time or a
+// date (midnight UTC). date reports whether a date was given.
+func timeParam(value string) (t time.Time, date bool, err error) {
+	if value == "" {
+		return time.Time{}, false, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, false, nil
+	}
+	t, err = time.Parse("2006-01-02", value)
+	return t, true, err
+}
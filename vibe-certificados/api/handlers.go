@@ -1,31 +1,51 @@
 package api
 
 import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime/multipart"
 	"net/http"
+	"net/url"
+	"slices"
 	"strings"
+	"unicode/utf8"
 	"vibe-certificados/models"
 	"vibe-certificados/services"
+	"vibe-certificados/storage"
 
 	"github.com/gin-gonic/gin"
 )
 
 // Handlers contains all HTTP handlers
 type Handlers struct {
-	certificateService *services.CertificateService
-	templateService    *services.TemplateService
-	pdfService         *services.PDFService
+	certificateService  *services.CertificateService
+	templateService     *services.TemplateService
+	pdfService          *services.PDFService
+	jobService          *services.JobService
+	exportService       *services.ExportService
+	organizationService *services.OrganizationService
+	auditService        *services.AuditService
 }
 
 // NewHandlers creates a new handlers instance
-func NewHandlers(certService *services.CertificateService, templateService *services.TemplateService, pdfService *services.PDFService) *Handlers {
+func NewHandlers(certService *services.CertificateService, templateService *services.TemplateService, pdfService *services.PDFService, jobService *services.JobService, exportService *services.ExportService, organizationService *services.OrganizationService, auditService *services.AuditService) *Handlers {
 	return &Handlers{
-		certificateService: certService,
-		templateService:    templateService,
-		pdfService:         pdfService,
+		certificateService:  certService,
+		templateService:     templateService,
+		pdfService:          pdfService,
+		jobService:          jobService,
+		exportService:       exportService,
+		organizationService: organizationService,
+		auditService:        auditService,
 	}
 }
 
-// CreateCertificate handles POST /api/certificates
+// CreateCertificate handles POST /api/certificates. With an
+// Idempotency-Key header, retries of the request return the certificate
+// first issued, flagged by an Idempotent-Replayed header. Certificates
+// already issued that are returned because of on_duplicate come with 200
+// instead of 201.
 func (h *Handlers) CreateCertificate(c *gin.Context) {
 	var req models.CertificateRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -33,20 +53,42 @@ func (h *Handlers) CreateCertificate(c *gin.Context) {
 		return
 	}
 
-	cert, err := h.certificateService.CreateCertificate(&req)
+	cert, outcome, err := h.certificateService.IssueCertificate(organizationID(c), requestActor(c), c.GetHeader("Idempotency-Key"), &req)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		var validation *services.ValidationError
+		switch {
+		case errors.As(err, &validation):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid template fields", "fields": validation.Fields})
+		case errors.Is(err, services.ErrDuplicateCertificate):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrIdempotencyKeyReused):
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		}
 		return
 	}
 
-	c.JSON(http.StatusCreated, cert)
+	switch outcome {
+	case services.IssueReplayed:
+		c.Header("Idempotent-Replayed", "true")
+		c.JSON(http.StatusOK, cert)
+	case services.IssueExisting:
+		c.JSON(http.StatusOK, cert)
+	default:
+		c.JSON(http.StatusCreated, cert)
+	}
 }
 
-// CreateCertificatesBatch handles POST /api/certificates/batch
+// CreateCertificatesBatch handles POST /api/certificates/batch. The file,
+// CSV, XLSX or JSON Lines, is issued in the background and a job is
+// returned; with ?sync=true the certificates are issued within the
+// request, as before. ?dry_run=true only validates the file, reporting
+// each row, and &report=csv downloads its failed rows instead.
 func (h *Handlers) CreateCertificatesBatch(c *gin.Context) {
 	file, err := c.FormFile("file")
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "CSV file is required"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
 		return
 	}
 
@@ -57,26 +99,265 @@ func (h *Handlers) CreateCertificatesBatch(c *gin.Context) {
 	}
 	defer src.Close()
 
-	response, err := h.certificateService.CreateCertificatesFromCSV(src)
+	opts, err := importOptions(c, file)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, response)
+	// send_email=true emails every certificate of the file once issued
+	if opts.SendEmail && !h.certificateService.CanSendEmail() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "email delivery is not configured"})
+		return
+	}
+
+	if c.Query("dry_run") == "true" {
+		report, err := h.certificateService.ValidateBatchFile(organizationID(c), src, opts)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if c.Query("report") != "csv" {
+			c.JSON(http.StatusOK, report)
+			return
+		}
+
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Header("Content-Disposition", "attachment; filename=failed_rows.csv")
+		c.Status(http.StatusOK)
+		if err := services.WriteFailedRowsCSV(c.Writer, report, opts); err != nil {
+			// Headers are already sent; the client sees a truncated file
+			c.Error(err)
+		}
+		return
+	}
+
+	if c.Query("sync") == "true" {
+		response, err := h.certificateService.CreateCertificatesFromFile(organizationID(c), requestActor(c), src, opts)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	job, err := h.jobService.SubmitFile(organizationID(c), requestActor(c), src, opts)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidBatchFile) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Location", services.OrganizationPath(job.OrganizationID)+"/jobs/"+job.ID)
+	c.JSON(http.StatusAccepted, job)
+}
+
+// importOptions reads how an uploaded batch file is read from the form:
+// format (detected from the file when empty), delimiter (a single
+// character or "tab"), encoding, sheet, mapping, a JSON object of file
+// headers to the fields or data keys they hold, and on_duplicate, the
+// policy of rows matching certificates already issued
+func importOptions(c *gin.Context, file *multipart.FileHeader) (services.ImportOptions, error) {
+	opts := services.ImportOptions{
+		Format:      strings.ToLower(c.PostForm("format")),
+		Encoding:    c.PostForm("encoding"),
+		Sheet:       c.PostForm("sheet"),
+		SendEmail:   c.PostForm("send_email") == "true",
+		OnDuplicate: c.PostForm("on_duplicate"),
+	}
+	if opts.OnDuplicate != "" && !slices.Contains(models.DuplicatePolicies, opts.OnDuplicate) {
+		return opts, errors.New("on_duplicate must be one of " + strings.Join(models.DuplicatePolicies, ", "))
+	}
+	switch opts.Format {
+	case "":
+		opts.Format = services.DetectBatchFormat(file.Filename, file.Header.Get("Content-Type"))
+	case services.FormatCSV, services.FormatXLSX, services.FormatJSONL:
+	default:
+		return opts, errors.New("format must be csv, xlsx or jsonl")
+	}
+
+	switch delimiter := c.PostForm("delimiter"); {
+	case delimiter == "":
+	case strings.EqualFold(delimiter, "tab"):
+		opts.Delimiter = '\t'
+	case utf8.RuneCountInString(delimiter) == 1:
+		opts.Delimiter, _ = utf8.DecodeRuneInString(delimiter)
+	default:
+		return opts, errors.New("delimiter must be a single character or tab")
+	}
+
+	if mapping := c.PostForm("mapping"); mapping != "" {
+		if err := json.Unmarshal([]byte(mapping), &opts.Mapping); err != nil {
+			return opts, errors.New("mapping must be a JSON object of file headers to fields")
+		}
+	}
+	return opts, nil
+}
+
+// RevokeCertificate handles POST /api/certificates/{id}/revoke
+func (h *Handlers) RevokeCertificate(c *gin.Context) {
+	id := c.Param("id")
+
+	var req models.RevokeCertificateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	cert, err := h.certificateService.RevokeCertificate(organizationID(c), requestActor(c), id, req.Reason)
+	if err != nil {
+		if errors.Is(err, storage.ErrCertificateNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Certificate not found"})
+			return
+		}
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, cert)
+}
+
+// CorrectCertificate handles PATCH /api/certificates/{id}: the name,
+// course or data are corrected by issuing a new certificate that
+// supersedes the old one
+func (h *Handlers) CorrectCertificate(c *gin.Context) {
+	var req models.CorrectCertificateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	cert, err := h.certificateService.CorrectCertificate(organizationID(c), requestActor(c), c.Param("id"), &req)
+	if err != nil {
+		var validation *services.ValidationError
+		switch {
+		case errors.Is(err, storage.ErrCertificateNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Certificate not found"})
+		case errors.Is(err, services.ErrCertificateNotCorrectable):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.As(err, &validation):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid template fields", "fields": validation.Fields})
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.Header("Location", services.OrganizationPath(cert.OrganizationID)+"/certificates/"+cert.ID)
+	c.JSON(http.StatusCreated, cert)
+}
+
+// GetCertificateHistory handles GET /api/certificates/{id}/history, the
+// corrections of a certificate from the first one issued to the current one
+func (h *Handlers) GetCertificateHistory(c *gin.Context) {
+	history, err := h.certificateService.CertificateHistory(organizationID(c), c.Param("id"))
+	if err != nil {
+		if errors.Is(err, storage.ErrCertificateNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Certificate not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, history)
+}
+
+// SendCertificate handles POST /api/certificates/{id}/send, (re)sending the
+// certificate to its recipient by email
+func (h *Handlers) SendCertificate(c *gin.Context) {
+	cert, err := h.certificateService.SendCertificate(organizationID(c), requestActor(c), c.Param("id"))
+	if err != nil {
+		if errors.Is(err, storage.ErrCertificateNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Certificate not found"})
+			return
+		}
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"id": cert.ID, "delivery": cert.Delivery})
+}
+
+// GetCertificateStatus handles GET /api/certificates/{id}/status
+func (h *Handlers) GetCertificateStatus(c *gin.Context) {
+	cert, err := h.certificateService.GetCertificate(organizationID(c), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Certificate not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":                cert.ID,
+		"status":            certificateStatus(cert),
+		"valid":             cert.IsValid(),
+		"revocation_reason": cert.RevocationReason,
+		"revoked_at":        cert.RevokedAt,
+		"superseded_by":     cert.SupersededBy,
+	})
+}
+
+// certificateStatus returns the status of a certificate, treating
+// certificates stored before statuses existed as active
+func certificateStatus(cert *models.Certificate) string {
+	if cert.Status == "" {
+		return models.StatusActive
+	}
+	return cert.Status
 }
 
-// GetCertificateByFormat handles both HTML and PDF export based on file extension
+// setStatusHeaders describes the status of a served certificate. A
+// superseded certificate links to its replacement in the same format.
+func setStatusHeaders(c *gin.Context, cert *models.Certificate, ext string) {
+	c.Header("X-Certificate-Status", certificateStatus(cert))
+	if cert.SupersededBy != "" {
+		c.Header("Link", "<"+services.OrganizationPath(cert.OrganizationID)+"/certificates/"+cert.SupersededBy+ext+`>; rel="successor-version"`)
+	}
+}
+
+// redirectToCurrent redirects requests for a superseded certificate made
+// with ?current=true to the current certificate of its history, reporting
+// whether it responded
+func (h *Handlers) redirectToCurrent(c *gin.Context, cert *models.Certificate, ext string) bool {
+	if cert.SupersededBy == "" || c.Query("current") != "true" {
+		return false
+	}
+
+	history, err := h.certificateService.CertificateHistory(cert.OrganizationID, cert.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return true
+	}
+
+	target := services.OrganizationPath(cert.OrganizationID) + "/certificates/" + history.CurrentID + ext
+	if lang := c.Query("lang"); lang != "" {
+		target += "?lang=" + url.QueryEscape(lang)
+	}
+	c.Redirect(http.StatusFound, target)
+	return true
+}
+
+// GetCertificateByFormat handles both HTML and PDF export based on file
+// extension. Superseded certificates are served with a link to their
+// replacement, or redirected to the current one with ?current=true.
 func (h *Handlers) GetCertificateByFormat(c *gin.Context) {
 	idParam := c.Param("id")
-	
+
 	// Check if it ends with .html or .pdf
 	if strings.HasSuffix(idParam, ".html") {
 		id := strings.TrimSuffix(idParam, ".html")
-		h.serveCertificateHTML(c, id)
+		if locale, ok := requestedLocale(c); ok {
+			h.serveCertificateHTML(c, id, locale)
+		}
 	} else if strings.HasSuffix(idParam, ".pdf") {
 		id := strings.TrimSuffix(idParam, ".pdf")
-		h.serveCertificatePDF(c, id)
+		if locale, ok := requestedLocale(c); ok {
+			h.serveCertificatePDF(c, id, locale)
+		}
 	} else {
 		// Default to JSON response with certificate data
 		h.serveCertificateJSON(c, idParam)
@@ -85,46 +366,95 @@ func (h *Handlers) GetCertificateByFormat(c *gin.Context) {
 
 // serveCertificateJSON returns certificate as JSON
 func (h *Handlers) serveCertificateJSON(c *gin.Context, id string) {
-	cert, err := h.certificateService.GetCertificate(id)
+	cert, err := h.certificateService.GetCertificate(organizationID(c), id)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Certificate not found"})
 		return
 	}
+	if h.redirectToCurrent(c, cert, "") {
+		return
+	}
+	setStatusHeaders(c, cert, "")
 	c.JSON(http.StatusOK, cert)
 }
 
+// requestedLocale returns the locale a certificate should be rendered in,
+// chosen with ?lang=. An empty locale keeps the certificate's own, see
+// withLocale. ok is false, after responding with 400, when ?lang= names an
+// unsupported language.
+func requestedLocale(c *gin.Context) (string, bool) {
+	c.Writer.Header().Add("Vary", "Accept-Language")
+
+	if lang := c.Query("lang"); lang != "" {
+		locale := services.MatchLocale(lang)
+		if locale == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":     "unsupported locale: " + lang,
+				"supported": services.SupportedLocales(),
+			})
+			return "", false
+		}
+		return locale, true
+	}
+	return "", true
+}
+
+// withLocale returns a copy of cert rendered in locale, or cert itself
+// when locale is empty. Without a requested locale, a certificate issued
+// without one follows the Accept-Language header; the locale stored at
+// issuance is never overridden by it.
+func withLocale(c *gin.Context, cert *models.Certificate, locale string) *models.Certificate {
+	if locale == "" && cert.Locale == "" {
+		locale = services.MatchLocale(c.GetHeader("Accept-Language"))
+	}
+	if locale == "" {
+		return cert
+	}
+	localized := *cert
+	localized.Locale = locale
+	return &localized
+}
+
 // serveCertificateHTML serves certificate as HTML
-func (h *Handlers) serveCertificateHTML(c *gin.Context, id string) {
-	cert, err := h.certificateService.GetCertificate(id)
+func (h *Handlers) serveCertificateHTML(c *gin.Context, id, locale string) {
+	cert, err := h.certificateService.GetCertificate(organizationID(c), id)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Certificate not found"})
 		return
 	}
+	if h.redirectToCurrent(c, cert, ".html") {
+		return
+	}
 
-	html, err := h.templateService.RenderCertificate(cert)
+	html, err := h.templateService.RenderCertificate(withLocale(c, cert, locale))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render certificate"})
 		return
 	}
 
+	setStatusHeaders(c, cert, ".html")
 	c.Header("Content-Type", "text/html; charset=utf-8")
 	c.String(http.StatusOK, html)
 }
 
 // serveCertificatePDF serves certificate as PDF
-func (h *Handlers) serveCertificatePDF(c *gin.Context, id string) {
-	cert, err := h.certificateService.GetCertificate(id)
+func (h *Handlers) serveCertificatePDF(c *gin.Context, id, locale string) {
+	cert, err := h.certificateService.GetCertificate(organizationID(c), id)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Certificate not found"})
 		return
 	}
+	if h.redirectToCurrent(c, cert, ".pdf") {
+		return
+	}
 
-	pdf, err := h.pdfService.GeneratePDF(cert)
+	pdf, err := h.pdfService.GeneratePDF(withLocale(c, cert, locale))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate PDF"})
 		return
 	}
 
+	setStatusHeaders(c, cert, ".pdf")
 	c.Header("Content-Type", "application/pdf")
 	c.Header("Content-Disposition", "inline; filename=certificate_"+cert.ID+".pdf")
 	c.Data(http.StatusOK, "application/pdf", pdf)
@@ -134,7 +464,7 @@ func (h *Handlers) serveCertificatePDF(c *gin.Context, id string) {
 func (h *Handlers) GetCertificatesByEmail(c *gin.Context) {
 	email := c.Param("email")
 
-	certificates, err := h.certificateService.GetCertificatesByEmail(email)
+	certificates, err := h.certificateService.GetCertificatesByEmail(organizationID(c), email)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -147,9 +477,43 @@ func (h *Handlers) GetCertificatesByEmail(c *gin.Context) {
 	})
 }
 
+// ExportCertificates handles POST /api/certificates/export, streaming a ZIP
+// with the PDF (and optionally HTML) of the selected certificates
+func (h *Handlers) ExportCertificates(c *gin.Context) {
+	var req models.ExportCertificatesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	pattern, err := services.ParseFilenamePattern(req.FilenamePattern)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	certificates, err := h.exportService.ResolveCertificates(organizationID(c), &req)
+	if err != nil {
+		if errors.Is(err, storage.ErrCertificateNotFound) || errors.Is(err, storage.ErrJobNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", "attachment; filename=certificates.zip")
+	c.Status(http.StatusOK)
+	if err := h.exportService.WriteZIP(c.Writer, certificates, pattern, req.IncludeHTML); err != nil {
+		// Headers are already sent; the client sees a truncated archive
+		c.Error(err)
+	}
+}
+
 // GetTemplates handles GET /api/templates
 func (h *Handlers) GetTemplates(c *gin.Context) {
-	templates, err := h.templateService.GetAllTemplates()
+	templates, err := h.templateService.GetAllTemplates(organizationID(c))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -162,7 +526,7 @@ func (h *Handlers) GetTemplates(c *gin.Context) {
 func (h *Handlers) GetTemplate(c *gin.Context) {
 	id := c.Param("id")
 
-	template, err := h.templateService.GetTemplate(id)
+	template, err := h.templateService.GetTemplate(organizationID(c), id)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
 		return
@@ -179,13 +543,13 @@ func (h *Handlers) CreateTemplate(c *gin.Context) {
 		return
 	}
 
-	err := h.templateService.CreateTemplate(&template)
+	err := h.templateService.CreateTemplate(organizationID(c), requestActor(c), &template)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusCreated, template)
+	c.JSON(http.StatusCreated, h.withWarnings(&template))
 }
 
 // UpdateTemplate handles PUT /api/templates/{id}
@@ -199,24 +563,107 @@ func (h *Handlers) UpdateTemplate(c *gin.Context) {
 	}
 
 	template.ID = id
-	err := h.templateService.UpdateTemplate(&template)
+	err := h.templateService.UpdateTemplate(organizationID(c), requestActor(c), &template)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, template)
+	c.JSON(http.StatusOK, h.withWarnings(&template))
 }
 
 // DeleteTemplate handles DELETE /api/templates/{id}
 func (h *Handlers) DeleteTemplate(c *gin.Context) {
 	id := c.Param("id")
 
-	err := h.templateService.DeleteTemplate(id)
+	err := h.templateService.DeleteTemplate(organizationID(c), requestActor(c), id)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Template deleted successfully"})
-}
\ No newline at end of file
+}
+
+// templateResponse is a saved template with the problems found that do
+// not prevent saving it
+type templateResponse struct {
+	*models.Template
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// withWarnings reports variables used by the template but not declared in
+// its fields, and images that are missing from its assets
+func (h *Handlers) withWarnings(template *models.Template) templateResponse {
+	response := templateResponse{Template: template}
+	for _, name := range services.UndeclaredVariables(template) {
+		response.Warnings = append(response.Warnings, "variable "+name+" is not declared in fields")
+	}
+	response.Warnings = append(response.Warnings, h.templateService.AssetWarnings(template)...)
+	return response
+}
+
+// PreviewTemplate handles POST /api/templates/{id}/preview
+func (h *Handlers) PreviewTemplate(c *gin.Context) {
+	var req models.PreviewTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	template, err := h.templateService.GetTemplate(organizationID(c), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+		return
+	}
+
+	h.servePreview(c, template, &req)
+}
+
+// PreviewUnsavedTemplate handles POST /api/templates/preview, rendering the
+// template in the request body without saving it
+func (h *Handlers) PreviewUnsavedTemplate(c *gin.Context) {
+	var req models.PreviewTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Template == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "template is required"})
+		return
+	}
+
+	req.Template.OrganizationID = organizationID(c)
+	h.servePreview(c, req.Template, &req)
+}
+
+// servePreview renders a template as HTML or PDF for a sample certificate
+func (h *Handlers) servePreview(c *gin.Context, template *models.Template, req *models.PreviewTemplateRequest) {
+	if req.Locale != "" && !services.IsSupportedLocale(req.Locale) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported locale: " + req.Locale, "supported": services.SupportedLocales()})
+		return
+	}
+	cert := h.certificateService.PreviewCertificate(template, req.Data)
+	cert.Locale = req.Locale
+
+	switch req.Format {
+	case "", "html":
+		html, err := h.templateService.PreviewHTML(template, cert)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.Header("Content-Type", "text/html; charset=utf-8")
+		c.String(http.StatusOK, html)
+	case "pdf":
+		pdf, err := h.pdfService.PreviewPDF(template, cert)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.Header("Content-Disposition", "inline; filename=preview.pdf")
+		c.Data(http.StatusOK, "application/pdf", pdf)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be html or pdf"})
+	}
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"vibe-certificados/services"
+	"vibe-certificados/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetJobs handles GET /api/jobs
+func (h *Handlers) GetJobs(c *gin.Context) {
+	jobs, err := h.jobService.GetAllJobs(organizationID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, jobs)
+}
+
+// GetJob handles GET /api/jobs/{id}
+func (h *Handlers) GetJob(c *gin.Context) {
+	job, err := h.jobService.GetJob(organizationID(c), c.Param("id"))
+	if err != nil {
+		respondJobError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// CancelJob handles POST /api/jobs/{id}/cancel
+func (h *Handlers) CancelJob(c *gin.Context) {
+	job, err := h.jobService.CancelJob(organizationID(c), c.Param("id"))
+	if err != nil {
+		respondJobError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// ExpireJob handles DELETE /api/jobs/{id}
+func (h *Handlers) ExpireJob(c *gin.Context) {
+	if err := h.jobService.ExpireJob(organizationID(c), c.Param("id")); err != nil {
+		respondJobError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Job expired successfully"})
+}
+
+// respondJobError maps job service errors to HTTP responses
+func respondJobError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, storage.ErrJobNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+	case errors.Is(err, services.ErrJobFinished):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"vibe-certificados/models"
+	"vibe-certificados/services"
+	"vibe-certificados/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyHeader carries the API key that identifies the organization of a
+// request
+const APIKeyHeader = "X-API-Key"
+
+// Keys of the request state stored in the gin context
+const (
+	organizationKey = "organization"
+	apiKeyKey       = "api_key"
+)
+
+// ResolveOrganization is the middleware selecting the organization a
+// request acts on: the one of the API key, if any, else the one in the
+// /api/orgs/{org} prefix, else the default organization. A key used under
+// another organization's prefix is refused.
+func (h *Handlers) ResolveOrganization(c *gin.Context) {
+	orgID := c.Param("org")
+
+	if key := c.GetHeader(APIKeyHeader); key != "" {
+		apiKey, err := h.organizationService.ResolveAPIKey(key)
+		if errors.Is(err, services.ErrAPIKeyRevoked) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid API key"})
+			return
+		}
+		if orgID != "" && orgID != apiKey.OrganizationID {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "API key does not belong to organization " + orgID})
+			return
+		}
+		orgID = apiKey.OrganizationID
+		c.Set(apiKeyKey, apiKey)
+	}
+	if orgID == "" {
+		orgID = models.DefaultOrganizationID
+	}
+
+	if _, err := h.organizationService.GetOrganization(orgID); err != nil {
+		respondOrganizationError(c, err)
+		c.Abort()
+		return
+	}
+
+	c.Set(organizationKey, orgID)
+	c.Next()
+}
+
+// organizationID returns the organization resolved by ResolveOrganization
+func organizationID(c *gin.Context) string {
+	if orgID := c.GetString(organizationKey); orgID != "" {
+		return orgID
+	}
+	return models.DefaultOrganizationID
+}
+
+// CreateOrganization handles POST /api/orgs. The response holds the first
+// API key of the organization, an admin key, which is not shown again.
+func (h *Handlers) CreateOrganization(c *gin.Context) {
+	var req models.CreateOrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	created, err := h.organizationService.CreateOrganization(&req)
+	if err != nil {
+		respondOrganizationError(c, err)
+		return
+	}
+
+	c.Header("Location", "/api/orgs/"+created.ID)
+	c.JSON(http.StatusCreated, created)
+}
+
+// GetOrganizations handles GET /api/orgs
+func (h *Handlers) GetOrganizations(c *gin.Context) {
+	orgs, err := h.organizationService.GetAllOrganizations()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, orgs)
+}
+
+// GetOrganization handles GET /api/orgs/{org}
+func (h *Handlers) GetOrganization(c *gin.Context) {
+	org, err := h.organizationService.GetOrganization(organizationID(c))
+	if err != nil {
+		respondOrganizationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, org)
+}
+
+// respondOrganizationError maps organization service errors to HTTP responses
+func respondOrganizationError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, storage.ErrOrganizationNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+	case errors.Is(err, services.ErrOrganizationExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidOrganizationID), errors.Is(err, services.ErrOrganizationNameMissing):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
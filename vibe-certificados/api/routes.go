@@ -1,32 +1,41 @@
 package api
 
 import (
+	"vibe-certificados/models"
+
 	"github.com/gin-gonic/gin"
 )
 
-// SetupRoutes configures all API routes
+// SetupRoutes configures all API routes. The routes of an organization are
+// served under /api/orgs/{org} and, for the default organization or the
+// organization of the X-API-Key header, directly under /api.
+//
+// Viewing and verifying certificates is public; everything else needs an
+// API key with a role allowed for the route group.
 func SetupRoutes(r *gin.Engine, handlers *Handlers) {
 	// API group
 	api := r.Group("/api")
+	tenant := api.Group("", handlers.ResolveOrganization)
+	setupOrganizationRoutes(tenant, handlers)
 
-	// Certificate routes
-	certificates := api.Group("/certificates")
+	// Organization routes, managed with admin keys of the default organization
+	orgs := tenant.Group("/orgs", RequireRole(models.RoleAdmin), requireDefaultOrganization)
 	{
-		certificates.POST("", handlers.CreateCertificate)
-		certificates.POST("/batch", handlers.CreateCertificatesBatch)
-		certificates.GET("/:id", handlers.GetCertificateByFormat) // Handle both .html and .pdf
-		certificates.GET("/by-email/:email", handlers.GetCertificatesByEmail)
+		orgs.GET("", handlers.GetOrganizations)
+		orgs.POST("", handlers.CreateOrganization)
 	}
+	scoped := api.Group("/orgs/:org", handlers.ResolveOrganization)
+	scoped.GET("", RequireRole(models.Roles...), handlers.GetOrganization)
+	setupOrganizationRoutes(scoped, handlers)
 
-	// Template routes
-	templates := api.Group("/templates")
+	// Verification routes (public)
+	verify := api.Group("/verify")
 	{
-		templates.GET("", handlers.GetTemplates)
-		templates.POST("", handlers.CreateTemplate)
-		templates.GET("/:id", handlers.GetTemplate)
-		templates.PUT("/:id", handlers.UpdateTemplate)
-		templates.DELETE("/:id", handlers.DeleteTemplate)
+		verify.POST("", handlers.VerifySubmittedCertificate)
+		verify.GET("/public-key", handlers.GetPublicKey)
+		verify.GET("/:id", handlers.VerifyCertificate)
 	}
+	r.GET("/verify/:id", handlers.VerificationPage)
 
 	// Health check
 	api.GET("/health", func(c *gin.Context) {
@@ -35,4 +44,87 @@ func SetupRoutes(r *gin.Engine, handlers *Handlers) {
 			"service": "vibe-certificados",
 		})
 	})
-}
\ No newline at end of file
+}
+
+// setupOrganizationRoutes configures the routes acting on the data of a
+// single organization
+func setupOrganizationRoutes(api *gin.RouterGroup, handlers *Handlers) {
+	// Every role may read; admin keys are allowed everything
+	read := RequireRole(models.Roles...)
+	issue := RequireRole(models.RoleIssuer)
+	design := RequireRole(models.RoleTemplateAdmin)
+
+	// Certificate routes
+	certificates := api.Group("/certificates")
+	{
+		// Public, as the links are shared with recipients and verifiers
+		certificates.GET("/:id", handlers.GetCertificateByFormat) // Handle both .html and .pdf
+		certificates.GET("/:id/status", handlers.GetCertificateStatus)
+	}
+	reading := certificates.Group("", read)
+	{
+		reading.GET("", handlers.ListCertificates)
+		reading.POST("/export", handlers.ExportCertificates)
+		reading.GET("/by-email/:email", handlers.GetCertificatesByEmail)
+		reading.GET("/:id/history", handlers.GetCertificateHistory)
+	}
+	issuing := certificates.Group("", issue)
+	{
+		issuing.POST("", handlers.CreateCertificate)
+		issuing.POST("/batch", handlers.CreateCertificatesBatch)
+		issuing.PATCH("/:id", handlers.CorrectCertificate)
+		issuing.POST("/:id/revoke", handlers.RevokeCertificate)
+		issuing.POST("/:id/send", handlers.SendCertificate)
+	}
+
+	// Template routes
+	templates := api.Group("/templates")
+	{
+		// Public, as rendered certificates link to them
+		templates.GET("/:id/assets/:name", handlers.GetTemplateAsset)
+	}
+	browsing := templates.Group("", read)
+	{
+		browsing.GET("", handlers.GetTemplates)
+		browsing.POST("/preview", handlers.PreviewUnsavedTemplate)
+		browsing.GET("/:id", handlers.GetTemplate)
+		browsing.POST("/:id/preview", handlers.PreviewTemplate)
+		browsing.GET("/:id/versions", handlers.GetTemplateVersions)
+		browsing.GET("/:id/versions/:version", handlers.GetTemplateVersion)
+		browsing.GET("/:id/diff", handlers.DiffTemplateVersions)
+		browsing.GET("/:id/assets", handlers.GetTemplateAssets)
+	}
+	designing := templates.Group("", design)
+	{
+		designing.POST("", handlers.CreateTemplate)
+		designing.PUT("/:id", handlers.UpdateTemplate)
+		designing.DELETE("/:id", handlers.DeleteTemplate)
+		designing.POST("/:id/rollback", handlers.RollbackTemplate)
+		designing.POST("/:id/assets", handlers.UploadTemplateAsset)
+		designing.DELETE("/:id/assets/:name", handlers.DeleteTemplateAsset)
+	}
+
+	// Batch job routes
+	jobs := api.Group("/jobs")
+	watching := jobs.Group("", read)
+	{
+		watching.GET("", handlers.GetJobs)
+		watching.GET("/:id", handlers.GetJob)
+	}
+	controlling := jobs.Group("", issue)
+	{
+		controlling.POST("/:id/cancel", handlers.CancelJob)
+		controlling.DELETE("/:id", handlers.ExpireJob)
+	}
+
+	// API key routes
+	keys := api.Group("/keys", RequireRole(models.RoleAdmin))
+	{
+		keys.GET("", handlers.GetAPIKeys)
+		keys.POST("", handlers.CreateAPIKey)
+		keys.DELETE("/:id", handlers.RevokeAPIKey)
+	}
+
+	// Audit log routes
+	api.GET("/audit", RequireRole(models.RoleAdmin), handlers.GetAuditLog)
+}
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"path/filepath"
+	"vibe-certificados/models"
+	"vibe-certificados/services"
+	"vibe-certificados/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// multipartOverhead is the room left for multipart headers above the
+// asset size limit when bounding upload request bodies
+const multipartOverhead = 64 << 10
+
+// assetResponse is the metadata of an asset with the path that serves it
+type assetResponse struct {
+	*models.TemplateAsset
+	URL string `json:"url"`
+}
+
+// newAssetResponse returns the metadata of asset, without its content
+func newAssetResponse(asset *models.TemplateAsset) assetResponse {
+	listed := *asset
+	listed.Data = nil
+	return assetResponse{TemplateAsset: &listed, URL: services.AssetPath(asset.OrganizationID, asset.TemplateID, asset.Name)}
+}
+
+// UploadTemplateAsset handles POST /api/templates/{id}/assets. The image is
+// sent as the multipart field "file"; the optional field "name" overrides
+// the file name it is referenced by.
+func (h *Handlers) UploadTemplateAsset(c *gin.Context) {
+	maxSize := h.templateService.MaxAssetSize()
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSize+multipartOverhead)
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": services.ErrAssetTooLarge.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "image file is required"})
+		return
+	}
+
+	name := c.PostForm("name")
+	if name == "" {
+		name = filepath.Base(file.Filename)
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open file"})
+		return
+	}
+	defer src.Close()
+
+	// One byte past the limit is enough for the service to reject it
+	data, err := io.ReadAll(io.LimitReader(src, maxSize+1))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+		return
+	}
+
+	asset, err := h.templateService.UploadAsset(organizationID(c), requestActor(c), c.Param("id"), name, data)
+	if err != nil {
+		respondAssetError(c, err)
+		return
+	}
+
+	response := newAssetResponse(asset)
+	c.Header("Location", response.URL)
+	c.JSON(http.StatusCreated, response)
+}
+
+// GetTemplateAssets handles GET /api/templates/{id}/assets
+func (h *Handlers) GetTemplateAssets(c *gin.Context) {
+	assets, err := h.templateService.GetAssets(organizationID(c), c.Param("id"))
+	if err != nil {
+		respondAssetError(c, err)
+		return
+	}
+
+	response := make([]assetResponse, 0, len(assets))
+	for _, asset := range assets {
+		response = append(response, newAssetResponse(asset))
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// GetTemplateAsset handles GET /api/templates/{id}/assets/{name}. Assets
+// never change once uploaded, so they may be cached indefinitely;
+// If-None-Match and Range requests are answered by http.ServeContent.
+func (h *Handlers) GetTemplateAsset(c *gin.Context) {
+	asset, err := h.templateService.GetAsset(organizationID(c), c.Param("id"), c.Param("name"))
+	if err != nil {
+		respondAssetError(c, err)
+		return
+	}
+
+	c.Header("Content-Type", asset.ContentType)
+	c.Header("ETag", `"`+asset.ETag+`"`)
+	c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	c.Header("X-Content-Type-Options", "nosniff")
+	http.ServeContent(c.Writer, c.Request, asset.Name, asset.CreatedAt, bytes.NewReader(asset.Data))
+}
+
+// DeleteTemplateAsset handles DELETE /api/templates/{id}/assets/{name}
+func (h *Handlers) DeleteTemplateAsset(c *gin.Context) {
+	if err := h.templateService.DeleteAsset(organizationID(c), requestActor(c), c.Param("id"), c.Param("name")); err != nil {
+		respondAssetError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Asset deleted successfully"})
+}
+
+// respondAssetError maps asset errors to HTTP responses
+func respondAssetError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, storage.ErrTemplateNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+	case errors.Is(err, storage.ErrAssetNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Asset not found"})
+	case errors.Is(err, services.ErrAssetTooLarge):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrAssetType):
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidAssetName):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrAssetExists), errors.Is(err, services.ErrAssetInUse):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"vibe-certificados/models"
+	"vibe-certificados/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetTemplateVersions handles GET /api/templates/{id}/versions
+func (h *Handlers) GetTemplateVersions(c *gin.Context) {
+	versions, err := h.templateService.GetTemplateVersions(organizationID(c), c.Param("id"))
+	if err != nil {
+		respondTemplateVersionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, versions)
+}
+
+// GetTemplateVersion handles GET /api/templates/{id}/versions/{version}
+func (h *Handlers) GetTemplateVersion(c *gin.Context) {
+	version, ok := versionParam(c, c.Param("version"))
+	if !ok {
+		return
+	}
+
+	template, err := h.templateService.GetTemplateVersion(organizationID(c), c.Param("id"), version)
+	if err != nil {
+		respondTemplateVersionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, template)
+}
+
+// DiffTemplateVersions handles GET /api/templates/{id}/diff?from=1&to=2.
+// to defaults to the active version.
+func (h *Handlers) DiffTemplateVersions(c *gin.Context) {
+	id := c.Param("id")
+
+	from, ok := versionParam(c, c.Query("from"))
+	if !ok {
+		return
+	}
+
+	var to int
+	if c.Query("to") == "" {
+		current, err := h.templateService.GetTemplate(organizationID(c), id)
+		if err != nil {
+			respondTemplateVersionError(c, err)
+			return
+		}
+		to = current.Version
+	} else if to, ok = versionParam(c, c.Query("to")); !ok {
+		return
+	}
+
+	diff, err := h.templateService.DiffTemplateVersions(organizationID(c), id, from, to)
+	if err != nil {
+		respondTemplateVersionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, diff)
+}
+
+// RollbackTemplate handles POST /api/templates/{id}/rollback
+func (h *Handlers) RollbackTemplate(c *gin.Context) {
+	var req models.RollbackTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	template, err := h.templateService.RollbackTemplate(organizationID(c), requestActor(c), c.Param("id"), req.Version)
+	if err != nil {
+		respondTemplateVersionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, template)
+}
+
+// versionParam parses a template version number, responding with 400 when
+// it is not a positive integer
+func versionParam(c *gin.Context, value string) (int, bool) {
+	version, err := strconv.Atoi(value)
+	if err != nil || version < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "version must be a positive integer"})
+		return 0, false
+	}
+	return version, true
+}
+
+// respondTemplateVersionError maps template version errors to HTTP responses
+func respondTemplateVersionError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, storage.ErrTemplateNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+	case errors.Is(err, storage.ErrTemplateVersionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
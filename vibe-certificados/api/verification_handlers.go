@@ -0,0 +1,114 @@
+package api
+
+import (
+	"html/template"
+	"net/http"
+	"vibe-certificados/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// verificationPage is the public page linked from issued certificates
+var verificationPage = template.Must(template.New("verification").Parse(`<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <title>Verificação de Certificado</title>
+    <style>
+        body { font-family: sans-serif; background: #f4f4f4; margin: 0; padding: 40px; }
+        .card { background: white; max-width: 640px; margin: 0 auto; padding: 40px; border-radius: 10px; }
+        .result { font-size: 28px; font-weight: bold; margin-bottom: 20px; }
+        .valid { color: #27ae60; }
+        .invalid, .revoked, .superseded { color: #c0392b; }
+        dt { font-weight: bold; margin-top: 10px; }
+        dd { margin: 0; }
+    </style>
+</head>
+<body>
+    <div class="card">
+        {{if eq .Result "valid"}}
+        <div class="result valid">Certificado válido</div>
+        {{else if eq .Result "revoked"}}
+        <div class="result revoked">Certificado revogado</div>
+        {{else if eq .Result "superseded"}}
+        <div class="result superseded">Certificado substituído</div>
+        {{else}}
+        <div class="result invalid">Certificado inválido</div>
+        {{end}}
+        <p>{{.Message}}</p>
+        {{with .Certificate}}
+        <dl>
+            <dt>Nome</dt><dd>{{.Name}}</dd>
+            <dt>Curso</dt><dd>{{.Course}}</dd>
+            <dt>Concluído em</dt><dd>{{.CompletionDate.Format "02/01/2006"}}</dd>
+            <dt>Emitido em</dt><dd>{{.CreatedAt.Format "02/01/2006"}}</dd>
+            <dt>ID</dt><dd>{{.ID}}</dd>
+        </dl>
+        {{end}}
+        {{if .RevokedAt}}
+        <p>Revogado em {{.RevokedAt.Format "02/01/2006"}}{{if .RevocationReason}} — Motivo: {{.RevocationReason}}{{end}}</p>
+        {{end}}
+        {{with .SupersededBy}}
+        <p>Este certificado foi corrigido e substituído por <a href="/verify/{{.}}">{{.}}</a>.</p>
+        {{end}}
+    </div>
+</body>
+</html>`))
+
+// VerifyCertificate handles GET /api/verify/{id}
+func (h *Handlers) VerifyCertificate(c *gin.Context) {
+	result, err := h.certificateService.VerifyCertificate(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Certificate not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// VerifySubmittedCertificate handles POST /api/verify
+func (h *Handlers) VerifySubmittedCertificate(c *gin.Context) {
+	var req models.VerifyCertificateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result := h.certificateService.VerifySubmittedCertificate(&req.Certificate, req.Signature)
+	c.JSON(http.StatusOK, result)
+}
+
+// GetPublicKey handles GET /api/verify/public-key
+func (h *Handlers) GetPublicKey(c *gin.Context) {
+	key, err := h.certificateService.PublicKey()
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"algorithm":  "Ed25519",
+		"public_key": key,
+	})
+}
+
+// VerificationPage handles GET /verify/{id}, the human readable counterpart
+// of GET /api/verify/{id}
+func (h *Handlers) VerificationPage(c *gin.Context) {
+	result, err := h.certificateService.VerifyCertificate(c.Param("id"))
+	status := http.StatusOK
+	if err != nil {
+		status = http.StatusNotFound
+		result = &models.VerificationResult{
+			ID:      c.Param("id"),
+			Result:  models.VerificationInvalid,
+			Message: "Certificado não encontrado.",
+		}
+	}
+
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Status(status)
+	if err := verificationPage.Execute(c.Writer, result); err != nil {
+		c.Error(err)
+	}
+}
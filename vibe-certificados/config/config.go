@@ -0,0 +1,150 @@
+package config
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the runtime configuration of the service
+type Config struct {
+	StorageDriver string
+	SQLitePath    string
+
+	// Durability mode of the memory driver (disabled when MemoryDataDir is empty)
+	MemoryDataDir         string
+	MemoryCompactInterval time.Duration
+
+	// SigningKeyPath is the Ed25519 private key (PEM); created when missing
+	SigningKeyPath string
+	// PublicBaseURL is the address printed on certificates for verification
+	PublicBaseURL string
+
+	// AdminKeyPath holds an admin API key of the default organization;
+	// created when missing and no admin key exists
+	AdminKeyPath string
+	// CORSAllowedOrigins are the browser origins allowed to call the API
+	// ("*" for any); none by default
+	CORSAllowedOrigins []string
+
+	// FontsDir holds UTF-8 TrueType fonts (*.ttf) embedded in PDFs
+	FontsDir string
+	// FontFallback is the ordered list of font families tried for text the
+	// selected font cannot display (defaults to every font in FontsDir)
+	FontFallback []string
+
+	// AssetMaxBytes is the largest image that can be uploaded for a template
+	AssetMaxBytes int64
+
+	// BatchWorkers is the number of rows of batch jobs issued concurrently
+	BatchWorkers int
+	// ExportConcurrency is the number of certificates rendered in parallel
+	// for a ZIP export
+	ExportConcurrency int
+	// DuplicateKey are the certificate fields identifying duplicates
+	// (defaults to email, course, completion_date and template_id)
+	DuplicateKey []string
+
+	// Mailer selects email delivery: "" (disabled), "smtp" or "file"
+	Mailer       string
+	MailFrom     string
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	// MailDropDir receives .eml files when Mailer is "file"
+	MailDropDir     string
+	MailMaxAttempts int
+	MailRetryDelay  time.Duration
+}
+
+// Load reads the configuration from environment variables, falling back to
+// defaults suitable for local development
+func Load() *Config {
+	return &Config{
+		StorageDriver: getEnv("STORAGE_DRIVER", "memory"),
+		SQLitePath:    getEnv("SQLITE_PATH", "certificados.db"),
+
+		MemoryDataDir:         getEnv("MEMORY_DATA_DIR", ""),
+		MemoryCompactInterval: getDuration("MEMORY_COMPACT_INTERVAL", 5*time.Minute),
+
+		SigningKeyPath: getEnv("SIGNING_KEY_PATH", "signing_key.pem"),
+		PublicBaseURL:  getEnv("PUBLIC_BASE_URL", "http://localhost:8080"),
+
+		AdminKeyPath:       getEnv("ADMIN_KEY_PATH", "admin_api_key"),
+		CORSAllowedOrigins: getList("CORS_ALLOWED_ORIGINS"),
+
+		FontsDir:     getEnv("FONTS_DIR", "fonts"),
+		FontFallback: getList("PDF_FONT_FALLBACK"),
+
+		AssetMaxBytes: int64(getInt("ASSET_MAX_BYTES", 2<<20)),
+
+		BatchWorkers:      getInt("BATCH_WORKERS", 4),
+		ExportConcurrency: getInt("EXPORT_CONCURRENCY", 4),
+		DuplicateKey:      getList("DUPLICATE_KEY"),
+
+		Mailer:          getEnv("MAILER", ""),
+		MailFrom:        getEnv("MAIL_FROM", "Vibe Certificados <certificados@localhost>"),
+		SMTPHost:        getEnv("SMTP_HOST", ""),
+		SMTPPort:        getInt("SMTP_PORT", 587),
+		SMTPUsername:    getEnv("SMTP_USERNAME", ""),
+		SMTPPassword:    getEnv("SMTP_PASSWORD", ""),
+		MailDropDir:     getEnv("MAIL_DROP_DIR", "mail"),
+		MailMaxAttempts: getInt("MAIL_MAX_ATTEMPTS", 3),
+		MailRetryDelay:  getDuration("MAIL_RETRY_DELAY", 30*time.Second),
+	}
+}
+
+// getEnv returns the value of an environment variable or a fallback
+func getEnv(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok && value != "" {
+		return value
+	}
+	return fallback
+}
+
+// getDuration parses a duration environment variable such as "30s" or "5m"
+func getDuration(key string, fallback time.Duration) time.Duration {
+	value := getEnv(key, "")
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Invalid %s %q, using %s", key, value, fallback)
+		return fallback
+	}
+	return d
+}
+
+// getInt parses a positive integer environment variable
+func getInt(key string, fallback int) int {
+	value := getEnv(key, "")
+	if value == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		log.Printf("Invalid %s %q, using %d", key, value, fallback)
+		return fallback
+	}
+	return n
+}
+
+// getList parses a comma separated environment variable
+func getList(key string) []string {
+	value := getEnv(key, "")
+	if value == "" {
+		return nil
+	}
+
+	items := make([]string, 0)
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -1,8 +1,12 @@
 package main
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"log"
 	"vibe-certificados/api"
+	"vibe-certificados/config"
 	"vibe-certificados/services"
 	"vibe-certificados/storage"
 
@@ -10,33 +14,80 @@ import (
 )
 
 func main() {
+	if err := run(config.Load()); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run starts the service and blocks while it serves requests. Errors are
+// returned rather than fatal so that the deferred closes flush the storage.
+func run(cfg *config.Config) error {
 	// Initialize storage
-	memoryStorage := storage.NewMemoryStorage()
+	store, err := storage.Open(storage.Options{
+		Driver:          cfg.StorageDriver,
+		SQLitePath:      cfg.SQLitePath,
+		DataDir:         cfg.MemoryDataDir,
+		CompactInterval: cfg.MemoryCompactInterval,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to initialize storage: %w", err)
+	}
+	if closer, ok := store.(io.Closer); ok {
+		defer closer.Close()
+	}
+	log.Printf("Using %s storage", cfg.StorageDriver)
 
 	// Initialize services
-	templateService := services.NewTemplateService(memoryStorage)
-	certificateService := services.NewCertificateService(memoryStorage)
+	templateService := services.NewTemplateService(store)
+	templateService.SetMaxAssetSize(cfg.AssetMaxBytes)
+	certificateService := services.NewCertificateService(store)
+
+	signer, err := services.LoadOrCreateSigningService(cfg.SigningKeyPath)
+	if err != nil {
+		return fmt.Errorf("failed to load signing key: %w", err)
+	}
+	certificateService.SetSigner(signer)
+	certificateService.SetPublicBaseURL(cfg.PublicBaseURL)
+	if err := certificateService.SetDuplicateKey(cfg.DuplicateKey); err != nil {
+		return fmt.Errorf("invalid DUPLICATE_KEY: %w", err)
+	}
 	pdfService := services.NewPDFService(templateService)
 
+	fonts, err := services.LoadFontRegistry(cfg.FontsDir, cfg.FontFallback)
+	if err != nil {
+		return fmt.Errorf("failed to load fonts: %w", err)
+	}
+	pdfService.SetFontRegistry(fonts)
+	log.Printf("Loaded PDF fonts from %s: %v", cfg.FontsDir, fonts.Families())
+
+	mailer, err := newMailer(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to configure mailer: %w", err)
+	}
+	if mailer != nil {
+		delivery := services.NewDeliveryService(store, templateService, pdfService, mailer, 2, cfg.MailMaxAttempts, cfg.MailRetryDelay)
+		defer delivery.Close()
+		certificateService.SetDeliveryService(delivery)
+		log.Printf("Email delivery enabled (%s)", cfg.Mailer)
+	}
+
+	jobService := services.NewJobService(store, certificateService, cfg.BatchWorkers)
+	defer jobService.Close()
+	exportService := services.NewExportService(certificateService, jobService, templateService, pdfService, cfg.ExportConcurrency)
+	organizationService := services.NewOrganizationService(store, templateService)
+	if err := organizationService.LoadOrCreateAdminKey(cfg.AdminKeyPath); err != nil {
+		return fmt.Errorf("failed to load admin API key: %w", err)
+	}
+	auditService := services.NewAuditService(store)
+
 	// Initialize handlers
-	handlers := api.NewHandlers(certificateService, templateService, pdfService)
+	handlers := api.NewHandlers(certificateService, templateService, pdfService, jobService, exportService, organizationService, auditService)
 
 	// Setup Gin router
 	r := gin.Default()
 
 	// Add CORS middleware
-	r.Use(func(c *gin.Context) {
-		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
-		
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
-		}
-		
-		c.Next()
-	})
+	r.Use(api.CORS(cfg.CORSAllowedOrigins))
 
 	// Setup routes
 	api.SetupRoutes(r, handlers)
@@ -49,19 +100,64 @@ func main() {
 			"description": "API para geração de certificados em HTML e PDF",
 			"endpoints": map[string]interface{}{
 				"health": "/api/health",
+				"organizations": map[string]string{
+					"list":   "GET /api/orgs",
+					"create": "POST /api/orgs",
+					"get":    "GET /api/orgs/{org}",
+					"scoped": "/api/orgs/{org}/... (certificates, templates and jobs of the organization; X-API-Key selects it under /api/...)",
+				},
+				"audit": map[string]string{
+					"list":   "GET /api/audit?actor=&action=&target_type=&target_id=&since=&until=&limit=",
+					"export": "GET /api/audit?format=jsonl",
+				},
+				"keys": map[string]string{
+					"list":   "GET /api/keys",
+					"create": "POST /api/keys",
+					"revoke": "DELETE /api/keys/{id}",
+				},
 				"certificates": map[string]string{
-					"create":       "POST /api/certificates",
-					"batch":        "POST /api/certificates/batch",
-					"html":         "GET /api/certificates/{id}.html",
-					"pdf":          "GET /api/certificates/{id}.pdf",
-					"by_email":     "GET /api/certificates/by-email/{email}",
+					"list":     "GET /api/certificates?course=&template_id=&name=&status=&completed_from=&completed_to=&created_from=&created_to=&sort=&limit=&cursor=",
+					"create":   "POST /api/certificates (header: Idempotency-Key)",
+					"batch":    "POST /api/certificates/batch (form: file, format, delimiter, encoding, sheet, mapping, send_email, on_duplicate)",
+					"dry_run":  "POST /api/certificates/batch?dry_run=true[&report=csv]",
+					"export":   "POST /api/certificates/export",
+					"html":     "GET /api/certificates/{id}.html",
+					"pdf":      "GET /api/certificates/{id}.pdf",
+					"by_email": "GET /api/certificates/by-email/{email}",
+					"status":   "GET /api/certificates/{id}/status",
+					"revoke":   "POST /api/certificates/{id}/revoke",
+					"send":     "POST /api/certificates/{id}/send",
+					"correct":  "PATCH /api/certificates/{id}",
+					"history":  "GET /api/certificates/{id}/history",
+				},
+				"jobs": map[string]string{
+					"list":   "GET /api/jobs",
+					"get":    "GET /api/jobs/{id}",
+					"cancel": "POST /api/jobs/{id}/cancel",
+					"expire": "DELETE /api/jobs/{id}",
+				},
+				"verification": map[string]string{
+					"page":       "GET /verify/{id}",
+					"verify":     "GET /api/verify/{id}",
+					"submit":     "POST /api/verify",
+					"public_key": "GET /api/verify/public-key",
 				},
 				"templates": map[string]string{
-					"list":   "GET /api/templates",
-					"create": "POST /api/templates",
-					"get":    "GET /api/templates/{id}",
-					"update": "PUT /api/templates/{id}",
-					"delete": "DELETE /api/templates/{id}",
+					"list":            "GET /api/templates",
+					"create":          "POST /api/templates",
+					"get":             "GET /api/templates/{id}",
+					"update":          "PUT /api/templates/{id}",
+					"delete":          "DELETE /api/templates/{id}",
+					"preview":         "POST /api/templates/{id}/preview",
+					"preview_unsaved": "POST /api/templates/preview",
+					"versions":        "GET /api/templates/{id}/versions",
+					"version":         "GET /api/templates/{id}/versions/{version}",
+					"diff":            "GET /api/templates/{id}/diff?from={version}&to={version}",
+					"rollback":        "POST /api/templates/{id}/rollback",
+					"assets":          "GET /api/templates/{id}/assets",
+					"upload_asset":    "POST /api/templates/{id}/assets",
+					"asset":           "GET /api/templates/{id}/assets/{name}",
+					"delete_asset":    "DELETE /api/templates/{id}/assets/{name}",
 				},
 			},
 			"documentation": "https://github.com/dwildt/gosandbox/tree/main/vibe-certificados",
@@ -72,8 +168,24 @@ func main() {
 	log.Println("Starting Vibe Certificados API on :8080")
 	log.Println("API Documentation: http://localhost:8080")
 	log.Println("Health Check: http://localhost:8080/api/health")
-	
+
 	if err := r.Run(":8080"); err != nil {
-		log.Fatal("Failed to start server:", err)
+		return fmt.Errorf("failed to start server: %w", err)
+	}
+	return nil
+}
+
+// newMailer creates the mailer selected by cfg.Mailer, or nil when email
+// delivery is disabled
+func newMailer(cfg *config.Config) (services.Mailer, error) {
+	switch cfg.Mailer {
+	case "", "none":
+		return nil, nil
+	case "smtp":
+		return services.NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.MailFrom)
+	case "file":
+		return services.NewFileMailer(cfg.MailDropDir, cfg.MailFrom)
+	default:
+		return nil, errors.New("unknown mailer: " + cfg.Mailer)
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// TemplateAsset is an image uploaded for a template (a logo, a scanned
+// signature or a background). Assets are referenced by name from the HTML
+// template and the PDF layout, and are immutable: a new image needs a new
+// name, so certificates issued with older template versions keep theirs.
+type TemplateAsset struct {
+	OrganizationID string    `json:"organization_id"`
+	TemplateID     string    `json:"template_id"`
+	Name           string    `json:"name"`
+	ContentType    string    `json:"content_type"`
+	Size           int64     `json:"size"`
+	ETag           string    `json:"etag"` // SHA-256 of the content
+	CreatedAt      time.Time `json:"created_at"`
+	Data           []byte    `json:"data,omitempty"` // omitted when listing
+}
@@ -0,0 +1,84 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Audited actions
+const (
+	AuditCertificateCreate  = "certificate.create"
+	AuditCertificateRevoke  = "certificate.revoke"
+	AuditCertificateSend    = "certificate.send"
+	AuditCertificateCorrect = "certificate.correct"
+	AuditTemplateCreate     = "template.create"
+	AuditTemplateUpdate     = "template.update"
+	AuditTemplateDelete     = "template.delete"
+	AuditTemplateRollback   = "template.rollback"
+	AuditAssetUpload        = "asset.upload"
+	AuditAssetDelete        = "asset.delete"
+)
+
+// Kinds of records changed by audited actions
+const (
+	AuditTargetCertificate = "certificate"
+	AuditTargetTemplate    = "template"
+	AuditTargetAsset       = "asset"
+)
+
+// Actor identifies who performed an operation: an API key, by its ID and
+// name, or the service itself
+type Actor struct {
+	ID   string `json:"id"`
+	Name string `json:"name,omitempty"`
+}
+
+// SystemActor performs the operations the service does on its own, such as
+// creating the default template of an organization
+var SystemActor = Actor{ID: "system", Name: "system"}
+
+// AuditEntry records a change made to a certificate, template or asset.
+// Before and After hold the record as JSON before and after the change;
+// Before is empty for creations and After for deletions.
+type AuditEntry struct {
+	ID             string          `json:"id"`
+	OrganizationID string          `json:"organization_id"`
+	Actor          Actor           `json:"actor"`
+	Action         string          `json:"action"`
+	TargetType     string          `json:"target_type"`
+	TargetID       string          `json:"target_id"` // assets use "<template ID>/<name>"
+	Before         json.RawMessage `json:"before,omitempty"`
+	After          json.RawMessage `json:"after,omitempty"`
+	Timestamp      time.Time       `json:"timestamp"`
+}
+
+// AuditFilter selects audit entries; empty fields match every entry.
+// Limit keeps only the newest entries when greater than zero.
+type AuditFilter struct {
+	ActorID    string
+	Action     string
+	TargetType string
+	TargetID   string
+	Since      time.Time
+	Until      time.Time
+	Limit      int
+}
+
+// Matches reports whether an entry is selected by the filter, ignoring Limit
+func (f *AuditFilter) Matches(entry *AuditEntry) bool {
+	switch {
+	case f.ActorID != "" && entry.Actor.ID != f.ActorID:
+		return false
+	case f.Action != "" && entry.Action != f.Action:
+		return false
+	case f.TargetType != "" && entry.TargetType != f.TargetType:
+		return false
+	case f.TargetID != "" && entry.TargetID != f.TargetID:
+		return false
+	case !f.Since.IsZero() && entry.Timestamp.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && !entry.Timestamp.Before(f.Until):
+		return false
+	}
+	return true
+}
@@ -1,27 +1,83 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+// Certificate status values
+const (
+	StatusActive     = "active"
+	StatusRevoked    = "revoked"
+	StatusSuperseded = "superseded"
+)
+
+// Email delivery status values
+const (
+	DeliveryPending = "pending"
+	DeliverySent    = "sent"
+	DeliveryFailed  = "failed"
+)
+
+// DeliveryStatus records the email delivery of a certificate to its recipient
+type DeliveryStatus struct {
+	Status        string     `json:"status"`
+	Attempts      int        `json:"attempts"`
+	LastError     string     `json:"last_error,omitempty"`
+	LastAttemptAt *time.Time `json:"last_attempt_at,omitempty"`
+	SentAt        *time.Time `json:"sent_at,omitempty"`
+}
+
 // Certificate represents a generated certificate
 type Certificate struct {
+	ID               string            `json:"id"`
+	OrganizationID   string            `json:"organization_id"`
+	Email            string            `json:"email"`
+	Name             string            `json:"name"`
+	Course           string            `json:"course"`
+	CompletionDate   time.Time         `json:"completion_date"`
+	TemplateID       string            `json:"template_id"`
+	TemplateVersion  int               `json:"template_version,omitempty"` // 0 for certificates issued before versioning
+	Locale           string            `json:"locale,omitempty"`           // empty uses the template's locale
+	CreatedAt        time.Time         `json:"created_at"`
+	Data             map[string]string `json:"data,omitempty"`
+	Status           string            `json:"status"`
+	RevocationReason string            `json:"revocation_reason,omitempty"`
+	RevokedAt        *time.Time        `json:"revoked_at,omitempty"`
+	Signature        string            `json:"signature,omitempty"`
+	VerificationURL  string            `json:"verification_url,omitempty"`
+	Delivery         *DeliveryStatus   `json:"delivery,omitempty"`
+	// A correction issues a new certificate superseding the old one; both
+	// are linked so the whole history can be followed
+	Supersedes       string     `json:"supersedes,omitempty"`
+	SupersededBy     string     `json:"superseded_by,omitempty"`
+	SupersededAt     *time.Time `json:"superseded_at,omitempty"`
+	CorrectionReason string     `json:"correction_reason,omitempty"` // why this certificate superseded the previous one
+}
+
+// canonicalCertificate is the signed representation of a certificate. Only
+// the issued content is covered: status changes such as revocation and the
+// verification URL do not alter it.
+type canonicalCertificate struct {
+	Version        string            `json:"v"`
 	ID             string            `json:"id"`
 	Email          string            `json:"email"`
 	Name           string            `json:"name"`
 	Course         string            `json:"course"`
-	CompletionDate time.Time         `json:"completion_date"`
+	CompletionDate string            `json:"completion_date"`
 	TemplateID     string            `json:"template_id"`
-	CreatedAt      time.Time         `json:"created_at"`
-	Data           map[string]string `json:"data,omitempty"`
+	CreatedAt      string            `json:"created_at"`
+	Data           map[string]string `json:"data"`
 }
 
-// NewCertificate creates a new certificate with a unique UUID
+// NewCertificate creates a new certificate with a unique UUID in the
+// default organization
 func NewCertificate(email, name, course, templateID string, completionDate time.Time, additionalData map[string]string) *Certificate {
 	cert := &Certificate{
 		ID:             uuid.New().String(),
+		OrganizationID: DefaultOrganizationID,
 		Email:          email,
 		Name:           name,
 		Course:         course,
@@ -29,6 +85,7 @@ func NewCertificate(email, name, course, templateID string, completionDate time.
 		TemplateID:     templateID,
 		CreatedAt:      time.Now(),
 		Data:           make(map[string]string),
+		Status:         StatusActive,
 	}
 
 	// Add additional data if provided
@@ -41,6 +98,44 @@ func NewCertificate(email, name, course, templateID string, completionDate time.
 	return cert
 }
 
+// IsValid reports whether the certificate is still active. Certificates
+// stored before statuses existed have an empty status and count as active.
+func (c *Certificate) IsValid() bool {
+	return c.Status == "" || c.Status == StatusActive
+}
+
+// IsRevoked reports whether the certificate has been revoked
+func (c *Certificate) IsRevoked() bool {
+	return c.Status == StatusRevoked
+}
+
+// IsSuperseded reports whether a corrected certificate replaced this one
+func (c *Certificate) IsSuperseded() bool {
+	return c.Status == StatusSuperseded
+}
+
+// CanonicalBytes returns the deterministic encoding of the certificate that
+// is signed at issuance. Map keys are sorted by encoding/json, so the same
+// certificate always produces the same bytes.
+func (c *Certificate) CanonicalBytes() ([]byte, error) {
+	data := c.Data
+	if data == nil {
+		data = map[string]string{}
+	}
+
+	return json.Marshal(canonicalCertificate{
+		Version:        "vibe-certificados/v1",
+		ID:             c.ID,
+		Email:          c.Email,
+		Name:           c.Name,
+		Course:         c.Course,
+		CompletionDate: c.CompletionDate.Format("2006-01-02"),
+		TemplateID:     c.TemplateID,
+		CreatedAt:      c.CreatedAt.UTC().Format(time.RFC3339Nano),
+		Data:           data,
+	})
+}
+
 // GetAllData returns all certificate data including standard fields
 func (c *Certificate) GetAllData() map[string]interface{} {
 	data := make(map[string]interface{})
@@ -50,6 +145,14 @@ func (c *Certificate) GetAllData() map[string]interface{} {
 	data["Course"] = c.Course
 	data["CompletionDate"] = c.CompletionDate.Format("02/01/2006")
 	data["CreatedAt"] = c.CreatedAt.Format("02/01/2006 15:04:05")
+	data["Status"] = c.Status
+	data["Revoked"] = c.IsRevoked()
+	data["RevocationReason"] = c.RevocationReason
+	if c.RevokedAt != nil {
+		data["RevokedAt"] = c.RevokedAt.Format("02/01/2006 15:04:05")
+	}
+	data["Signature"] = c.Signature
+	data["VerificationURL"] = c.VerificationURL
 
 	// Add custom data
 	for k, v := range c.Data {
@@ -57,4 +160,4 @@ func (c *Certificate) GetAllData() map[string]interface{} {
 	}
 
 	return data
-}
\ No newline at end of file
+}
@@ -0,0 +1,50 @@
+package models
+
+import "time"
+
+// Fields certificates can be sorted by
+const (
+	SortCreatedAt      = "created_at"
+	SortCompletionDate = "completion_date"
+	SortName           = "name"
+	SortCourse         = "course"
+)
+
+// CertificateSortFields lists the fields certificates can be sorted by
+var CertificateSortFields = []string{SortCreatedAt, SortCompletionDate, SortName, SortCourse}
+
+// CertificateQuery selects a page of the certificates of an organization.
+// Empty fields match every certificate; time ranges include their start
+// and exclude their end.
+type CertificateQuery struct {
+	Course         string
+	TemplateID     string
+	Name           string // case-insensitive substring
+	Status         string
+	CompletedFrom  time.Time
+	CompletedUntil time.Time
+	CreatedFrom    time.Time
+	CreatedUntil   time.Time
+
+	Sort       string // one of CertificateSortFields, ties broken by ID
+	Descending bool
+	Limit      int
+	Cursor     string // NextCursor of the previous page
+}
+
+// CertificatePage is a page of certificates. NextCursor is empty on the
+// last page.
+type CertificatePage struct {
+	Certificates []*Certificate `json:"certificates"`
+	NextCursor   string         `json:"next_cursor,omitempty"`
+}
+
+// IsValidCertificateSort reports whether certificates can be sorted by field
+func IsValidCertificateSort(field string) bool {
+	for _, f := range CertificateSortFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// Policies for certificate requests matching a certificate already issued,
+// see CertificateRequest.OnDuplicate
+const (
+	DuplicateAllow          = "allow"           // issue another certificate
+	DuplicateSkip           = "skip"            // issue nothing
+	DuplicateReturnExisting = "return_existing" // issue nothing and return the existing certificate
+	DuplicateFail           = "fail"            // fail the request
+)
+
+// DuplicatePolicies lists the valid values of CertificateRequest.OnDuplicate
+var DuplicatePolicies = []string{DuplicateAllow, DuplicateSkip, DuplicateReturnExisting, DuplicateFail}
+
+// IdempotencyKey records the certificate issued for a request sent with an
+// Idempotency-Key header, so that retries return it instead of issuing
+// another one
+type IdempotencyKey struct {
+	OrganizationID string    `json:"organization_id"`
+	Key            string    `json:"key"`
+	RequestHash    string    `json:"request_hash"` // SHA-256 of the request, to reject a key reused for another request
+	CertificateID  string    `json:"certificate_id"`
+	CreatedAt      time.Time `json:"created_at"`
+}
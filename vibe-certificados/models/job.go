@@ -0,0 +1,64 @@
+package models
+
+import (
+	"sort"
+	"time"
+)
+
+// Batch job status values
+const (
+	JobQueued      = "queued"
+	JobRunning     = "running"
+	JobCompleted   = "completed"
+	JobCancelled   = "cancelled"
+	JobInterrupted = "interrupted" // the service stopped while the job was running
+)
+
+// BatchJob tracks the asynchronous issuance of a batch of certificates
+type BatchJob struct {
+	ID             string     `json:"id"`
+	OrganizationID string     `json:"organization_id"`
+	SubmittedBy    Actor      `json:"submitted_by"`
+	Status         string     `json:"status"`
+	Total          int        `json:"total"`
+	Processed      int        `json:"processed"`
+	Succeeded      int        `json:"succeeded"`
+	Skipped        int        `json:"skipped"` // rows matching a certificate already issued, see BatchCertificateResponse
+	Failed         int        `json:"failed"`
+	Errors         []RowError `json:"errors"`
+	CreatedIDs     []string   `json:"created_ids"`
+	ExistingIDs    []string   `json:"existing_ids,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	StartedAt      *time.Time `json:"started_at,omitempty"`
+	FinishedAt     *time.Time `json:"finished_at,omitempty"`
+}
+
+// RowError describes why a row of a batch could not be issued
+type RowError struct {
+	Row    int          `json:"row"`
+	Error  string       `json:"error"`
+	Fields []FieldError `json:"fields,omitempty"` // set when template fields are invalid
+}
+
+// IsFinished reports whether the job will not make further progress
+func (j *BatchJob) IsFinished() bool {
+	return j.Status == JobCompleted || j.Status == JobCancelled || j.Status == JobInterrupted
+}
+
+// Clone returns a deep copy of the job, safe to hand out while workers
+// keep updating the original
+func (j *BatchJob) Clone() *BatchJob {
+	clone := *j
+	clone.Errors = append([]RowError{}, j.Errors...)
+	clone.CreatedIDs = append([]string{}, j.CreatedIDs...)
+	clone.ExistingIDs = append([]string(nil), j.ExistingIDs...)
+	return &clone
+}
+
+// SortErrors orders the row errors by row number, since rows are processed
+// concurrently and fail in no particular order
+func (j *BatchJob) SortErrors() {
+	sort.Slice(j.Errors, func(a, b int) bool {
+		return j.Errors[a].Row < j.Errors[b].Row
+	})
+}
@@ -0,0 +1,96 @@
+package models
+
+import "time"
+
+// DefaultOrganizationID is the organization served by the unprefixed API
+// and the owner of the data stored before organizations existed
+const DefaultOrganizationID = "default"
+
+// Organization is a tenant of the service. Its templates, certificates and
+// batch jobs are invisible to other organizations, and template IDs only
+// need to be unique within it.
+type Organization struct {
+	ID        string    `json:"id"` // lowercase slug used in /api/orgs/{id}
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CreateOrganizationRequest represents a request to create an organization
+type CreateOrganizationRequest struct {
+	ID   string `json:"id" binding:"required"`
+	Name string `json:"name" binding:"required"`
+}
+
+// API key roles
+const (
+	RoleAdmin         = "admin"          // everything, including API keys
+	RoleIssuer        = "issuer"         // issues, revokes and sends certificates
+	RoleTemplateAdmin = "template-admin" // creates and changes templates and their assets
+	RoleReadOnly      = "read-only"      // reads templates, certificates and jobs
+)
+
+// Roles lists every API key role
+var Roles = []string{RoleAdmin, RoleIssuer, RoleTemplateAdmin, RoleReadOnly}
+
+// IsValidRole reports whether role is an API key role
+func IsValidRole(role string) bool {
+	for _, r := range Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// APIKey identifies the organization of a request and what the request
+// may do there. Only the SHA-256 hash of the key is stored; the key itself
+// is shown once, when created.
+type APIKey struct {
+	ID             string     `json:"id"`
+	OrganizationID string     `json:"organization_id"`
+	Name           string     `json:"name"`
+	Role           string     `json:"role"`
+	Prefix         string     `json:"prefix"` // first characters of the key, to tell keys apart
+	Hash           string     `json:"-"`
+	CreatedAt      time.Time  `json:"created_at"`
+	RevokedAt      *time.Time `json:"revoked_at,omitempty"`
+}
+
+// IsRevoked reports whether the key can no longer be used
+func (k *APIKey) IsRevoked() bool {
+	return k.RevokedAt != nil
+}
+
+// Allows reports whether the key has one of roles. Admin keys are allowed
+// everything.
+func (k *APIKey) Allows(roles ...string) bool {
+	if k.Role == RoleAdmin {
+		return true
+	}
+	for _, role := range roles {
+		if k.Role == role {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateAPIKeyRequest represents a request to create an API key
+type CreateAPIKeyRequest struct {
+	Name string `json:"name" binding:"required"`
+	Role string `json:"role" binding:"required"`
+}
+
+// CreatedAPIKey is a newly created API key with its plaintext, which is
+// not shown again
+type CreatedAPIKey struct {
+	*APIKey
+	Key string `json:"key"`
+}
+
+// CreatedOrganization is the response to an organization creation, with
+// the plaintext of its first API key, an admin key
+type CreatedOrganization struct {
+	*Organization
+	APIKey string `json:"api_key"`
+}
@@ -0,0 +1,56 @@
+package models
+
+// PDFLayout describes how a template is drawn on a PDF page. Coordinates
+// and sizes are in millimetres from the top left corner of the page.
+type PDFLayout struct {
+	Orientation     string         `json:"orientation,omitempty"` // "L" (landscape, default) or "P"
+	PageSize        string         `json:"page_size,omitempty"`   // "A4" (default), "A3", "A5", "Letter" or "Legal"
+	BackgroundColor string         `json:"background_color,omitempty"`
+	BackgroundImage string         `json:"background_image,omitempty"` // data URI of a PNG or JPEG image
+	BackgroundAsset string         `json:"background_asset,omitempty"` // name of an uploaded template asset
+	Border          *PDFBorder     `json:"border,omitempty"`
+	Fonts           []string       `json:"fonts,omitempty"` // fallback chain tried after each block font
+	Blocks          []PDFTextBlock `json:"blocks"`
+	Images          []PDFImage     `json:"images,omitempty"`  // drawn before the text blocks
+	QRCode          *PDFBox        `json:"qr_code,omitempty"` // defaults to the bottom right corner
+}
+
+// PDFBorder is a rectangle drawn around the page
+type PDFBorder struct {
+	Width  float64 `json:"width"`            // line width
+	Color  string  `json:"color,omitempty"`  // hex color, e.g. "#764ba2"
+	Margin float64 `json:"margin,omitempty"` // distance from the page edge
+}
+
+// PDFTextBlock is a positioned piece of text. Text is a Go template
+// expression evaluated with the certificate data, e.g. "{{.Name}}".
+type PDFTextBlock struct {
+	Text      string  `json:"text"`
+	X         float64 `json:"x,omitempty"`     // ignored when Width is 0
+	Y         float64 `json:"y"`               // top of the block
+	Width     float64 `json:"width,omitempty"` // 0 spans the page between the margins
+	Height    float64 `json:"height,omitempty"`
+	Font      string  `json:"font,omitempty"`  // core font ("Arial" default, "Times", "Courier") or TrueType family
+	Style     string  `json:"style,omitempty"` // "", "B", "I" or "BI"
+	Size      float64 `json:"size,omitempty"`
+	Color     string  `json:"color,omitempty"`
+	Align     string  `json:"align,omitempty"` // "L", "C" (default) or "R"
+	Multiline bool    `json:"multiline,omitempty"`
+}
+
+// PDFImage places an uploaded template asset on the page. When only one of
+// Width and Height is set the other keeps the image proportions.
+type PDFImage struct {
+	Asset  string  `json:"asset"`
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width,omitempty"`
+	Height float64 `json:"height,omitempty"`
+}
+
+// PDFBox is a square area on the page
+type PDFBox struct {
+	X    float64 `json:"x"`
+	Y    float64 `json:"y"`
+	Size float64 `json:"size"`
+}
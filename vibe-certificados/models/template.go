@@ -1,22 +1,46 @@
 package models
 
+import "time"
+
 // Template represents a certificate template
 type Template struct {
-	ID           string          `json:"id"`
-	Name         string          `json:"name"`
-	HTMLTemplate string          `json:"html_template"`
-	Fields       []TemplateField `json:"fields"`
-	CreatedAt    string          `json:"created_at"`
-	UpdatedAt    string          `json:"updated_at"`
+	ID             string          `json:"id"` // unique within the organization
+	OrganizationID string          `json:"organization_id"`
+	Name           string          `json:"name"`
+	HTMLTemplate   string          `json:"html_template"`
+	Fields         []TemplateField `json:"fields"`
+	PDFLayout      *PDFLayout      `json:"pdf_layout,omitempty"`
+	Email          *EmailTemplate  `json:"email,omitempty"`
+	Locale         string          `json:"locale,omitempty"` // default language of certificates, e.g. "en"
+	Version        int             `json:"version"`          // active version; every update creates a new one
+	CreatedAt      string          `json:"created_at"`
+	UpdatedAt      string          `json:"updated_at"`
 }
 
 // TemplateField represents a field definition in a template
 type TemplateField struct {
 	Name        string      `json:"name"`
-	Type        string      `json:"type"`
+	Type        string      `json:"type"` // string, date, number, email, enum or url
 	Required    bool        `json:"required"`
 	Default     interface{} `json:"default,omitempty"`
 	Description string      `json:"description,omitempty"`
+	Options     []string    `json:"options,omitempty"` // allowed values of enum fields
+}
+
+// Template field types
+const (
+	FieldString = "string"
+	FieldDate   = "date"
+	FieldNumber = "number"
+	FieldEmail  = "email"
+	FieldEnum   = "enum"
+	FieldURL    = "url"
+)
+
+// FieldError describes why a value does not match a template field
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
 }
 
 // CertificateRequest represents a request to generate a certificate
@@ -27,13 +51,141 @@ type CertificateRequest struct {
 	CompletionDate string            `json:"completion_date" binding:"required"`
 	TemplateID     string            `json:"template_id"`
 	Data           map[string]string `json:"data,omitempty"`
+	SendEmail      bool              `json:"send_email,omitempty"`
+	Locale         string            `json:"locale,omitempty"`
+	OnDuplicate    string            `json:"on_duplicate,omitempty"` // one of DuplicatePolicies, allow when empty
+}
+
+// EmailTemplate is the message sent with a certificate. Subject and Body
+// are Go templates evaluated with the certificate data, like the HTML template.
+type EmailTemplate struct {
+	Subject string `json:"subject"`
+	Body    string `json:"body"` // plain text
+}
+
+// PreviewTemplateRequest asks for a rendering of a template with sample
+// data. Template is only used by the unsaved-template preview.
+type PreviewTemplateRequest struct {
+	Template *Template         `json:"template,omitempty"`
+	Format   string            `json:"format,omitempty"` // "html" (default) or "pdf"
+	Data     map[string]string `json:"data,omitempty"`   // may also set name, course, email and completion_date
+	Locale   string            `json:"locale,omitempty"`
+}
+
+// RollbackTemplateRequest selects the template version to make active again
+type RollbackTemplateRequest struct {
+	Version int `json:"version" binding:"required"`
+}
+
+// TemplateDiff lists the changes between two versions of a template
+type TemplateDiff struct {
+	ID      string           `json:"id"`
+	From    int              `json:"from"`
+	To      int              `json:"to"`
+	Changes []TemplateChange `json:"changes"`
+}
+
+// TemplateChange is a line diff of one part of a template (name,
+// html_template, fields, pdf_layout or email). Lines start with "+ ", "- "
+// or "  ".
+type TemplateChange struct {
+	Field string   `json:"field"`
+	Diff  []string `json:"diff"`
+}
+
+// RevokeCertificateRequest represents a request to revoke a certificate
+type RevokeCertificateRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+// CorrectCertificateRequest changes the name, course or data of an issued
+// certificate. Omitted fields keep their value and a null data value
+// removes the key.
+type CorrectCertificateRequest struct {
+	Name      *string            `json:"name,omitempty"`
+	Course    *string            `json:"course,omitempty"`
+	Data      map[string]*string `json:"data,omitempty"`
+	Reason    string             `json:"reason,omitempty"`
+	SendEmail bool               `json:"send_email,omitempty"` // emails the corrected certificate
+}
+
+// CertificateHistory is the chain of corrections a certificate belongs to,
+// oldest first; the last certificate is the current one
+type CertificateHistory struct {
+	CurrentID    string         `json:"current_id"`
+	Certificates []*Certificate `json:"certificates"`
+}
+
+// Verification results
+const (
+	VerificationValid      = "valid"
+	VerificationInvalid    = "invalid"
+	VerificationRevoked    = "revoked"
+	VerificationSuperseded = "superseded"
+)
+
+// VerifyCertificateRequest represents a certificate and signature submitted for verification
+type VerifyCertificateRequest struct {
+	Certificate Certificate `json:"certificate" binding:"required"`
+	Signature   string      `json:"signature"`
+}
+
+// VerificationResult reports whether a certificate is genuine and still valid
+type VerificationResult struct {
+	ID               string       `json:"id"`
+	Result           string       `json:"result"`
+	Message          string       `json:"message"`
+	Status           string       `json:"status,omitempty"`
+	RevocationReason string       `json:"revocation_reason,omitempty"`
+	RevokedAt        *time.Time   `json:"revoked_at,omitempty"`
+	SupersededBy     string       `json:"superseded_by,omitempty"`
+	Certificate      *Certificate `json:"certificate,omitempty"`
 }
 
 // BatchCertificateRequest represents the response for batch creation
 type BatchCertificateResponse struct {
-	Total      int      `json:"total"`
-	Success    int      `json:"success"`
-	Failed     int      `json:"failed"`
-	Errors     []string `json:"errors,omitempty"`
-	CreatedIDs []string `json:"created_ids"`
-}
\ No newline at end of file
+	Total   int `json:"total"`
+	Success int `json:"success"`
+	// Skipped counts the rows matching a certificate already issued whose
+	// policy is skip or return_existing; ExistingIDs lists the certificates
+	// of the return_existing ones
+	Skipped     int      `json:"skipped"`
+	Failed      int      `json:"failed"`
+	Errors      []string `json:"errors,omitempty"`
+	CreatedIDs  []string `json:"created_ids"`
+	ExistingIDs []string `json:"existing_ids,omitempty"`
+}
+
+// BatchValidationReport is the result of a dry run of a batch: which rows
+// would be issued, which would be skipped as duplicates and why the others
+// would fail
+type BatchValidationReport struct {
+	Total   int              `json:"total"`
+	Valid   int              `json:"valid"`
+	Skipped int              `json:"skipped"`
+	Failed  int              `json:"failed"`
+	Rows    []BatchRowResult `json:"rows"`
+}
+
+// BatchRowResult is the outcome of validating a row of a batch. Request is
+// what could be read of the row. Skipped rows are valid but match a
+// certificate already issued, or an earlier row, and would not be issued.
+type BatchRowResult struct {
+	Row        int                 `json:"row"`
+	Valid      bool                `json:"valid"`
+	Skipped    bool                `json:"skipped,omitempty"`
+	ExistingID string              `json:"existing_id,omitempty"` // certificate a return_existing row would return
+	Error      string              `json:"error,omitempty"`
+	Fields     []FieldError        `json:"fields,omitempty"` // set when template fields are invalid
+	Request    *CertificateRequest `json:"request,omitempty"`
+}
+
+// ExportCertificatesRequest selects the certificates bundled in a ZIP
+// export. IDs, JobID and Email may be combined; duplicates are exported once.
+type ExportCertificatesRequest struct {
+	IDs             []string `json:"ids,omitempty"`
+	JobID           string   `json:"job_id,omitempty"`
+	Email           string   `json:"email,omitempty"`
+	IncludeHTML     bool     `json:"include_html,omitempty"`
+	FilenamePattern string   `json:"filename_pattern,omitempty"` // e.g. "{{.Name}} - {{.Course}}.pdf"
+}
@@ -0,0 +1,200 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"vibe-certificados/models"
+	"vibe-certificados/storage"
+
+	"github.com/google/uuid"
+)
+
+// Errors returned when an API key cannot be created, used or revoked
+var (
+	ErrInvalidRole       = errors.New("role must be one of " + strings.Join(models.Roles, ", "))
+	ErrAPIKeyNameMissing = errors.New("API key name is required")
+	ErrAPIKeyRevoked     = errors.New("API key has been revoked")
+	ErrLastAdminKey      = errors.New("the last admin key of an organization cannot be revoked")
+)
+
+// apiKeyPrefix starts every API key, so leaked keys are easy to recognise
+const apiKeyPrefix = "vc_"
+
+// CreateAPIKey creates a key of an organization. The plaintext of the key
+// is only returned here.
+func (orgs *OrganizationService) CreateAPIKey(orgID string, req *models.CreateAPIKeyRequest) (*models.CreatedAPIKey, error) {
+	if !models.IsValidRole(req.Role) {
+		return nil, ErrInvalidRole
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, ErrAPIKeyNameMissing
+	}
+	return orgs.createAPIKey(orgID, name, req.Role)
+}
+
+// GetAPIKeys lists the keys of an organization, including revoked ones
+func (orgs *OrganizationService) GetAPIKeys(orgID string) ([]*models.APIKey, error) {
+	return orgs.storage.GetAPIKeys(orgID)
+}
+
+// RevokeAPIKey revokes a key of an organization. The key is kept, so it
+// still shows up in the list, but requests using it are refused.
+func (orgs *OrganizationService) RevokeAPIKey(orgID, id string) (*models.APIKey, error) {
+	orgs.mutex.Lock()
+	defer orgs.mutex.Unlock()
+
+	keys, err := orgs.storage.GetAPIKeys(orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	var key *models.APIKey
+	activeAdmins := 0
+	for _, k := range keys {
+		if k.ID == id {
+			key = k
+		}
+		if k.Role == models.RoleAdmin && !k.IsRevoked() {
+			activeAdmins++
+		}
+	}
+	switch {
+	case key == nil:
+		return nil, storage.ErrAPIKeyNotFound
+	case key.IsRevoked():
+		return nil, ErrAPIKeyRevoked
+	case key.Role == models.RoleAdmin && activeAdmins == 1:
+		return nil, ErrLastAdminKey
+	}
+
+	// Work on a copy so readers never observe a half-updated key
+	revoked := *key
+	now := time.Now()
+	revoked.RevokedAt = &now
+	if err := orgs.storage.SaveAPIKey(&revoked); err != nil {
+		return nil, err
+	}
+	return &revoked, nil
+}
+
+// ResolveAPIKey returns the stored API key matching a plaintext key.
+// Unknown keys return storage.ErrAPIKeyNotFound and revoked keys
+// ErrAPIKeyRevoked.
+func (orgs *OrganizationService) ResolveAPIKey(key string) (*models.APIKey, error) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return nil, storage.ErrAPIKeyNotFound
+	}
+	stored, err := orgs.storage.GetAPIKeyByHash(hashAPIKey(key))
+	if err != nil {
+		return nil, err
+	}
+	if stored.IsRevoked() {
+		return nil, ErrAPIKeyRevoked
+	}
+	return stored, nil
+}
+
+// LoadOrCreateAdminKey makes sure the default organization, which also
+// manages the other organizations, can be administered. The key in the file
+// at path is registered as an admin key when it is not stored yet. When the
+// file does not exist and the default organization has no active admin key,
+// a new key is generated and written there, so a fresh installation can be
+// set up without other steps.
+func (orgs *OrganizationService) LoadOrCreateAdminKey(path string) error {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		return orgs.registerAdminKey(strings.TrimSpace(string(data)))
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read admin key: %v", err)
+	}
+
+	keys, err := orgs.storage.GetAPIKeys(models.DefaultOrganizationID)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if key.Role == models.RoleAdmin && !key.IsRevoked() {
+			return nil
+		}
+	}
+
+	created, err := orgs.createAPIKey(models.DefaultOrganizationID, "admin", models.RoleAdmin)
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return fmt.Errorf("failed to create admin key directory: %v", err)
+		}
+	}
+	if err := os.WriteFile(path, []byte(created.Key+"\n"), 0o600); err != nil {
+		return fmt.Errorf("failed to write admin key: %v", err)
+	}
+	log.Printf("Created admin API key for organization %s in %s", models.DefaultOrganizationID, path)
+	return nil
+}
+
+// registerAdminKey stores a plaintext key read from the admin key file
+func (orgs *OrganizationService) registerAdminKey(key string) error {
+	if !strings.HasPrefix(key, apiKeyPrefix) || len(key) < len(apiKeyPrefix)+16 {
+		return fmt.Errorf("admin key must start with %s and have at least 16 more characters", apiKeyPrefix)
+	}
+
+	stored, err := orgs.storage.GetAPIKeyByHash(hashAPIKey(key))
+	if err == nil {
+		if stored.IsRevoked() {
+			log.Printf("The admin key file holds a revoked key")
+		}
+		return nil
+	}
+	if !errors.Is(err, storage.ErrAPIKeyNotFound) {
+		return err
+	}
+	return orgs.storage.SaveAPIKey(newAPIKey(models.DefaultOrganizationID, "admin", models.RoleAdmin, key))
+}
+
+// createAPIKey generates and stores a key of an organization
+func (orgs *OrganizationService) createAPIKey(orgID, name, role string) (*models.CreatedAPIKey, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	key := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+
+	record := newAPIKey(orgID, name, role, key)
+	if err := orgs.storage.SaveAPIKey(record); err != nil {
+		return nil, err
+	}
+	return &models.CreatedAPIKey{APIKey: record, Key: key}, nil
+}
+
+// newAPIKey builds the stored record of a plaintext key
+func newAPIKey(orgID, name, role, key string) *models.APIKey {
+	return &models.APIKey{
+		ID:             uuid.New().String(),
+		OrganizationID: orgID,
+		Name:           name,
+		Role:           role,
+		Prefix:         key[:len(apiKeyPrefix)+6],
+		Hash:           hashAPIKey(key),
+		CreatedAt:      time.Now(),
+	}
+}
+
+// hashAPIKey returns the hex SHA-256 hash under which a key is stored. Keys
+// are random, so a plain hash is enough to make a leaked database useless.
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,78 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"time"
+	"vibe-certificados/models"
+	"vibe-certificados/storage"
+
+	"github.com/google/uuid"
+)
+
+// AuditService reads the audit log written by the certificate and template
+// services
+type AuditService struct {
+	storage storage.Storage
+}
+
+// NewAuditService creates a new audit service
+func NewAuditService(storage storage.Storage) *AuditService {
+	return &AuditService{storage: storage}
+}
+
+// GetEntries retrieves the audit entries of an organization selected by
+// filter, newest first
+func (au *AuditService) GetEntries(orgID string, filter *models.AuditFilter) ([]*models.AuditEntry, error) {
+	return au.storage.GetAuditEntries(orgID, filter)
+}
+
+// recordAudit stores an audit entry for a change that has already been
+// made, with before and after (nil when absent) as JSON snapshots. Errors
+// are logged rather than returned, since the change itself succeeded.
+func recordAudit(store storage.Storage, orgID string, actor models.Actor, action, targetType, targetID string, before, after interface{}) {
+	entry := &models.AuditEntry{
+		ID:             uuid.New().String(),
+		OrganizationID: orgID,
+		Actor:          actor,
+		Action:         action,
+		TargetType:     targetType,
+		TargetID:       targetID,
+		Before:         auditSnapshot(before),
+		After:          auditSnapshot(after),
+		Timestamp:      time.Now(),
+	}
+	if err := store.SaveAuditEntry(entry); err != nil {
+		log.Printf("failed to record %s of %s %s in the audit log: %v", action, targetType, targetID, err)
+	}
+}
+
+// auditSnapshot encodes a record for the audit log. HTML is left
+// unescaped, so template snapshots stay readable.
+func auditSnapshot(record interface{}) json.RawMessage {
+	if record == nil {
+		return nil
+	}
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(record); err != nil {
+		log.Printf("failed to encode audit snapshot: %v", err)
+		return nil
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n")
+}
+
+// assetAuditTarget identifies an asset in the audit log
+func assetAuditTarget(asset *models.TemplateAsset) string {
+	return asset.TemplateID + "/" + asset.Name
+}
+
+// assetAuditSnapshot returns the metadata of an asset, leaving out the
+// image itself
+func assetAuditSnapshot(asset *models.TemplateAsset) *models.TemplateAsset {
+	snapshot := *asset
+	snapshot.Data = nil
+	return &snapshot
+}
@@ -0,0 +1,286 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"path/filepath"
+	"strings"
+	"vibe-certificados/models"
+)
+
+// Formats of batch files
+const (
+	FormatCSV   = "csv"
+	FormatXLSX  = "xlsx"
+	FormatJSONL = "jsonl"
+)
+
+// Request fields a column of a batch file can hold
+const (
+	fieldEmail          = "email"
+	fieldName           = "name"
+	fieldCourse         = "course"
+	fieldCompletionDate = "completion_date"
+	fieldTemplateID     = "template_id"
+	fieldLocale         = "locale"
+)
+
+// ImportOptions describe how a batch file of certificate requests is read.
+// The zero value reads comma separated UTF-8 CSV files.
+type ImportOptions struct {
+	Format    string // csv (default), xlsx or jsonl
+	Delimiter rune   // CSV only, defaults to ','
+	Encoding  string // CSV only: utf-8 (default), latin1 or windows-1252
+	Sheet     string // XLSX only, defaults to the first sheet
+
+	// Mapping renames the columns of the file, or the keys of JSON Lines
+	// objects: keys are names used in the file and values the request
+	// field they hold (email, name, course, completion_date, template_id
+	// or locale) or else the Data key. An empty value skips the column.
+	Mapping map[string]string
+
+	SendEmail   bool   // sets SendEmail on every request
+	OnDuplicate string // sets OnDuplicate on every request
+}
+
+// BatchReader reads the rows of a batch file one at a time. Next returns
+// io.EOF after the last row; rows that cannot be issued are returned with
+// Err set, and the error is only set when the file cannot be read any
+// further.
+type BatchReader interface {
+	Next() (BatchRow, error)
+}
+
+// NewBatchReader reads a batch file in the format of opts
+func NewBatchReader(data io.Reader, opts ImportOptions) (BatchReader, error) {
+	switch opts.Format {
+	case "", FormatCSV:
+		return NewCSVReader(data, opts)
+	case FormatXLSX:
+		return NewXLSXReader(data, opts)
+	case FormatJSONL:
+		return NewJSONLReader(data, opts)
+	default:
+		return nil, errors.New("unsupported batch format: " + opts.Format)
+	}
+}
+
+// ReadBatch reads the remaining rows of a batch file
+func ReadBatch(reader BatchReader) ([]BatchRow, error) {
+	var rows []BatchRow
+	for {
+		row, err := reader.Next()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
+}
+
+// DetectBatchFormat returns the format of an uploaded file from its
+// extension or, failing that, its content type. Files of unknown type are
+// read as CSV.
+func DetectBatchFormat(filename, contentType string) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv", ".tsv", ".txt":
+		return FormatCSV
+	case ".xlsx":
+		return FormatXLSX
+	case ".jsonl", ".ndjson":
+		return FormatJSONL
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":
+		return FormatXLSX
+	case "application/x-ndjson", "application/jsonl", "application/x-jsonlines":
+		return FormatJSONL
+	}
+	return FormatCSV
+}
+
+// batchColumn is what a column of a file holds: a request field or, when
+// field is empty, the Data key
+type batchColumn struct {
+	field string
+	key   string
+}
+
+// columnTargets normalizes the keys of a column mapping
+func columnTargets(mapping map[string]string) map[string]string {
+	targets := make(map[string]string, len(mapping))
+	for name, target := range mapping {
+		targets[strings.ToLower(strings.TrimSpace(name))] = strings.TrimSpace(target)
+	}
+	return targets
+}
+
+// resolveColumn returns what the column named name holds and whether it
+// is kept at all
+func resolveColumn(name string, targets map[string]string) (batchColumn, bool) {
+	name = strings.TrimSpace(name)
+	target, mapped := targets[strings.ToLower(name)]
+	if !mapped {
+		if isReportColumn(name) {
+			return batchColumn{}, false
+		}
+		target = name
+	}
+	if target == "" {
+		return batchColumn{}, false
+	}
+
+	column := batchColumn{field: requestField(target)}
+	if column.field == "" {
+		column.key = target
+	}
+	return column, true
+}
+
+// requestField returns the request field named by a column, or "" for
+// data columns
+func requestField(name string) string {
+	switch strings.ToLower(name) {
+	case "email":
+		return fieldEmail
+	case "name":
+		return fieldName
+	case "course":
+		return fieldCourse
+	case "completion_date", "date":
+		return fieldCompletionDate
+	case "template_id", "template":
+		return fieldTemplateID
+	case "locale", "language":
+		return fieldLocale
+	}
+	return ""
+}
+
+// newBatchRequest returns an empty request of a batch file
+func newBatchRequest(opts ImportOptions) *models.CertificateRequest {
+	return &models.CertificateRequest{TemplateID: "default", SendEmail: opts.SendEmail, OnDuplicate: opts.OnDuplicate}
+}
+
+// setColumn stores the value of a column in a request. Empty values are
+// left out of Data so template field defaults apply.
+func setColumn(req *models.CertificateRequest, column batchColumn, value string) {
+	value = strings.TrimSpace(value)
+	switch column.field {
+	case fieldEmail:
+		req.Email = value
+	case fieldName:
+		req.Name = value
+	case fieldCourse:
+		req.Course = value
+	case fieldCompletionDate:
+		req.CompletionDate = value
+	case fieldTemplateID:
+		if value != "" {
+			req.TemplateID = value
+		}
+	case fieldLocale:
+		req.Locale = value
+	default:
+		if value == "" {
+			return
+		}
+		if req.Data == nil {
+			req.Data = make(map[string]string)
+		}
+		req.Data[column.key] = value
+	}
+}
+
+// checkRequired fails for requests missing a required field
+func checkRequired(req *models.CertificateRequest) error {
+	var missing []string
+	for _, field := range []struct{ name, value string }{
+		{fieldEmail, req.Email},
+		{fieldName, req.Name},
+		{fieldCourse, req.Course},
+		{fieldCompletionDate, req.CompletionDate},
+	} {
+		if field.value == "" {
+			missing = append(missing, field.name)
+		}
+	}
+	if len(missing) > 0 {
+		return errors.New("missing " + strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// tableReader turns the records of a tabular file (CSV or XLSX), whose
+// first record is the header, into rows
+type tableReader struct {
+	columns   []batchColumn
+	minFields int // fields a record needs to have every required column
+	opts      ImportOptions
+}
+
+// newTableReader resolves the columns of a header. It fails when the
+// header lacks the email, name, course or completion_date columns.
+func newTableReader(headers []string, opts ImportOptions, format string) (*tableReader, error) {
+	targets := columnTargets(opts.Mapping)
+	table := &tableReader{columns: make([]batchColumn, len(headers)), opts: opts}
+
+	seen := make(map[batchColumn]bool)
+	used := make(map[string]bool)
+	for i, header := range headers {
+		used[strings.ToLower(strings.TrimSpace(header))] = true
+		column, ok := resolveColumn(header, targets)
+		if !ok {
+			continue
+		}
+		if seen[column] {
+			return nil, fmt.Errorf("%s has more than one %s column", format, column.field+column.key)
+		}
+		seen[column] = true
+		table.columns[i] = column
+
+		switch column.field {
+		case fieldEmail, fieldName, fieldCourse, fieldCompletionDate:
+			table.minFields = max(table.minFields, i+1)
+		}
+	}
+
+	for name := range targets {
+		if used[name] {
+			continue
+		}
+		return nil, fmt.Errorf("column mapping refers to %q, which is not in the %s header", name, format)
+	}
+	if !seen[batchColumn{field: fieldEmail}] || !seen[batchColumn{field: fieldName}] ||
+		!seen[batchColumn{field: fieldCourse}] || !seen[batchColumn{field: fieldCompletionDate}] {
+		return nil, errors.New(format + " must contain email, name, course, and completion_date columns")
+	}
+	return table, nil
+}
+
+// row turns a record into the request of row number n
+func (t *tableReader) row(n int, record []string) BatchRow {
+	req := newBatchRequest(t.opts)
+	for i, value := range record {
+		if i >= len(t.columns) {
+			break
+		}
+		if column := t.columns[i]; column != (batchColumn{}) {
+			setColumn(req, column, value)
+		}
+	}
+
+	row := BatchRow{Row: n, Request: req}
+	if len(record) < t.minFields {
+		row.Err = errors.New("insufficient columns")
+	} else {
+		row.Err = checkRequired(req)
+	}
+	return row
+}
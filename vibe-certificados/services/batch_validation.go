@@ -0,0 +1,181 @@
+package services
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"vibe-certificados/models"
+)
+
+// Columns of the failed rows CSV besides the request fields. They are
+// skipped when the file is uploaded again, so it can be fixed and
+// resubmitted with the options of the original file.
+const (
+	reportRowColumn   = "import_row"
+	reportErrorColumn = "import_error"
+)
+
+// ValidateBatchFile runs the checks of CreateCertificatesFromFile on every
+// row of a batch file without issuing anything. Rows sharing the natural
+// key of an earlier valid row, or of a certificate already issued, follow
+// their duplicate policy as they would when the file is issued.
+func (cs *CertificateService) ValidateBatchFile(orgID string, data io.Reader, opts ImportOptions) (*models.BatchValidationReport, error) {
+	reader, err := NewBatchReader(data, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &models.BatchValidationReport{Rows: make([]models.BatchRowResult, 0)}
+	seen := make(map[string]int) // natural key -> row
+	for {
+		row, err := reader.Next()
+		if err == io.EOF {
+			return report, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		result := models.BatchRowResult{Row: row.Row, Request: row.Request}
+		var cert *models.Certificate
+		err = row.Err
+		if err == nil {
+			cert, err = cs.ValidateCertificate(orgID, row.Request)
+		}
+		if err == nil {
+			key := cs.naturalKey(cert)
+			first, inFile := seen[key]
+			var existing *models.Certificate
+			if !inFile {
+				if existing, err = cs.FindDuplicate(orgID, cert); err != nil {
+					return nil, err
+				}
+			}
+
+			policy := row.Request.OnDuplicate
+			switch {
+			case !inFile && existing == nil:
+				seen[key] = row.Row
+			case policy == "" || policy == models.DuplicateAllow:
+				if !inFile {
+					seen[key] = row.Row
+				}
+			case policy == models.DuplicateSkip || policy == models.DuplicateReturnExisting:
+				result.Skipped = true
+				if existing != nil && policy == models.DuplicateReturnExisting {
+					result.ExistingID = existing.ID
+				}
+			case inFile:
+				err = errors.New("duplicate of row " + strconv.Itoa(first) + " (same " + strings.Join(cs.duplicateKey, ", ") + ")")
+			case policy == models.DuplicateFail:
+				err = cs.duplicateError(existing)
+			}
+		}
+
+		report.Total++
+		if err != nil {
+			report.Failed++
+			result.Error = err.Error()
+			var validation *ValidationError
+			if errors.As(err, &validation) {
+				result.Fields = validation.Fields
+			}
+		} else if result.Skipped {
+			report.Skipped++
+			result.Valid = true
+		} else {
+			report.Valid++
+			result.Valid = true
+		}
+		report.Rows = append(report.Rows, result)
+	}
+}
+
+// WriteFailedRowsCSV writes the failed rows of a report as a CSV file that
+// can be fixed and uploaded again with the mapping and delimiter of the
+// original file, opts: the request fields and data of each row under the
+// column names of the file, preceded by its row number and error. The
+// report is always a UTF-8 CSV file, whatever the original format.
+func WriteFailedRowsCSV(w io.Writer, report *models.BatchValidationReport, opts ImportOptions) error {
+	dataKeys := make(map[string]bool)
+	for _, result := range report.Rows {
+		if !result.Valid && result.Request != nil {
+			for key := range result.Request.Data {
+				dataKeys[key] = true
+			}
+		}
+	}
+	keys := slices.Sorted(maps.Keys(dataKeys))
+
+	// Columns renamed by the mapping get their name in the file back, and
+	// the ones it skips are kept empty so the mapping still applies
+	names := make(map[batchColumn]string)
+	var skipped []string
+	for _, name := range slices.Sorted(maps.Keys(opts.Mapping)) {
+		target := strings.TrimSpace(opts.Mapping[name])
+		if target == "" {
+			skipped = append(skipped, name)
+			continue
+		}
+		column := batchColumn{field: requestField(target)}
+		if column.field == "" {
+			column.key = target
+		}
+		if _, ok := names[column]; !ok {
+			names[column] = name
+		}
+	}
+	columnName := func(column batchColumn) string {
+		if name, ok := names[column]; ok {
+			return name
+		}
+		return column.field + column.key
+	}
+
+	writer := csv.NewWriter(w)
+	if opts.Delimiter != 0 {
+		writer.Comma = opts.Delimiter
+	}
+	header := []string{reportRowColumn, reportErrorColumn}
+	for _, field := range []string{fieldEmail, fieldName, fieldCourse, fieldCompletionDate, fieldTemplateID, fieldLocale} {
+		header = append(header, columnName(batchColumn{field: field}))
+	}
+	for _, key := range keys {
+		header = append(header, columnName(batchColumn{key: key}))
+	}
+	if err := writer.Write(append(header, skipped...)); err != nil {
+		return err
+	}
+
+	for _, result := range report.Rows {
+		if result.Valid {
+			continue
+		}
+		record := []string{strconv.Itoa(result.Row), result.Error}
+		if req := result.Request; req != nil {
+			record = append(record, req.Email, req.Name, req.Course, req.CompletionDate, req.TemplateID, req.Locale)
+			for _, key := range keys {
+				record = append(record, req.Data[key])
+			}
+			for range skipped {
+				record = append(record, "")
+			}
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// isReportColumn reports whether a column was added by WriteFailedRowsCSV
+func isReportColumn(name string) bool {
+	name = strings.ToLower(name)
+	return name == reportRowColumn || name == reportErrorColumn
+}
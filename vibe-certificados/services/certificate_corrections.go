@@ -0,0 +1,132 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+	"vibe-certificados/models"
+)
+
+// ErrCertificateNotCorrectable is returned when correcting a certificate
+// that was revoked or already superseded
+var ErrCertificateNotCorrectable = errors.New("certificate cannot be corrected")
+
+// CorrectCertificate reissues a certificate with its name, course or data
+// corrected. The new certificate supersedes the old one, which remains
+// retrievable with status superseded and a link to its replacement. The
+// recipient, completion date, template and locale are kept; the data is
+// validated against the current version of the template.
+func (cs *CertificateService) CorrectCertificate(orgID string, actor models.Actor, id string, correction *models.CorrectCertificateRequest) (*models.Certificate, error) {
+	// Two corrections, or a correction and a revocation, of the same
+	// certificate must not both succeed
+	cs.issueMutex.Lock()
+	defer cs.issueMutex.Unlock()
+
+	old, err := cs.GetCertificate(orgID, id)
+	switch {
+	case err != nil:
+		return nil, err
+	case old.IsRevoked():
+		return nil, fmt.Errorf("%w: it was revoked", ErrCertificateNotCorrectable)
+	case old.SupersededBy != "":
+		return nil, fmt.Errorf("%w: it was superseded by %s", ErrCertificateNotCorrectable, old.SupersededBy)
+	}
+
+	req := &models.CertificateRequest{
+		Email:          old.Email,
+		Name:           old.Name,
+		Course:         old.Course,
+		CompletionDate: old.CompletionDate.Format("2006-01-02"),
+		TemplateID:     old.TemplateID,
+		Data:           maps.Clone(old.Data),
+		Locale:         old.Locale,
+		SendEmail:      correction.SendEmail,
+	}
+	if correction.Name != nil {
+		req.Name = strings.TrimSpace(*correction.Name)
+	}
+	if correction.Course != nil {
+		req.Course = strings.TrimSpace(*correction.Course)
+	}
+	if req.Data == nil {
+		req.Data = make(map[string]string)
+	}
+	for key, value := range correction.Data {
+		if value == nil {
+			delete(req.Data, key)
+		} else {
+			req.Data[key] = *value
+		}
+	}
+
+	if req.Name == "" || req.Course == "" {
+		return nil, errors.New("name and course must not be empty")
+	}
+	if req.Name == old.Name && req.Course == old.Course && maps.Equal(req.Data, old.Data) {
+		return nil, errors.New("correction does not change the certificate")
+	}
+
+	cert, err := cs.ValidateCertificate(orgID, req)
+	if err != nil {
+		return nil, err
+	}
+	cert.Supersedes = old.ID
+	cert.CorrectionReason = strings.TrimSpace(correction.Reason)
+
+	// The old certificate is superseded before its replacement is issued,
+	// so a failure never leaves two active certificates; if issuing fails
+	// the old one is restored
+	superseded := *old
+	now := time.Now()
+	superseded.Status = models.StatusSuperseded
+	superseded.SupersededBy = cert.ID
+	superseded.SupersededAt = &now
+	if err := cs.storage.SaveCertificate(&superseded); err != nil {
+		return nil, err
+	}
+	if err := cs.issue(orgID, actor, cert, req.SendEmail); err != nil {
+		if restoreErr := cs.storage.SaveCertificate(old); restoreErr != nil {
+			return nil, errors.Join(err, fmt.Errorf("failed to restore certificate %s: %w", old.ID, restoreErr))
+		}
+		return nil, err
+	}
+	recordAudit(cs.storage, orgID, actor, models.AuditCertificateCorrect, models.AuditTargetCertificate, old.ID, old, &superseded)
+
+	return cert, nil
+}
+
+// CertificateHistory returns the chain of corrections a certificate
+// belongs to, from the first certificate issued to the current one
+func (cs *CertificateService) CertificateHistory(orgID, id string) (*models.CertificateHistory, error) {
+	cert, err := cs.GetCertificate(orgID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Walk back to the first certificate, then forward to the current one;
+	// seen guards against cycles in damaged data
+	seen := map[string]bool{cert.ID: true}
+	var earlier []*models.Certificate
+	for previous := cert; previous.Supersedes != "" && !seen[previous.Supersedes]; {
+		if previous, err = cs.GetCertificate(orgID, previous.Supersedes); err != nil {
+			return nil, err
+		}
+		seen[previous.ID] = true
+		earlier = append(earlier, previous)
+	}
+	slices.Reverse(earlier)
+
+	chain := append(earlier, cert)
+	for next := cert; next.SupersededBy != "" && !seen[next.SupersededBy]; {
+		if next, err = cs.GetCertificate(orgID, next.SupersededBy); err != nil {
+			return nil, err
+		}
+		seen[next.ID] = true
+		chain = append(chain, next)
+	}
+
+	return &models.CertificateHistory{CurrentID: chain[len(chain)-1].ID, Certificates: chain}, nil
+}
@@ -1,34 +1,133 @@
 package services
 
 import (
-	"encoding/csv"
 	"errors"
+	"fmt"
 	"io"
+	"log"
+	"maps"
+	"net/mail"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 	"vibe-certificados/models"
 	"vibe-certificados/storage"
 )
 
+// Number of certificates in a page of ListCertificates
+const (
+	DefaultCertificatePageSize = 50
+	MaxCertificatePageSize     = 500
+)
+
+// ErrInvalidCertificateQuery is returned when the filters, sort order or
+// page size of a certificate listing are not valid
+var ErrInvalidCertificateQuery = errors.New("invalid certificate query")
+
 // CertificateService handles certificate-related operations
 type CertificateService struct {
-	storage *storage.MemoryStorage
+	storage       storage.Storage
+	signer        *SigningService
+	publicBaseURL string
+	delivery      *DeliveryService
+	duplicateKey  []string
+	issueMutex    sync.Mutex // serializes issuance checking for duplicates or idempotency keys, corrections and revocations
 }
 
 // NewCertificateService creates a new certificate service
-func NewCertificateService(storage *storage.MemoryStorage) *CertificateService {
+func NewCertificateService(storage storage.Storage) *CertificateService {
 	return &CertificateService{
-		storage: storage,
+		storage:      storage,
+		duplicateKey: DefaultDuplicateKey,
 	}
 }
 
-// CreateCertificate creates a new certificate from a request
-func (cs *CertificateService) CreateCertificate(req *models.CertificateRequest) (*models.Certificate, error) {
-	// Parse completion date
-	completionDate, err := time.Parse("2006-01-02", req.CompletionDate)
-	if err != nil {
-		return nil, errors.New("invalid completion_date format. Use YYYY-MM-DD")
+// SetSigner enables signing of newly issued certificates and verification
+func (cs *CertificateService) SetSigner(signer *SigningService) {
+	cs.signer = signer
+}
+
+// SetPublicBaseURL sets the public address of the service (e.g.
+// "https://certificados.example.com") used to build verification links
+func (cs *CertificateService) SetPublicBaseURL(baseURL string) {
+	cs.publicBaseURL = strings.TrimRight(baseURL, "/")
+}
+
+// SetDeliveryService enables emailing certificates to their recipients
+func (cs *CertificateService) SetDeliveryService(delivery *DeliveryService) {
+	cs.delivery = delivery
+}
+
+// VerificationURL returns the public verification page of a certificate
+func (cs *CertificateService) VerificationURL(id string) string {
+	return cs.publicBaseURL + "/verify/" + id
+}
+
+// PreviewCertificate builds an unsaved sample certificate for tmpl, see
+// SampleCertificate
+func (cs *CertificateService) PreviewCertificate(tmpl *models.Template, data map[string]string) *models.Certificate {
+	cert := SampleCertificate(tmpl, data)
+	if cs.publicBaseURL != "" {
+		cert.VerificationURL = cs.VerificationURL(cert.ID)
+	}
+	return cert
+}
+
+// CreateCertificate creates a new certificate of an organization from a
+// request, using a template of that organization. The issuance is recorded
+// in the audit log as done by actor. Requests matching a certificate
+// already issued follow their duplicate policy, see IssueCertificate.
+func (cs *CertificateService) CreateCertificate(orgID string, actor models.Actor, req *models.CertificateRequest) (*models.Certificate, error) {
+	cert, _, err := cs.IssueCertificate(orgID, actor, "", req)
+	return cert, err
+}
+
+// issue signs and saves a validated certificate
+func (cs *CertificateService) issue(orgID string, actor models.Actor, cert *models.Certificate, sendEmail bool) error {
+	// Sign the issued content so it can be verified later
+	if cs.signer != nil {
+		signature, err := cs.signer.Sign(cert)
+		if err != nil {
+			return err
+		}
+		cert.Signature = signature
+	}
+
+	if sendEmail {
+		cert.Delivery = &models.DeliveryStatus{Status: models.DeliveryPending}
+	}
+
+	// Save certificate
+	if err := cs.storage.SaveCertificate(cert); err != nil {
+		return err
+	}
+	recordAudit(cs.storage, orgID, actor, models.AuditCertificateCreate, models.AuditTargetCertificate, cert.ID, nil, cert)
+
+	// The certificate is issued even if it cannot be queued; it stays
+	// pending and can be sent again with SendCertificate
+	if sendEmail {
+		if err := cs.delivery.Queue(cert.ID); err != nil {
+			log.Printf("certificate %s not queued for delivery: %v", cert.ID, err)
+		}
+	}
+	return nil
+}
+
+// ValidateCertificate runs the checks of CreateCertificate on a request
+// and returns the certificate it would issue, unsigned and unsaved
+func (cs *CertificateService) ValidateCertificate(orgID string, req *models.CertificateRequest) (*models.Certificate, error) {
+	if req.SendEmail && cs.delivery == nil {
+		return nil, errors.New("email delivery is not configured")
+	}
+	if addr, err := mail.ParseAddress(req.Email); err != nil || addr.Address != req.Email {
+		return nil, &ValidationError{Fields: []models.FieldError{{Field: "email", Message: "must be a valid email address"}}}
+	}
+	if err := validateLocale(req.Locale); err != nil {
+		return nil, err
+	}
+	if err := validateDuplicatePolicy(req.OnDuplicate); err != nil {
+		return nil, err
 	}
 
 	// Use default template if not specified
@@ -38,11 +137,26 @@ func (cs *CertificateService) CreateCertificate(req *models.CertificateRequest)
 	}
 
 	// Verify template exists
-	_, err = cs.storage.GetTemplate(templateID)
+	template, err := cs.storage.GetTemplate(orgID, templateID)
 	if err != nil {
 		return nil, errors.New("template not found: " + templateID)
 	}
 
+	// Validate against the template fields and apply their defaults on a
+	// copy, leaving the caller's request untouched
+	validated := *req
+	validated.Data = maps.Clone(req.Data)
+	if err := ApplyTemplateFields(template, &validated); err != nil {
+		return nil, err
+	}
+	req = &validated
+
+	// Parse completion date
+	completionDate, err := time.Parse("2006-01-02", req.CompletionDate)
+	if err != nil {
+		return nil, errors.New("invalid completion_date format. Use YYYY-MM-DD")
+	}
+
 	// Create certificate
 	cert := models.NewCertificate(
 		req.Email,
@@ -52,103 +166,287 @@ func (cs *CertificateService) CreateCertificate(req *models.CertificateRequest)
 		completionDate,
 		req.Data,
 	)
+	cert.OrganizationID = orgID
+	cert.TemplateVersion = template.Version
+	cert.Locale = req.Locale
 
-	// Save certificate
-	err = cs.storage.SaveCertificate(cert)
+	// Public link printed on the certificate (and encoded in its QR code)
+	if cs.publicBaseURL != "" {
+		cert.VerificationURL = cs.VerificationURL(cert.ID)
+	}
+	return cert, nil
+}
+
+// CanSendEmail reports whether email delivery is configured
+func (cs *CertificateService) CanSendEmail() bool {
+	return cs.delivery != nil
+}
+
+// SendCertificate (re)sends a certificate to its recipient by email
+func (cs *CertificateService) SendCertificate(orgID string, actor models.Actor, id string) (*models.Certificate, error) {
+	if cs.delivery == nil {
+		return nil, errors.New("email delivery is not configured")
+	}
+	cert, err := cs.GetCertificate(orgID, id)
 	if err != nil {
 		return nil, err
 	}
 
+	// The delivery is reset to pending even when it cannot be queued
+	pending, err := cs.delivery.Resend(id)
+	if pending != nil {
+		recordAudit(cs.storage, orgID, actor, models.AuditCertificateSend, models.AuditTargetCertificate, id, cert, pending)
+	}
+	return pending, err
+}
+
+// GetCertificate retrieves a certificate of an organization by ID.
+// Certificates of other organizations are reported as not found.
+func (cs *CertificateService) GetCertificate(orgID, id string) (*models.Certificate, error) {
+	cert, err := cs.storage.GetCertificate(id)
+	if err != nil {
+		return nil, err
+	}
+	if cert.OrganizationID != orgID {
+		return nil, storage.ErrCertificateNotFound
+	}
 	return cert, nil
 }
 
-// GetCertificate retrieves a certificate by ID
-func (cs *CertificateService) GetCertificate(id string) (*models.Certificate, error) {
-	return cs.storage.GetCertificate(id)
+// GetCertificatesByEmail retrieves the certificates of an organization for
+// an email
+func (cs *CertificateService) GetCertificatesByEmail(orgID, email string) ([]*models.Certificate, error) {
+	return cs.storage.GetCertificatesByEmail(orgID, email)
 }
 
-// GetCertificatesByEmail retrieves all certificates for an email
-func (cs *CertificateService) GetCertificatesByEmail(email string) ([]*models.Certificate, error) {
-	return cs.storage.GetCertificatesByEmail(email)
+// ListCertificates returns a page of the certificates of an organization.
+// Without a sort field the newest certificates come first; without a limit
+// a page holds DefaultCertificatePageSize certificates.
+func (cs *CertificateService) ListCertificates(orgID string, query *models.CertificateQuery) (*models.CertificatePage, error) {
+	q := *query
+	if q.Sort == "" {
+		q.Sort = models.SortCreatedAt
+		q.Descending = true
+	}
+	if !models.IsValidCertificateSort(q.Sort) {
+		return nil, fmt.Errorf("%w: sort must be one of %s", ErrInvalidCertificateQuery, strings.Join(models.CertificateSortFields, ", "))
+	}
+	switch q.Status {
+	case "", models.StatusActive, models.StatusRevoked, models.StatusSuperseded:
+	default:
+		return nil, fmt.Errorf("%w: status must be active, revoked or superseded", ErrInvalidCertificateQuery)
+	}
+	if q.Limit == 0 {
+		q.Limit = DefaultCertificatePageSize
+	}
+	if q.Limit < 0 || q.Limit > MaxCertificatePageSize {
+		return nil, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidCertificateQuery, MaxCertificatePageSize)
+	}
+	if !q.CompletedUntil.IsZero() && q.CompletedUntil.Before(q.CompletedFrom) ||
+		!q.CreatedUntil.IsZero() && q.CreatedUntil.Before(q.CreatedFrom) {
+		return nil, fmt.Errorf("%w: date ranges must not end before they start", ErrInvalidCertificateQuery)
+	}
+
+	return cs.storage.ListCertificates(orgID, &q)
 }
 
-// CreateCertificatesFromCSV creates multiple certificates from CSV data
-func (cs *CertificateService) CreateCertificatesFromCSV(csvData io.Reader) (*models.BatchCertificateResponse, error) {
-	response := &models.BatchCertificateResponse{
-		CreatedIDs: make([]string, 0),
-		Errors:     make([]string, 0),
+// RevokeCertificate withdraws a certificate, recording the reason and time.
+// Revoked certificates remain retrievable so verifiers can see their status.
+func (cs *CertificateService) RevokeCertificate(orgID string, actor models.Actor, id, reason string) (*models.Certificate, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, errors.New("revocation reason is required")
 	}
 
-	reader := csv.NewReader(csvData)
-	records, err := reader.ReadAll()
+	// A correction saving the certificate at the same time would undo
+	// the revocation
+	cs.issueMutex.Lock()
+	defer cs.issueMutex.Unlock()
+
+	cert, err := cs.GetCertificate(orgID, id)
 	if err != nil {
-		return nil, errors.New("failed to parse CSV: " + err.Error())
+		return nil, err
 	}
+	if cert.IsRevoked() {
+		return nil, errors.New("certificate already revoked")
+	}
+
+	// Work on a copy so readers never observe a half-updated certificate
+	revoked := *cert
+	now := time.Now()
+	revoked.Status = models.StatusRevoked
+	revoked.RevocationReason = reason
+	revoked.RevokedAt = &now
 
-	if len(records) == 0 {
-		return nil, errors.New("CSV file is empty")
+	if err := cs.storage.SaveCertificate(&revoked); err != nil {
+		return nil, err
 	}
+	recordAudit(cs.storage, orgID, actor, models.AuditCertificateRevoke, models.AuditTargetCertificate, id, cert, &revoked)
 
-	// Assume first row is header
-	headers := records[0]
-	response.Total = len(records) - 1
+	return &revoked, nil
+}
 
-	// Find required column indices
-	emailIdx, nameIdx, courseIdx, dateIdx := -1, -1, -1, -1
-	templateIdx := -1
+// VerifyCertificate checks the stored certificate against its signature.
+// Verification is public, so certificates of every organization are found.
+func (cs *CertificateService) VerifyCertificate(id string) (*models.VerificationResult, error) {
+	cert, err := cs.storage.GetCertificate(id)
+	if err != nil {
+		return nil, err
+	}
+	return cs.verify(cert, cert, cert.Signature), nil
+}
 
-	for i, header := range headers {
-		switch strings.ToLower(strings.TrimSpace(header)) {
-		case "email":
-			emailIdx = i
-		case "name":
-			nameIdx = i
-		case "course":
-			courseIdx = i
-		case "completion_date", "date":
-			dateIdx = i
-		case "template_id", "template":
-			templateIdx = i
-		}
+// VerifySubmittedCertificate checks a certificate presented by a third
+// party (e.g. the JSON behind a PDF) against the given signature. The
+// signature proves the content was issued by this service; the stored
+// record, when available, tells whether it has been revoked since.
+func (cs *CertificateService) VerifySubmittedCertificate(submitted *models.Certificate, signature string) *models.VerificationResult {
+	if signature == "" {
+		signature = submitted.Signature
 	}
 
-	if emailIdx == -1 || nameIdx == -1 || courseIdx == -1 || dateIdx == -1 {
-		return nil, errors.New("CSV must contain email, name, course, and completion_date columns")
+	stored, err := cs.storage.GetCertificate(submitted.ID)
+	if err != nil {
+		stored = nil
 	}
+	return cs.verify(submitted, stored, signature)
+}
 
-	// Process each record
-	for i := 1; i < len(records); i++ {
-		record := records[i]
-		rowNum := strconv.Itoa(i + 1)
+// verify builds the verification result for content signed with signature;
+// stored is the issued record used for the status and may be nil
+func (cs *CertificateService) verify(content, stored *models.Certificate, signature string) *models.VerificationResult {
+	result := &models.VerificationResult{ID: content.ID}
 
-		if len(record) <= emailIdx || len(record) <= nameIdx || len(record) <= courseIdx || len(record) <= dateIdx {
-			response.Failed++
-			response.Errors = append(response.Errors, "Row "+rowNum+": insufficient columns")
-			continue
-		}
+	switch {
+	case cs.signer == nil:
+		result.Result = models.VerificationInvalid
+		result.Message = "signature verification is not enabled"
+		return result
+	case signature == "":
+		result.Result = models.VerificationInvalid
+		result.Message = "certificate is not signed"
+		return result
+	case !cs.signer.Verify(content, signature):
+		result.Result = models.VerificationInvalid
+		result.Message = "signature does not match the certificate content"
+		return result
+	case stored == nil:
+		result.Result = models.VerificationInvalid
+		result.Message = "certificate is not registered by this service"
+		return result
+	}
 
-		templateID := "default"
-		if templateIdx >= 0 && len(record) > templateIdx && record[templateIdx] != "" {
-			templateID = record[templateIdx]
-		}
+	result.Status = stored.Status
+	result.Certificate = stored
+	if stored.IsRevoked() {
+		result.Result = models.VerificationRevoked
+		result.Message = "certificate was revoked"
+		result.RevocationReason = stored.RevocationReason
+		result.RevokedAt = stored.RevokedAt
+		return result
+	}
+	if stored.IsSuperseded() {
+		result.Result = models.VerificationSuperseded
+		result.Message = "certificate was superseded by a corrected certificate"
+		result.SupersededBy = stored.SupersededBy
+		return result
+	}
 
-		req := &models.CertificateRequest{
-			Email:          strings.TrimSpace(record[emailIdx]),
-			Name:           strings.TrimSpace(record[nameIdx]),
-			Course:         strings.TrimSpace(record[courseIdx]),
-			CompletionDate: strings.TrimSpace(record[dateIdx]),
-			TemplateID:     templateID,
-		}
+	result.Result = models.VerificationValid
+	result.Message = "certificate is genuine"
+	return result
+}
 
-		cert, err := cs.CreateCertificate(req)
+// PublicKey returns the base64 encoded Ed25519 key used to sign certificates
+func (cs *CertificateService) PublicKey() (string, error) {
+	if cs.signer == nil {
+		return "", errors.New("signature verification is not enabled")
+	}
+	return cs.signer.PublicKey(), nil
+}
+
+// BatchRow is a row of a batch file turned into a certificate request. Err
+// is set when the row cannot be issued (e.g. missing columns); Request then
+// holds what could be read of the row, if anything.
+type BatchRow struct {
+	Row     int // row of the CSV file or sheet, the header being row 1, or line of the JSON Lines file
+	Request *models.CertificateRequest
+	Err     error
+}
+
+// ParseBatch reads certificate requests from a CSV, XLSX or JSON Lines
+// file. Every row needs email, name, course and completion_date; other
+// columns are kept in the request Data.
+func (cs *CertificateService) ParseBatch(data io.Reader, opts ImportOptions) ([]BatchRow, error) {
+	reader, err := NewBatchReader(data, opts)
+	if err != nil {
+		return nil, err
+	}
+	return ReadBatch(reader)
+}
+
+// CreateCertificatesFromFile creates multiple certificates from a batch
+// file synchronously, issuing each row as it is read. Large files should
+// go through JobService instead.
+func (cs *CertificateService) CreateCertificatesFromFile(orgID string, actor models.Actor, data io.Reader, opts ImportOptions) (*models.BatchCertificateResponse, error) {
+	reader, err := NewBatchReader(data, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	response := newBatchResponse()
+	for {
+		row, err := reader.Next()
+		if err == io.EOF {
+			return response, nil
+		}
 		if err != nil {
-			response.Failed++
-			response.Errors = append(response.Errors, "Row "+rowNum+": "+err.Error())
-		} else {
-			response.Success++
-			response.CreatedIDs = append(response.CreatedIDs, cert.ID)
+			return nil, err
 		}
+		cs.issueInto(response, orgID, actor, row)
 	}
+}
+
+// IssueBatch creates the certificates of parsed rows synchronously
+func (cs *CertificateService) IssueBatch(orgID string, actor models.Actor, rows []BatchRow) *models.BatchCertificateResponse {
+	response := newBatchResponse()
+	for _, row := range rows {
+		cs.issueInto(response, orgID, actor, row)
+	}
+	return response
+}
 
-	return response, nil
-}
\ No newline at end of file
+func newBatchResponse() *models.BatchCertificateResponse {
+	return &models.BatchCertificateResponse{
+		CreatedIDs: make([]string, 0),
+		Errors:     make([]string, 0),
+	}
+}
+
+// issueInto creates the certificate of a row and counts it in response
+func (cs *CertificateService) issueInto(response *models.BatchCertificateResponse, orgID string, actor models.Actor, row BatchRow) {
+	response.Total++
+	cert, outcome, err := cs.IssueBatchRow(orgID, actor, row)
+	switch {
+	case err != nil:
+		response.Failed++
+		response.Errors = append(response.Errors, "Row "+strconv.Itoa(row.Row)+": "+err.Error())
+	case outcome == IssueExisting:
+		response.Skipped++
+		if row.Request.OnDuplicate == models.DuplicateReturnExisting {
+			response.ExistingIDs = append(response.ExistingIDs, cert.ID)
+		}
+	default:
+		response.Success++
+		response.CreatedIDs = append(response.CreatedIDs, cert.ID)
+	}
+}
+
+// IssueBatchRow creates the certificate of a parsed row, applying its
+// duplicate policy like IssueCertificate
+func (cs *CertificateService) IssueBatchRow(orgID string, actor models.Actor, row BatchRow) (*models.Certificate, IssueOutcome, error) {
+	if row.Err != nil {
+		return nil, "", row.Err
+	}
+	return cs.IssueCertificate(orgID, actor, "", row.Request)
+}
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// CSVReader reads certificate requests from a CSV file one row at a time.
+// Columns other than the request fields are kept in the request Data.
+type CSVReader struct {
+	reader    *csv.Reader
+	checkUTF8 bool
+	table     *tableReader
+	row       int
+}
+
+// NewCSVReader reads the header of a CSV file. It fails when the header
+// lacks the email, name, course or completion_date columns.
+func NewCSVReader(csvData io.Reader, opts ImportOptions) (*CSVReader, error) {
+	decoded, checkUTF8, err := decodeCSV(csvData, opts.Encoding)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := csv.NewReader(decoded)
+	if opts.Delimiter != 0 {
+		if !validCSVDelimiter(opts.Delimiter) {
+			return nil, fmt.Errorf("invalid CSV delimiter %q", opts.Delimiter)
+		}
+		reader.Comma = opts.Delimiter
+	}
+	// Rows may be shorter or longer than the header; rows missing a
+	// required column are reported on their own
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+
+	headers, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("CSV file is empty")
+	}
+	if err != nil {
+		return nil, errors.New("failed to parse CSV: " + err.Error())
+	}
+	if checkUTF8 && !validUTF8(headers) {
+		return nil, errors.New("CSV header is not valid UTF-8; set the encoding of the file (e.g. latin1)")
+	}
+
+	table, err := newTableReader(headers, opts, "CSV")
+	if err != nil {
+		return nil, err
+	}
+	return &CSVReader{reader: reader, checkUTF8: checkUTF8, table: table, row: 1}, nil
+}
+
+// Next returns the next row of the file, or io.EOF after the last one.
+// The header is row 1.
+func (r *CSVReader) Next() (BatchRow, error) {
+	record, err := r.reader.Read()
+	if err == io.EOF {
+		return BatchRow{}, io.EOF
+	}
+	r.row++
+
+	var parseErr *csv.ParseError
+	switch {
+	case errors.As(err, &parseErr):
+		return BatchRow{Row: r.row, Err: errors.New("malformed CSV row: " + parseErr.Err.Error())}, nil
+	case err != nil:
+		return BatchRow{}, errors.New("failed to read CSV: " + err.Error())
+	case r.checkUTF8 && !validUTF8(record):
+		return BatchRow{Row: r.row, Err: errors.New("row is not valid UTF-8; set the encoding of the file (e.g. latin1)")}, nil
+	}
+	return r.table.row(r.row, record), nil
+}
+
+// decodeCSV converts CSV data in the given encoding to UTF-8. UTF-8 data is
+// returned as is, without its byte order mark, and must be checked for
+// invalid sequences.
+func decodeCSV(csvData io.Reader, encoding string) (io.Reader, bool, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", "utf-8", "utf8":
+		return skipBOM(csvData), true, nil
+	case "latin1", "latin-1", "iso-8859-1":
+		return charmap.ISO8859_1.NewDecoder().Reader(csvData), false, nil
+	case "windows-1252", "cp1252":
+		return charmap.Windows1252.NewDecoder().Reader(csvData), false, nil
+	default:
+		return nil, false, errors.New("unsupported CSV encoding: " + encoding)
+	}
+}
+
+// skipBOM drops the UTF-8 byte order mark spreadsheets put at the start of
+// exported files
+func skipBOM(data io.Reader) *bufio.Reader {
+	buffered := bufio.NewReader(data)
+	if bom, _ := buffered.Peek(3); bytes.Equal(bom, []byte("\xef\xbb\xbf")) {
+		buffered.Discard(3)
+	}
+	return buffered
+}
+
+// validCSVDelimiter reports whether r can separate the fields of a CSV file
+func validCSVDelimiter(r rune) bool {
+	return r != '"' && r != '\r' && r != '\n' && r != utf8.RuneError && utf8.ValidRune(r)
+}
+
+func validUTF8(fields []string) bool {
+	for _, field := range fields {
+		if !utf8.ValidString(field) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,226 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+	"vibe-certificados/models"
+	"vibe-certificados/storage"
+)
+
+// DefaultEmailTemplate is used for templates without their own email. Its
+// text comes from the message catalog of the certificate's locale.
+func DefaultEmailTemplate() *models.EmailTemplate {
+	return &models.EmailTemplate{
+		Subject: `{{t "email.subject" .Course}}`,
+		Body:    `{{t "email.body" .Name .Course .VerificationURL}}`,
+	}
+}
+
+// ValidateEmailTemplate checks the subject and body templates before they
+// are stored with a template
+func ValidateEmailTemplate(email *models.EmailTemplate) error {
+	if email == nil {
+		return nil
+	}
+	if _, err := parseTextTemplate("subject", email.Subject, localeFor(DefaultLocale)); err != nil {
+		return fmt.Errorf("email.subject: %v", err)
+	}
+	if _, err := parseTextTemplate("body", email.Body, localeFor(DefaultLocale)); err != nil {
+		return fmt.Errorf("email.body: %v", err)
+	}
+	return nil
+}
+
+// ErrDeliveryQueueFull is returned when a delivery cannot be queued without
+// waiting. The certificate stays pending and can be sent again with Resend.
+var ErrDeliveryQueueFull = errors.New("delivery queue is full")
+
+// DeliveryService emails issued certificates, with the PDF attached, in the
+// background. Failed sends are retried with exponential backoff and the
+// outcome is recorded in the certificate's delivery status.
+type DeliveryService struct {
+	storage         storage.Storage
+	templateService *TemplateService
+	pdfService      *PDFService
+	mailer          Mailer
+
+	maxAttempts int
+	retryDelay  time.Duration
+
+	queue  chan string // certificate IDs
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewDeliveryService starts workers sending queued certificates through
+// mailer. A failed send is retried after retryDelay, doubling on each
+// attempt, until maxAttempts is reached.
+func NewDeliveryService(storage storage.Storage, templateService *TemplateService, pdfService *PDFService, mailer Mailer, workers, maxAttempts int, retryDelay time.Duration) *DeliveryService {
+	if workers < 1 {
+		workers = 1
+	}
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ds := &DeliveryService{
+		storage:         storage,
+		templateService: templateService,
+		pdfService:      pdfService,
+		mailer:          mailer,
+		maxAttempts:     maxAttempts,
+		retryDelay:      retryDelay,
+		queue:           make(chan string, 1000),
+		ctx:             ctx,
+		cancel:          cancel,
+	}
+
+	for i := 0; i < workers; i++ {
+		ds.wg.Add(1)
+		go ds.work()
+	}
+	return ds
+}
+
+// Queue schedules the delivery of a certificate whose delivery status is
+// already pending. It never blocks: ErrDeliveryQueueFull is returned while
+// the queue is full.
+func (ds *DeliveryService) Queue(id string) error {
+	if ds.ctx.Err() != nil {
+		return errors.New("delivery service is shutting down")
+	}
+	select {
+	case ds.queue <- id:
+		return nil
+	default:
+		return ErrDeliveryQueueFull
+	}
+}
+
+// Resend resets the delivery status of a certificate and queues it again
+func (ds *DeliveryService) Resend(id string) (*models.Certificate, error) {
+	if err := ds.storage.UpdateDelivery(id, &models.DeliveryStatus{Status: models.DeliveryPending}); err != nil {
+		return nil, err
+	}
+	pending, err := ds.storage.GetCertificate(id)
+	if err != nil {
+		return nil, err
+	}
+	return pending, ds.Queue(id)
+}
+
+// Close stops the workers. Deliveries still pending keep that status and
+// can be sent again with Resend.
+func (ds *DeliveryService) Close() {
+	ds.cancel()
+	ds.wg.Wait()
+}
+
+// work sends queued certificates until the service is closed
+func (ds *DeliveryService) work() {
+	defer ds.wg.Done()
+
+	for {
+		select {
+		case id := <-ds.queue:
+			ds.attempt(id)
+		case <-ds.ctx.Done():
+			return
+		}
+	}
+}
+
+// attempt sends a certificate once, records the outcome and schedules a
+// retry when the send failed and attempts remain
+func (ds *DeliveryService) attempt(id string) {
+	cert, err := ds.storage.GetCertificate(id)
+	if err != nil {
+		log.Printf("delivery of certificate %s: %v", id, err)
+		return
+	}
+
+	sendErr := ds.send(cert)
+
+	// The certificate may have been revoked or corrected while it was
+	// sent; only its delivery status is written back
+	cert, err = ds.storage.GetCertificate(id)
+	if err != nil {
+		log.Printf("delivery of certificate %s: %v", id, err)
+		return
+	}
+
+	now := time.Now()
+	delivery := models.DeliveryStatus{Status: models.DeliveryPending}
+	if cert.Delivery != nil {
+		delivery = *cert.Delivery
+	}
+	delivery.Attempts++
+	delivery.LastAttemptAt = &now
+	switch {
+	case sendErr == nil:
+		delivery.Status = models.DeliverySent
+		delivery.LastError = ""
+		delivery.SentAt = &now
+	case delivery.Attempts >= ds.maxAttempts:
+		delivery.Status = models.DeliveryFailed
+		delivery.LastError = sendErr.Error()
+	default:
+		delivery.LastError = sendErr.Error()
+	}
+
+	if err := ds.storage.UpdateDelivery(id, &delivery); err != nil {
+		log.Printf("delivery of certificate %s: failed to save status: %v", id, err)
+		return
+	}
+
+	if delivery.Status == models.DeliveryPending {
+		delay := ds.retryDelay << (delivery.Attempts - 1)
+		time.AfterFunc(delay, func() {
+			if err := ds.Queue(id); err != nil {
+				log.Printf("delivery of certificate %s: retry not queued: %v", id, err)
+			}
+		})
+	}
+}
+
+// send renders the email of a certificate and hands it to the mailer
+func (ds *DeliveryService) send(cert *models.Certificate) error {
+	email := DefaultEmailTemplate()
+	tmpl, err := ds.templateService.TemplateFor(cert)
+	if err == nil && tmpl.Email != nil {
+		email = tmpl.Email
+	}
+
+	loc := certificateLocale(tmpl, cert)
+	data := certificateData(cert, loc)
+	subject, err := renderBlockText(email.Subject, data, loc)
+	if err != nil {
+		return fmt.Errorf("failed to render email subject: %v", err)
+	}
+	body, err := renderBlockText(email.Body, data, loc)
+	if err != nil {
+		return fmt.Errorf("failed to render email body: %v", err)
+	}
+
+	pdf, err := ds.pdfService.GeneratePDF(cert)
+	if err != nil {
+		return fmt.Errorf("failed to generate PDF: %v", err)
+	}
+
+	return ds.mailer.Send(&EmailMessage{
+		To:      cert.Email,
+		Subject: subject,
+		Body:    body,
+		Attachments: []EmailAttachment{{
+			Filename:    "certificado_" + cert.ID + ".pdf",
+			ContentType: "application/pdf",
+			Data:        pdf,
+		}},
+	})
+}
@@ -0,0 +1,246 @@
+package services
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"vibe-certificados/models"
+)
+
+// DefaultExportFilenamePattern names the files of a ZIP export when the
+// request does not set a pattern
+const DefaultExportFilenamePattern = "{{.ID}}.pdf"
+
+// ExportService bundles certificate PDFs (and optionally HTML) into ZIP archives
+type ExportService struct {
+	certService     *CertificateService
+	jobService      *JobService
+	templateService *TemplateService
+	pdfService      *PDFService
+	concurrency     int
+}
+
+// NewExportService creates an export service that renders at most
+// concurrency certificates at the same time
+func NewExportService(certService *CertificateService, jobService *JobService, templateService *TemplateService, pdfService *PDFService, concurrency int) *ExportService {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &ExportService{
+		certService:     certService,
+		jobService:      jobService,
+		templateService: templateService,
+		pdfService:      pdfService,
+		concurrency:     concurrency,
+	}
+}
+
+// ResolveCertificates returns the certificates selected by req in request
+// order: listed IDs first, then the certificates of the job, then those of
+// the email. Only certificates of the organization are selected; unknown
+// IDs or jobs are reported as errors.
+func (es *ExportService) ResolveCertificates(orgID string, req *models.ExportCertificatesRequest) ([]*models.Certificate, error) {
+	if len(req.IDs) == 0 && req.JobID == "" && req.Email == "" {
+		return nil, errors.New("ids, job_id or email is required")
+	}
+
+	certificates := make([]*models.Certificate, 0, len(req.IDs))
+	seen := make(map[string]bool)
+	add := func(cert *models.Certificate) {
+		if !seen[cert.ID] {
+			seen[cert.ID] = true
+			certificates = append(certificates, cert)
+		}
+	}
+
+	ids := req.IDs
+	if req.JobID != "" {
+		job, err := es.jobService.GetJob(orgID, req.JobID)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(append([]string{}, ids...), job.CreatedIDs...)
+	}
+	for _, id := range ids {
+		cert, err := es.certService.GetCertificate(orgID, id)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", err, id)
+		}
+		add(cert)
+	}
+
+	if req.Email != "" {
+		byEmail, err := es.certService.GetCertificatesByEmail(orgID, req.Email)
+		if err != nil {
+			return nil, err
+		}
+		for _, cert := range byEmail {
+			add(cert)
+		}
+	}
+
+	if len(certificates) == 0 {
+		return nil, errors.New("no certificates match the request")
+	}
+	return certificates, nil
+}
+
+// ParseFilenamePattern validates a filename pattern; an empty pattern
+// selects DefaultExportFilenamePattern
+func ParseFilenamePattern(pattern string) (*template.Template, error) {
+	if pattern == "" {
+		pattern = DefaultExportFilenamePattern
+	}
+	t, err := parseTextTemplate("filename", pattern, localeFor(DefaultLocale))
+	if err != nil {
+		return nil, fmt.Errorf("invalid filename_pattern: %v", err)
+	}
+	return t, nil
+}
+
+// exportedFile is the rendered output of a single certificate
+type exportedFile struct {
+	name string // without extension
+	pdf  []byte
+	html []byte
+	err  error
+}
+
+// WriteZIP renders the certificates concurrently and writes them to w as a
+// ZIP archive, in the order given. A certificate that fails to render is
+// listed in an errors.txt entry instead of aborting the archive, since the
+// response may already be partially sent.
+func (es *ExportService) WriteZIP(w io.Writer, certificates []*models.Certificate, pattern *template.Template, includeHTML bool) error {
+	// Each certificate gets its own result channel so files are written in
+	// order while up to es.concurrency of them are being rendered
+	results := make([]chan exportedFile, len(certificates))
+	for i := range results {
+		results[i] = make(chan exportedFile, 1)
+	}
+
+	// Stops rendering when the archive cannot be written (e.g. the client
+	// went away)
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		sem := make(chan struct{}, es.concurrency)
+		for i, cert := range certificates {
+			select {
+			case sem <- struct{}{}:
+			case <-done:
+				return
+			}
+			go func(i int, cert *models.Certificate) {
+				defer func() { <-sem }()
+				results[i] <- es.render(cert, pattern, includeHTML)
+			}(i, cert)
+		}
+	}()
+
+	archive := zip.NewWriter(w)
+	names := make(map[string]bool)
+	var failures []string
+
+	for i, cert := range certificates {
+		file := <-results[i]
+		if file.err != nil {
+			failures = append(failures, cert.ID+": "+file.err.Error())
+			continue
+		}
+
+		name := uniqueFileName(names, file.name)
+		if err := writeZIPEntry(archive, name+".pdf", file.pdf); err != nil {
+			return err
+		}
+		if includeHTML {
+			if err := writeZIPEntry(archive, name+".html", file.html); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(failures) > 0 {
+		report := strings.Join(failures, "\n") + "\n"
+		if err := writeZIPEntry(archive, "errors.txt", []byte(report)); err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+// render generates the files of a certificate
+func (es *ExportService) render(cert *models.Certificate, pattern *template.Template, includeHTML bool) exportedFile {
+	var file exportedFile
+
+	name, err := executeTemplate(pattern, cert.GetAllData())
+	if err != nil {
+		file.err = fmt.Errorf("failed to build file name: %v", err)
+		return file
+	}
+	file.name = sanitizeFileName(strings.ReplaceAll(name, "<no value>", ""), cert.ID)
+
+	if file.pdf, file.err = es.pdfService.GeneratePDF(cert); file.err != nil {
+		return file
+	}
+	if includeHTML {
+		html, err := es.templateService.RenderCertificate(cert)
+		if err != nil {
+			file.err = err
+			return file
+		}
+		file.html = []byte(html)
+	}
+	return file
+}
+
+// writeZIPEntry adds a file to the archive
+func writeZIPEntry(archive *zip.Writer, name string, data []byte) error {
+	entry, err := archive.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = entry.Write(data)
+	return err
+}
+
+// sanitizeFileName turns a rendered pattern into a safe file name without
+// extension. Path separators and characters reserved on Windows are
+// replaced; an empty result falls back to the certificate ID.
+func sanitizeFileName(name, fallback string) string {
+	if ext := strings.ToLower(path.Ext(name)); ext == ".pdf" || ext == ".html" {
+		name = name[:len(name)-len(ext)]
+	}
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '-'
+		}
+		return r
+	}, name)
+	name = strings.Trim(strings.TrimSpace(name), ".")
+	if name == "" {
+		return fallback
+	}
+	return name
+}
+
+// uniqueFileName appends " (2)", " (3)"... to names already in the archive
+func uniqueFileName(names map[string]bool, name string) string {
+	unique := name
+	for n := 2; names[strings.ToLower(unique)]; n++ {
+		unique = name + " (" + strconv.Itoa(n) + ")"
+	}
+	names[strings.ToLower(unique)] = true
+	return unique
+}
@@ -0,0 +1,163 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"vibe-certificados/models"
+)
+
+// ValidationError lists the template fields a certificate request fails
+type ValidationError struct {
+	Fields []models.FieldError
+}
+
+// Error joins the field errors, e.g. "hours: must be a number; level: is required"
+func (ve *ValidationError) Error() string {
+	messages := make([]string, len(ve.Fields))
+	for i, field := range ve.Fields {
+		messages[i] = field.Field + ": " + field.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// requestFields are template field names stored in the request itself
+// rather than in its custom data
+var requestFields = map[string]func(req *models.CertificateRequest) *string{
+	"email":           func(req *models.CertificateRequest) *string { return &req.Email },
+	"name":            func(req *models.CertificateRequest) *string { return &req.Name },
+	"course":          func(req *models.CertificateRequest) *string { return &req.Course },
+	"completion_date": func(req *models.CertificateRequest) *string { return &req.CompletionDate },
+}
+
+// ValidateTemplateFields checks the field definitions of a template before
+// it is stored
+func ValidateTemplateFields(fields []models.TemplateField) error {
+	seen := make(map[string]bool)
+
+	for i, field := range fields {
+		prefix := fmt.Sprintf("fields[%d]", i)
+		if field.Name == "" {
+			return errors.New(prefix + ".name is required")
+		}
+		if seen[field.Name] {
+			return errors.New(prefix + ": duplicate field " + field.Name)
+		}
+		seen[field.Name] = true
+
+		switch field.Type {
+		case "", models.FieldString, models.FieldDate, models.FieldNumber, models.FieldEmail, models.FieldURL:
+		case models.FieldEnum:
+			if len(field.Options) == 0 {
+				return errors.New(prefix + ": enum fields require options")
+			}
+		default:
+			return fmt.Errorf("%s.type must be one of string, date, number, email, enum, url", prefix)
+		}
+
+		if field.Default != nil {
+			if message := validateFieldValue(field, defaultValue(field.Default)); message != "" {
+				return fmt.Errorf("%s.default %s", prefix, message)
+			}
+		}
+	}
+	return nil
+}
+
+// ApplyTemplateFields validates a request against the field definitions of
+// a template, filling in default values for missing fields. All invalid
+// fields are reported together in a *ValidationError.
+func ApplyTemplateFields(template *models.Template, req *models.CertificateRequest) error {
+	var fieldErrors []models.FieldError
+
+	for _, field := range template.Fields {
+		value := fieldValue(req, field.Name)
+
+		if strings.TrimSpace(value) == "" {
+			if field.Default != nil {
+				setFieldValue(req, field.Name, defaultValue(field.Default))
+				continue
+			}
+			if field.Required {
+				fieldErrors = append(fieldErrors, models.FieldError{Field: field.Name, Message: "is required"})
+			}
+			continue
+		}
+
+		if message := validateFieldValue(field, value); message != "" {
+			fieldErrors = append(fieldErrors, models.FieldError{Field: field.Name, Message: message})
+		}
+	}
+
+	if len(fieldErrors) > 0 {
+		return &ValidationError{Fields: fieldErrors}
+	}
+	return nil
+}
+
+// validateFieldValue checks a non-empty value against the field type and
+// returns a message describing the problem, or "" when it is valid
+func validateFieldValue(field models.TemplateField, value string) string {
+	switch field.Type {
+	case models.FieldDate:
+		if _, err := time.Parse("2006-01-02", value); err != nil {
+			return "must be a date in YYYY-MM-DD format"
+		}
+	case models.FieldNumber:
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return "must be a number"
+		}
+	case models.FieldEmail:
+		if addr, err := mail.ParseAddress(value); err != nil || addr.Address != value {
+			return "must be a valid email address"
+		}
+	case models.FieldEnum:
+		for _, option := range field.Options {
+			if value == option {
+				return ""
+			}
+		}
+		return "must be one of " + strings.Join(field.Options, ", ")
+	case models.FieldURL:
+		if u, err := url.Parse(value); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return "must be an http or https URL"
+		}
+	}
+	return ""
+}
+
+// fieldValue returns the value of a field from the request
+func fieldValue(req *models.CertificateRequest, name string) string {
+	if field, ok := requestFields[name]; ok {
+		return *field(req)
+	}
+	return req.Data[name]
+}
+
+// setFieldValue stores a field value in the request
+func setFieldValue(req *models.CertificateRequest, name, value string) {
+	if field, ok := requestFields[name]; ok {
+		*field(req) = value
+		return
+	}
+	if req.Data == nil {
+		req.Data = make(map[string]string)
+	}
+	req.Data[name] = value
+}
+
+// defaultValue formats a default decoded from JSON (string, number or bool)
+func defaultValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,222 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// coreFonts are the standard PDF fonts built into gofpdf. They only
+// support the Windows-1252 character set.
+var coreFonts = map[string]bool{"arial": true, "helvetica": true, "times": true, "courier": true}
+
+// fontStyleSuffixes maps TrueType file name suffixes to gofpdf styles
+var fontStyleSuffixes = []struct {
+	suffix string
+	style  string
+}{
+	{"-bolditalic", "BI"},
+	{"-boldoblique", "BI"},
+	{"-bold", "B"},
+	{"-italic", "I"},
+	{"-oblique", "I"},
+	{"-regular", ""},
+}
+
+// FontRegistry holds the UTF-8 TrueType fonts available to PDF rendering
+// and the fallback chain used when a text is not covered by a font
+type FontRegistry struct {
+	families map[string]*fontFamily // lower case family name -> family
+	fallback []string
+}
+
+// fontFamily groups the styles of a TrueType font
+type fontFamily struct {
+	name   string
+	styles map[string]*fontFace // "", "B", "I" or "BI"
+}
+
+// fontFace is a single TrueType font file
+type fontFace struct {
+	data []byte
+	font *sfnt.Font
+}
+
+// NewFontRegistry creates an empty registry; PDFs then only use core fonts
+func NewFontRegistry() *FontRegistry {
+	return &FontRegistry{families: make(map[string]*fontFamily)}
+}
+
+// LoadFontRegistry loads every .ttf file in dir. The family and style come
+// from the file name, e.g. "DejaVuSans-Bold.ttf" is family "DejaVuSans",
+// style bold. fallback lists the families tried, in order, for text the
+// requested font cannot display; when empty all loaded families are used
+// in alphabetical order. A missing directory yields an empty registry.
+func LoadFontRegistry(dir string, fallback []string) (*FontRegistry, error) {
+	registry := NewFontRegistry()
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.[tT][tT][fF]"))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read font %s: %v", path, err)
+		}
+		family, style := fontNameFromFile(path)
+		if err := registry.AddFont(family, style, data); err != nil {
+			return nil, fmt.Errorf("failed to load font %s: %v", path, err)
+		}
+	}
+
+	for _, name := range fallback {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !registry.HasFamily(name) {
+			return nil, errors.New("fallback font not found in fonts directory: " + name)
+		}
+		registry.fallback = append(registry.fallback, name)
+	}
+	if len(registry.fallback) == 0 {
+		registry.fallback = registry.Families()
+	}
+
+	return registry, nil
+}
+
+// AddFont registers a TrueType font under family and style
+func (fr *FontRegistry) AddFont(family, style string, data []byte) error {
+	font, err := sfnt.Parse(data)
+	if err != nil {
+		return err
+	}
+
+	key := strings.ToLower(family)
+	f, exists := fr.families[key]
+	if !exists {
+		f = &fontFamily{name: family, styles: make(map[string]*fontFace)}
+		fr.families[key] = f
+	}
+	f.styles[style] = &fontFace{data: data, font: font}
+	return nil
+}
+
+// HasFamily reports whether a TrueType family has been loaded
+func (fr *FontRegistry) HasFamily(family string) bool {
+	_, exists := fr.families[strings.ToLower(family)]
+	return exists
+}
+
+// Families returns the names of the loaded TrueType families
+func (fr *FontRegistry) Families() []string {
+	names := make([]string, 0, len(fr.families))
+	for _, f := range fr.families {
+		names = append(names, f.name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// resolvedFont is the font chosen to draw a piece of text
+type resolvedFont struct {
+	family string
+	style  string
+	data   []byte // nil for core fonts
+}
+
+// Resolve picks the first font of chain (followed by the registry fallback
+// chain) able to display every character of text. Core fonts qualify when
+// the text fits Windows-1252. When nothing covers the text completely the
+// first candidate is used and unsupported characters are replaced.
+func (fr *FontRegistry) Resolve(chain []string, style, text string) resolvedFont {
+	candidates := append(append([]string{}, chain...), fr.fallback...)
+	candidates = append(candidates, "Arial")
+
+	var first *resolvedFont
+	for _, name := range candidates {
+		candidate, ok := fr.candidate(name, style)
+		if !ok {
+			continue
+		}
+		if first == nil {
+			first = &candidate
+		}
+		if fr.covers(candidate, text) {
+			return candidate
+		}
+	}
+	return *first
+}
+
+// candidate returns the font for a family name, falling back to the
+// regular face when the family lacks the requested style
+func (fr *FontRegistry) candidate(name, style string) (resolvedFont, bool) {
+	if coreFonts[strings.ToLower(name)] {
+		return resolvedFont{family: name, style: style}, true
+	}
+
+	f, exists := fr.families[strings.ToLower(name)]
+	if !exists {
+		return resolvedFont{}, false
+	}
+	face, exists := f.styles[style]
+	if !exists {
+		style = ""
+		if face, exists = f.styles[""]; !exists {
+			return resolvedFont{}, false
+		}
+	}
+	return resolvedFont{family: f.name, style: style, data: face.data}, true
+}
+
+// covers reports whether font can display every character of text
+func (fr *FontRegistry) covers(font resolvedFont, text string) bool {
+	if font.data == nil {
+		return fitsCP1252(text)
+	}
+
+	face := fr.families[strings.ToLower(font.family)].styles[font.style]
+	var buf sfnt.Buffer
+	for _, r := range text {
+		if r == ' ' || r == '\n' {
+			continue
+		}
+		index, err := face.font.GlyphIndex(&buf, r)
+		if err != nil || index == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// fitsCP1252 reports whether text can be encoded in Windows-1252
+func fitsCP1252(text string) bool {
+	for _, r := range text {
+		if _, ok := charmap.Windows1252.EncodeRune(r); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// fontNameFromFile derives the family and style from a font file name
+func fontNameFromFile(path string) (string, string) {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	lower := strings.ToLower(name)
+	for _, s := range fontStyleSuffixes {
+		if strings.HasSuffix(lower, s.suffix) {
+			return name[:len(name)-len(s.suffix)], s.style
+		}
+	}
+	return name, ""
+}
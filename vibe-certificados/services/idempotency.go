@@ -0,0 +1,229 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+	"vibe-certificados/models"
+	"vibe-certificados/storage"
+)
+
+// MaxIdempotencyKeyLength is the longest Idempotency-Key accepted
+const MaxIdempotencyKeyLength = 255
+
+var (
+	// ErrDuplicateCertificate is returned for a request matching a
+	// certificate already issued when its policy is fail
+	ErrDuplicateCertificate = errors.New("duplicate certificate")
+	// ErrIdempotencyKeyReused is returned when an idempotency key is sent
+	// again with a different request
+	ErrIdempotencyKeyReused = errors.New("idempotency key was already used for a different request")
+)
+
+// DefaultDuplicateKey are the fields of the natural key of a certificate:
+// requests agreeing on all of them are duplicates
+var DefaultDuplicateKey = []string{fieldEmail, fieldCourse, fieldCompletionDate, fieldTemplateID}
+
+// duplicateKeyFields are the fields a natural key can be made of
+var duplicateKeyFields = map[string]func(cert *models.Certificate) string{
+	fieldEmail:          func(cert *models.Certificate) string { return cert.Email },
+	fieldName:           func(cert *models.Certificate) string { return cert.Name },
+	fieldCourse:         func(cert *models.Certificate) string { return cert.Course },
+	fieldCompletionDate: func(cert *models.Certificate) string { return cert.CompletionDate.Format("2006-01-02") },
+	fieldTemplateID:     func(cert *models.Certificate) string { return cert.TemplateID },
+	fieldLocale:         func(cert *models.Certificate) string { return cert.Locale },
+}
+
+// IssueOutcome tells how IssueCertificate resolved a request
+type IssueOutcome string
+
+const (
+	IssueCreated  IssueOutcome = "created"  // a certificate was issued
+	IssueExisting IssueOutcome = "existing" // the request matched a certificate already issued
+	IssueReplayed IssueOutcome = "replayed" // the idempotency key was used before
+)
+
+// SetDuplicateKey sets the fields of the natural key used to detect
+// duplicate certificates, DefaultDuplicateKey when empty. Duplicates are
+// looked up by email, so the key must include it.
+func (cs *CertificateService) SetDuplicateKey(fields []string) error {
+	if len(fields) == 0 {
+		fields = DefaultDuplicateKey
+	}
+
+	key := make([]string, 0, len(fields))
+	for _, field := range fields {
+		field = strings.ToLower(strings.TrimSpace(field))
+		if _, ok := duplicateKeyFields[field]; !ok {
+			return errors.New("unknown duplicate key field: " + field)
+		}
+		if !slices.Contains(key, field) {
+			key = append(key, field)
+		}
+	}
+	if !slices.Contains(key, fieldEmail) {
+		return errors.New("duplicate key must include email")
+	}
+
+	cs.duplicateKey = key
+	return nil
+}
+
+// IssueCertificate creates a certificate like CreateCertificate, applying
+// the duplicate policy of the request: when it matches a valid certificate
+// already issued, skip and return_existing return that certificate instead,
+// and fail returns ErrDuplicateCertificate.
+//
+// Requests sent with an idempotency key are only issued once: repeating the
+// key returns the certificate of the first request, and using it for a
+// different request returns ErrIdempotencyKeyReused. Failed requests do not
+// use up their key.
+func (cs *CertificateService) IssueCertificate(orgID string, actor models.Actor, idempotencyKey string, req *models.CertificateRequest) (*models.Certificate, IssueOutcome, error) {
+	if len(idempotencyKey) > MaxIdempotencyKeyLength {
+		return nil, "", fmt.Errorf("idempotency key must be at most %d characters", MaxIdempotencyKeyLength)
+	}
+
+	// Looking for an earlier certificate and issuing one must not
+	// interleave with another request doing the same
+	policy := req.OnDuplicate
+	if idempotencyKey != "" || policy != "" && policy != models.DuplicateAllow {
+		cs.issueMutex.Lock()
+		defer cs.issueMutex.Unlock()
+	}
+
+	var hash string
+	if idempotencyKey != "" {
+		var err error
+		if hash, err = requestHash(req); err != nil {
+			return nil, "", err
+		}
+		record, err := cs.storage.GetIdempotencyKey(orgID, idempotencyKey)
+		switch {
+		case err == nil:
+			if record.RequestHash != hash {
+				return nil, "", ErrIdempotencyKeyReused
+			}
+			cert, err := cs.GetCertificate(orgID, record.CertificateID)
+			if err != nil {
+				return nil, "", err
+			}
+			return cert, IssueReplayed, nil
+		case !errors.Is(err, storage.ErrIdempotencyKeyNotFound):
+			return nil, "", err
+		}
+	}
+
+	cert, err := cs.ValidateCertificate(orgID, req)
+	if err != nil {
+		return nil, "", err
+	}
+
+	outcome := IssueCreated
+	existing, err := cs.findDuplicate(orgID, policy, cert)
+	switch {
+	case err != nil:
+		return nil, "", err
+	case existing != nil:
+		cert, outcome = existing, IssueExisting
+	default:
+		if err := cs.issue(orgID, actor, cert, req.SendEmail); err != nil {
+			return nil, "", err
+		}
+	}
+
+	// The certificate is issued even if its key cannot be saved; a retry
+	// would then issue another one
+	if idempotencyKey != "" {
+		record := &models.IdempotencyKey{
+			OrganizationID: orgID,
+			Key:            idempotencyKey,
+			RequestHash:    hash,
+			CertificateID:  cert.ID,
+			CreatedAt:      time.Now(),
+		}
+		if err := cs.storage.SaveIdempotencyKey(record); err != nil {
+			log.Printf("idempotency key of certificate %s not saved: %v", cert.ID, err)
+		}
+	}
+	return cert, outcome, nil
+}
+
+// findDuplicate returns the valid certificate of an organization sharing
+// the natural key of cert when policy is skip or return_existing, and fails
+// with ErrDuplicateCertificate when it is fail
+func (cs *CertificateService) findDuplicate(orgID, policy string, cert *models.Certificate) (*models.Certificate, error) {
+	if policy == "" || policy == models.DuplicateAllow {
+		return nil, nil
+	}
+	existing, err := cs.FindDuplicate(orgID, cert)
+	if err != nil || existing == nil {
+		return nil, err
+	}
+	if policy == models.DuplicateFail {
+		return nil, cs.duplicateError(existing)
+	}
+	return existing, nil
+}
+
+// duplicateError is the ErrDuplicateCertificate of a request matching
+// existing
+func (cs *CertificateService) duplicateError(existing *models.Certificate) error {
+	return fmt.Errorf("%w: same %s as certificate %s", ErrDuplicateCertificate, strings.Join(cs.duplicateKey, ", "), existing.ID)
+}
+
+// FindDuplicate returns the earliest valid certificate of an organization
+// sharing the natural key of cert, or nil. Revoked and superseded
+// certificates are not duplicates.
+func (cs *CertificateService) FindDuplicate(orgID string, cert *models.Certificate) (*models.Certificate, error) {
+	certificates, err := cs.storage.GetCertificatesByEmail(orgID, cert.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	key := cs.naturalKey(cert)
+	var duplicate *models.Certificate
+	for _, stored := range certificates {
+		if stored.ID == cert.ID || !stored.IsValid() || cs.naturalKey(stored) != key {
+			continue
+		}
+		if duplicate == nil || stored.CreatedAt.Before(duplicate.CreatedAt) {
+			duplicate = stored
+		}
+	}
+	return duplicate, nil
+}
+
+// naturalKey joins the values of the duplicate key fields of a certificate
+func (cs *CertificateService) naturalKey(cert *models.Certificate) string {
+	values := make([]string, len(cs.duplicateKey))
+	for i, field := range cs.duplicateKey {
+		values[i] = duplicateKeyFields[field](cert)
+	}
+	return strings.Join(values, "\x00")
+}
+
+// requestHash fingerprints a request to tell whether an idempotency key is
+// reused for the same request
+func requestHash(req *models.CertificateRequest) (string, error) {
+	// Maps are encoded with sorted keys, so equal requests hash equally
+	content, err := json.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// validateDuplicatePolicy checks the on_duplicate value of a request
+func validateDuplicatePolicy(policy string) error {
+	if policy != "" && !slices.Contains(models.DuplicatePolicies, policy) {
+		return errors.New("on_duplicate must be one of " + strings.Join(models.DuplicatePolicies, ", "))
+	}
+	return nil
+}
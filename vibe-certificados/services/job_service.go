@@ -0,0 +1,455 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+	"vibe-certificados/models"
+	"vibe-certificados/storage"
+
+	"github.com/google/uuid"
+)
+
+// ErrJobFinished is returned when cancelling a job that is no longer running
+var ErrJobFinished = errors.New("job has already finished")
+
+// ErrInvalidBatchFile is returned by SubmitFile for a file that cannot be
+// read, e.g. one missing required columns
+var ErrInvalidBatchFile = errors.New("invalid batch file")
+
+// How often the progress of a running job is written to storage
+const (
+	jobSaveEvery    = 100
+	jobSaveInterval = time.Second
+)
+
+// JobService issues certificate batches in the background. Rows of every
+// job are processed by a shared pool of workers, and the job record stays
+// in storage until it is expired with ExpireJob.
+type JobService struct {
+	storage     storage.Storage
+	certService *CertificateService
+
+	tasks   chan jobTask
+	workers sync.WaitGroup
+
+	mutex   sync.Mutex
+	running map[string]*jobRun
+	closed  bool
+}
+
+// jobRun is the in-memory state of a job being processed
+type jobRun struct {
+	mutex    sync.Mutex
+	job      *models.BatchJob
+	lastSave time.Time
+
+	ctx      context.Context
+	cancel   context.CancelFunc
+	pending  sync.WaitGroup // rows handed to workers and not yet recorded
+	finished chan struct{}  // closed once the final state is saved
+	readErr  error          // set by dispatch when the rows stopped early
+}
+
+// jobTask is a single row handed to a worker
+type jobTask struct {
+	run *jobRun
+	row BatchRow
+}
+
+// NewJobService creates a job service with the given number of workers.
+// Jobs left queued or running by a previous process are marked as
+// interrupted, since their remaining rows cannot be recovered.
+func NewJobService(storage storage.Storage, certService *CertificateService, workers int) *JobService {
+	if workers < 1 {
+		workers = 1
+	}
+
+	js := &JobService{
+		storage:     storage,
+		certService: certService,
+		tasks:       make(chan jobTask),
+		running:     make(map[string]*jobRun),
+	}
+	js.markInterrupted()
+
+	for i := 0; i < workers; i++ {
+		js.workers.Add(1)
+		go js.work()
+	}
+	return js
+}
+
+// SubmitFile enqueues the rows of a batch file as a new job. The file is
+// copied to a temporary file and read a row at a time, once when submitted
+// to count the rows and again as they are issued, so it is never held in
+// memory. Errors in the file itself (e.g. missing columns) are returned
+// immediately, wrapping ErrInvalidBatchFile; errors in individual rows are
+// reported in the job.
+func (js *JobService) SubmitFile(orgID string, actor models.Actor, data io.Reader, opts ImportOptions) (*models.BatchJob, error) {
+	file, err := os.CreateTemp("", "vibe-batch-*")
+	if err != nil {
+		return nil, err
+	}
+	cleanup := func() {
+		file.Close()
+		os.Remove(file.Name())
+	}
+	if _, err := io.Copy(file, data); err != nil {
+		cleanup()
+		return nil, err
+	}
+
+	total, err := countBatchRows(file, opts)
+	if err != nil {
+		cleanup()
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBatchFile, err)
+	}
+	reader, err := rewindBatchFile(file, opts)
+	if err != nil {
+		cleanup()
+		return nil, err
+	}
+	return js.submit(orgID, actor, total, reader, cleanup)
+}
+
+// countBatchRows reads a batch file from the start and returns its number
+// of rows
+func countBatchRows(file *os.File, opts ImportOptions) (int, error) {
+	reader, err := rewindBatchFile(file, opts)
+	if err != nil {
+		return 0, err
+	}
+	total := 0
+	for {
+		_, err := reader.Next()
+		if err == io.EOF {
+			return total, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		total++
+	}
+}
+
+// rewindBatchFile returns a reader of a batch file from its first row
+func rewindBatchFile(file *os.File, opts ImportOptions) (BatchReader, error) {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return NewBatchReader(file, opts)
+}
+
+// Submit enqueues parsed rows as a new job of an organization and returns
+// it in queued state. The certificates are issued on behalf of actor.
+func (js *JobService) Submit(orgID string, actor models.Actor, rows []BatchRow) (*models.BatchJob, error) {
+	return js.submit(orgID, actor, len(rows), &rowsReader{rows: rows}, func() {})
+}
+
+// rowsReader is a BatchReader of rows already parsed
+type rowsReader struct {
+	rows []BatchRow
+}
+
+func (r *rowsReader) Next() (BatchRow, error) {
+	if len(r.rows) == 0 {
+		return BatchRow{}, io.EOF
+	}
+	row := r.rows[0]
+	r.rows = r.rows[1:]
+	return row, nil
+}
+
+// submit enqueues the total rows of reader as a new job. cleanup is called
+// once the rows are no longer needed, or right away when the job cannot be
+// submitted.
+func (js *JobService) submit(orgID string, actor models.Actor, total int, reader BatchReader, cleanup func()) (*models.BatchJob, error) {
+	job := &models.BatchJob{
+		ID:             uuid.New().String(),
+		OrganizationID: orgID,
+		SubmittedBy:    actor,
+		Status:         models.JobQueued,
+		Total:          total,
+		Errors:         make([]models.RowError, 0),
+		CreatedIDs:     make([]string, 0),
+		CreatedAt:      time.Now(),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	run := &jobRun{job: job, ctx: ctx, cancel: cancel, finished: make(chan struct{})}
+
+	js.mutex.Lock()
+	defer js.mutex.Unlock()
+
+	if js.closed {
+		cancel()
+		cleanup()
+		return nil, errors.New("job service is shutting down")
+	}
+	if err := js.storage.SaveJob(job); err != nil {
+		cancel()
+		cleanup()
+		return nil, err
+	}
+	js.running[job.ID] = run
+	queued := job.Clone()
+
+	go js.dispatch(run, reader, cleanup)
+	return queued, nil
+}
+
+// GetJob returns the current state of a job of an organization. Jobs of
+// other organizations are reported as not found.
+func (js *JobService) GetJob(orgID, id string) (*models.BatchJob, error) {
+	if run := js.runningJob(id); run != nil {
+		run.mutex.Lock()
+		defer run.mutex.Unlock()
+		if run.job.OrganizationID != orgID {
+			return nil, storage.ErrJobNotFound
+		}
+		return run.job.Clone(), nil
+	}
+	return js.storedJob(orgID, id)
+}
+
+// GetAllJobs returns every job of an organization that has not been
+// expired, oldest first
+func (js *JobService) GetAllJobs(orgID string) ([]*models.BatchJob, error) {
+	stored, err := js.storage.GetAllJobs()
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make([]*models.BatchJob, 0, len(stored))
+	for _, job := range stored {
+		if job.OrganizationID != orgID {
+			continue
+		}
+		// Stored progress of running jobs may lag behind
+		if run := js.runningJob(job.ID); run != nil {
+			run.mutex.Lock()
+			job = run.job.Clone()
+			run.mutex.Unlock()
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// CancelJob stops a queued or running job. Rows already being issued are
+// completed; the remaining rows are skipped. The final state is returned.
+func (js *JobService) CancelJob(orgID, id string) (*models.BatchJob, error) {
+	if _, err := js.GetJob(orgID, id); err != nil {
+		return nil, err
+	}
+	run := js.runningJob(id)
+	if run == nil {
+		return nil, ErrJobFinished
+	}
+
+	run.cancel()
+	<-run.finished
+	return js.storage.GetJob(id)
+}
+
+// ExpireJob deletes a job record, cancelling the job first if it is still
+// running. Certificates issued by the job are kept.
+func (js *JobService) ExpireJob(orgID, id string) error {
+	if _, err := js.GetJob(orgID, id); err != nil {
+		return err
+	}
+	if run := js.runningJob(id); run != nil {
+		run.cancel()
+		<-run.finished
+	}
+	return js.storage.DeleteJob(id)
+}
+
+// storedJob reads a job of an organization from storage
+func (js *JobService) storedJob(orgID, id string) (*models.BatchJob, error) {
+	job, err := js.storage.GetJob(id)
+	if err != nil {
+		return nil, err
+	}
+	if job.OrganizationID != orgID {
+		return nil, storage.ErrJobNotFound
+	}
+	return job, nil
+}
+
+// Close stops accepting jobs, interrupts the running ones and stops the
+// workers
+func (js *JobService) Close() {
+	js.mutex.Lock()
+	if js.closed {
+		js.mutex.Unlock()
+		return
+	}
+	js.closed = true
+	runs := make([]*jobRun, 0, len(js.running))
+	for _, run := range js.running {
+		runs = append(runs, run)
+	}
+	js.mutex.Unlock()
+
+	for _, run := range runs {
+		run.cancel()
+		<-run.finished
+	}
+	close(js.tasks)
+	js.workers.Wait()
+}
+
+// runningJob returns the state of a job still being processed, or nil
+func (js *JobService) runningJob(id string) *jobRun {
+	js.mutex.Lock()
+	defer js.mutex.Unlock()
+
+	return js.running[id]
+}
+
+// dispatch reads the rows of a job and hands them to the workers, and
+// finishes the job once every row has been recorded or the job is cancelled
+func (js *JobService) dispatch(run *jobRun, reader BatchReader, cleanup func()) {
+	run.mutex.Lock()
+	now := time.Now()
+	run.job.Status = models.JobRunning
+	run.job.StartedAt = &now
+	js.save(run)
+	run.mutex.Unlock()
+
+enqueue:
+	for {
+		row, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// The file was read in full when it was submitted
+			log.Printf("job %s: failed to read rows: %v", run.job.ID, err)
+			run.readErr = err
+			break
+		}
+
+		run.pending.Add(1)
+		select {
+		case js.tasks <- jobTask{run: run, row: row}:
+		case <-run.ctx.Done():
+			run.pending.Done()
+			break enqueue
+		}
+	}
+	cleanup()
+	run.pending.Wait()
+
+	js.finish(run)
+}
+
+// work issues rows until the service is closed
+func (js *JobService) work() {
+	defer js.workers.Done()
+
+	for task := range js.tasks {
+		if task.run.ctx.Err() == nil {
+			cert, outcome, err := js.certService.IssueBatchRow(task.run.job.OrganizationID, task.run.job.SubmittedBy, task.row)
+			js.record(task.run, task.row, cert, outcome, err)
+		}
+		task.run.pending.Done()
+	}
+}
+
+// record updates the job progress with the outcome of a row
+func (js *JobService) record(run *jobRun, row BatchRow, cert *models.Certificate, outcome IssueOutcome, err error) {
+	run.mutex.Lock()
+	defer run.mutex.Unlock()
+
+	job := run.job
+	job.Processed++
+	if err != nil {
+		job.Failed++
+		rowError := models.RowError{Row: row.Row, Error: err.Error()}
+		var validation *ValidationError
+		if errors.As(err, &validation) {
+			rowError.Fields = validation.Fields
+		}
+		job.Errors = append(job.Errors, rowError)
+	} else if outcome == IssueExisting {
+		job.Skipped++
+		if row.Request.OnDuplicate == models.DuplicateReturnExisting {
+			job.ExistingIDs = append(job.ExistingIDs, cert.ID)
+		}
+	} else {
+		job.Succeeded++
+		job.CreatedIDs = append(job.CreatedIDs, cert.ID)
+	}
+
+	if job.Processed%jobSaveEvery == 0 || time.Since(run.lastSave) >= jobSaveInterval {
+		js.save(run)
+	}
+}
+
+// finish records the final state of a job and forgets its in-memory state
+func (js *JobService) finish(run *jobRun) {
+	js.mutex.Lock()
+	closing := js.closed
+	js.mutex.Unlock()
+
+	run.mutex.Lock()
+	now := time.Now()
+	job := run.job
+	job.FinishedAt = &now
+	switch {
+	case job.Processed == job.Total:
+		job.Status = models.JobCompleted
+	case closing || run.readErr != nil:
+		job.Status = models.JobInterrupted
+	default:
+		job.Status = models.JobCancelled
+	}
+	job.SortErrors()
+	js.save(run)
+	run.mutex.Unlock()
+
+	run.cancel()
+
+	js.mutex.Lock()
+	delete(js.running, job.ID)
+	js.mutex.Unlock()
+	close(run.finished)
+}
+
+// save writes the job to storage. The caller must hold run.mutex.
+func (js *JobService) save(run *jobRun) {
+	run.lastSave = time.Now()
+	if err := js.storage.SaveJob(run.job); err != nil {
+		log.Printf("failed to save job %s: %v", run.job.ID, err)
+	}
+}
+
+// markInterrupted flags jobs that were still in progress when the previous
+// process stopped
+func (js *JobService) markInterrupted() {
+	jobs, err := js.storage.GetAllJobs()
+	if err != nil {
+		log.Printf("failed to load jobs: %v", err)
+		return
+	}
+
+	for _, job := range jobs {
+		if job.IsFinished() {
+			continue
+		}
+		now := time.Now()
+		job.Status = models.JobInterrupted
+		job.FinishedAt = &now
+		if err := js.storage.SaveJob(job); err != nil {
+			log.Printf("failed to save job %s: %v", job.ID, err)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// JSONLReader reads certificate requests from a JSON Lines file, one object
+// per line. Keys other than the request fields are kept in the request
+// Data, as are the entries of a "data" object.
+type JSONLReader struct {
+	reader  *bufio.Reader
+	targets map[string]string
+	opts    ImportOptions
+	line    int
+}
+
+// NewJSONLReader reads a JSON Lines file. Mapping renames the keys of its
+// objects like the columns of a CSV file.
+func NewJSONLReader(data io.Reader, opts ImportOptions) (*JSONLReader, error) {
+	return &JSONLReader{reader: skipBOM(data), targets: columnTargets(opts.Mapping), opts: opts}, nil
+}
+
+// Next returns the request of the next line, or io.EOF after the last one.
+// Rows are numbered by line, blank lines being skipped.
+func (r *JSONLReader) Next() (BatchRow, error) {
+	for {
+		line, err := r.reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return BatchRow{}, errors.New("failed to read JSON Lines: " + err.Error())
+		}
+		if len(line) == 0 && err == io.EOF {
+			return BatchRow{}, io.EOF
+		}
+
+		r.line++
+		if len(bytes.TrimSpace(line)) > 0 {
+			return r.row(line), nil
+		}
+	}
+}
+
+// row turns a line into a request
+func (r *JSONLReader) row(line []byte) BatchRow {
+	row := BatchRow{Row: r.line}
+
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(line, &object); err != nil || object == nil {
+		row.Err = errors.New("line is not a JSON object")
+		return row
+	}
+
+	req := newBatchRequest(r.opts)
+	seen := make(map[batchColumn]bool)
+	for _, key := range slices.Sorted(maps.Keys(object)) {
+		value := object[key]
+
+		if _, mapped := r.targets[strings.ToLower(key)]; !mapped && strings.EqualFold(key, "data") {
+			var data map[string]json.RawMessage
+			if err := json.Unmarshal(value, &data); err != nil {
+				row.Err = errors.New("data must be a JSON object")
+				return row
+			}
+			for _, dataKey := range slices.Sorted(maps.Keys(data)) {
+				text, err := jsonText(data[dataKey])
+				if err != nil {
+					row.Err = fmt.Errorf("data.%s %v", dataKey, err)
+					return row
+				}
+				setColumn(req, batchColumn{key: dataKey}, text)
+			}
+			continue
+		}
+
+		column, ok := resolveColumn(key, r.targets)
+		if !ok {
+			continue
+		}
+		if seen[column] {
+			row.Err = fmt.Errorf("more than one %s value", column.field+column.key)
+			return row
+		}
+		seen[column] = true
+
+		text, err := jsonText(value)
+		if err != nil {
+			row.Err = fmt.Errorf("%s %v", key, err)
+			return row
+		}
+		setColumn(req, column, text)
+	}
+
+	row.Request = req
+	row.Err = checkRequired(req)
+	return row
+}
+
+// jsonText returns a JSON scalar as the text kept in a request; null is
+// empty
+func jsonText(value json.RawMessage) (string, error) {
+	decoder := json.NewDecoder(bytes.NewReader(value))
+	decoder.UseNumber()
+
+	var v any
+	if err := decoder.Decode(&v); err != nil {
+		return "", err
+	}
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	}
+	return "", errors.New("must be a string, number or boolean")
+}
@@ -0,0 +1,191 @@
+package services
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+	"vibe-certificados/models"
+
+	"golang.org/x/text/language"
+)
+
+// DefaultLocale is used when neither the certificate nor its template
+// choose a locale
+const DefaultLocale = "pt-BR"
+
+// catalogFiles are the message catalogs shipped with the service, one
+// JSON file per locale named after its BCP 47 tag
+//
+//go:embed locales/*.json
+var catalogFiles embed.FS
+
+// locale holds the messages and the names and separators used to format
+// dates, numbers and durations in one language
+type locale struct {
+	Tag           string
+	Months        [12]string        `json:"months"`
+	ShortMonths   [12]string        `json:"short_months"`
+	Weekdays      [7]string         `json:"weekdays"` // starting on Sunday, like time.Weekday
+	ShortWeekdays [7]string         `json:"short_weekdays"`
+	DecimalSep    string            `json:"decimal_separator"`
+	ThousandsSep  string            `json:"thousands_separator"`
+	Hour          string            `json:"hour"`
+	Hours         string            `json:"hours"`
+	DateLayouts   map[string]string `json:"date_layouts"` // short, medium, long, datetime and timestamp
+	Messages      map[string]string `json:"messages"`
+}
+
+var (
+	// locales are the supported languages, keyed by tag
+	locales = mustLoadCatalogs()
+
+	// supportedLocales lists the tags with DefaultLocale first, which is
+	// the order expected by localeMatcher
+	supportedLocales = sortedLocaleTags()
+
+	localeMatcher = newLocaleMatcher()
+)
+
+// mustLoadCatalogs parses the embedded catalogs. They are part of the
+// build, so a broken catalog is a programming error.
+func mustLoadCatalogs() map[string]*locale {
+	files, err := catalogFiles.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+
+	catalogs := make(map[string]*locale)
+	for _, file := range files {
+		data, err := catalogFiles.ReadFile(path.Join("locales", file.Name()))
+		if err != nil {
+			panic(err)
+		}
+		loc := &locale{Tag: strings.TrimSuffix(file.Name(), ".json")}
+		if err := json.Unmarshal(data, loc); err != nil {
+			panic(fmt.Sprintf("invalid message catalog %s: %v", file.Name(), err))
+		}
+		catalogs[loc.Tag] = loc
+	}
+	if catalogs[DefaultLocale] == nil {
+		panic("missing message catalog for " + DefaultLocale)
+	}
+	return catalogs
+}
+
+// sortedLocaleTags returns the supported tags, DefaultLocale first
+func sortedLocaleTags() []string {
+	tags := make([]string, 0, len(locales))
+	for tag := range locales {
+		if tag != DefaultLocale {
+			tags = append(tags, tag)
+		}
+	}
+	sort.Strings(tags)
+	return append([]string{DefaultLocale}, tags...)
+}
+
+// newLocaleMatcher matches language preferences against supportedLocales
+func newLocaleMatcher() language.Matcher {
+	tags := make([]language.Tag, len(supportedLocales))
+	for i, tag := range supportedLocales {
+		tags[i] = language.MustParse(tag)
+	}
+	return language.NewMatcher(tags)
+}
+
+// SupportedLocales lists the locales certificates can be rendered in
+func SupportedLocales() []string {
+	return append([]string{}, supportedLocales...)
+}
+
+// IsSupportedLocale reports whether tag names a shipped catalog exactly
+func IsSupportedLocale(tag string) bool {
+	return locales[tag] != nil
+}
+
+// MatchLocale returns the supported locale closest to an Accept-Language
+// value or a single tag ("en-US" selects en, "pt" selects pt-BR), or ""
+// when none of the preferred languages is supported
+func MatchLocale(preferences string) string {
+	tags, _, err := language.ParseAcceptLanguage(preferences)
+	if err != nil || len(tags) == 0 {
+		return ""
+	}
+	_, index, confidence := localeMatcher.Match(tags...)
+	if confidence == language.No {
+		return ""
+	}
+	return supportedLocales[index]
+}
+
+// validateLocale rejects locales without a catalog; empty selects the default
+func validateLocale(tag string) error {
+	if tag != "" && !IsSupportedLocale(tag) {
+		return fmt.Errorf("unsupported locale %q, supported locales: %s", tag, strings.Join(supportedLocales, ", "))
+	}
+	return nil
+}
+
+// localeFor returns the locale for tag, or the default locale when the tag
+// is not supported
+func localeFor(tag string) *locale {
+	if loc, ok := locales[tag]; ok {
+		return loc
+	}
+	return locales[DefaultLocale]
+}
+
+// certificateLocale picks the locale a certificate is rendered in: the
+// certificate's own, then its template's, then the default
+func certificateLocale(tmpl *models.Template, cert *models.Certificate) *locale {
+	if IsSupportedLocale(cert.Locale) {
+		return locales[cert.Locale]
+	}
+	if tmpl != nil && IsSupportedLocale(tmpl.Locale) {
+		return locales[tmpl.Locale]
+	}
+	return locales[DefaultLocale]
+}
+
+// message returns the catalog message for key formatted with args, falling
+// back to the default locale and then to the key itself, unformatted
+func (loc *locale) message(key string, args ...interface{}) string {
+	text, ok := loc.Messages[key]
+	if !ok {
+		if text, ok = locales[DefaultLocale].Messages[key]; !ok {
+			return key
+		}
+	}
+	if len(args) == 0 {
+		return text
+	}
+	return fmt.Sprintf(text, args...)
+}
+
+// certificateData returns the template data of a certificate with its
+// dates formatted for loc
+func certificateData(cert *models.Certificate, loc *locale) map[string]interface{} {
+	data := cert.GetAllData()
+	data["CompletionDate"] = formatLocalDate(cert.CompletionDate, "short", loc)
+	data["CompletionDateLong"] = formatLocalDate(cert.CompletionDate, "long", loc)
+	data["CreatedAt"] = formatLocalDate(cert.CreatedAt, "timestamp", loc)
+	if cert.RevokedAt != nil {
+		data["RevokedAt"] = formatLocalDate(*cert.RevokedAt, "timestamp", loc)
+	}
+	data["Locale"] = loc.Tag
+	return data
+}
+
+// parseLocalDate parses the dates written by certificateData for loc
+func parseLocalDate(text string, loc *locale) (time.Time, bool) {
+	for _, style := range []string{"timestamp", "short"} {
+		if t, err := time.Parse(loc.DateLayouts[style], text); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,180 @@
+package services
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Mailer delivers email messages
+type Mailer interface {
+	Send(msg *EmailMessage) error
+}
+
+// EmailMessage is a plain text email with optional attachments
+type EmailMessage struct {
+	To          string
+	Subject     string
+	Body        string
+	Attachments []EmailAttachment
+}
+
+// EmailAttachment is a file attached to an email
+type EmailAttachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// SMTPMailer sends email through an SMTP server. STARTTLS is used when the
+// server supports it; authentication is skipped when Username is empty.
+type SMTPMailer struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+// NewSMTPMailer creates a mailer for the SMTP server at host:port
+func NewSMTPMailer(host string, port int, username, password, from string) (*SMTPMailer, error) {
+	if host == "" {
+		return nil, errors.New("smtp host is required")
+	}
+	if _, err := mail.ParseAddress(from); err != nil {
+		return nil, fmt.Errorf("invalid from address: %v", err)
+	}
+	return &SMTPMailer{Host: host, Port: port, Username: username, Password: password, From: from}, nil
+}
+
+// Send delivers msg through the SMTP server
+func (sm *SMTPMailer) Send(msg *EmailMessage) error {
+	data, err := buildEmail(sm.From, msg)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if sm.Username != "" {
+		auth = smtp.PlainAuth("", sm.Username, sm.Password, sm.Host)
+	}
+	from, _ := mail.ParseAddress(sm.From)
+	to, _ := mail.ParseAddress(msg.To)
+
+	addr := sm.Host + ":" + strconv.Itoa(sm.Port)
+	return smtp.SendMail(addr, auth, from.Address, []string{to.Address}, data)
+}
+
+// FileMailer writes each email as an .eml file in a directory instead of
+// sending it, for local development and tests
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+// NewFileMailer creates a mailer that drops messages in dir
+func NewFileMailer(dir, from string) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create mail directory: %v", err)
+	}
+	return &FileMailer{Dir: dir, From: from}, nil
+}
+
+// Send writes msg to a new file in the mail directory
+func (fm *FileMailer) Send(msg *EmailMessage) error {
+	data, err := buildEmail(fm.From, msg)
+	if err != nil {
+		return err
+	}
+
+	name := time.Now().Format("20060102-150405") + "-" + uuid.New().String()[:8] + ".eml"
+	return os.WriteFile(filepath.Join(fm.Dir, name), data, 0o644)
+}
+
+// buildEmail encodes msg as a MIME message: a quoted-printable text part
+// followed by base64 attachments
+func buildEmail(from string, msg *EmailMessage) ([]byte, error) {
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recipient address: %v", err)
+	}
+
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+
+	// Rendered subjects may contain line breaks, which would end the header
+	subject := strings.Join(strings.Fields(msg.Subject), " ")
+
+	headers := []string{
+		"From: " + from,
+		"To: " + to.String(),
+		"Subject: " + mime.QEncoding.Encode("utf-8", subject),
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: multipart/mixed; boundary=" + writer.Boundary(),
+	}
+	buf.WriteString(strings.Join(headers, "\r\n") + "\r\n\r\n")
+
+	text, err := writer.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	qp := quotedprintable.NewWriter(text)
+	if _, err := qp.Write([]byte(msg.Body)); err != nil {
+		return nil, err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+
+	for _, attachment := range msg.Attachments {
+		part, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {attachment.ContentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename})},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeBase64Lines(part, attachment.Data); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeBase64Lines writes data base64 encoded in 76 character lines, as
+// required for MIME bodies
+func writeBase64Lines(w io.Writer, data []byte) error {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 0 {
+		n := min(76, len(encoded))
+		if _, err := w.Write([]byte(encoded[:n] + "\r\n")); err != nil {
+			return err
+		}
+		encoded = encoded[n:]
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"vibe-certificados/models"
+	"vibe-certificados/storage"
+)
+
+// Errors returned when an organization cannot be created
+var (
+	ErrInvalidOrganizationID   = errors.New("organization id must be a lowercase slug of letters, digits and '-'")
+	ErrOrganizationNameMissing = errors.New("organization name is required")
+	ErrOrganizationExists      = errors.New("organization already exists")
+)
+
+var validOrganizationID = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{1,62}$`)
+
+// OrganizationService manages the tenants of the service and resolves the
+// organization of API keys
+type OrganizationService struct {
+	storage         storage.Storage
+	templateService *TemplateService
+	mutex           sync.Mutex // serialises organization creation
+}
+
+// NewOrganizationService creates an organization service. The default
+// organization, which owns the data stored before organizations existed,
+// is created if missing.
+func NewOrganizationService(storage storage.Storage, templateService *TemplateService) *OrganizationService {
+	orgs := &OrganizationService{
+		storage:         storage,
+		templateService: templateService,
+	}
+	orgs.ensureDefaultOrganization()
+	return orgs
+}
+
+// ensureDefaultOrganization stores the default organization unless the
+// storage already holds it
+func (orgs *OrganizationService) ensureDefaultOrganization() {
+	if _, err := orgs.storage.GetOrganization(models.DefaultOrganizationID); err == nil {
+		return
+	}
+
+	org := &models.Organization{
+		ID:        models.DefaultOrganizationID,
+		Name:      "Default organization",
+		CreatedAt: time.Now(),
+	}
+	if err := orgs.storage.SaveOrganization(org); err != nil {
+		log.Printf("failed to create the default organization: %v", err)
+	}
+}
+
+// CreateOrganization creates an organization with its own default template
+// and a first API key, whose plaintext is only returned here
+func (orgs *OrganizationService) CreateOrganization(req *models.CreateOrganizationRequest) (*models.CreatedOrganization, error) {
+	id := strings.TrimSpace(req.ID)
+	if !validOrganizationID.MatchString(id) {
+		return nil, ErrInvalidOrganizationID
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, ErrOrganizationNameMissing
+	}
+
+	orgs.mutex.Lock()
+	defer orgs.mutex.Unlock()
+
+	if _, err := orgs.storage.GetOrganization(id); err == nil {
+		return nil, ErrOrganizationExists
+	} else if !errors.Is(err, storage.ErrOrganizationNotFound) {
+		return nil, err
+	}
+
+	org := &models.Organization{ID: id, Name: name, CreatedAt: time.Now()}
+	if err := orgs.storage.SaveOrganization(org); err != nil {
+		return nil, err
+	}
+	if err := orgs.templateService.EnsureDefaultTemplate(id); err != nil {
+		return nil, err
+	}
+
+	key, err := orgs.createAPIKey(id, "admin", models.RoleAdmin)
+	if err != nil {
+		return nil, err
+	}
+	return &models.CreatedOrganization{Organization: org, APIKey: key.Key}, nil
+}
+
+// GetOrganization retrieves an organization by ID
+func (orgs *OrganizationService) GetOrganization(id string) (*models.Organization, error) {
+	return orgs.storage.GetOrganization(id)
+}
+
+// GetAllOrganizations retrieves all organizations
+func (orgs *OrganizationService) GetAllOrganizations() ([]*models.Organization, error) {
+	return orgs.storage.GetAllOrganizations()
+}
+
+// OrganizationPath returns the API path prefix of an organization. The
+// default organization is also served without a prefix.
+func OrganizationPath(orgID string) string {
+	if orgID == "" || orgID == models.DefaultOrganizationID {
+		return "/api"
+	}
+	return "/api/orgs/" + url.PathEscape(orgID)
+}
@@ -0,0 +1,314 @@
+package services
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"vibe-certificados/models"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// Page margin used for blocks that span the page width
+const pdfPageMargin = 20.0
+
+// DefaultPDFLayout returns the layout of the default template, which
+// reproduces the original certificate with its phrases taken from the
+// message catalog of the certificate's locale
+func DefaultPDFLayout() *models.PDFLayout {
+	return &models.PDFLayout{
+		Orientation: "L",
+		PageSize:    "A4",
+		Blocks: []models.PDFTextBlock{
+			{Text: `{{t "certificate.title"}}`, Y: 40, Height: 15, Style: "B", Size: 30},
+			{Text: `{{t "certificate.certify_that"}}`, Y: 70, Height: 10, Size: 16},
+			{Text: "{{.Name}}", Y: 95, Height: 12, Style: "B", Size: 24},
+			{Text: `{{t "certificate.completed_course"}}`, Y: 125, Height: 10, Size: 18},
+			{Text: "{{.Course}}", Y: 150, Height: 10, Style: "B", Size: 20},
+			{Text: `{{t "certificate.completed_on" .CompletionDateLong}}`, Y: 175, Height: 8, Size: 14},
+		},
+	}
+}
+
+// ValidatePDFLayout checks a layout before it is stored with a template
+func ValidatePDFLayout(layout *models.PDFLayout) error {
+	if layout == nil {
+		return nil
+	}
+
+	if layout.Orientation != "" && layout.Orientation != "L" && layout.Orientation != "P" {
+		return errors.New("pdf_layout.orientation must be L or P")
+	}
+	if layout.PageSize != "" && !validPageSizes[layout.PageSize] {
+		return errors.New("pdf_layout.page_size must be one of A3, A4, A5, Letter, Legal")
+	}
+	if _, err := parseHexColor(layout.BackgroundColor); err != nil {
+		return fmt.Errorf("pdf_layout.background_color: %v", err)
+	}
+	if layout.BackgroundImage != "" {
+		if _, _, err := decodeImageDataURI(layout.BackgroundImage); err != nil {
+			return fmt.Errorf("pdf_layout.background_image: %v", err)
+		}
+	}
+	if layout.BackgroundAsset != "" && !validAssetName.MatchString(layout.BackgroundAsset) {
+		return errors.New("pdf_layout.background_asset is not a valid asset name")
+	}
+	if layout.Border != nil {
+		if _, err := parseHexColor(layout.Border.Color); err != nil {
+			return fmt.Errorf("pdf_layout.border.color: %v", err)
+		}
+	}
+
+	for i, font := range layout.Fonts {
+		if !validFontName.MatchString(font) {
+			return fmt.Errorf("pdf_layout.fonts[%d] is not a valid font name", i)
+		}
+	}
+
+	for i, image := range layout.Images {
+		prefix := fmt.Sprintf("pdf_layout.images[%d]", i)
+		if !validAssetName.MatchString(image.Asset) {
+			return fmt.Errorf("%s.asset is not a valid asset name", prefix)
+		}
+		if image.Width < 0 || image.Height < 0 {
+			return fmt.Errorf("%s width and height must not be negative", prefix)
+		}
+	}
+
+	for i, block := range layout.Blocks {
+		prefix := fmt.Sprintf("pdf_layout.blocks[%d]", i)
+		if _, err := parseTextTemplate("block", block.Text, localeFor(DefaultLocale)); err != nil {
+			return fmt.Errorf("%s.text: %v", prefix, err)
+		}
+		if block.Font != "" && !validFontName.MatchString(block.Font) {
+			return fmt.Errorf("%s.font must be a core font (Arial, Helvetica, Times, Courier) or a font file name", prefix)
+		}
+		if !validStyles[strings.ToUpper(block.Style)] {
+			return fmt.Errorf("%s.style must be empty, B, I or BI", prefix)
+		}
+		if block.Align != "" && block.Align != "L" && block.Align != "C" && block.Align != "R" {
+			return fmt.Errorf("%s.align must be L, C or R", prefix)
+		}
+		if _, err := parseHexColor(block.Color); err != nil {
+			return fmt.Errorf("%s.color: %v", prefix, err)
+		}
+	}
+
+	return nil
+}
+
+var validPageSizes = map[string]bool{"A3": true, "A4": true, "A5": true, "Letter": true, "Legal": true}
+var validStyles = map[string]bool{"": true, "B": true, "I": true, "BI": true, "IB": true}
+
+// validFontName matches core font names and TrueType family names, which
+// come from file names in the fonts directory (e.g. "DejaVuSans")
+var validFontName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// newLayoutPDF creates a document with the page format of the layout
+func newLayoutPDF(layout *models.PDFLayout) *gofpdf.Fpdf {
+	orientation := layout.Orientation
+	if orientation == "" {
+		orientation = "L"
+	}
+	pageSize := layout.PageSize
+	if pageSize == "" {
+		pageSize = "A4"
+	}
+	return gofpdf.New(orientation, "mm", pageSize, "")
+}
+
+// drawLayout draws the page decoration, the images and the text blocks of
+// the layout of a template
+func (ps *PDFService) drawLayout(pdf *gofpdf.Fpdf, tmpl *models.Template, layout *models.PDFLayout, data map[string]interface{}, loc *locale) error {
+	pageWidth, pageHeight := pdf.GetPageSize()
+
+	if layout.BackgroundColor != "" {
+		r, g, b := mustHexColor(layout.BackgroundColor)
+		pdf.SetFillColor(r, g, b)
+		pdf.Rect(0, 0, pageWidth, pageHeight, "F")
+	}
+
+	if layout.BackgroundImage != "" {
+		imageType, image, err := decodeImageDataURI(layout.BackgroundImage)
+		if err != nil {
+			return fmt.Errorf("invalid background image: %v", err)
+		}
+		options := gofpdf.ImageOptions{ImageType: imageType}
+		pdf.RegisterImageOptionsReader("background", options, bytes.NewReader(image))
+		pdf.ImageOptions("background", 0, 0, pageWidth, pageHeight, false, options, 0, "")
+	}
+	if layout.BackgroundAsset != "" {
+		if name, options, ok := ps.registerAsset(pdf, tmpl, layout.BackgroundAsset); ok {
+			pdf.ImageOptions(name, 0, 0, pageWidth, pageHeight, false, options, 0, "")
+		}
+	}
+
+	if border := layout.Border; border != nil && border.Width > 0 {
+		r, g, b := mustHexColor(border.Color)
+		pdf.SetDrawColor(r, g, b)
+		pdf.SetLineWidth(border.Width)
+		pdf.Rect(border.Margin, border.Margin, pageWidth-2*border.Margin, pageHeight-2*border.Margin, "D")
+		pdf.SetDrawColor(0, 0, 0)
+	}
+
+	for _, image := range layout.Images {
+		if name, options, ok := ps.registerAsset(pdf, tmpl, image.Asset); ok {
+			pdf.ImageOptions(name, image.X, image.Y, image.Width, image.Height, false, options, 0, "")
+		}
+	}
+
+	for i, block := range layout.Blocks {
+		text, err := renderBlockText(block.Text, data, loc)
+		if err != nil {
+			return fmt.Errorf("block %d: %v", i, err)
+		}
+		ps.drawTextBlock(pdf, block, layout.Fonts, text)
+	}
+
+	pdf.SetTextColor(0, 0, 0)
+	return nil
+}
+
+// registerAsset loads a template asset into the document. Missing assets
+// and formats gofpdf cannot draw (WebP) are skipped, like missing images
+// in the HTML rendering.
+func (ps *PDFService) registerAsset(pdf *gofpdf.Fpdf, tmpl *models.Template, name string) (string, gofpdf.ImageOptions, bool) {
+	options := gofpdf.ImageOptions{}
+	templateID := tmpl.ID
+	asset, err := ps.templateService.GetAsset(tmpl.OrganizationID, templateID, name)
+	if err != nil {
+		log.Printf("PDF of template %s: skipping asset %s: %v", templateID, name, err)
+		return "", options, false
+	}
+	options.ImageType = pdfImageTypes[asset.ContentType]
+	if options.ImageType == "" {
+		log.Printf("PDF of template %s: skipping asset %s: %s is not supported", templateID, name, asset.ContentType)
+		return "", options, false
+	}
+
+	imageName := "asset:" + name
+	if info := pdf.GetImageInfo(imageName); info == nil {
+		pdf.RegisterImageOptionsReader(imageName, options, bytes.NewReader(asset.Data))
+		if pdf.Err() {
+			// e.g. interlaced PNGs, which gofpdf does not read
+			log.Printf("PDF of template %s: skipping asset %s: %v", templateID, name, pdf.Error())
+			pdf.ClearError()
+			return "", options, false
+		}
+	}
+	return imageName, options, true
+}
+
+// drawTextBlock writes a single block with its font, color and alignment.
+// The block font is tried first, then the template fallback fonts.
+func (ps *PDFService) drawTextBlock(pdf *gofpdf.Fpdf, block models.PDFTextBlock, fallback []string, text string) {
+	font := block.Font
+	if font == "" {
+		font = "Arial"
+	}
+	style := strings.ToUpper(block.Style)
+	if style == "IB" {
+		style = "BI"
+	}
+	size := block.Size
+	if size == 0 {
+		size = 14
+	}
+	height := block.Height
+	if height == 0 {
+		height = size * 0.5
+	}
+	align := block.Align
+	if align == "" {
+		align = "C"
+	}
+
+	text = ps.setFont(pdf, append([]string{font}, fallback...), style, size, text)
+	r, g, b := mustHexColor(block.Color)
+	pdf.SetTextColor(r, g, b)
+
+	// Width 0 means "up to the right margin", starting at the left margin
+	x := block.X
+	if block.Width == 0 {
+		x = pdfPageMargin
+	}
+	pdf.SetXY(x, block.Y)
+
+	if block.Multiline {
+		pdf.MultiCell(block.Width, height, text, "", align, false)
+	} else {
+		pdf.CellFormat(block.Width, height, text, "", 1, align, false, 0, "")
+	}
+}
+
+// renderBlockText evaluates the template expression of a text block
+func renderBlockText(text string, data map[string]interface{}, loc *locale) (string, error) {
+	t, err := parseTextTemplate("block", text, loc)
+	if err != nil {
+		return "", err
+	}
+
+	rendered, err := executeTemplate(t, data)
+	if err != nil {
+		return "", err
+	}
+	return strings.ReplaceAll(rendered, "<no value>", ""), nil
+}
+
+// parseHexColor parses "#rrggbb" (or "rrggbb"); an empty string is black
+func parseHexColor(color string) ([3]int, error) {
+	var rgb [3]int
+	if color == "" {
+		return rgb, nil
+	}
+
+	hex := strings.TrimPrefix(color, "#")
+	if len(hex) != 6 {
+		return rgb, errors.New("color must be in #rrggbb format")
+	}
+	for i := 0; i < 3; i++ {
+		value, err := strconv.ParseUint(hex[i*2:i*2+2], 16, 8)
+		if err != nil {
+			return rgb, errors.New("color must be in #rrggbb format")
+		}
+		rgb[i] = int(value)
+	}
+	return rgb, nil
+}
+
+// mustHexColor returns the components of a color validated by
+// ValidatePDFLayout, falling back to black
+func mustHexColor(color string) (int, int, int) {
+	rgb, _ := parseHexColor(color)
+	return rgb[0], rgb[1], rgb[2]
+}
+
+// decodeImageDataURI decodes a base64 PNG or JPEG data URI and returns the
+// gofpdf image type with the image bytes
+func decodeImageDataURI(uri string) (string, []byte, error) {
+	header, payload, found := strings.Cut(uri, ",")
+	if !found || !strings.HasPrefix(header, "data:") || !strings.HasSuffix(header, ";base64") {
+		return "", nil, errors.New("image must be a base64 data URI")
+	}
+
+	var imageType string
+	switch strings.TrimSuffix(strings.TrimPrefix(header, "data:"), ";base64") {
+	case "image/png":
+		imageType = "PNG"
+	case "image/jpeg", "image/jpg":
+		imageType = "JPG"
+	default:
+		return "", nil, errors.New("image must be PNG or JPEG")
+	}
+
+	image, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return "", nil, errors.New("image is not valid base64")
+	}
+	return imageType, image, nil
+}
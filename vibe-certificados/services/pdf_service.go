@@ -6,105 +6,160 @@ import (
 	"os/exec"
 	"strings"
 	"vibe-certificados/models"
+
 	"github.com/jung-kurt/gofpdf"
+	"golang.org/x/text/encoding/charmap"
 )
 
 // PDFService handles PDF generation from HTML
 type PDFService struct {
 	templateService *TemplateService
+	fonts           *FontRegistry
 }
 
 // NewPDFService creates a new PDF service
 func NewPDFService(templateService *TemplateService) *PDFService {
 	return &PDFService{
 		templateService: templateService,
+		fonts:           NewFontRegistry(),
 	}
 }
 
-// GeneratePDF generates a PDF from a certificate using gofpdf
+// SetFontRegistry sets the TrueType fonts used for text that the core
+// PDF fonts cannot display
+func (ps *PDFService) SetFontRegistry(fonts *FontRegistry) {
+	ps.fonts = fonts
+}
+
+// GeneratePDF generates a PDF from a certificate using gofpdf, following
+// the PDF layout of the certificate's template
 func (ps *PDFService) GeneratePDF(cert *models.Certificate) ([]byte, error) {
-	// Create a new PDF in landscape orientation, A4 size
-	pdf := gofpdf.New("L", "mm", "A4", "")
-	
+	tmpl, err := ps.templateService.TemplateFor(cert)
+	if err != nil {
+		return nil, err
+	}
+	return ps.renderPDF(tmpl, cert)
+}
+
+// PreviewPDF generates the PDF of tmpl, which does not need to be saved,
+// for a sample certificate
+func (ps *PDFService) PreviewPDF(tmpl *models.Template, cert *models.Certificate) ([]byte, error) {
+	if err := ps.templateService.validate(tmpl); err != nil {
+		return nil, err
+	}
+	return ps.renderPDF(tmpl, cert)
+}
+
+// renderPDF draws a certificate with the PDF layout of tmpl
+func (ps *PDFService) renderPDF(tmpl *models.Template, cert *models.Certificate) ([]byte, error) {
+	layout := layoutOf(tmpl)
+	loc := certificateLocale(tmpl, cert)
+
+	// Create a new PDF with the page format of the layout
+	pdf := newLayoutPDF(layout)
+
 	// Add a page
 	pdf.AddPage()
-	
+
 	// Set margins
-	pdf.SetMargins(20, 20, 20)
-	
-	// Add Portuguese content with character conversion
-	ps.addPortugueseCertificateContent(pdf, cert)
-	
+	pdf.SetMargins(pdfPageMargin, pdfPageMargin, pdfPageMargin)
+
+	// The layout is absolutely positioned on a single page; footer lines
+	// near the bottom edge must not spill onto a second page
+	pdf.SetAutoPageBreak(false, 0)
+
+	// Draw the template layout with the certificate data
+	if err := ps.drawLayout(pdf, tmpl, layout, certificateData(cert, loc), loc); err != nil {
+		return nil, err
+	}
+
+	// Mark certificates that are no longer valid
+	ps.addStatusWatermark(pdf, cert, loc)
+
+	// Signature and link to the public verification page
+	ps.addVerificationFooter(pdf, cert, loc)
+	if err := ps.addQRCode(pdf, cert, layout.QRCode); err != nil {
+		return nil, err
+	}
+
 	// Check for errors
 	if pdf.Error() != nil {
 		return nil, fmt.Errorf("PDF generation error: %v", pdf.Error())
 	}
-	
+
 	// Generate PDF as bytes
 	var buf bytes.Buffer
-	err := pdf.Output(&buf)
-	if err != nil {
+	if err := pdf.Output(&buf); err != nil {
 		return nil, fmt.Errorf("failed to generate PDF: %v", err)
 	}
-	
+
 	return buf.Bytes(), nil
 }
 
+// layoutOf returns the PDF layout of a template. Templates created before
+// layouts existed use the default layout.
+func layoutOf(tmpl *models.Template) *models.PDFLayout {
+	if tmpl.PDFLayout == nil {
+		return DefaultPDFLayout()
+	}
+	return tmpl.PDFLayout
+}
+
 // addCertificateContent adds the certificate content to the PDF
 func (ps *PDFService) addCertificateContent(pdf *gofpdf.Fpdf, cert *models.Certificate) error {
 	// Check for errors
 	if pdf.Error() != nil {
 		return fmt.Errorf("PDF error before content: %v", pdf.Error())
 	}
-	
+
 	// Set font for the title
 	pdf.SetFont("Arial", "B", 28)
 	if pdf.Error() != nil {
 		return fmt.Errorf("Failed to set title font: %v", pdf.Error())
 	}
-	
+
 	// Add title
 	pdf.CellFormat(0, 20, "CERTIFICADO DE CONCLUSAO", "", 1, "C", false, 0, "")
 	if pdf.Error() != nil {
 		return fmt.Errorf("Failed to add title: %v", pdf.Error())
 	}
 	pdf.Ln(10)
-	
+
 	// Set font for subtitle
 	pdf.SetFont("Arial", "", 16)
 	pdf.CellFormat(0, 10, "Certificate of Completion", "", 1, "C", false, 0, "")
 	pdf.Ln(5)
-	
+
 	// Set font for student name (larger and bold)
 	pdf.SetFont("Arial", "B", 24)
 	pdf.CellFormat(0, 15, cert.Name, "", 1, "C", false, 0, "")
 	pdf.Ln(10)
-	
+
 	// Set font for course details
 	pdf.SetFont("Arial", "", 16)
 	pdf.CellFormat(0, 10, "has successfully completed the course", "", 1, "C", false, 0, "")
 	pdf.Ln(5)
-	
+
 	// Course name (bold)
 	pdf.SetFont("Arial", "B", 20)
 	pdf.CellFormat(0, 12, cert.Course, "", 1, "C", false, 0, "")
 	pdf.Ln(15)
-	
+
 	// Completion date
 	pdf.SetFont("Arial", "", 14)
 	completionDate := cert.CompletionDate.Format("02/01/2006")
 	pdf.CellFormat(0, 8, fmt.Sprintf("Completed on: %s", completionDate), "", 1, "C", false, 0, "")
 	pdf.Ln(10)
-	
+
 	// Certificate ID
 	pdf.SetFont("Arial", "", 10)
 	pdf.CellFormat(0, 6, fmt.Sprintf("Certificate ID: %s", cert.ID), "", 1, "C", false, 0, "")
-	
+
 	// Final error check
 	if pdf.Error() != nil {
 		return fmt.Errorf("PDF error after content: %v", pdf.Error())
 	}
-	
+
 	return nil
 }
 
@@ -114,21 +169,21 @@ func (ps *PDFService) addSimpleCertificateContent(pdf *gofpdf.Fpdf, cert *models
 	pdf.SetFont("Arial", "B", 30)
 	pdf.SetY(40)
 	pdf.CellFormat(0, 15, "CERTIFICATE OF COMPLETION", "", 1, "C", false, 0, "")
-	
+
 	// Student name
 	pdf.SetY(80)
 	pdf.SetFont("Arial", "B", 24)
 	pdf.CellFormat(0, 12, cert.Name, "", 1, "C", false, 0, "")
-	
+
 	// Course
 	pdf.SetY(110)
 	pdf.SetFont("Arial", "", 18)
 	pdf.CellFormat(0, 10, "has completed the course:", "", 1, "C", false, 0, "")
-	
+
 	pdf.SetY(130)
 	pdf.SetFont("Arial", "B", 20)
 	pdf.CellFormat(0, 10, cert.Course, "", 1, "C", false, 0, "")
-	
+
 	// Date
 	pdf.SetY(160)
 	pdf.SetFont("Arial", "", 14)
@@ -136,69 +191,123 @@ func (ps *PDFService) addSimpleCertificateContent(pdf *gofpdf.Fpdf, cert *models
 	pdf.CellFormat(0, 8, "Completed: "+dateStr, "", 1, "C", false, 0, "")
 }
 
-// addPortugueseCertificateContent adds Portuguese certificate content with proper encoding
-func (ps *PDFService) addPortugueseCertificateContent(pdf *gofpdf.Fpdf, cert *models.Certificate) {
-	// Title - using special characters that work with gofpdf's CP1252 encoding
-	pdf.SetFont("Arial", "B", 30)
-	pdf.SetY(40)
-	title := ps.toCP1252("CERTIFICADO DE CONCLUSÃO")
-	pdf.CellFormat(0, 15, title, "", 1, "C", false, 0, "")
-	
-	// Subtitle
-	pdf.SetY(70)
-	pdf.SetFont("Arial", "", 16)
-	subtitle := ps.toCP1252("Certificamos que")
-	pdf.CellFormat(0, 10, subtitle, "", 1, "C", false, 0, "")
-	
-	// Student name (apply CP1252 conversion)
-	pdf.SetY(95)
-	pdf.SetFont("Arial", "B", 24)
-	studentName := ps.toCP1252(cert.Name)
-	pdf.CellFormat(0, 12, studentName, "", 1, "C", false, 0, "")
-	
-	// Course description
-	pdf.SetY(125)
-	pdf.SetFont("Arial", "", 18)
-	courseDesc := ps.toCP1252("concluiu com êxito o curso")
-	pdf.CellFormat(0, 10, courseDesc, "", 1, "C", false, 0, "")
-	
-	// Course name (apply CP1252 conversion)
-	pdf.SetY(150)
-	pdf.SetFont("Arial", "B", 20)
-	courseName := ps.toCP1252(cert.Course)
-	pdf.CellFormat(0, 10, courseName, "", 1, "C", false, 0, "")
-	
-	// Date
-	pdf.SetY(175)
-	pdf.SetFont("Arial", "", 14)
-	dateStr := cert.CompletionDate.Format("02 de January de 2006")
-	dateStr = ps.toCP1252("Concluído em: " + dateStr)
-	pdf.CellFormat(0, 8, dateStr, "", 1, "C", false, 0, "")
+// addStatusWatermark overlays a diagonal watermark and a status line on
+// certificates that have been revoked or superseded
+func (ps *PDFService) addStatusWatermark(pdf *gofpdf.Fpdf, cert *models.Certificate, loc *locale) {
+	if cert.IsValid() {
+		return
+	}
+
+	watermark := loc.message("status.revoked_watermark")
+	status := loc.message("status.revoked")
+	if cert.Status == models.StatusSuperseded {
+		watermark = loc.message("status.superseded_watermark")
+		status = loc.message("status.superseded")
+		if cert.SupersededBy != "" {
+			status += loc.message("status.superseded_by", cert.SupersededBy)
+		}
+	}
+	if cert.IsRevoked() {
+		if cert.RevokedAt != nil {
+			status += loc.message("status.on", formatLocalDate(*cert.RevokedAt, "short", loc))
+		}
+		if cert.RevocationReason != "" {
+			status += loc.message("status.reason", cert.RevocationReason)
+		}
+	}
+
+	pageWidth, pageHeight := pdf.GetPageSize()
+
+	// Diagonal, semi-transparent watermark across the page
+	pdf.SetTextColor(192, 57, 43)
+	text := ps.setFont(pdf, nil, "B", 90, watermark)
+	pdf.SetAlpha(0.25, "Normal")
+	pdf.TransformBegin()
+	pdf.TransformRotate(30, pageWidth/2, pageHeight/2)
+	pdf.Text((pageWidth-pdf.GetStringWidth(text))/2, pageHeight/2+15, text)
+	pdf.TransformEnd()
+	pdf.SetAlpha(1, "Normal")
+
+	// Status line above the verification footer
+	pdf.SetY(pageHeight - 28)
+	status = ps.setFont(pdf, nil, "B", 12, status)
+	pdf.CellFormat(0, 8, status, "", 1, "C", false, 0, "")
+	pdf.SetTextColor(0, 0, 0)
+}
+
+// addVerificationFooter prints the verification URL and the signature at
+// the bottom of the page so anyone holding the PDF can check it
+func (ps *PDFService) addVerificationFooter(pdf *gofpdf.Fpdf, cert *models.Certificate, loc *locale) {
+	if cert.Signature == "" {
+		return
+	}
+
+	_, pageHeight := pdf.GetPageSize()
+
+	pdf.SetTextColor(100, 100, 100)
+	pdf.SetY(pageHeight - 18)
+	link := ps.setFont(pdf, nil, "", 9, loc.message("verification.check_at")+" "+cert.VerificationURL)
+	pdf.CellFormat(0, 5, link, "", 1, "C", false, 0, cert.VerificationURL)
+	pdf.SetFont("Courier", "", 7)
+	signature := ps.toCP1252("ID: " + cert.ID + "  " + loc.message("verification.signature") + " (Ed25519): " + cert.Signature)
+	pdf.CellFormat(0, 4, signature, "", 1, "C", false, 0, "")
+	pdf.SetTextColor(0, 0, 0)
 }
 
-// toCP1252 converts UTF-8 Portuguese characters to CP1252 encoding for gofpdf
+// addQRCode draws a QR code linking to the verification page at the
+// position given by the layout, or in the bottom right corner by default
+func (ps *PDFService) addQRCode(pdf *gofpdf.Fpdf, cert *models.Certificate, box *models.PDFBox) error {
+	if cert.VerificationURL == "" {
+		return nil
+	}
+
+	png, err := GenerateQRCode(cert.VerificationURL)
+	if err != nil {
+		return fmt.Errorf("failed to generate QR code: %v", err)
+	}
+
+	if box == nil {
+		const size = 26.0
+		pageWidth, pageHeight := pdf.GetPageSize()
+		box = &models.PDFBox{X: pageWidth - size - 15, Y: pageHeight - size - 15, Size: size}
+	}
+
+	imageName := "qrcode-" + cert.ID
+	options := gofpdf.ImageOptions{ImageType: "PNG"}
+	pdf.RegisterImageOptionsReader(imageName, options, bytes.NewReader(png))
+	pdf.ImageOptions(imageName, box.X, box.Y, box.Size, box.Size, false, options, 0, cert.VerificationURL)
+
+	return nil
+}
+
+// setFont selects the first font of chain (or of the fallback chain) able
+// to display text and returns the text encoded for that font: UTF-8 for
+// TrueType fonts, Windows-1252 for the core PDF fonts
+func (ps *PDFService) setFont(pdf *gofpdf.Fpdf, chain []string, style string, size float64, text string) string {
+	font := ps.fonts.Resolve(chain, style, text)
+	if font.data == nil {
+		pdf.SetFont(font.family, font.style, size)
+		return ps.toCP1252(text)
+	}
+
+	// Registration is a no-op when the font is already in the document
+	pdf.AddUTF8FontFromBytes(font.family, font.style, font.data)
+	pdf.SetFont(font.family, font.style, size)
+	return text
+}
+
+// toCP1252 converts UTF-8 text to the Windows-1252 encoding used by the
+// gofpdf core fonts, replacing characters outside it with "?"
 func (ps *PDFService) toCP1252(text string) string {
-	// gofpdf supports CP1252 encoding, which includes Portuguese characters
-	// Map UTF-8 characters to their CP1252 equivalents
-	result := strings.NewReplacer(
-		// Portuguese accented characters to CP1252
-		"ã", "\xe3", "á", "\xe1", "à", "\xe0", "â", "\xe2",
-		"é", "\xe9", "ê", "\xea", "è", "\xe8",
-		"í", "\xed", "ì", "\xec", "î", "\xee",
-		"ó", "\xf3", "ô", "\xf4", "ò", "\xf2", "õ", "\xf5",
-		"ú", "\xfa", "ù", "\xf9", "û", "\xfb",
-		"ç", "\xe7",
-		
-		// Uppercase
-		"Ã", "\xc3", "Á", "\xc1", "À", "\xc0", "Â", "\xc2",
-		"É", "\xc9", "Ê", "\xca", "È", "\xc8",
-		"Í", "\xcd", "Ì", "\xcc", "Î", "\xce",
-		"Ó", "\xd3", "Ô", "\xd4", "Ò", "\xd2", "Õ", "\xd5",
-		"Ú", "\xda", "Ù", "\xd9", "Û", "\xdb",
-		"Ç", "\xc7",
-	).Replace(text)
-	
-	return result
+	var b strings.Builder
+	for _, r := range text {
+		if c, ok := charmap.Windows1252.EncodeRune(r); ok {
+			b.WriteByte(c)
+		} else {
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
 }
 
 // convertWithWkhtmltopdf uses wkhtmltopdf for conversion (if available)
@@ -206,11 +315,11 @@ func (ps *PDFService) toCP1252(text string) string {
 func (ps *PDFService) convertWithWkhtmltopdf(html string) ([]byte, error) {
 	cmd := exec.Command("wkhtmltopdf", "--page-size", "A4", "--orientation", "Landscape", "-", "-")
 	cmd.Stdin = bytes.NewReader([]byte(html))
-	
+
 	output, err := cmd.Output()
 	if err != nil {
 		return nil, fmt.Errorf("wkhtmltopdf conversion failed: %v", err)
 	}
-	
+
 	return output, nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,26 @@
+package services
+
+import (
+	"encoding/base64"
+	"html/template"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// qrCodeSize is the width and height in pixels of generated QR code images
+const qrCodeSize = 256
+
+// GenerateQRCode encodes content as a PNG QR code image
+func GenerateQRCode(content string) ([]byte, error) {
+	return qrcode.Encode(content, qrcode.Medium, qrCodeSize)
+}
+
+// QRCodeDataURI encodes content as a QR code and returns it as a data URI
+// that html/template accepts in an <img src="..."> attribute
+func QRCodeDataURI(content string) (template.URL, error) {
+	png, err := GenerateQRCode(content)
+	if err != nil {
+		return "", err
+	}
+	return template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(png)), nil
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"vibe-certificados/models"
+)
+
+// SigningService signs certificates with an Ed25519 key so their
+// authenticity can be checked later, even from a printed PDF
+type SigningService struct {
+	privateKey ed25519.PrivateKey
+	publicKey  ed25519.PublicKey
+}
+
+// NewSigningService creates a signing service for an existing key
+func NewSigningService(privateKey ed25519.PrivateKey) *SigningService {
+	return &SigningService{
+		privateKey: privateKey,
+		publicKey:  privateKey.Public().(ed25519.PublicKey),
+	}
+}
+
+// LoadOrCreateSigningService loads the PEM encoded (PKCS#8) Ed25519 private
+// key at path. When the file does not exist a new key is generated and
+// written there, so a fresh installation works offline without setup.
+func LoadOrCreateSigningService(path string) (*SigningService, error) {
+	pemData, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return createSigningKey(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key: %v", err)
+	}
+
+	block, _ := pem.Decode(pemData)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, errors.New("signing key must be a PEM encoded PRIVATE KEY")
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signing key: %v", err)
+	}
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.New("signing key is not an Ed25519 key")
+	}
+
+	return NewSigningService(privateKey), nil
+}
+
+// createSigningKey generates a new key and stores it at path
+func createSigningKey(path string) (*SigningService, error) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate signing key: %v", err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return nil, fmt.Errorf("failed to create signing key directory: %v", err)
+		}
+	}
+	pemData := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(path, pemData, 0o600); err != nil {
+		return nil, fmt.Errorf("failed to write signing key: %v", err)
+	}
+
+	return NewSigningService(privateKey), nil
+}
+
+// Sign returns the base64 (URL-safe, unpadded) signature of the
+// certificate's canonical form
+func (ss *SigningService) Sign(cert *models.Certificate) (string, error) {
+	payload, err := cert.CanonicalBytes()
+	if err != nil {
+		return "", err
+	}
+	signature := ed25519.Sign(ss.privateKey, payload)
+	return base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// Verify reports whether signature matches the certificate's canonical form
+func (ss *SigningService) Verify(cert *models.Certificate, signature string) bool {
+	decoded, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || len(decoded) != ed25519.SignatureSize {
+		return false
+	}
+
+	payload, err := cert.CanonicalBytes()
+	if err != nil {
+		return false
+	}
+	return ed25519.Verify(ss.publicKey, payload, decoded)
+}
+
+// PublicKey returns the base64 encoded public key used for verification
+func (ss *SigningService) PublicKey() string {
+	return base64.StdEncoding.EncodeToString(ss.publicKey)
+}
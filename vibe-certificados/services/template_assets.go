@@ -0,0 +1,287 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"text/template/parse"
+	"time"
+	"vibe-certificados/models"
+	"vibe-certificados/storage"
+
+	_ "golang.org/x/image/webp"
+)
+
+// DefaultMaxAssetSize is the largest asset accepted unless changed with
+// SetMaxAssetSize
+const DefaultMaxAssetSize = 2 << 20
+
+// Errors returned when an asset upload or deletion is rejected
+var (
+	ErrInvalidAssetName = errors.New("asset name may only contain letters, digits, '.', '_' and '-'")
+	ErrAssetType        = errors.New("asset must be a PNG, JPEG, GIF or WebP image")
+	ErrAssetTooLarge    = errors.New("asset is too large")
+	ErrAssetExists      = errors.New("asset already exists")
+	ErrAssetInUse       = errors.New("asset is used by the template")
+)
+
+// assetTypes are the accepted content types, as detected from the uploaded
+// bytes. SVG is excluded because it can carry scripts.
+var assetTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// pdfImageTypes maps asset content types to the image types gofpdf draws
+var pdfImageTypes = map[string]string{
+	"image/png":  "PNG",
+	"image/jpeg": "JPG",
+	"image/gif":  "GIF",
+}
+
+var validAssetName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,127}$`)
+
+// SetMaxAssetSize sets the largest asset accepted, in bytes
+func (ts *TemplateService) SetMaxAssetSize(size int64) {
+	ts.maxAssetSize = size
+}
+
+// MaxAssetSize returns the largest asset accepted, in bytes
+func (ts *TemplateService) MaxAssetSize() int64 {
+	return ts.maxAssetSize
+}
+
+// UploadAsset stores an image for a template. The content type is detected
+// from the data rather than trusted from the client. Names cannot be
+// reused, so certificates rendered with earlier template versions keep
+// showing the image they were issued with.
+func (ts *TemplateService) UploadAsset(orgID string, actor models.Actor, templateID, name string, data []byte) (*models.TemplateAsset, error) {
+	if !validAssetName.MatchString(name) {
+		return nil, ErrInvalidAssetName
+	}
+	if int64(len(data)) > ts.maxAssetSize {
+		return nil, fmt.Errorf("%w: the limit is %d bytes", ErrAssetTooLarge, ts.maxAssetSize)
+	}
+	contentType := http.DetectContentType(data)
+	if !assetTypes[contentType] {
+		return nil, ErrAssetType
+	}
+	if _, _, err := image.DecodeConfig(bytes.NewReader(data)); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrAssetType, err)
+	}
+	if _, err := ts.storage.GetTemplate(orgID, templateID); err != nil {
+		return nil, err
+	}
+
+	ts.assetMu.Lock()
+	defer ts.assetMu.Unlock()
+
+	if _, err := ts.storage.GetAsset(orgID, templateID, name); err == nil {
+		return nil, ErrAssetExists
+	} else if !errors.Is(err, storage.ErrAssetNotFound) {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(data)
+	asset := &models.TemplateAsset{
+		OrganizationID: orgID,
+		TemplateID:     templateID,
+		Name:           name,
+		ContentType:    contentType,
+		Size:           int64(len(data)),
+		ETag:           hex.EncodeToString(sum[:]),
+		CreatedAt:      time.Now(),
+		Data:           data,
+	}
+	if err := ts.storage.SaveAsset(asset); err != nil {
+		return nil, err
+	}
+	recordAudit(ts.storage, orgID, actor, models.AuditAssetUpload, models.AuditTargetAsset, assetAuditTarget(asset), nil, assetAuditSnapshot(asset))
+	return asset, nil
+}
+
+// GetAsset retrieves a template asset with its content
+func (ts *TemplateService) GetAsset(orgID, templateID, name string) (*models.TemplateAsset, error) {
+	return ts.storage.GetAsset(orgID, templateID, name)
+}
+
+// GetAssets lists the assets of a template without their content
+func (ts *TemplateService) GetAssets(orgID, templateID string) ([]*models.TemplateAsset, error) {
+	if _, err := ts.storage.GetTemplate(orgID, templateID); err != nil {
+		return nil, err
+	}
+	return ts.storage.GetAssets(orgID, templateID)
+}
+
+// DeleteAsset removes an asset that no version of its template uses
+func (ts *TemplateService) DeleteAsset(orgID string, actor models.Actor, templateID, name string) error {
+	ts.assetMu.Lock()
+	defer ts.assetMu.Unlock()
+
+	asset, err := ts.storage.GetAsset(orgID, templateID, name)
+	if err != nil {
+		return err
+	}
+
+	versions, err := ts.storage.GetTemplateVersions(orgID, templateID)
+	if err != nil {
+		return err
+	}
+	for _, version := range versions {
+		html, pdf := templateAssetNames(version)
+		if html[name] || pdf[name] {
+			return fmt.Errorf("%w (version %d)", ErrAssetInUse, version.Version)
+		}
+	}
+	if err := ts.storage.DeleteAsset(orgID, templateID, name); err != nil {
+		return err
+	}
+	recordAudit(ts.storage, orgID, actor, models.AuditAssetDelete, models.AuditTargetAsset, assetAuditTarget(asset), assetAuditSnapshot(asset), nil)
+	return nil
+}
+
+// AssetWarnings lists the assets referenced by a template that are not
+// uploaded, and those the PDF cannot draw. Missing images render empty, so
+// templates may be saved before their assets are uploaded.
+func (ts *TemplateService) AssetWarnings(tmpl *models.Template) []string {
+	html, pdf := templateAssetNames(tmpl)
+
+	names := make([]string, 0, len(html)+len(pdf))
+	for name := range html {
+		names = append(names, name)
+	}
+	for name := range pdf {
+		if !html[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	warnings := make([]string, 0)
+	for _, name := range names {
+		asset, err := ts.storage.GetAsset(tmpl.OrganizationID, tmpl.ID, name)
+		if err != nil {
+			warnings = append(warnings, "asset "+name+" is not uploaded")
+			continue
+		}
+		if pdf[name] && pdfImageTypes[asset.ContentType] == "" {
+			warnings = append(warnings, "asset "+name+" is "+asset.ContentType+", which is not drawn in the PDF")
+		}
+	}
+	return warnings
+}
+
+// assetFuncs returns the asset functions of the HTML template of
+// templateID: asset embeds an image as a data URI and assetURL links to it
+func (ts *TemplateService) assetFuncs(orgID, templateID string) htmltemplate.FuncMap {
+	return htmltemplate.FuncMap{
+		"asset": func(name string) htmltemplate.URL {
+			asset, err := ts.storage.GetAsset(orgID, templateID, name)
+			if err != nil {
+				return ""
+			}
+			return htmltemplate.URL(assetDataURI(asset))
+		},
+		"assetURL": func(name string) htmltemplate.URL {
+			return htmltemplate.URL(AssetPath(orgID, templateID, name))
+		},
+	}
+}
+
+// AssetPath returns the API path that serves an asset
+func AssetPath(orgID, templateID, name string) string {
+	return OrganizationPath(orgID) + "/templates/" + url.PathEscape(templateID) + "/assets/" + url.PathEscape(name)
+}
+
+// assetDataURI encodes an asset as a base64 data URI
+func assetDataURI(asset *models.TemplateAsset) string {
+	return "data:" + asset.ContentType + ";base64," + base64.StdEncoding.EncodeToString(asset.Data)
+}
+
+// templateAssetNames returns the assets referenced by the HTML template
+// (as literal arguments of asset and assetURL) and by the PDF layout
+func templateAssetNames(tmpl *models.Template) (html, pdf map[string]bool) {
+	html = make(map[string]bool)
+	pdf = make(map[string]bool)
+
+	tree := parse.New("template")
+	tree.Mode = parse.SkipFuncCheck
+	trees := make(map[string]*parse.Tree)
+	if _, err := tree.Parse(tmpl.HTMLTemplate, "", "", trees); err == nil {
+		for _, t := range trees {
+			collectAssetNames(t.Root, html)
+		}
+	}
+
+	if layout := tmpl.PDFLayout; layout != nil {
+		if layout.BackgroundAsset != "" {
+			pdf[layout.BackgroundAsset] = true
+		}
+		for _, image := range layout.Images {
+			pdf[image.Asset] = true
+		}
+	}
+	return html, pdf
+}
+
+// collectAssetNames records the string literals passed to asset and
+// assetURL under node
+func collectAssetNames(node parse.Node, names map[string]bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			collectAssetNames(child, names)
+		}
+	case *parse.ActionNode:
+		collectAssetNames(n.Pipe, names)
+	case *parse.IfNode:
+		collectAssetNames(n.Pipe, names)
+		collectAssetNames(n.List, names)
+		collectAssetNames(n.ElseList, names)
+	case *parse.RangeNode:
+		collectAssetNames(n.Pipe, names)
+		collectAssetNames(n.List, names)
+		collectAssetNames(n.ElseList, names)
+	case *parse.WithNode:
+		collectAssetNames(n.Pipe, names)
+		collectAssetNames(n.List, names)
+		collectAssetNames(n.ElseList, names)
+	case *parse.TemplateNode:
+		collectAssetNames(n.Pipe, names)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			if len(cmd.Args) == 2 {
+				ident, isIdent := cmd.Args[0].(*parse.IdentifierNode)
+				name, isString := cmd.Args[1].(*parse.StringNode)
+				if isIdent && isString && (ident.Ident == "asset" || ident.Ident == "assetURL") {
+					names[name.Text] = true
+				}
+			}
+			for _, arg := range cmd.Args {
+				if pipe, ok := arg.(*parse.PipeNode); ok {
+					collectAssetNames(pipe, names)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,488 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxTemplateOutput bounds the output of a single template execution, so a
+// runaway range cannot exhaust memory
+const maxTemplateOutput = 5 << 20
+
+// errTemplateOutputTooLarge is returned when a template exceeds maxTemplateOutput
+var errTemplateOutputTooLarge = errors.New("template output exceeds 5 MB")
+
+// maxTemplateSteps bounds the range iterations and template calls of a
+// single template execution, so a loop that writes nothing cannot run for
+// long either
+const maxTemplateSteps = 100000
+
+// errTemplateTooManySteps is returned when a template exceeds maxTemplateSteps
+var errTemplateTooManySteps = errors.New("template exceeds 100000 loop iterations and template calls")
+
+// templateStepFunc is called at the start of every range iteration and
+// template call to count the steps of an execution
+const templateStepFunc = "_step"
+
+// maxNumberDecimals bounds the decimals formatNumber accepts
+const maxNumberDecimals = 10
+
+// dateInputLayouts are the formats accepted by the date functions: the ones
+// produced by Certificate.GetAllData and the ones used in requests
+var dateInputLayouts = []string{
+	"02/01/2006 15:04:05",
+	"02/01/2006",
+	"2006-01-02",
+	time.RFC3339,
+}
+
+// imageDataURI matches the embedded images templates may display. SVG is
+// excluded because it can carry scripts.
+var imageDataURI = regexp.MustCompile(`^data:image/(png|jpeg|gif|webp);base64,[A-Za-z0-9+/]+={0,2}$`)
+
+// titleLowerWords stay lowercase inside title-cased text, as usual in
+// Portuguese and Spanish names ("Maria da Silva")
+var titleLowerWords = map[string]bool{
+	"da": true, "das": true, "de": true, "del": true, "do": true, "dos": true,
+	"e": true, "y": true, "la": true, "las": true, "los": true,
+}
+
+// templateFuncs returns the functions available to certificate templates
+// (HTML, PDF blocks, email and export file names), formatting for loc.
+// Only pure formatting helpers are exposed: templates cannot read files,
+// reach the network or invoke functions passed in their data.
+func templateFuncs(loc *locale) template.FuncMap {
+	return template.FuncMap{
+		"t": loc.message,
+		"formatDate": func(layout string, value interface{}) (string, error) {
+			t, err := toTime(value, loc)
+			if err != nil || t.IsZero() {
+				return "", err
+			}
+			return formatLocalDate(t, layout, loc), nil
+		},
+		"upper": strings.ToUpper,
+		"lower": strings.ToLower,
+		"title": titleCase,
+		"formatNumber": func(decimals int, value interface{}) (string, error) {
+			n, ok, err := toNumber(value)
+			if !ok {
+				return "", err
+			}
+			return formatLocalNumber(n, min(max(decimals, 0), maxNumberDecimals), loc), nil
+		},
+		"hours": func(value interface{}) (string, error) {
+			n, ok, err := toNumber(value)
+			if !ok {
+				return "", err
+			}
+			unit := loc.Hours
+			if n == 1 {
+				unit = loc.Hour
+			}
+			return formatLocalNumber(n, -1, loc) + " " + unit, nil
+		},
+		"duration": formatDuration,
+		"default": func(fallback, value interface{}) interface{} {
+			if isEmpty(value) {
+				return fallback
+			}
+			return value
+		},
+		"empty": isEmpty,
+		"coalesce": func(values ...interface{}) interface{} {
+			for _, value := range values {
+				if !isEmpty(value) {
+					return value
+				}
+			}
+			return ""
+		},
+		"ternary": func(whenTrue, whenFalse interface{}, condition bool) interface{} {
+			if condition {
+				return whenTrue
+			}
+			return whenFalse
+		},
+		"contains": func(substr string, value interface{}) bool {
+			return strings.Contains(toString(value), substr)
+		},
+		"image": func(value interface{}) htmltemplate.URL {
+			uri := strings.TrimSpace(toString(value))
+			if !imageDataURI.MatchString(uri) {
+				return ""
+			}
+			return htmltemplate.URL(uri)
+		},
+		// asset and assetURL are bound to the template's uploaded images
+		// when its HTML is rendered; elsewhere they render empty
+		"asset":    func(string) htmltemplate.URL { return "" },
+		"assetURL": func(string) htmltemplate.URL { return "" },
+		// call would let templates run functions found in their data
+		"call": func(...interface{}) (string, error) {
+			return "", errors.New("call is not allowed in certificate templates")
+		},
+		// The print functions could build huge strings without writing them
+		"print": func(args ...interface{}) (string, error) {
+			return limitText(fmt.Sprint(args...))
+		},
+		"printf": func(format string, args ...interface{}) (string, error) {
+			return limitText(fmt.Sprintf(format, args...))
+		},
+		"println": func(args ...interface{}) (string, error) {
+			return limitText(fmt.Sprintln(args...))
+		},
+		// Replaced by executeTemplate with a counter for each execution
+		templateStepFunc: func() string { return "" },
+	}
+}
+
+// limitText fails when a value built by a template exceeds maxTemplateOutput
+func limitText(s string) (string, error) {
+	if len(s) > maxTemplateOutput {
+		return "", errTemplateOutputTooLarge
+	}
+	return s, nil
+}
+
+// parseHTMLTemplate parses an HTML certificate template with the template
+// functions
+func parseHTMLTemplate(name, text string, loc *locale) (*htmltemplate.Template, error) {
+	t, err := htmltemplate.New(name).Funcs(htmltemplate.FuncMap(templateFuncs(loc))).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	for _, defined := range t.Templates() {
+		addTemplateSteps(defined.Tree)
+	}
+	return t, nil
+}
+
+// parseTextTemplate parses a plain text template (PDF blocks, email, file
+// names) with the template functions. Missing keys render as empty.
+func parseTextTemplate(name, text string, loc *locale) (*template.Template, error) {
+	t, err := template.New(name).Funcs(templateFuncs(loc)).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	for _, defined := range t.Templates() {
+		addTemplateSteps(defined.Tree)
+	}
+	return t, nil
+}
+
+// addTemplateSteps inserts a call to templateStepFunc at the start of a
+// parsed template and of each range body in it. The call is a variable
+// declaration, which writes nothing and is left alone by HTML escaping.
+func addTemplateSteps(tree *parse.Tree) {
+	if tree == nil || tree.Root == nil {
+		return
+	}
+	addStep(tree.Root)
+	addRangeSteps(tree.Root)
+}
+
+// addRangeSteps adds a step to the range bodies found under node
+func addRangeSteps(node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			addRangeSteps(child)
+		}
+	case *parse.RangeNode:
+		addRangeSteps(n.List)
+		addRangeSteps(n.ElseList)
+		addStep(n.List)
+	case *parse.IfNode:
+		addRangeSteps(n.List)
+		addRangeSteps(n.ElseList)
+	case *parse.WithNode:
+		addRangeSteps(n.List)
+		addRangeSteps(n.ElseList)
+	}
+}
+
+// addStep prepends {{$_step := _step}} to list
+func addStep(list *parse.ListNode) {
+	step := &parse.ActionNode{
+		NodeType: parse.NodeAction,
+		Pos:      list.Pos,
+		Pipe: &parse.PipeNode{
+			NodeType: parse.NodePipe,
+			Pos:      list.Pos,
+			Decl:     []*parse.VariableNode{{NodeType: parse.NodeVariable, Pos: list.Pos, Ident: []string{"$_step"}}},
+			Cmds: []*parse.CommandNode{{
+				NodeType: parse.NodeCommand,
+				Pos:      list.Pos,
+				Args:     []parse.Node{parse.NewIdentifier(templateStepFunc).SetPos(list.Pos)},
+			}},
+		},
+	}
+	list.Nodes = append([]parse.Node{step}, list.Nodes...)
+}
+
+// templateExecutor is implemented by text and HTML templates
+type templateExecutor interface {
+	Execute(w io.Writer, data interface{}) error
+}
+
+// executeTemplate runs t with data, stopping when the output grows past
+// maxTemplateOutput or the execution takes more than maxTemplateSteps. The
+// step counter is installed on a clone, so t itself is never executed and can
+// be shared by concurrent renders (e.g. the export filename pattern)
+func executeTemplate(t templateExecutor, data interface{}) (string, error) {
+	steps := 0
+	step := func() (string, error) {
+		if steps++; steps > maxTemplateSteps {
+			return "", errTemplateTooManySteps
+		}
+		return "", nil
+	}
+	var run templateExecutor
+	switch t := t.(type) {
+	case *template.Template:
+		clone, err := t.Clone()
+		if err != nil {
+			return "", err
+		}
+		run = clone.Funcs(template.FuncMap{templateStepFunc: step})
+	case *htmltemplate.Template:
+		clone, err := t.Clone()
+		if err != nil {
+			return "", err
+		}
+		run = clone.Funcs(htmltemplate.FuncMap{templateStepFunc: step})
+	default:
+		run = t
+	}
+
+	var buf bytes.Buffer
+	if err := run.Execute(&limitedWriter{buf: &buf, remaining: maxTemplateOutput}, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// limitedWriter fails writes once remaining bytes are used up
+type limitedWriter struct {
+	buf       *bytes.Buffer
+	remaining int
+}
+
+func (lw *limitedWriter) Write(p []byte) (int, error) {
+	if len(p) > lw.remaining {
+		return 0, errTemplateOutputTooLarge
+	}
+	lw.remaining -= len(p)
+	return lw.buf.Write(p)
+}
+
+// formatLocalDate formats t with a named style (short, medium, long,
+// datetime, timestamp, iso) or a Go layout, using the month and weekday
+// names of loc
+func formatLocalDate(t time.Time, layout string, loc *locale) string {
+	switch layout {
+	case "":
+		layout = loc.DateLayouts["short"]
+	case "short", "medium", "long", "datetime", "timestamp":
+		layout = loc.DateLayouts[layout]
+	case "iso":
+		return t.Format("2006-01-02")
+	}
+
+	// Names are substituted outside time.Format, which only knows English
+	var out strings.Builder
+	for layout != "" {
+		pos, token := nextNameToken(layout)
+		if pos < 0 {
+			out.WriteString(t.Format(layout))
+			break
+		}
+		if pos > 0 {
+			out.WriteString(t.Format(layout[:pos]))
+		}
+		switch token {
+		case "January":
+			out.WriteString(loc.Months[t.Month()-1])
+		case "Jan":
+			out.WriteString(loc.ShortMonths[t.Month()-1])
+		case "Monday":
+			out.WriteString(loc.Weekdays[t.Weekday()])
+		case "Mon":
+			out.WriteString(loc.ShortWeekdays[t.Weekday()])
+		}
+		layout = layout[pos+len(token):]
+	}
+	return out.String()
+}
+
+// nextNameToken finds the first month or weekday name element of a Go
+// layout, returning -1 when there is none
+func nextNameToken(layout string) (int, string) {
+	for i := 0; i < len(layout); i++ {
+		for _, token := range []string{"January", "Jan", "Monday", "Mon"} {
+			if strings.HasPrefix(layout[i:], token) {
+				return i, token
+			}
+		}
+	}
+	return -1, ""
+}
+
+// formatLocalNumber formats n with the separators of loc. A negative
+// decimals keeps only the decimals needed.
+func formatLocalNumber(n float64, decimals int, loc *locale) string {
+	text := strconv.FormatFloat(math.Abs(n), 'f', decimals, 64)
+	integer, fraction, _ := strings.Cut(text, ".")
+
+	var out strings.Builder
+	if n < 0 {
+		out.WriteString("-")
+	}
+	for i, digit := range integer {
+		if i > 0 && (len(integer)-i)%3 == 0 {
+			out.WriteString(loc.ThousandsSep)
+		}
+		out.WriteRune(digit)
+	}
+	if fraction != "" {
+		out.WriteString(loc.DecimalSep + fraction)
+	}
+	return out.String()
+}
+
+// formatDuration formats a Go duration ("1h30m") or a number of hours
+// ("1.5") as "1h30min"
+func formatDuration(value interface{}) (string, error) {
+	var d time.Duration
+	if text, ok := value.(string); ok && strings.ContainsAny(text, "hms") {
+		parsed, err := time.ParseDuration(strings.TrimSpace(text))
+		if err != nil {
+			return "", err
+		}
+		d = parsed
+	} else {
+		n, ok, err := toNumber(value)
+		if !ok {
+			return "", err
+		}
+		d = time.Duration(n * float64(time.Hour))
+	}
+
+	d = d.Round(time.Minute)
+	hours, minutes := int(d/time.Hour), int(d%time.Hour/time.Minute)
+	switch {
+	case hours > 0 && minutes > 0:
+		return strconv.Itoa(hours) + "h" + strconv.Itoa(minutes) + "min", nil
+	case hours > 0:
+		return strconv.Itoa(hours) + "h", nil
+	default:
+		return strconv.Itoa(minutes) + "min", nil
+	}
+}
+
+// titleCase capitalizes each word, keeping connectives such as "da" and
+// "de" lowercase except at the start
+func titleCase(s string) string {
+	words := strings.Fields(strings.ToLower(s))
+	for i, word := range words {
+		if i > 0 && titleLowerWords[word] {
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(word)
+		words[i] = string(unicode.ToTitle(r)) + word[size:]
+	}
+	return strings.Join(words, " ")
+}
+
+// toTime converts a date value from certificate data, which may be
+// formatted for loc. Empty values are the zero time.
+func toTime(value interface{}, loc *locale) (time.Time, error) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, nil
+	case *time.Time:
+		if v == nil {
+			return time.Time{}, nil
+		}
+		return *v, nil
+	}
+
+	text := strings.TrimSpace(toString(value))
+	if text == "" {
+		return time.Time{}, nil
+	}
+	if t, ok := parseLocalDate(text, loc); ok {
+		return t, nil
+	}
+	for _, layout := range dateInputLayouts {
+		if t, err := time.Parse(layout, text); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.New("formatDate: unrecognized date " + strconv.Quote(text))
+}
+
+// toNumber converts a numeric value from certificate data. ok is false for
+// empty values, which format as empty text.
+func toNumber(value interface{}) (n float64, ok bool, err error) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true, nil
+	case float64:
+		return v, true, nil
+	}
+
+	text := strings.TrimSpace(toString(value))
+	if text == "" {
+		return 0, false, nil
+	}
+	n, err = strconv.ParseFloat(text, 64)
+	if err != nil {
+		return 0, false, errors.New("not a number: " + strconv.Quote(text))
+	}
+	return n, true, nil
+}
+
+// toString converts a template value to text
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case htmltemplate.URL:
+		return string(v)
+	}
+	return fmt.Sprint(value)
+}
+
+// isEmpty reports whether a template value is missing, blank, false or zero
+func isEmpty(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case bool:
+		return !v
+	case int:
+		return v == 0
+	case float64:
+		return v == 0
+	}
+	return strings.TrimSpace(toString(value)) == ""
+}
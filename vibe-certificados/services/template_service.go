@@ -1,9 +1,11 @@
 package services
 
 import (
-	"bytes"
 	"errors"
-	"html/template"
+	"html"
+	"log"
+	"strings"
+	"sync"
 	"time"
 	"vibe-certificados/models"
 	"vibe-certificados/storage"
@@ -11,31 +13,47 @@ import (
 
 // TemplateService handles template-related operations
 type TemplateService struct {
-	storage *storage.MemoryStorage
+	storage      storage.Storage
+	versionMu    sync.Mutex // serialises version numbering
+	assetMu      sync.Mutex // serialises asset uploads and deletions
+	maxAssetSize int64
 }
 
 // NewTemplateService creates a new template service
-func NewTemplateService(storage *storage.MemoryStorage) *TemplateService {
+func NewTemplateService(storage storage.Storage) *TemplateService {
 	ts := &TemplateService{
-		storage: storage,
+		storage:      storage,
+		maxAssetSize: DefaultMaxAssetSize,
 	}
-	
+
 	// Initialize with default template
-	ts.initializeDefaultTemplate()
-	
+	if err := ts.EnsureDefaultTemplate(models.DefaultOrganizationID); err != nil {
+		log.Printf("failed to create the default template: %v", err)
+	}
+	ts.versionLegacyTemplates()
+
 	return ts
 }
 
-// initializeDefaultTemplate creates the default template
-func (ts *TemplateService) initializeDefaultTemplate() {
+// EnsureDefaultTemplate creates the default template of an organization
+// unless the storage already holds one (e.g. a persistent database after a
+// restart)
+func (ts *TemplateService) EnsureDefaultTemplate(orgID string) error {
+	if _, err := ts.storage.GetTemplate(orgID, "default"); err == nil {
+		return nil
+	} else if !errors.Is(err, storage.ErrTemplateNotFound) {
+		return err
+	}
+
 	defaultTemplate := &models.Template{
-		ID:   "default",
-		Name: "Default Certificate Template",
+		ID:             "default",
+		OrganizationID: orgID,
+		Name:           "Default Certificate Template",
 		HTMLTemplate: `<!DOCTYPE html>
-<html>
+<html lang="{{.Locale}}">
 <head>
     <meta charset="UTF-8">
-    <title>Certificate</title>
+    <title>{{t "certificate.heading"}}</title>
     <style>
         body {
             font-family: 'Georgia', serif;
@@ -101,31 +119,54 @@ func (ts *TemplateService) initializeDefaultTemplate() {
             color: #999;
             margin-top: 20px;
         }
+        .verification {
+            font-size: 11px;
+            color: #999;
+            margin-top: 10px;
+        }
+        .qrcode {
+            width: 120px;
+            height: 120px;
+            margin-top: 20px;
+        }
+        .signature {
+            font-family: monospace;
+            word-break: break-all;
+        }
     </style>
 </head>
 <body>
     <div class="certificate">
         <div class="header">
-            <h1 class="title">Certificado</h1>
-            <p class="subtitle">Certificate of Completion</p>
+            <h1 class="title">{{t "certificate.heading"}}</h1>
+            <p class="subtitle">{{t "certificate.subtitle"}}</p>
         </div>
         
         <div class="content">
-            <p>Certificamos que</p>
+            <p>{{t "certificate.certify_that"}}</p>
             <div class="recipient">{{.Name}}</div>
-            <p>concluiu com êxito o curso</p>
+            <p>{{t "certificate.completed_course"}}</p>
             <div class="course">{{.Course}}</div>
-            <p>demonstrando conhecimento e dedicação ao aprendizado.</p>
+            <p>{{t "certificate.dedication"}}</p>
         </div>
         
         <div class="footer">
             <div class="date">
-                Concluído em: {{.CompletionDate}}<br>
-                Emitido em: {{.CreatedAt}}
+                {{t "certificate.completed_on" .CompletionDate}}<br>
+                {{t "certificate.issued_on" .CreatedAt}}
             </div>
             <div class="certificate-id">
-                ID do Certificado: {{.ID}}
+                {{t "certificate.id" .ID}}
             </div>
+            {{if .QRCode}}
+            <img class="qrcode" src="{{.QRCode}}" alt="{{t "verification.qr_alt"}}">
+            {{end}}
+            {{if .VerificationURL}}
+            <div class="verification">
+                {{t "verification.check_at"}} <a href="{{.VerificationURL}}">{{.VerificationURL}}</a><br>
+                <span class="signature">{{t "verification.signature"}}: {{.Signature}}</span>
+            </div>
+            {{end}}
         </div>
     </div>
 </body>
@@ -135,70 +176,191 @@ func (ts *TemplateService) initializeDefaultTemplate() {
 			{Name: "course", Type: "string", Required: true, Description: "Nome do curso"},
 			{Name: "completion_date", Type: "date", Required: true, Description: "Data de conclusão (YYYY-MM-DD)"},
 		},
+		PDFLayout: DefaultPDFLayout(),
+		Version:   1,
 		CreatedAt: time.Now().Format("2006-01-02 15:04:05"),
 		UpdatedAt: time.Now().Format("2006-01-02 15:04:05"),
 	}
-	
-	ts.storage.SaveTemplate(defaultTemplate)
+
+	if err := ts.storage.SaveTemplateVersion(defaultTemplate); err != nil {
+		return err
+	}
+	if err := ts.storage.SaveTemplate(defaultTemplate); err != nil {
+		return err
+	}
+	recordAudit(ts.storage, orgID, models.SystemActor, models.AuditTemplateCreate, models.AuditTargetTemplate, defaultTemplate.ID, nil, defaultTemplate)
+	return nil
 }
 
-// GetTemplate retrieves a template by ID
-func (ts *TemplateService) GetTemplate(id string) (*models.Template, error) {
-	return ts.storage.GetTemplate(id)
+// GetTemplate retrieves a template of an organization by ID
+func (ts *TemplateService) GetTemplate(orgID, id string) (*models.Template, error) {
+	return ts.storage.GetTemplate(orgID, id)
 }
 
-// GetAllTemplates retrieves all templates
-func (ts *TemplateService) GetAllTemplates() ([]*models.Template, error) {
-	return ts.storage.GetAllTemplates()
+// GetAllTemplates retrieves the templates of an organization
+func (ts *TemplateService) GetAllTemplates(orgID string) ([]*models.Template, error) {
+	return ts.storage.GetAllTemplates(orgID)
 }
 
-// CreateTemplate creates a new template
-func (ts *TemplateService) CreateTemplate(template *models.Template) error {
+// CreateTemplate creates a new template of an organization as its first
+// version
+func (ts *TemplateService) CreateTemplate(orgID string, actor models.Actor, template *models.Template) error {
+	template.OrganizationID = orgID
+	if err := ts.validate(template); err != nil {
+		return err
+	}
+
 	template.CreatedAt = time.Now().Format("2006-01-02 15:04:05")
 	template.UpdatedAt = template.CreatedAt
-	return ts.storage.SaveTemplate(template)
+	if err := ts.saveNewVersion(template); err != nil {
+		return err
+	}
+	recordAudit(ts.storage, orgID, actor, models.AuditTemplateCreate, models.AuditTargetTemplate, template.ID, nil, template)
+	return nil
 }
 
-// UpdateTemplate updates an existing template
-func (ts *TemplateService) UpdateTemplate(template *models.Template) error {
+// UpdateTemplate stores the template as a new version and makes it the
+// active one. Previous versions are kept, so certificates issued with them
+// keep their design.
+func (ts *TemplateService) UpdateTemplate(orgID string, actor models.Actor, template *models.Template) error {
 	// Check if template exists
-	_, err := ts.storage.GetTemplate(template.ID)
+	template.OrganizationID = orgID
+	existing, err := ts.storage.GetTemplate(orgID, template.ID)
 	if err != nil {
 		return err
 	}
-	
+
+	if err := ts.validate(template); err != nil {
+		return err
+	}
+
+	template.CreatedAt = existing.CreatedAt
 	template.UpdatedAt = time.Now().Format("2006-01-02 15:04:05")
-	return ts.storage.SaveTemplate(template)
+	if err := ts.saveNewVersion(template); err != nil {
+		return err
+	}
+	recordAudit(ts.storage, orgID, actor, models.AuditTemplateUpdate, models.AuditTargetTemplate, template.ID, existing, template)
+	return nil
 }
 
-// DeleteTemplate removes a template
-func (ts *TemplateService) DeleteTemplate(id string) error {
+// DeleteTemplate removes a template. Its versions are kept so that
+// certificates issued with it can still be rendered.
+func (ts *TemplateService) DeleteTemplate(orgID string, actor models.Actor, id string) error {
 	// Don't allow deletion of default template
 	if id == "default" {
 		return errors.New("cannot delete default template")
 	}
-	return ts.storage.DeleteTemplate(id)
+
+	existing, err := ts.storage.GetTemplate(orgID, id)
+	if err != nil {
+		return err
+	}
+	if err := ts.storage.DeleteTemplate(orgID, id); err != nil {
+		return err
+	}
+	recordAudit(ts.storage, orgID, actor, models.AuditTemplateDelete, models.AuditTargetTemplate, id, existing, nil)
+	return nil
 }
 
-// RenderCertificate renders a certificate using its template
+// RenderCertificate renders a certificate using the template version it
+// was issued with
 func (ts *TemplateService) RenderCertificate(cert *models.Certificate) (string, error) {
-	tmpl, err := ts.storage.GetTemplate(cert.TemplateID)
+	tmpl, err := ts.TemplateFor(cert)
 	if err != nil {
 		return "", err
 	}
+	return ts.renderTemplate(tmpl, cert)
+}
 
+// renderTemplate renders the HTML of tmpl for cert
+func (ts *TemplateService) renderTemplate(tmpl *models.Template, cert *models.Certificate) (string, error) {
 	// Parse template
-	t, err := template.New("certificate").Parse(tmpl.HTMLTemplate)
+	loc := certificateLocale(tmpl, cert)
+	t, err := parseHTMLTemplate("certificate", tmpl.HTMLTemplate, loc)
 	if err != nil {
 		return "", err
 	}
+	t.Funcs(ts.assetFuncs(tmpl.OrganizationID, tmpl.ID))
+
+	data := certificateData(cert, loc)
+
+	// QR code linking to the public verification page, for use as
+	// <img src="{{.QRCode}}">
+	if cert.VerificationURL != "" {
+		qr, err := QRCodeDataURI(cert.VerificationURL)
+		if err != nil {
+			return "", err
+		}
+		data["QRCode"] = qr
+	}
 
 	// Render with certificate data
-	var buf bytes.Buffer
-	err = t.Execute(&buf, cert.GetAllData())
+	rendered, err := executeTemplate(t, data)
 	if err != nil {
 		return "", err
 	}
 
-	return buf.String(), nil
-}
\ No newline at end of file
+	// Templates are not required to show the status or the signature, so
+	// both are added around the template output when missing
+	rendered = injectVerificationFooter(rendered, cert, loc)
+	return injectStatusBanner(rendered, cert, loc), nil
+}
+
+// injectVerificationFooter adds the verification link and signature before
+// </body> when the template does not display them itself
+func injectVerificationFooter(rendered string, cert *models.Certificate, loc *locale) string {
+	if cert.Signature == "" || strings.Contains(rendered, cert.Signature) {
+		return rendered
+	}
+
+	footer := `<div class="certificate-verification" style="text-align:center;font-family:sans-serif;` +
+		`font-size:11px;color:#999;margin:20px;word-break:break-all;">` +
+		html.EscapeString(loc.message("verification.check_at")) + ` <a href="` + html.EscapeString(cert.VerificationURL) + `">` +
+		html.EscapeString(cert.VerificationURL) + `</a><br>` + html.EscapeString(loc.message("verification.signature")) + `: ` +
+		html.EscapeString(cert.Signature) + `</div>`
+
+	if pos := strings.LastIndex(strings.ToLower(rendered), "</body>"); pos >= 0 {
+		return rendered[:pos] + footer + rendered[pos:]
+	}
+	return rendered + footer
+}
+
+// injectStatusBanner adds a warning banner right after the <body> tag of a
+// rendered certificate that is no longer valid
+func injectStatusBanner(rendered string, cert *models.Certificate, loc *locale) string {
+	if cert.IsValid() {
+		return rendered
+	}
+
+	var message string
+	switch cert.Status {
+	case models.StatusRevoked:
+		message = loc.message("status.revoked_banner")
+		if cert.RevokedAt != nil {
+			message += loc.message("status.on", formatLocalDate(*cert.RevokedAt, "short", loc))
+		}
+		if cert.RevocationReason != "" {
+			message += loc.message("status.reason", cert.RevocationReason)
+		}
+	case models.StatusSuperseded:
+		message = loc.message("status.superseded_banner")
+		if cert.SupersededBy != "" {
+			message += loc.message("status.superseded_by", cert.SupersededBy)
+		}
+	default:
+		message = loc.message("status.invalid_banner")
+	}
+
+	banner := `<div class="certificate-status-banner" style="background:#c0392b;color:#fff;` +
+		`padding:16px;text-align:center;font-family:sans-serif;font-size:20px;font-weight:bold;">` +
+		html.EscapeString(message) + `</div>`
+
+	lower := strings.ToLower(rendered)
+	if start := strings.Index(lower, "<body"); start >= 0 {
+		if end := strings.Index(lower[start:], ">"); end >= 0 {
+			pos := start + end + 1
+			return rendered[:pos] + banner + rendered[pos:]
+		}
+	}
+	return banner + rendered
+}
@@ -0,0 +1,232 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template/parse"
+	"time"
+	"vibe-certificados/models"
+)
+
+// builtinVariables are the template variables filled in from every
+// certificate, whatever the template fields declare
+var builtinVariables = map[string]bool{
+	"ID": true, "Email": true, "Name": true, "Course": true,
+	"CompletionDate": true, "CompletionDateLong": true, "CreatedAt": true,
+	"Status": true, "Revoked": true, "RevocationReason": true, "RevokedAt": true,
+	"Signature": true, "VerificationURL": true, "QRCode": true, "Locale": true,
+}
+
+// previewCertificateID identifies the sample certificates used for
+// validation and previews; they are never stored
+const previewCertificateID = "00000000-0000-0000-0000-000000000000"
+
+// validateHTMLTemplate parses the HTML template and renders it with sample
+// data, so syntax and escaping errors are reported when the template is
+// saved instead of when the first certificate is rendered
+func validateHTMLTemplate(tmpl *models.Template) error {
+	loc := localeFor(tmpl.Locale)
+	t, err := parseHTMLTemplate("certificate", tmpl.HTMLTemplate, loc)
+	if err != nil {
+		return fmt.Errorf("invalid html_template: %v", err)
+	}
+
+	sample := SampleCertificate(tmpl, nil)
+	if _, err := executeTemplate(t, certificateData(sample, loc)); err != nil {
+		return fmt.Errorf("invalid html_template: %v", err)
+	}
+	return nil
+}
+
+// UndeclaredVariables lists the variables used by the HTML template, PDF
+// layout or email of a template that are neither built-in certificate data
+// nor declared in Fields. They render empty unless supplied in the
+// certificate data, which is usually a typo.
+func UndeclaredVariables(tmpl *models.Template) []string {
+	sources := []string{tmpl.HTMLTemplate}
+	if tmpl.PDFLayout != nil {
+		for _, block := range tmpl.PDFLayout.Blocks {
+			sources = append(sources, block.Text)
+		}
+	}
+	if tmpl.Email != nil {
+		sources = append(sources, tmpl.Email.Subject, tmpl.Email.Body)
+	}
+
+	used := make(map[string]bool)
+	for _, source := range sources {
+		// Functions are checked by validation; here only the variables matter
+		tree := parse.New("template")
+		tree.Mode = parse.SkipFuncCheck
+		trees := make(map[string]*parse.Tree)
+		if _, err := tree.Parse(source, "", "", trees); err != nil {
+			continue
+		}
+		for _, t := range trees {
+			collectVariables(t.Root, true, used)
+		}
+	}
+
+	declared := make(map[string]bool)
+	for _, field := range tmpl.Fields {
+		declared[field.Name] = true
+	}
+
+	undeclared := make([]string, 0)
+	for name := range used {
+		if !builtinVariables[name] && !declared[name] {
+			undeclared = append(undeclared, name)
+		}
+	}
+	sort.Strings(undeclared)
+	return undeclared
+}
+
+// collectVariables records the top level data keys referenced under node.
+// Inside range and with blocks the dot is no longer the certificate data,
+// so only $.Name references count there.
+func collectVariables(node parse.Node, rootDot bool, used map[string]bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			collectVariables(child, rootDot, used)
+		}
+	case *parse.ActionNode:
+		collectPipeVariables(n.Pipe, rootDot, used)
+	case *parse.IfNode:
+		collectPipeVariables(n.Pipe, rootDot, used)
+		collectVariables(n.List, rootDot, used)
+		collectVariables(n.ElseList, rootDot, used)
+	case *parse.RangeNode:
+		collectPipeVariables(n.Pipe, rootDot, used)
+		collectVariables(n.List, false, used)
+		collectVariables(n.ElseList, rootDot, used)
+	case *parse.WithNode:
+		collectPipeVariables(n.Pipe, rootDot, used)
+		collectVariables(n.List, false, used)
+		collectVariables(n.ElseList, rootDot, used)
+	case *parse.TemplateNode:
+		collectPipeVariables(n.Pipe, rootDot, used)
+	}
+}
+
+// collectPipeVariables records the data keys referenced by a pipeline
+func collectPipeVariables(pipe *parse.PipeNode, rootDot bool, used map[string]bool) {
+	if pipe == nil {
+		return
+	}
+	for _, cmd := range pipe.Cmds {
+		for _, arg := range cmd.Args {
+			switch a := arg.(type) {
+			case *parse.FieldNode:
+				if rootDot {
+					used[a.Ident[0]] = true
+				}
+			case *parse.VariableNode:
+				if a.Ident[0] == "$" && len(a.Ident) > 1 {
+					used[a.Ident[1]] = true
+				}
+			case *parse.PipeNode:
+				collectPipeVariables(a, rootDot, used)
+			}
+		}
+	}
+}
+
+// SampleCertificate builds an unsaved certificate for previewing tmpl.
+// Values supplied in data (including name, course, email and
+// completion_date) take precedence; missing fields get their default or a
+// sample value matching their type.
+func SampleCertificate(tmpl *models.Template, supplied map[string]string) *models.Certificate {
+	values := map[string]string{
+		"email":           "maria.silva@example.com",
+		"name":            "Maria Silva",
+		"course":          "Curso de Exemplo",
+		"completion_date": time.Now().Format("2006-01-02"),
+	}
+	for name, value := range supplied {
+		values[name] = value
+	}
+	for _, field := range tmpl.Fields {
+		if values[field.Name] != "" {
+			continue
+		}
+		if field.Default != nil {
+			values[field.Name] = defaultValue(field.Default)
+		} else {
+			values[field.Name] = sampleFieldValue(field)
+		}
+	}
+
+	completionDate, err := time.Parse("2006-01-02", values["completion_date"])
+	if err != nil {
+		completionDate = time.Now()
+	}
+
+	data := make(map[string]string)
+	for name, value := range values {
+		if _, isRequestField := requestFields[name]; !isRequestField {
+			data[name] = value
+		}
+	}
+
+	cert := models.NewCertificate(values["email"], values["name"], values["course"], tmpl.ID, completionDate, data)
+	cert.ID = previewCertificateID
+	if tmpl.OrganizationID != "" {
+		cert.OrganizationID = tmpl.OrganizationID
+	}
+	return cert
+}
+
+// sampleFieldValue returns a valid example value for a field
+func sampleFieldValue(field models.TemplateField) string {
+	switch field.Type {
+	case models.FieldDate:
+		return time.Now().Format("2006-01-02")
+	case models.FieldNumber:
+		return "40"
+	case models.FieldEmail:
+		return "contato@example.com"
+	case models.FieldEnum:
+		if len(field.Options) > 0 {
+			return field.Options[0]
+		}
+	case models.FieldURL:
+		return "https://example.com"
+	}
+	return "Exemplo de " + strings.ReplaceAll(field.Name, "_", " ")
+}
+
+// PreviewHTML renders tmpl, which does not need to be saved, for a sample
+// certificate
+func (ts *TemplateService) PreviewHTML(tmpl *models.Template, cert *models.Certificate) (string, error) {
+	if err := ts.validate(tmpl); err != nil {
+		return "", err
+	}
+	return ts.renderTemplate(tmpl, cert)
+}
+
+// validate runs every check applied when a template is saved
+func (ts *TemplateService) validate(tmpl *models.Template) error {
+	if tmpl == nil {
+		return errors.New("template is required")
+	}
+	if err := validateLocale(tmpl.Locale); err != nil {
+		return err
+	}
+	if err := ValidatePDFLayout(tmpl.PDFLayout); err != nil {
+		return err
+	}
+	if err := ValidateEmailTemplate(tmpl.Email); err != nil {
+		return err
+	}
+	if err := ValidateTemplateFields(tmpl.Fields); err != nil {
+		return err
+	}
+	return validateHTMLTemplate(tmpl)
+}
@@ -0,0 +1,269 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"vibe-certificados/models"
+	"vibe-certificados/storage"
+)
+
+// TemplateFor returns the template version a certificate was issued with.
+// Certificates issued before templates were versioned use the first
+// version, which holds the design that was active at that time; when no
+// version is stored at all the current template is used.
+func (ts *TemplateService) TemplateFor(cert *models.Certificate) (*models.Template, error) {
+	version := cert.TemplateVersion
+	if version == 0 {
+		version = 1
+	}
+
+	tmpl, err := ts.storage.GetTemplateVersion(cert.OrganizationID, cert.TemplateID, version)
+	if errors.Is(err, storage.ErrTemplateVersionNotFound) && cert.TemplateVersion == 0 {
+		return ts.storage.GetTemplate(cert.OrganizationID, cert.TemplateID)
+	}
+	return tmpl, err
+}
+
+// GetTemplateVersions lists the versions of a template, oldest first
+func (ts *TemplateService) GetTemplateVersions(orgID, id string) ([]*models.Template, error) {
+	versions, err := ts.storage.GetTemplateVersions(orgID, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		return nil, storage.ErrTemplateNotFound
+	}
+	return versions, nil
+}
+
+// GetTemplateVersion retrieves a version of a template
+func (ts *TemplateService) GetTemplateVersion(orgID, id string, version int) (*models.Template, error) {
+	return ts.storage.GetTemplateVersion(orgID, id, version)
+}
+
+// RollbackTemplate makes an earlier version the active version of a
+// template. No version is created or removed; certificates issued from now
+// on record the restored version.
+func (ts *TemplateService) RollbackTemplate(orgID string, actor models.Actor, id string, version int) (*models.Template, error) {
+	ts.versionMu.Lock()
+	defer ts.versionMu.Unlock()
+
+	current, err := ts.storage.GetTemplate(orgID, id)
+	if err != nil {
+		return nil, err
+	}
+	target, err := ts.storage.GetTemplateVersion(orgID, id, version)
+	if err != nil {
+		return nil, err
+	}
+
+	restored := *target
+	restored.CreatedAt = current.CreatedAt
+	restored.UpdatedAt = time.Now().Format("2006-01-02 15:04:05")
+	if err := ts.storage.SaveTemplate(&restored); err != nil {
+		return nil, err
+	}
+	recordAudit(ts.storage, orgID, actor, models.AuditTemplateRollback, models.AuditTargetTemplate, id, current, &restored)
+	return &restored, nil
+}
+
+// DiffTemplateVersions compares two versions of a template. Only the parts
+// that changed are listed, each as a line diff.
+func (ts *TemplateService) DiffTemplateVersions(orgID, id string, from, to int) (*models.TemplateDiff, error) {
+	fromTemplate, err := ts.storage.GetTemplateVersion(orgID, id, from)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %d", err, from)
+	}
+	toTemplate, err := ts.storage.GetTemplateVersion(orgID, id, to)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %d", err, to)
+	}
+
+	diff := &models.TemplateDiff{ID: id, From: from, To: to, Changes: make([]models.TemplateChange, 0)}
+	for _, part := range []string{"name", "html_template", "fields", "pdf_layout", "email"} {
+		before, after := templatePart(fromTemplate, part), templatePart(toTemplate, part)
+		if before == after {
+			continue
+		}
+		diff.Changes = append(diff.Changes, models.TemplateChange{
+			Field: part,
+			Diff:  diffLines(splitLines(before), splitLines(after)),
+		})
+	}
+	return diff, nil
+}
+
+// saveNewVersion stores template as the next version of its ID and makes
+// it the active template. Numbering continues after the highest stored
+// version, including versions of a deleted template with the same ID in
+// the same organization.
+func (ts *TemplateService) saveNewVersion(template *models.Template) error {
+	ts.versionMu.Lock()
+	defer ts.versionMu.Unlock()
+
+	versions, err := ts.storage.GetTemplateVersions(template.OrganizationID, template.ID)
+	if err != nil {
+		return err
+	}
+	template.Version = 1
+	for _, version := range versions {
+		if version.Version >= template.Version {
+			template.Version = version.Version + 1
+		}
+	}
+
+	if err := ts.storage.SaveTemplateVersion(template); err != nil {
+		return err
+	}
+	return ts.storage.SaveTemplate(template)
+}
+
+// versionLegacyTemplates stores templates saved before versioning existed
+// as their first version. Such templates predate organizations too, so
+// they all belong to the default organization.
+func (ts *TemplateService) versionLegacyTemplates() {
+	templates, err := ts.storage.GetAllTemplates(models.DefaultOrganizationID)
+	if err != nil {
+		log.Printf("failed to list templates for versioning: %v", err)
+		return
+	}
+
+	for _, template := range templates {
+		if template.Version != 0 {
+			continue
+		}
+		versioned := *template
+		versioned.Version = 1
+		if err := ts.storage.SaveTemplateVersion(&versioned); err != nil {
+			log.Printf("failed to version template %s: %v", template.ID, err)
+			continue
+		}
+		if err := ts.storage.SaveTemplate(&versioned); err != nil {
+			log.Printf("failed to version template %s: %v", template.ID, err)
+		}
+	}
+}
+
+// templatePart returns a part of a template as text for diffing. Structured
+// parts are indented JSON so that changes show up line by line.
+func templatePart(tmpl *models.Template, part string) string {
+	var value interface{}
+	switch part {
+	case "name":
+		return tmpl.Name
+	case "html_template":
+		return tmpl.HTMLTemplate
+	case "fields":
+		value = tmpl.Fields
+	case "pdf_layout":
+		if tmpl.PDFLayout == nil {
+			return ""
+		}
+		value = tmpl.PDFLayout
+	case "email":
+		if tmpl.Email == nil {
+			return ""
+		}
+		value = tmpl.Email
+	}
+
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// splitLines splits text into lines, returning no lines for empty text
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// maxDiffCells bounds the size of the table diffLines builds (about 8MB);
+// larger changes are shown as a removed block followed by an added one
+const maxDiffCells = 1 << 20
+
+// diffLines returns a line diff of a and b based on their longest common
+// subsequence. Lines are prefixed with "+ " when added, "- " when removed
+// and "  " when unchanged.
+func diffLines(a, b []string) []string {
+	// Only the lines between the common prefix and suffix are compared
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	lines := make([]string, 0, len(a)+len(b)-prefix-suffix)
+	for _, line := range a[:prefix] {
+		lines = append(lines, "  "+line)
+	}
+	lines = append(lines, diffChangedLines(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		lines = append(lines, "  "+line)
+	}
+	return lines
+}
+
+// diffChangedLines diffs what is left of a and b once diffLines has dropped
+// their common prefix and suffix
+func diffChangedLines(a, b []string) []string {
+	lines := make([]string, 0, len(a)+len(b))
+	if (len(a)+1)*(len(b)+1) > maxDiffCells {
+		for _, line := range a {
+			lines = append(lines, "- "+line)
+		}
+		for _, line := range b {
+			lines = append(lines, "+ "+line)
+		}
+		return lines
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			lines = append(lines, "  "+a[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, "- "+a[i])
+			i++
+		default:
+			lines = append(lines, "+ "+b[j])
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		lines = append(lines, "- "+a[i])
+	}
+	for ; j < len(b); j++ {
+		lines = append(lines, "+ "+b[j])
+	}
+	return lines
+}
@@ -0,0 +1,426 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// XLSXReader reads certificate requests from a sheet of an Excel workbook
+// one row at a time. The first non-empty row is the header; columns other
+// than the request fields are kept in the request Data.
+type XLSXReader struct {
+	sheet   io.ReadCloser
+	decoder *xml.Decoder
+	table   *tableReader
+	lastRow int // number of the last row read
+
+	sharedStrings []string
+	dateStyles    map[int]bool // cell styles that format numbers as dates
+	date1904      bool
+}
+
+// xlsxText is a string of a workbook, either plain or made of formatted runs
+type xlsxText struct {
+	T    string `xml:"t"`
+	Runs []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxText) String() string {
+	if len(t.Runs) == 0 {
+		return t.T
+	}
+	var text strings.Builder
+	for _, run := range t.Runs {
+		text.WriteString(run.T)
+	}
+	return text.String()
+}
+
+type xlsxCell struct {
+	Ref    string    `xml:"r,attr"`
+	Style  int       `xml:"s,attr"`
+	Type   string    `xml:"t,attr"`
+	Value  string    `xml:"v"`
+	Inline *xlsxText `xml:"is"`
+}
+
+type xlsxRow struct {
+	Number int        `xml:"r,attr"`
+	Cells  []xlsxCell `xml:"c"`
+}
+
+// NewXLSXReader opens a sheet of a workbook, the one named opts.Sheet or
+// else the first, and reads its header. The whole file is read when data
+// cannot be read at random, since workbooks are ZIP archives.
+func NewXLSXReader(data io.Reader, opts ImportOptions) (*XLSXReader, error) {
+	archive, err := openXLSX(data)
+	if err != nil {
+		return nil, err
+	}
+
+	sheetPath, date1904, err := xlsxSheetPath(archive, opts.Sheet)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &XLSXReader{date1904: date1904}
+	if r.sharedStrings, err = xlsxSharedStrings(archive); err != nil {
+		return nil, err
+	}
+	if r.dateStyles, err = xlsxDateStyles(archive); err != nil {
+		return nil, err
+	}
+
+	if r.sheet, err = archive.Open(sheetPath); err != nil {
+		return nil, errors.New("XLSX sheet is missing: " + sheetPath)
+	}
+	r.decoder = xml.NewDecoder(r.sheet)
+
+	for {
+		_, record, err := r.nextRecord()
+		if err == io.EOF {
+			r.sheet.Close()
+			return nil, errors.New("XLSX sheet is empty")
+		}
+		if err != nil {
+			r.sheet.Close()
+			return nil, err
+		}
+		if !emptyRecord(record) {
+			if r.table, err = newTableReader(record, opts, "XLSX sheet"); err != nil {
+				r.sheet.Close()
+				return nil, err
+			}
+			return r, nil
+		}
+	}
+}
+
+// Next returns the next non-empty row of the sheet, or io.EOF after the last
+// one. Rows are numbered as in the spreadsheet.
+func (r *XLSXReader) Next() (BatchRow, error) {
+	for {
+		number, record, err := r.nextRecord()
+		if err == io.EOF {
+			r.sheet.Close()
+			return BatchRow{}, io.EOF
+		}
+		if err != nil {
+			r.sheet.Close()
+			return BatchRow{}, err
+		}
+		if !emptyRecord(record) {
+			return r.table.row(number, record), nil
+		}
+	}
+}
+
+// nextRecord decodes the next row element of the sheet into the text of its
+// cells
+func (r *XLSXReader) nextRecord() (int, []string, error) {
+	for {
+		token, err := r.decoder.Token()
+		if err == io.EOF {
+			return 0, nil, io.EOF
+		}
+		if err != nil {
+			return 0, nil, errors.New("failed to parse XLSX sheet: " + err.Error())
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "row" {
+			continue
+		}
+		var row xlsxRow
+		if err := r.decoder.DecodeElement(&row, &start); err != nil {
+			return 0, nil, errors.New("failed to parse XLSX sheet: " + err.Error())
+		}
+
+		// Rows without a number follow the previous one
+		r.lastRow++
+		if row.Number > 0 {
+			r.lastRow = row.Number
+		}
+
+		var record []string
+		for _, cell := range row.Cells {
+			column := len(record)
+			if cell.Ref != "" {
+				column = xlsxColumn(cell.Ref)
+			}
+			if column < 0 || column >= xlsxMaxColumns {
+				return 0, nil, errors.New("failed to parse XLSX sheet: row " + strconv.Itoa(r.lastRow) + " has a cell past column XFD")
+			}
+			for len(record) <= column {
+				record = append(record, "")
+			}
+			record[column] = r.cellText(cell)
+		}
+		return r.lastRow, record, nil
+	}
+}
+
+// cellText returns the text of a cell; numbers formatted as dates are
+// returned as YYYY-MM-DD
+func (r *XLSXReader) cellText(cell xlsxCell) string {
+	switch cell.Type {
+	case "s":
+		index, err := strconv.Atoi(cell.Value)
+		if err != nil || index < 0 || index >= len(r.sharedStrings) {
+			return ""
+		}
+		return r.sharedStrings[index]
+	case "inlineStr":
+		if cell.Inline == nil {
+			return ""
+		}
+		return cell.Inline.String()
+	case "b":
+		return strconv.FormatBool(cell.Value == "1")
+	case "str", "e", "d":
+		return cell.Value
+	}
+
+	number, err := strconv.ParseFloat(cell.Value, 64)
+	if err != nil {
+		return cell.Value
+	}
+	if r.dateStyles[cell.Style] {
+		return xlsxDate(number, r.date1904)
+	}
+	return strconv.FormatFloat(number, 'f', -1, 64)
+}
+
+// xlsxDate converts a date serial number of a workbook, counted in days, to
+// YYYY-MM-DD, adding the time when it is not midnight
+func xlsxDate(serial float64, date1904 bool) string {
+	// 1899-12-30 rather than 1899-12-31 makes up for the 29 February 1900
+	// that Excel counts
+	epoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	if date1904 {
+		epoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	days, fraction := math.Modf(serial)
+	date := epoch.AddDate(0, 0, int(days)).Add(time.Duration(math.Round(fraction*86400)) * time.Second)
+	if date.Hour() == 0 && date.Minute() == 0 && date.Second() == 0 {
+		return date.Format("2006-01-02")
+	}
+	return date.Format("2006-01-02T15:04:05")
+}
+
+// xlsxMaxColumns is the number of columns of a sheet, A to XFD
+const xlsxMaxColumns = 16384
+
+// xlsxColumn returns the index of the column of a cell reference like "AB12",
+// or xlsxMaxColumns for references past column XFD
+func xlsxColumn(ref string) int {
+	column := 0
+	for _, c := range strings.ToUpper(ref) {
+		if c < 'A' || c > 'Z' {
+			break
+		}
+		// Stops before the index can overflow
+		if column = column*26 + int(c-'A') + 1; column > xlsxMaxColumns {
+			return xlsxMaxColumns
+		}
+	}
+	return column - 1
+}
+
+func emptyRecord(record []string) bool {
+	for _, value := range record {
+		if strings.TrimSpace(value) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// openXLSX opens data as a ZIP archive
+func openXLSX(data io.Reader) (*zip.Reader, error) {
+	var (
+		readerAt io.ReaderAt
+		size     int64
+	)
+	if file, ok := data.(interface {
+		io.ReaderAt
+		io.Seeker
+	}); ok {
+		end, err := file.Seek(0, io.SeekEnd)
+		if err != nil {
+			return nil, errors.New("failed to read XLSX file: " + err.Error())
+		}
+		readerAt, size = file, end
+	} else {
+		content, err := io.ReadAll(data)
+		if err != nil {
+			return nil, errors.New("failed to read XLSX file: " + err.Error())
+		}
+		readerAt, size = bytes.NewReader(content), int64(len(content))
+	}
+
+	archive, err := zip.NewReader(readerAt, size)
+	if err != nil {
+		return nil, errors.New("file is not a valid XLSX workbook")
+	}
+	return archive, nil
+}
+
+// decodeXLSXPart decodes an XML part of a workbook, reporting whether it
+// exists
+func decodeXLSXPart(archive *zip.Reader, name string, v any) (bool, error) {
+	part, err := archive.Open(name)
+	if err != nil {
+		return false, nil
+	}
+	defer part.Close()
+
+	if err := xml.NewDecoder(part).Decode(v); err != nil {
+		return true, errors.New("failed to parse XLSX " + name + ": " + err.Error())
+	}
+	return true, nil
+}
+
+// xlsxSheetPath returns the part holding the sheet named name, or the first
+// sheet when name is empty, and whether dates count from 1904
+func xlsxSheetPath(archive *zip.Reader, name string) (string, bool, error) {
+	var workbook struct {
+		Properties struct {
+			Date1904 string `xml:"date1904,attr"`
+		} `xml:"workbookPr"`
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+			RID  string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	found, err := decodeXLSXPart(archive, "xl/workbook.xml", &workbook)
+	if err != nil {
+		return "", false, err
+	}
+	if !found || len(workbook.Sheets) == 0 {
+		return "", false, errors.New("XLSX workbook has no sheets")
+	}
+	date1904 := workbook.Properties.Date1904 == "1" || workbook.Properties.Date1904 == "true"
+
+	rID := workbook.Sheets[0].RID
+	if name != "" {
+		rID = ""
+		for _, sheet := range workbook.Sheets {
+			if strings.EqualFold(strings.TrimSpace(sheet.Name), strings.TrimSpace(name)) {
+				rID = sheet.RID
+				break
+			}
+		}
+		if rID == "" {
+			return "", false, errors.New("sheet not found in XLSX workbook: " + name)
+		}
+	}
+
+	var relationships struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if _, err := decodeXLSXPart(archive, "xl/_rels/workbook.xml.rels", &relationships); err != nil {
+		return "", false, err
+	}
+	for _, rel := range relationships.Relationships {
+		if rel.ID != rID {
+			continue
+		}
+		if strings.HasPrefix(rel.Target, "/") {
+			return strings.TrimPrefix(rel.Target, "/"), date1904, nil
+		}
+		return path.Join("xl", rel.Target), date1904, nil
+	}
+	return "", false, errors.New("XLSX sheet is missing from the workbook")
+}
+
+// xlsxSharedStrings reads the strings cells of a workbook refer to by index
+func xlsxSharedStrings(archive *zip.Reader) ([]string, error) {
+	var table struct {
+		Items []xlsxText `xml:"si"`
+	}
+	if _, err := decodeXLSXPart(archive, "xl/sharedStrings.xml", &table); err != nil {
+		return nil, err
+	}
+
+	strs := make([]string, len(table.Items))
+	for i, item := range table.Items {
+		strs[i] = item.String()
+	}
+	return strs, nil
+}
+
+// xlsxDateStyles returns the cell styles of a workbook that format numbers
+// as dates
+func xlsxDateStyles(archive *zip.Reader) (map[int]bool, error) {
+	var styles struct {
+		NumFmts []struct {
+			ID   int    `xml:"numFmtId,attr"`
+			Code string `xml:"formatCode,attr"`
+		} `xml:"numFmts>numFmt"`
+		CellXfs []struct {
+			NumFmtID int `xml:"numFmtId,attr"`
+		} `xml:"cellXfs>xf"`
+	}
+	if _, err := decodeXLSXPart(archive, "xl/styles.xml", &styles); err != nil {
+		return nil, err
+	}
+
+	dateFormats := make(map[int]bool)
+	for id := 14; id <= 22; id++ {
+		dateFormats[id] = true
+	}
+	for id := 45; id <= 47; id++ {
+		dateFormats[id] = true
+	}
+	for _, format := range styles.NumFmts {
+		dateFormats[format.ID] = isDateFormat(format.Code)
+	}
+
+	dateStyles := make(map[int]bool)
+	for i, xf := range styles.CellXfs {
+		if dateFormats[xf.NumFmtID] {
+			dateStyles[i] = true
+		}
+	}
+	return dateStyles, nil
+}
+
+// isDateFormat reports whether a number format code shows dates or times,
+// ignoring quoted text, escaped characters and [colour] sections
+func isDateFormat(code string) bool {
+	inQuotes, inBrackets, escaped := false, false, false
+	for _, c := range strings.ToLower(code) {
+		switch {
+		case escaped:
+			escaped = false
+		case inQuotes:
+			inQuotes = c != '"'
+		case inBrackets:
+			inBrackets = c != ']'
+		case c == '"':
+			inQuotes = true
+		case c == '[':
+			inBrackets = true
+		case c == '\\':
+			escaped = true
+		case c == 'y', c == 'm', c == 'd', c == 'h', c == 's':
+			return true
+		}
+	}
+	return false
+}
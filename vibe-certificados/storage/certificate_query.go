@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+	"vibe-certificados/models"
+)
+
+// sortableTimeFormat is a fixed-width RFC 3339 layout, so timestamps
+// formatted in UTC compare correctly as text
+const sortableTimeFormat = "2006-01-02T15:04:05.000000000Z07:00"
+
+// sortableTime formats t with sortableTimeFormat
+func sortableTime(t time.Time) string {
+	return t.UTC().Format(sortableTimeFormat)
+}
+
+// pageCursor is the position of the last certificate of a page within its
+// sort order, which the cursor records so it cannot be used with another
+type pageCursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    string `json:"id"`
+}
+
+// querySort describes the sort order of a query, e.g. "-created_at"
+func querySort(query *models.CertificateQuery) string {
+	if query.Descending {
+		return "-" + query.Sort
+	}
+	return query.Sort
+}
+
+// encodeCursor returns the cursor of the page following the certificate
+// with the given sort value and ID
+func encodeCursor(query *models.CertificateQuery, value, id string) string {
+	data, _ := json.Marshal(pageCursor{Sort: querySort(query), Value: value, ID: id})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor parses the cursor of a query, returning nil for the first page
+func decodeCursor(query *models.CertificateQuery) (*pageCursor, error) {
+	if query.Cursor == "" {
+		return nil, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(query.Cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var cursor pageCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.Sort != querySort(query) || cursor.ID == "" {
+		return nil, ErrInvalidCursor
+	}
+	return &cursor, nil
+}
+
+// certificateSortValue returns the value a certificate is sorted by
+func certificateSortValue(cert *models.Certificate, field string) string {
+	switch field {
+	case models.SortCompletionDate:
+		return sortableTime(cert.CompletionDate)
+	case models.SortName:
+		return cert.Name
+	case models.SortCourse:
+		return cert.Course
+	default:
+		return sortableTime(cert.CreatedAt)
+	}
+}
+
+// matchesCertificateQuery reports whether a certificate is selected by the
+// filters of a query
+func matchesCertificateQuery(cert *models.Certificate, query *models.CertificateQuery) bool {
+	switch {
+	case query.Course != "" && cert.Course != query.Course:
+		return false
+	case query.TemplateID != "" && cert.TemplateID != query.TemplateID:
+		return false
+	case query.Name != "" && !strings.Contains(strings.ToLower(cert.Name), strings.ToLower(query.Name)):
+		return false
+	case query.Status == models.StatusActive && !cert.IsValid():
+		return false
+	case query.Status != "" && query.Status != models.StatusActive && cert.Status != query.Status:
+		return false
+	case !inTimeRange(cert.CompletionDate, query.CompletedFrom, query.CompletedUntil):
+		return false
+	case !inTimeRange(cert.CreatedAt, query.CreatedFrom, query.CreatedUntil):
+		return false
+	}
+	return true
+}
+
+// inTimeRange reports whether from <= t < until, ignoring zero bounds
+func inTimeRange(t, from, until time.Time) bool {
+	return (from.IsZero() || !t.Before(from)) && (until.IsZero() || t.Before(until))
+}
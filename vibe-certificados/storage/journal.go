@@ -0,0 +1,363 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"vibe-certificados/models"
+)
+
+// File names used inside the durability directory
+const (
+	snapshotFile = "snapshot.json"
+	journalFile  = "journal.log"
+)
+
+// Journal operations
+const (
+	opSaveCertificate  = "save_certificate"
+	opSaveDelivery     = "save_delivery"
+	opSaveTemplate     = "save_template"
+	opDeleteTemplate   = "delete_template"
+	opSaveVersion      = "save_template_version"
+	opSaveAsset        = "save_asset"
+	opDeleteAsset      = "delete_asset"
+	opSaveJob          = "save_job"
+	opSaveJobProgress  = "save_job_progress"
+	opSaveOrganization = "save_organization"
+	opSaveAPIKey       = "save_api_key"
+	opSaveAuditEntry   = "save_audit_entry"
+	opSaveIdempotency  = "save_idempotency_key"
+	opDeleteJob        = "delete_job"
+)
+
+// journalEntry is a single change recorded in the journal
+type journalEntry struct {
+	Op          string                 `json:"op"`
+	Certificate *models.Certificate    `json:"certificate,omitempty"`
+	Template    *models.Template       `json:"template,omitempty"`
+	Asset       *models.TemplateAsset  `json:"asset,omitempty"`
+	Job         *models.BatchJob       `json:"job,omitempty"`
+	Org         *models.Organization   `json:"org,omitempty"`
+	APIKey      *apiKeyRecord          `json:"api_key,omitempty"`
+	Audit       *models.AuditEntry     `json:"audit,omitempty"`
+	Idempotency *models.IdempotencyKey `json:"idempotency_key,omitempty"`
+	Offsets     *jobOffsets            `json:"offsets,omitempty"` // with save_job_progress
+	Delivery    *models.DeliveryStatus `json:"delivery,omitempty"`
+	ID          string                 `json:"id,omitempty"`
+	Name        string                 `json:"name,omitempty"` // asset name, with ID holding the template ID
+	// Organization scopes the template ID of deletions; entries written
+	// before organizations existed leave it empty
+	Organization string `json:"organization,omitempty"`
+}
+
+// snapshot is the full state written when the journal is compacted
+type snapshot struct {
+	Certificates  []*models.Certificate    `json:"certificates"`
+	Templates     []*models.Template       `json:"templates"`
+	Versions      []*models.Template       `json:"template_versions,omitempty"`
+	Assets        []*models.TemplateAsset  `json:"assets,omitempty"`
+	Jobs          []*models.BatchJob       `json:"jobs,omitempty"`
+	Organizations []*models.Organization   `json:"organizations,omitempty"`
+	APIKeys       []*apiKeyRecord          `json:"api_keys,omitempty"`
+	Audit         []*models.AuditEntry     `json:"audit,omitempty"`
+	Idempotency   []*models.IdempotencyKey `json:"idempotency_keys,omitempty"`
+}
+
+// jobOffsets tells where the rows of a save_job_progress entry start in the
+// errors and IDs of the job, so that replaying the entry twice (e.g. over a
+// snapshot that already has it) does not record them twice
+type jobOffsets struct {
+	Errors   int `json:"errors"`
+	Created  int `json:"created"`
+	Existing int `json:"existing"`
+}
+
+// apiKeyRecord stores an API key with its hash, which the JSON of
+// models.APIKey leaves out
+type apiKeyRecord struct {
+	*models.APIKey
+	Hash string `json:"hash"`
+}
+
+// newAPIKeyRecord wraps key for the journal
+func newAPIKeyRecord(key *models.APIKey) *apiKeyRecord {
+	return &apiKeyRecord{APIKey: key, Hash: key.Hash}
+}
+
+// key returns the API key with its hash restored
+func (r *apiKeyRecord) key() *models.APIKey {
+	r.APIKey.Hash = r.Hash
+	return r.APIKey
+}
+
+// journal persists MemoryStorage changes as an append-only log of
+// checksummed JSON lines ("<crc32 hex> <json>\n") next to a JSON snapshot
+type journal struct {
+	dir  string
+	file *os.File
+}
+
+// openJournal prepares dir for use as a durability directory
+func openJournal(dir string) (*journal, error) {
+	if dir == "" {
+		return nil, errors.New("journal directory is required")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create journal directory: %v", err)
+	}
+	return &journal{dir: dir}, nil
+}
+
+// load replays the snapshot and the journal through apply. Corrupted or
+// incomplete entries at the end of the journal (e.g. from a crash during a
+// write) are logged and truncated. A corrupted entry followed by valid ones
+// cannot come from a crash, so loading fails with ErrCorruptedJournal
+// rather than dropping the entries after it.
+func (j *journal) load(apply func(journalEntry)) error {
+	if err := j.loadSnapshot(apply); err != nil {
+		return err
+	}
+
+	path := filepath.Join(j.dir, journalFile)
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open journal: %v", err)
+	}
+
+	validSize, err := replayJournal(file, apply)
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	if info.Size() > validSize {
+		log.Printf("journal %s: truncating %d corrupted bytes at offset %d", path, info.Size()-validSize, validSize)
+		if err := file.Truncate(validSize); err != nil {
+			file.Close()
+			return fmt.Errorf("failed to truncate journal: %v", err)
+		}
+	}
+	if _, err := file.Seek(validSize, io.SeekStart); err != nil {
+		file.Close()
+		return err
+	}
+
+	j.file = file
+	return nil
+}
+
+// loadSnapshot applies the snapshot, if one exists
+func (j *journal) loadSnapshot(apply func(journalEntry)) error {
+	data, err := os.ReadFile(filepath.Join(j.dir, snapshotFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read snapshot: %v", err)
+	}
+
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return fmt.Errorf("failed to parse snapshot: %v", err)
+	}
+
+	for _, org := range snap.Organizations {
+		apply(journalEntry{Op: opSaveOrganization, Org: org})
+	}
+	for _, key := range snap.APIKeys {
+		apply(journalEntry{Op: opSaveAPIKey, APIKey: key})
+	}
+	for _, template := range snap.Templates {
+		apply(journalEntry{Op: opSaveTemplate, Template: template})
+	}
+	for _, version := range snap.Versions {
+		apply(journalEntry{Op: opSaveVersion, Template: version})
+	}
+	for _, asset := range snap.Assets {
+		apply(journalEntry{Op: opSaveAsset, Asset: asset})
+	}
+	for _, cert := range snap.Certificates {
+		apply(journalEntry{Op: opSaveCertificate, Certificate: cert})
+	}
+	for _, job := range snap.Jobs {
+		apply(journalEntry{Op: opSaveJob, Job: job})
+	}
+	for _, entry := range snap.Audit {
+		apply(journalEntry{Op: opSaveAuditEntry, Audit: entry})
+	}
+	for _, key := range snap.Idempotency {
+		apply(journalEntry{Op: opSaveIdempotency, Idempotency: key})
+	}
+	return nil
+}
+
+// replayJournal applies every valid entry and returns the size in bytes of
+// the valid prefix of the journal. Only invalid entries at the end may
+// follow that prefix.
+func replayJournal(r io.Reader, apply func(journalEntry)) (int64, error) {
+	reader := bufio.NewReader(r)
+	var offset, size int64
+	line := 0
+	corrupted := 0 // first invalid line, if any
+
+	for {
+		data, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// Anything left without a trailing newline is an incomplete write
+			return offset, nil
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to read journal: %v", err)
+		}
+		line++
+		size += int64(len(data))
+
+		entry, ok := decodeJournalLine(data)
+		switch {
+		case !ok && corrupted == 0:
+			corrupted = line
+		case ok && corrupted != 0:
+			return 0, fmt.Errorf("%w: line %d is invalid but line %d after it is not; "+
+				"move the journal aside to start without its entries", ErrCorruptedJournal, corrupted, line)
+		case ok:
+			apply(entry)
+			offset = size
+		}
+	}
+}
+
+// encodeJournalLine serialises an entry with its checksum
+func encodeJournalLine(entry journalEntry) ([]byte, error) {
+	payload, err := json.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	line := fmt.Sprintf("%08x %s\n", crc32.ChecksumIEEE(payload), payload)
+	return []byte(line), nil
+}
+
+// decodeJournalLine parses and verifies a line written by encodeJournalLine
+func decodeJournalLine(line []byte) (journalEntry, bool) {
+	var entry journalEntry
+
+	line = bytes.TrimSuffix(line, []byte("\n"))
+	checksum, payload, found := bytes.Cut(line, []byte(" "))
+	if !found {
+		return entry, false
+	}
+
+	expected, err := strconv.ParseUint(string(checksum), 16, 32)
+	if err != nil || uint32(expected) != crc32.ChecksumIEEE(payload) {
+		return entry, false
+	}
+	if err := json.Unmarshal(payload, &entry); err != nil {
+		return entry, false
+	}
+
+	switch entry.Op {
+	case opSaveCertificate:
+		return entry, entry.Certificate != nil
+	case opSaveDelivery:
+		return entry, entry.ID != "" && entry.Delivery != nil
+	case opSaveTemplate, opSaveVersion:
+		return entry, entry.Template != nil
+	case opSaveAsset:
+		return entry, entry.Asset != nil
+	case opSaveJob:
+		return entry, entry.Job != nil
+	case opSaveJobProgress:
+		return entry, entry.Job != nil && entry.Offsets != nil
+	case opSaveOrganization:
+		return entry, entry.Org != nil
+	case opSaveAPIKey:
+		return entry, entry.APIKey != nil && entry.APIKey.APIKey != nil
+	case opSaveAuditEntry:
+		return entry, entry.Audit != nil
+	case opSaveIdempotency:
+		return entry, entry.Idempotency != nil
+	case opDeleteTemplate, opDeleteJob:
+		return entry, entry.ID != ""
+	case opDeleteAsset:
+		return entry, entry.ID != "" && entry.Name != ""
+	default:
+		return entry, false
+	}
+}
+
+// append writes an entry to the journal and flushes it to disk
+func (j *journal) append(entry journalEntry) error {
+	line, err := encodeJournalLine(entry)
+	if err != nil {
+		return err
+	}
+	if _, err := j.file.Write(line); err != nil {
+		return fmt.Errorf("failed to write journal: %v", err)
+	}
+	return j.file.Sync()
+}
+
+// compact atomically replaces the snapshot and empties the journal. If the
+// process dies between the two steps, replaying the old journal over the
+// new snapshot is harmless because every operation is idempotent.
+func (j *journal) compact(snap *snapshot) error {
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := filepath.Join(j.dir, snapshotFile+".tmp")
+	if err := writeFileSync(tmpPath, data); err != nil {
+		return fmt.Errorf("failed to write snapshot: %v", err)
+	}
+	if err := os.Rename(tmpPath, filepath.Join(j.dir, snapshotFile)); err != nil {
+		return fmt.Errorf("failed to replace snapshot: %v", err)
+	}
+
+	if err := j.file.Truncate(0); err != nil {
+		return fmt.Errorf("failed to truncate journal: %v", err)
+	}
+	if _, err := j.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return j.file.Sync()
+}
+
+// close closes the journal file
+func (j *journal) close() error {
+	if j.file == nil {
+		return nil
+	}
+	return j.file.Close()
+}
+
+// writeFileSync writes data to path and flushes it to disk
+func writeFileSync(path string, data []byte) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -1,42 +1,108 @@
 package storage
 
 import (
-	"errors"
+	"log"
+	"slices"
+	"sort"
 	"sync"
+	"time"
 	"vibe-certificados/models"
 )
 
-// MemoryStorage provides in-memory storage for certificates and templates
+// MemoryStorage provides in-memory storage for certificates, templates and jobs.
+// When created with NewJournaledMemoryStorage every change is also written
+// to an append-only journal so the data survives restarts.
 type MemoryStorage struct {
-	certificates map[string]*models.Certificate
-	templates    map[string]*models.Template
-	emailIndex   map[string][]string // email -> list of certificate IDs
-	mutex        sync.RWMutex
+	certificates  map[string]*models.Certificate
+	templates     map[scopedKey]*models.Template
+	versions      map[scopedKey]map[int]*models.Template         // template -> version -> template
+	assets        map[scopedKey]map[string]*models.TemplateAsset // template -> name -> asset
+	jobs          map[string]*models.BatchJob
+	organizations map[string]*models.Organization
+	apiKeys       map[string]*models.APIKey // key hash -> key
+	audit         []*models.AuditEntry      // in the order recorded
+	auditIDs      map[string]bool           // IDs in audit, so replays are idempotent
+	idempotency   map[scopedKey]*models.IdempotencyKey
+	emailIndex    map[string][]string    // email -> list of certificate IDs
+	orgIndex      map[string][]string    // organization -> certificate IDs, by creation
+	courseIndex   map[scopedKey][]string // organization and course -> certificate IDs
+	templateIndex map[scopedKey][]string // organization and template -> certificate IDs
+	statusIndex   map[scopedKey][]string // organization and status -> certificate IDs
+	mutex         sync.RWMutex
+
+	journal *journal      // nil when durability is disabled
+	stop    chan struct{} // stops the periodic compaction
+	done    chan struct{} // closed when the compaction loop exits
+}
+
+var _ Storage = (*MemoryStorage)(nil)
+
+// scopedKey identifies a template within its organization
+type scopedKey struct {
+	org string
+	id  string
 }
 
 // NewMemoryStorage creates a new in-memory storage instance
 func NewMemoryStorage() *MemoryStorage {
 	return &MemoryStorage{
-		certificates: make(map[string]*models.Certificate),
-		templates:    make(map[string]*models.Template),
-		emailIndex:   make(map[string][]string),
+		certificates:  make(map[string]*models.Certificate),
+		templates:     make(map[scopedKey]*models.Template),
+		versions:      make(map[scopedKey]map[int]*models.Template),
+		assets:        make(map[scopedKey]map[string]*models.TemplateAsset),
+		jobs:          make(map[string]*models.BatchJob),
+		organizations: make(map[string]*models.Organization),
+		apiKeys:       make(map[string]*models.APIKey),
+		auditIDs:      make(map[string]bool),
+		idempotency:   make(map[scopedKey]*models.IdempotencyKey),
+		emailIndex:    make(map[string][]string),
+		orgIndex:      make(map[string][]string),
+		courseIndex:   make(map[scopedKey][]string),
+		templateIndex: make(map[scopedKey][]string),
+		statusIndex:   make(map[scopedKey][]string),
 	}
 }
 
+// NewJournaledMemoryStorage creates an in-memory storage that persists its
+// data in dir. The last snapshot and the journal written after it are
+// replayed on startup, and the journal is compacted into a new snapshot
+// every compactInterval (zero disables periodic compaction).
+func NewJournaledMemoryStorage(dir string, compactInterval time.Duration) (*MemoryStorage, error) {
+	ms := NewMemoryStorage()
+
+	j, err := openJournal(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := j.load(ms.apply); err != nil {
+		j.close()
+		return nil, err
+	}
+	ms.journal = j
+
+	if compactInterval > 0 {
+		ms.stop = make(chan struct{})
+		ms.done = make(chan struct{})
+		go ms.compactLoop(compactInterval)
+	}
+
+	return ms, nil
+}
+
 // SaveCertificate stores a certificate
 func (ms *MemoryStorage) SaveCertificate(cert *models.Certificate) error {
+	return ms.write(journalEntry{Op: opSaveCertificate, Certificate: cert})
+}
+
+// UpdateDelivery replaces the delivery status of a stored certificate
+func (ms *MemoryStorage) UpdateDelivery(id string, delivery *models.DeliveryStatus) error {
 	ms.mutex.Lock()
 	defer ms.mutex.Unlock()
 
-	ms.certificates[cert.ID] = cert
-
-	// Update email index
-	if _, exists := ms.emailIndex[cert.Email]; !exists {
-		ms.emailIndex[cert.Email] = make([]string, 0)
+	if _, exists := ms.certificates[id]; !exists {
+		return ErrCertificateNotFound
 	}
-	ms.emailIndex[cert.Email] = append(ms.emailIndex[cert.Email], cert.ID)
-
-	return nil
+	return ms.writeLocked(journalEntry{Op: opSaveDelivery, ID: id, Delivery: delivery})
 }
 
 // GetCertificate retrieves a certificate by ID
@@ -46,13 +112,13 @@ func (ms *MemoryStorage) GetCertificate(id string) (*models.Certificate, error)
 
 	cert, exists := ms.certificates[id]
 	if !exists {
-		return nil, errors.New("certificate not found")
+		return nil, ErrCertificateNotFound
 	}
 	return cert, nil
 }
 
-// GetCertificatesByEmail retrieves all certificates for an email
-func (ms *MemoryStorage) GetCertificatesByEmail(email string) ([]*models.Certificate, error) {
+// GetCertificatesByEmail retrieves the certificates of an organization for an email
+func (ms *MemoryStorage) GetCertificatesByEmail(orgID, email string) ([]*models.Certificate, error) {
 	ms.mutex.RLock()
 	defer ms.mutex.RUnlock()
 
@@ -63,7 +129,7 @@ func (ms *MemoryStorage) GetCertificatesByEmail(email string) ([]*models.Certifi
 
 	certificates := make([]*models.Certificate, 0, len(ids))
 	for _, id := range ids {
-		if cert, exists := ms.certificates[id]; exists {
+		if cert, exists := ms.certificates[id]; exists && cert.OrganizationID == orgID {
 			certificates = append(certificates, cert)
 		}
 	}
@@ -71,47 +137,660 @@ func (ms *MemoryStorage) GetCertificatesByEmail(email string) ([]*models.Certifi
 	return certificates, nil
 }
 
+// sortedCertificate is a certificate with the value it is sorted by
+type sortedCertificate struct {
+	key  string
+	cert *models.Certificate
+}
+
+// indexedStatus returns the status a certificate is indexed under;
+// certificates stored without one are active
+func indexedStatus(cert *models.Certificate) string {
+	if cert.Status == "" {
+		return models.StatusActive
+	}
+	return cert.Status
+}
+
+// ListCertificates retrieves a page of the certificates of an organization
+// selected by query. Only the certificates in the narrowest of the course,
+// template and status indexes matching the query are considered. The
+// indexes are ordered by creation, so listings in that order stop once the
+// page is full; the name and date filters are checked on each certificate,
+// and other orders scan the whole index.
+func (ms *MemoryStorage) ListCertificates(orgID string, query *models.CertificateQuery) (*models.CertificatePage, error) {
+	cursor, err := decodeCursor(query)
+	if err != nil {
+		return nil, err
+	}
+
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+
+	ids := ms.orgIndex[orgID]
+	narrow := func(indexed []string) {
+		if len(indexed) < len(ids) {
+			ids = indexed
+		}
+	}
+	if query.Course != "" {
+		narrow(ms.courseIndex[scopedKey{orgID, query.Course}])
+	}
+	if query.TemplateID != "" {
+		narrow(ms.templateIndex[scopedKey{orgID, query.TemplateID}])
+	}
+	if query.Status != "" {
+		narrow(ms.statusIndex[scopedKey{orgID, query.Status}])
+	}
+
+	// before reports whether a comes first in the sort order of the query
+	before := func(a, b sortedCertificate) bool {
+		switch {
+		case a.key != b.key:
+			return (a.key < b.key) != query.Descending
+		case a.cert.ID != b.cert.ID:
+			return (a.cert.ID < b.cert.ID) != query.Descending
+		}
+		return false
+	}
+
+	var last *sortedCertificate
+	if cursor != nil {
+		last = &sortedCertificate{cursor.Value, &models.Certificate{ID: cursor.ID}}
+	}
+	keep := query.Limit + 1
+	matches := make([]sortedCertificate, 0, keep)
+	if query.Sort == models.SortCreatedAt {
+		// The indexes are ordered by creation, so the matches are read in
+		// order from the cursor until the page is full
+		at := func(i int) *models.Certificate {
+			if query.Descending {
+				i = len(ids) - 1 - i
+			}
+			return ms.certificates[ids[i]]
+		}
+		start := 0
+		if last != nil {
+			start = sort.Search(len(ids), func(i int) bool {
+				cert := at(i)
+				return before(*last, sortedCertificate{sortableTime(cert.CreatedAt), cert})
+			})
+		}
+		for i := start; i < len(ids) && len(matches) < keep; i++ {
+			if cert := at(i); cert.OrganizationID == orgID && matchesCertificateQuery(cert, query) {
+				matches = append(matches, sortedCertificate{sortableTime(cert.CreatedAt), cert})
+			}
+		}
+	} else {
+		// Only the first Limit+1 matches after the cursor are kept, in
+		// order, so a page never sorts the whole organization
+		for _, id := range ids {
+			cert := ms.certificates[id]
+			if cert.OrganizationID != orgID || !matchesCertificateQuery(cert, query) {
+				continue
+			}
+			match := sortedCertificate{certificateSortValue(cert, query.Sort), cert}
+			if last != nil && !before(*last, match) {
+				continue
+			}
+			if len(matches) == keep {
+				if !before(match, matches[keep-1]) {
+					continue
+				}
+				matches = matches[:keep-1]
+			}
+			i := sort.Search(len(matches), func(i int) bool {
+				return before(match, matches[i])
+			})
+			matches = slices.Insert(matches, i, match)
+		}
+	}
+
+	page := &models.CertificatePage{Certificates: make([]*models.Certificate, 0, query.Limit)}
+	for i, match := range matches {
+		if i == query.Limit {
+			page.NextCursor = encodeCursor(query, matches[i-1].key, matches[i-1].cert.ID)
+			break
+		}
+		page.Certificates = append(page.Certificates, match.cert)
+	}
+	return page, nil
+}
+
 // SaveTemplate stores a template
 func (ms *MemoryStorage) SaveTemplate(template *models.Template) error {
+	return ms.write(journalEntry{Op: opSaveTemplate, Template: template})
+}
+
+// GetTemplate retrieves a template of an organization by ID
+func (ms *MemoryStorage) GetTemplate(orgID, id string) (*models.Template, error) {
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+
+	template, exists := ms.templates[scopedKey{orgID, id}]
+	if !exists {
+		return nil, ErrTemplateNotFound
+	}
+	return template, nil
+}
+
+// GetAllTemplates retrieves the templates of an organization
+func (ms *MemoryStorage) GetAllTemplates(orgID string) ([]*models.Template, error) {
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+
+	templates := make([]*models.Template, 0)
+	for key, template := range ms.templates {
+		if key.org == orgID {
+			templates = append(templates, template)
+		}
+	}
+	return templates, nil
+}
+
+// DeleteTemplate removes a template
+func (ms *MemoryStorage) DeleteTemplate(orgID, id string) error {
 	ms.mutex.Lock()
 	defer ms.mutex.Unlock()
 
-	ms.templates[template.ID] = template
-	return nil
+	if _, exists := ms.templates[scopedKey{orgID, id}]; !exists {
+		return ErrTemplateNotFound
+	}
+	return ms.writeLocked(journalEntry{Op: opDeleteTemplate, Organization: orgID, ID: id})
+}
+
+// SaveTemplateVersion stores an immutable template version
+func (ms *MemoryStorage) SaveTemplateVersion(template *models.Template) error {
+	return ms.write(journalEntry{Op: opSaveVersion, Template: template})
 }
 
-// GetTemplate retrieves a template by ID
-func (ms *MemoryStorage) GetTemplate(id string) (*models.Template, error) {
+// GetTemplateVersion retrieves a version of a template
+func (ms *MemoryStorage) GetTemplateVersion(orgID, id string, version int) (*models.Template, error) {
 	ms.mutex.RLock()
 	defer ms.mutex.RUnlock()
 
-	template, exists := ms.templates[id]
+	template, exists := ms.versions[scopedKey{orgID, id}][version]
 	if !exists {
-		return nil, errors.New("template not found")
+		return nil, ErrTemplateVersionNotFound
 	}
 	return template, nil
 }
 
-// GetAllTemplates retrieves all templates
-func (ms *MemoryStorage) GetAllTemplates() ([]*models.Template, error) {
+// GetTemplateVersions retrieves every version of a template, oldest first
+func (ms *MemoryStorage) GetTemplateVersions(orgID, id string) ([]*models.Template, error) {
 	ms.mutex.RLock()
 	defer ms.mutex.RUnlock()
 
-	templates := make([]*models.Template, 0, len(ms.templates))
-	for _, template := range ms.templates {
-		templates = append(templates, template)
+	key := scopedKey{orgID, id}
+	versions := make([]*models.Template, 0, len(ms.versions[key]))
+	for _, template := range ms.versions[key] {
+		versions = append(versions, template)
 	}
-	return templates, nil
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].Version < versions[j].Version
+	})
+	return versions, nil
 }
 
-// DeleteTemplate removes a template
-func (ms *MemoryStorage) DeleteTemplate(id string) error {
+// SaveAsset stores a template asset, replacing any with the same name
+func (ms *MemoryStorage) SaveAsset(asset *models.TemplateAsset) error {
+	return ms.write(journalEntry{Op: opSaveAsset, Asset: asset})
+}
+
+// GetAsset retrieves a template asset with its content
+func (ms *MemoryStorage) GetAsset(orgID, templateID, name string) (*models.TemplateAsset, error) {
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+
+	asset, exists := ms.assets[scopedKey{orgID, templateID}][name]
+	if !exists {
+		return nil, ErrAssetNotFound
+	}
+	return asset, nil
+}
+
+// GetAssets lists the assets of a template without their content, by name
+func (ms *MemoryStorage) GetAssets(orgID, templateID string) ([]*models.TemplateAsset, error) {
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+
+	key := scopedKey{orgID, templateID}
+	assets := make([]*models.TemplateAsset, 0, len(ms.assets[key]))
+	for _, asset := range ms.assets[key] {
+		listed := *asset
+		listed.Data = nil
+		assets = append(assets, &listed)
+	}
+	sort.Slice(assets, func(i, j int) bool {
+		return assets[i].Name < assets[j].Name
+	})
+	return assets, nil
+}
+
+// DeleteAsset removes a template asset
+func (ms *MemoryStorage) DeleteAsset(orgID, templateID, name string) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	if _, exists := ms.assets[scopedKey{orgID, templateID}][name]; !exists {
+		return ErrAssetNotFound
+	}
+	return ms.writeLocked(journalEntry{Op: opDeleteAsset, Organization: orgID, ID: templateID, Name: name})
+}
+
+// SaveJob stores a copy of a batch job, so callers may keep updating theirs.
+// Saving the progress of a stored job only journals the rows recorded since
+// the last save, rather than the whole job again.
+func (ms *MemoryStorage) SaveJob(job *models.BatchJob) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	if stored, exists := ms.jobs[job.ID]; exists {
+		if progress, offsets, ok := jobProgress(stored, job); ok {
+			return ms.writeLocked(journalEntry{Op: opSaveJobProgress, Job: progress, Offsets: offsets})
+		}
+	}
+	return ms.writeLocked(journalEntry{Op: opSaveJob, Job: job.Clone()})
+}
+
+// replaceFrom returns the first n values of stored followed by tail. The
+// values after n are replaced rather than appended to, so replaying a job
+// progress entry twice is harmless, and stored is never grown in place.
+func replaceFrom[T any](stored []T, n int, tail []T) []T {
+	return append(slices.Clip(stored[:min(n, len(stored))]), tail...)
+}
+
+// jobProgress returns a copy of job holding only the errors and IDs added
+// since stored, or false when stored is not a prefix of job (e.g. once the
+// errors are sorted)
+func jobProgress(stored, job *models.BatchJob) (*models.BatchJob, *jobOffsets, bool) {
+	offsets := &jobOffsets{Errors: len(stored.Errors), Created: len(stored.CreatedIDs), Existing: len(stored.ExistingIDs)}
+	if len(job.Errors) < offsets.Errors || len(job.CreatedIDs) < offsets.Created || len(job.ExistingIDs) < offsets.Existing {
+		return nil, nil, false
+	}
+	sameError := func(a, b models.RowError) bool { return a.Row == b.Row && a.Error == b.Error }
+	if !slices.EqualFunc(stored.Errors, job.Errors[:offsets.Errors], sameError) ||
+		!slices.Equal(stored.CreatedIDs, job.CreatedIDs[:offsets.Created]) ||
+		!slices.Equal(stored.ExistingIDs, job.ExistingIDs[:offsets.Existing]) {
+		return nil, nil, false
+	}
+
+	progress := *job
+	progress.Errors = slices.Clone(job.Errors[offsets.Errors:])
+	progress.CreatedIDs = slices.Clone(job.CreatedIDs[offsets.Created:])
+	progress.ExistingIDs = slices.Clone(job.ExistingIDs[offsets.Existing:])
+	return &progress, offsets, true
+}
+
+// GetJob retrieves a batch job by ID
+func (ms *MemoryStorage) GetJob(id string) (*models.BatchJob, error) {
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+
+	job, exists := ms.jobs[id]
+	if !exists {
+		return nil, ErrJobNotFound
+	}
+	return job.Clone(), nil
+}
+
+// GetAllJobs retrieves all batch jobs, oldest first
+func (ms *MemoryStorage) GetAllJobs() ([]*models.BatchJob, error) {
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+
+	jobs := make([]*models.BatchJob, 0, len(ms.jobs))
+	for _, job := range ms.jobs {
+		jobs = append(jobs, job.Clone())
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+	})
+	return jobs, nil
+}
+
+// DeleteJob removes a batch job
+func (ms *MemoryStorage) DeleteJob(id string) error {
 	ms.mutex.Lock()
 	defer ms.mutex.Unlock()
 
-	if _, exists := ms.templates[id]; !exists {
-		return errors.New("template not found")
+	if _, exists := ms.jobs[id]; !exists {
+		return ErrJobNotFound
+	}
+	return ms.writeLocked(journalEntry{Op: opDeleteJob, ID: id})
+}
+
+// SaveOrganization stores an organization
+func (ms *MemoryStorage) SaveOrganization(org *models.Organization) error {
+	return ms.write(journalEntry{Op: opSaveOrganization, Org: org})
+}
+
+// GetOrganization retrieves an organization by ID
+func (ms *MemoryStorage) GetOrganization(id string) (*models.Organization, error) {
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+
+	org, exists := ms.organizations[id]
+	if !exists {
+		return nil, ErrOrganizationNotFound
+	}
+	return org, nil
+}
+
+// GetAllOrganizations retrieves all organizations, by ID
+func (ms *MemoryStorage) GetAllOrganizations() ([]*models.Organization, error) {
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+
+	orgs := make([]*models.Organization, 0, len(ms.organizations))
+	for _, org := range ms.organizations {
+		orgs = append(orgs, org)
 	}
-	delete(ms.templates, id)
+	sort.Slice(orgs, func(i, j int) bool {
+		return orgs[i].ID < orgs[j].ID
+	})
+	return orgs, nil
+}
+
+// SaveAPIKey stores an API key
+func (ms *MemoryStorage) SaveAPIKey(key *models.APIKey) error {
+	return ms.write(journalEntry{Op: opSaveAPIKey, APIKey: newAPIKeyRecord(key)})
+}
+
+// GetAPIKeyByHash retrieves an API key by the hash of the key
+func (ms *MemoryStorage) GetAPIKeyByHash(hash string) (*models.APIKey, error) {
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+
+	key, exists := ms.apiKeys[hash]
+	if !exists {
+		return nil, ErrAPIKeyNotFound
+	}
+	return key, nil
+}
+
+// GetAPIKeys retrieves the API keys of an organization, oldest first
+func (ms *MemoryStorage) GetAPIKeys(orgID string) ([]*models.APIKey, error) {
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+
+	keys := make([]*models.APIKey, 0)
+	for _, key := range ms.apiKeys {
+		if key.OrganizationID == orgID {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+	return keys, nil
+}
+
+// SaveAuditEntry stores an audit entry
+func (ms *MemoryStorage) SaveAuditEntry(entry *models.AuditEntry) error {
+	return ms.write(journalEntry{Op: opSaveAuditEntry, Audit: entry})
+}
+
+// GetAuditEntries retrieves the audit entries of an organization selected
+// by filter, newest first
+func (ms *MemoryStorage) GetAuditEntries(orgID string, filter *models.AuditFilter) ([]*models.AuditEntry, error) {
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+
+	entries := make([]*models.AuditEntry, 0)
+	for i := len(ms.audit) - 1; i >= 0; i-- {
+		if filter.Limit > 0 && len(entries) == filter.Limit {
+			break
+		}
+		entry := ms.audit[i]
+		if entry.OrganizationID == orgID && filter.Matches(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// SaveIdempotencyKey stores an idempotency key, unless the organization
+// already has it
+func (ms *MemoryStorage) SaveIdempotencyKey(key *models.IdempotencyKey) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	if _, exists := ms.idempotency[scopedKey{key.OrganizationID, key.Key}]; exists {
+		return nil
+	}
+	return ms.writeLocked(journalEntry{Op: opSaveIdempotency, Idempotency: key})
+}
+
+// GetIdempotencyKey retrieves an idempotency key of an organization
+func (ms *MemoryStorage) GetIdempotencyKey(orgID, key string) (*models.IdempotencyKey, error) {
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+
+	record, exists := ms.idempotency[scopedKey{orgID, key}]
+	if !exists {
+		return nil, ErrIdempotencyKeyNotFound
+	}
+	return record, nil
+}
+
+// Compact writes the current state to a snapshot and truncates the journal.
+// It is a no-op when durability is disabled.
+func (ms *MemoryStorage) Compact() error {
+	if ms.journal == nil {
+		return nil
+	}
+
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	return ms.journal.compact(ms.snapshotLocked())
+}
+
+// Close stops the periodic compaction, writes a final snapshot and closes
+// the journal. It is a no-op when durability is disabled.
+func (ms *MemoryStorage) Close() error {
+	if ms.journal == nil {
+		return nil
+	}
+
+	if ms.stop != nil {
+		close(ms.stop)
+		<-ms.done
+	}
+
+	err := ms.Compact()
+	if closeErr := ms.journal.close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// write records a change in the journal (when enabled) and then applies it
+func (ms *MemoryStorage) write(entry journalEntry) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	return ms.writeLocked(entry)
+}
+
+// writeLocked is write for callers already holding the write lock
+func (ms *MemoryStorage) writeLocked(entry journalEntry) error {
+	if ms.journal != nil {
+		if err := ms.journal.append(entry); err != nil {
+			return err
+		}
+	}
+	ms.apply(entry)
 	return nil
-}
\ No newline at end of file
+}
+
+// insertByCreation adds the ID of cert to an index, which is ordered by
+// creation time and then ID like a listing sorted by created_at.
+// Certificates are usually saved in that order, so they are appended.
+func (ms *MemoryStorage) insertByCreation(ids []string, cert *models.Certificate) []string {
+	created := cert.CreatedAt.Round(0) // wall clock, as in sortableTime
+	i := sort.Search(len(ids), func(i int) bool {
+		other := ms.certificates[ids[i]]
+		c := created.Compare(other.CreatedAt.Round(0))
+		return c < 0 || c == 0 && cert.ID < other.ID
+	})
+	return slices.Insert(ids, i, cert.ID)
+}
+
+// apply performs a change on the in-memory maps. The caller must hold the
+// write lock (or be the only user, as during journal replay).
+func (ms *MemoryStorage) apply(entry journalEntry) {
+	switch entry.Op {
+	case opSaveCertificate:
+		cert := entry.Certificate
+		cert.OrganizationID = orgOrDefault(cert.OrganizationID)
+		stored, existed := ms.certificates[cert.ID]
+		ms.certificates[cert.ID] = cert
+		if existed && indexedStatus(stored) != indexedStatus(cert) {
+			previous := scopedKey{stored.OrganizationID, indexedStatus(stored)}
+			ms.statusIndex[previous] = slices.DeleteFunc(ms.statusIndex[previous], func(id string) bool { return id == cert.ID })
+		}
+		if !existed || indexedStatus(stored) != indexedStatus(cert) {
+			status := scopedKey{cert.OrganizationID, indexedStatus(cert)}
+			ms.statusIndex[status] = ms.insertByCreation(ms.statusIndex[status], cert)
+		}
+		if !existed {
+			ms.emailIndex[cert.Email] = append(ms.emailIndex[cert.Email], cert.ID)
+			ms.orgIndex[cert.OrganizationID] = ms.insertByCreation(ms.orgIndex[cert.OrganizationID], cert)
+			course := scopedKey{cert.OrganizationID, cert.Course}
+			ms.courseIndex[course] = ms.insertByCreation(ms.courseIndex[course], cert)
+			template := scopedKey{cert.OrganizationID, cert.TemplateID}
+			ms.templateIndex[template] = ms.insertByCreation(ms.templateIndex[template], cert)
+		}
+	case opSaveDelivery:
+		// Certificates handed out by GetCertificate are never changed in place
+		if stored, exists := ms.certificates[entry.ID]; exists {
+			cert := *stored
+			cert.Delivery = entry.Delivery
+			ms.certificates[entry.ID] = &cert
+		}
+	case opSaveTemplate:
+		template := entry.Template
+		template.OrganizationID = orgOrDefault(template.OrganizationID)
+		ms.templates[scopedKey{template.OrganizationID, template.ID}] = template
+	case opDeleteTemplate:
+		delete(ms.templates, scopedKey{orgOrDefault(entry.Organization), entry.ID})
+	case opSaveVersion:
+		template := entry.Template
+		template.OrganizationID = orgOrDefault(template.OrganizationID)
+		key := scopedKey{template.OrganizationID, template.ID}
+		if ms.versions[key] == nil {
+			ms.versions[key] = make(map[int]*models.Template)
+		}
+		ms.versions[key][template.Version] = template
+	case opSaveAsset:
+		asset := entry.Asset
+		asset.OrganizationID = orgOrDefault(asset.OrganizationID)
+		key := scopedKey{asset.OrganizationID, asset.TemplateID}
+		if ms.assets[key] == nil {
+			ms.assets[key] = make(map[string]*models.TemplateAsset)
+		}
+		ms.assets[key][asset.Name] = asset
+	case opDeleteAsset:
+		delete(ms.assets[scopedKey{orgOrDefault(entry.Organization), entry.ID}], entry.Name)
+	case opSaveJob:
+		entry.Job.OrganizationID = orgOrDefault(entry.Job.OrganizationID)
+		ms.jobs[entry.Job.ID] = entry.Job
+	case opSaveJobProgress:
+		stored, exists := ms.jobs[entry.Job.ID]
+		if !exists {
+			break
+		}
+		job, offsets := entry.Job, entry.Offsets
+		job.OrganizationID = orgOrDefault(job.OrganizationID)
+		job.Errors = replaceFrom(stored.Errors, offsets.Errors, job.Errors)
+		job.CreatedIDs = replaceFrom(stored.CreatedIDs, offsets.Created, job.CreatedIDs)
+		job.ExistingIDs = replaceFrom(stored.ExistingIDs, offsets.Existing, job.ExistingIDs)
+		ms.jobs[job.ID] = job
+	case opSaveOrganization:
+		ms.organizations[entry.Org.ID] = entry.Org
+	case opSaveAPIKey:
+		key := entry.APIKey.key()
+		if key.Role == "" {
+			// Keys created before roles were admin keys
+			key.Role = models.RoleAdmin
+		}
+		ms.apiKeys[key.Hash] = key
+	case opSaveAuditEntry:
+		if !ms.auditIDs[entry.Audit.ID] {
+			ms.auditIDs[entry.Audit.ID] = true
+			ms.audit = append(ms.audit, entry.Audit)
+		}
+	case opSaveIdempotency:
+		key := scopedKey{entry.Idempotency.OrganizationID, entry.Idempotency.Key}
+		if _, exists := ms.idempotency[key]; !exists {
+			ms.idempotency[key] = entry.Idempotency
+		}
+	case opDeleteJob:
+		delete(ms.jobs, entry.ID)
+	}
+}
+
+// snapshotLocked copies the current state for compaction, keeping
+// certificates in creation order so the email index is rebuilt in the same
+// order on replay. The caller must hold at least the read lock.
+func (ms *MemoryStorage) snapshotLocked() *snapshot {
+	snap := &snapshot{
+		Certificates: make([]*models.Certificate, 0, len(ms.certificates)),
+		Templates:    make([]*models.Template, 0, len(ms.templates)),
+		Jobs:         make([]*models.BatchJob, 0, len(ms.jobs)),
+	}
+	for _, cert := range ms.certificates {
+		snap.Certificates = append(snap.Certificates, cert)
+	}
+	for _, template := range ms.templates {
+		snap.Templates = append(snap.Templates, template)
+	}
+	for _, versions := range ms.versions {
+		for _, version := range versions {
+			snap.Versions = append(snap.Versions, version)
+		}
+	}
+	for _, assets := range ms.assets {
+		for _, asset := range assets {
+			snap.Assets = append(snap.Assets, asset)
+		}
+	}
+	for _, org := range ms.organizations {
+		snap.Organizations = append(snap.Organizations, org)
+	}
+	for _, key := range ms.apiKeys {
+		snap.APIKeys = append(snap.APIKeys, newAPIKeyRecord(key))
+	}
+	for _, job := range ms.jobs {
+		snap.Jobs = append(snap.Jobs, job)
+	}
+	snap.Audit = append(snap.Audit, ms.audit...)
+	for _, key := range ms.idempotency {
+		snap.Idempotency = append(snap.Idempotency, key)
+	}
+	sort.Slice(snap.Certificates, func(i, j int) bool {
+		return snap.Certificates[i].CreatedAt.Before(snap.Certificates[j].CreatedAt)
+	})
+	return snap
+}
+
+// compactLoop compacts the journal periodically until Close is called
+func (ms *MemoryStorage) compactLoop(interval time.Duration) {
+	defer close(ms.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := ms.Compact(); err != nil {
+				log.Printf("journal compaction failed: %v", err)
+			}
+		case <-ms.stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// migrations holds the SQLite schema changes in the order they must be
+// applied. Each entry is applied once and recorded in schema_migrations,
+// so new changes must always be appended at the end of the list.
+var migrations = []string{
+	// 1: initial schema
+	`CREATE TABLE certificates (
+		id              TEXT PRIMARY KEY,
+		email           TEXT NOT NULL,
+		name            TEXT NOT NULL,
+		course          TEXT NOT NULL,
+		completion_date TEXT NOT NULL,
+		template_id     TEXT NOT NULL,
+		created_at      TEXT NOT NULL,
+		data            TEXT NOT NULL DEFAULT '{}'
+	);
+	CREATE INDEX idx_certificates_email ON certificates(email);
+	CREATE TABLE templates (
+		id            TEXT PRIMARY KEY,
+		name          TEXT NOT NULL,
+		html_template TEXT NOT NULL,
+		fields        TEXT NOT NULL DEFAULT '[]',
+		created_at    TEXT NOT NULL,
+		updated_at    TEXT NOT NULL
+	);`,
+	// 2: certificate revocation
+	`ALTER TABLE certificates ADD COLUMN status TEXT NOT NULL DEFAULT 'active';
+	ALTER TABLE certificates ADD COLUMN revocation_reason TEXT NOT NULL DEFAULT '';
+	ALTER TABLE certificates ADD COLUMN revoked_at TEXT;`,
+	// 3: certificate signatures
+	`ALTER TABLE certificates ADD COLUMN signature TEXT NOT NULL DEFAULT '';
+	ALTER TABLE certificates ADD COLUMN verification_url TEXT NOT NULL DEFAULT '';`,
+	// 4: template PDF layouts
+	`ALTER TABLE templates ADD COLUMN pdf_layout TEXT;`,
+	// 5: batch jobs
+	`CREATE TABLE jobs (
+		id         TEXT PRIMARY KEY,
+		status     TEXT NOT NULL,
+		created_at TEXT NOT NULL,
+		data       TEXT NOT NULL
+	);`,
+	// 6: email delivery
+	`ALTER TABLE certificates ADD COLUMN delivery TEXT;
+	ALTER TABLE templates ADD COLUMN email TEXT;`,
+	// 7: template versions; existing templates become version 1
+	`ALTER TABLE templates ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+	ALTER TABLE certificates ADD COLUMN template_version INTEGER NOT NULL DEFAULT 0;
+	CREATE TABLE template_versions (
+		id            TEXT NOT NULL,
+		version       INTEGER NOT NULL,
+		name          TEXT NOT NULL,
+		html_template TEXT NOT NULL,
+		fields        TEXT NOT NULL DEFAULT '[]',
+		created_at    TEXT NOT NULL,
+		updated_at    TEXT NOT NULL,
+		pdf_layout    TEXT,
+		email         TEXT,
+		PRIMARY KEY (id, version)
+	);
+	INSERT INTO template_versions (id, version, name, html_template, fields, created_at, updated_at, pdf_layout, email)
+		SELECT id, version, name, html_template, fields, created_at, updated_at, pdf_layout, email FROM templates;`,
+	// 8: certificate and template locales
+	`ALTER TABLE certificates ADD COLUMN locale TEXT NOT NULL DEFAULT '';
+	ALTER TABLE templates ADD COLUMN locale TEXT NOT NULL DEFAULT '';
+	ALTER TABLE template_versions ADD COLUMN locale TEXT NOT NULL DEFAULT '';`,
+	// 9: images uploaded for templates
+	`CREATE TABLE assets (
+		template_id  TEXT NOT NULL,
+		name         TEXT NOT NULL,
+		content_type TEXT NOT NULL,
+		size         INTEGER NOT NULL,
+		etag         TEXT NOT NULL,
+		created_at   TEXT NOT NULL,
+		data         BLOB NOT NULL,
+		PRIMARY KEY (template_id, name)
+	);`,
+	// 10: organizations; existing data belongs to the default organization.
+	// Template IDs become unique per organization, so the template tables
+	// are rebuilt with the organization in their primary keys.
+	`CREATE TABLE organizations (
+		id         TEXT PRIMARY KEY,
+		name       TEXT NOT NULL,
+		created_at TEXT NOT NULL
+	);
+	CREATE TABLE api_keys (
+		id              TEXT PRIMARY KEY,
+		organization_id TEXT NOT NULL,
+		name            TEXT NOT NULL,
+		prefix          TEXT NOT NULL,
+		hash            TEXT NOT NULL UNIQUE,
+		created_at      TEXT NOT NULL
+	);
+	ALTER TABLE certificates ADD COLUMN organization_id TEXT NOT NULL DEFAULT 'default';
+	DROP INDEX idx_certificates_email;
+	CREATE INDEX idx_certificates_email ON certificates(organization_id, email);
+
+	CREATE TABLE templates_scoped (
+		organization_id TEXT NOT NULL DEFAULT 'default',
+		id              TEXT NOT NULL,
+		name            TEXT NOT NULL,
+		html_template   TEXT NOT NULL,
+		fields          TEXT NOT NULL DEFAULT '[]',
+		created_at      TEXT NOT NULL,
+		updated_at      TEXT NOT NULL,
+		pdf_layout      TEXT,
+		email           TEXT,
+		version         INTEGER NOT NULL DEFAULT 1,
+		locale          TEXT NOT NULL DEFAULT '',
+		PRIMARY KEY (organization_id, id)
+	);
+	INSERT INTO templates_scoped (id, name, html_template, fields, created_at, updated_at, pdf_layout, email, version, locale)
+		SELECT id, name, html_template, fields, created_at, updated_at, pdf_layout, email, version, locale FROM templates;
+	DROP TABLE templates;
+	ALTER TABLE templates_scoped RENAME TO templates;
+
+	CREATE TABLE template_versions_scoped (
+		organization_id TEXT NOT NULL DEFAULT 'default',
+		id              TEXT NOT NULL,
+		version         INTEGER NOT NULL,
+		name            TEXT NOT NULL,
+		html_template   TEXT NOT NULL,
+		fields          TEXT NOT NULL DEFAULT '[]',
+		created_at      TEXT NOT NULL,
+		updated_at      TEXT NOT NULL,
+		pdf_layout      TEXT,
+		email           TEXT,
+		locale          TEXT NOT NULL DEFAULT '',
+		PRIMARY KEY (organization_id, id, version)
+	);
+	INSERT INTO template_versions_scoped (id, version, name, html_template, fields, created_at, updated_at, pdf_layout, email, locale)
+		SELECT id, version, name, html_template, fields, created_at, updated_at, pdf_layout, email, locale FROM template_versions;
+	DROP TABLE template_versions;
+	ALTER TABLE template_versions_scoped RENAME TO template_versions;
+
+	CREATE TABLE assets_scoped (
+		organization_id TEXT NOT NULL DEFAULT 'default',
+		template_id     TEXT NOT NULL,
+		name            TEXT NOT NULL,
+		content_type    TEXT NOT NULL,
+		size            INTEGER NOT NULL,
+		etag            TEXT NOT NULL,
+		created_at      TEXT NOT NULL,
+		data            BLOB NOT NULL,
+		PRIMARY KEY (organization_id, template_id, name)
+	);
+	INSERT INTO assets_scoped (template_id, name, content_type, size, etag, created_at, data)
+		SELECT template_id, name, content_type, size, etag, created_at, data FROM assets;
+	DROP TABLE assets;
+	ALTER TABLE assets_scoped RENAME TO assets;`,
+	// 11: API key roles; keys created before roles were the first key of
+	// their organization, which is an admin key
+	`ALTER TABLE api_keys ADD COLUMN role TEXT NOT NULL DEFAULT 'admin';
+	ALTER TABLE api_keys ADD COLUMN revoked_at TEXT;
+	CREATE INDEX idx_api_keys_organization ON api_keys(organization_id, created_at);`,
+	// 12: audit log of changes to certificates, templates and assets
+	`CREATE TABLE audit_log (
+		id              TEXT PRIMARY KEY,
+		organization_id TEXT NOT NULL,
+		actor_id        TEXT NOT NULL,
+		actor_name      TEXT NOT NULL,
+		action          TEXT NOT NULL,
+		target_type     TEXT NOT NULL,
+		target_id       TEXT NOT NULL,
+		before          TEXT,
+		after           TEXT,
+		created_at      TEXT NOT NULL
+	);
+	CREATE INDEX idx_audit_log_organization ON audit_log(organization_id, created_at);
+	CREATE INDEX idx_audit_log_target ON audit_log(organization_id, target_id);`,
+	// 13: certificate listing. created_at keeps the time as written, which
+	// does not sort as text, so created_key holds it in a fixed-width UTC
+	// form (with millisecond precision for existing rows)
+	`ALTER TABLE certificates ADD COLUMN created_key TEXT NOT NULL DEFAULT '';
+	UPDATE certificates SET created_key = COALESCE(strftime('%Y-%m-%dT%H:%M:%f', created_at) || '000000Z', created_at);
+	CREATE INDEX idx_certificates_created ON certificates(organization_id, created_key, id);
+	CREATE INDEX idx_certificates_completion ON certificates(organization_id, completion_date, id);
+	CREATE INDEX idx_certificates_name ON certificates(organization_id, name, id);
+	CREATE INDEX idx_certificates_course ON certificates(organization_id, course, created_key, id);
+	CREATE INDEX idx_certificates_template ON certificates(organization_id, template_id, created_key, id);
+	CREATE INDEX idx_certificates_status ON certificates(organization_id, status, created_key, id);`,
+	// 14: idempotency keys of certificate requests. Duplicates are found
+	// by email through idx_certificates_email, scoped by organization in 10.
+	`CREATE TABLE idempotency_keys (
+		organization_id TEXT NOT NULL,
+		key             TEXT NOT NULL,
+		request_hash    TEXT NOT NULL,
+		certificate_id  TEXT NOT NULL,
+		created_at      TEXT NOT NULL,
+		PRIMARY KEY (organization_id, key)
+	);`,
+	// 15: corrections, linking a certificate to the one it supersedes
+	`ALTER TABLE certificates ADD COLUMN supersedes TEXT NOT NULL DEFAULT '';
+	ALTER TABLE certificates ADD COLUMN superseded_by TEXT NOT NULL DEFAULT '';
+	ALTER TABLE certificates ADD COLUMN superseded_at TEXT;
+	ALTER TABLE certificates ADD COLUMN correction_reason TEXT NOT NULL DEFAULT '';`,
+}
+
+// migrate brings the database schema up to date
+func migrate(db *sql.DB) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at TEXT NOT NULL
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %v", err)
+	}
+
+	var current int
+	err = db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&current)
+	if err != nil {
+		return fmt.Errorf("failed to read schema version: %v", err)
+	}
+
+	for i := current; i < len(migrations); i++ {
+		version := i + 1
+
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(migrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d failed: %v", version, err)
+		}
+		_, err = tx.Exec("INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)",
+			version, time.Now().UTC().Format(time.RFC3339))
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to record migration %d: %v", version, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
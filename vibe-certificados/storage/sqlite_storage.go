@@ -0,0 +1,900 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"vibe-certificados/models"
+
+	_ "modernc.org/sqlite"
+)
+
+// SQLiteStorage provides persistent storage for certificates, templates and
+// jobs backed by a SQLite database file
+type SQLiteStorage struct {
+	db *sql.DB
+}
+
+var _ Storage = (*SQLiteStorage)(nil)
+
+// certificateColumns lists the certificate columns in the order read by scanCertificate
+const certificateColumns = `id, email, name, course, completion_date, template_id, created_at, data,
+	status, revocation_reason, revoked_at, signature, verification_url, delivery, template_version, locale, organization_id,
+	supersedes, superseded_by, superseded_at, correction_reason`
+
+// templateColumns lists the template columns in the order read by scanTemplate
+const templateColumns = `id, name, html_template, fields, created_at, updated_at, pdf_layout, email, version, locale, organization_id`
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// NewSQLiteStorage opens (or creates) the SQLite database at path and
+// applies any pending schema migrations
+func NewSQLiteStorage(path string) (*SQLiteStorage, error) {
+	if path == "" {
+		return nil, errors.New("sqlite database path is required")
+	}
+
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sqlite database: %v", err)
+	}
+	// SQLite allows a single writer; serialising access avoids SQLITE_BUSY
+	db.SetMaxOpenConns(1)
+
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &SQLiteStorage{db: db}, nil
+}
+
+// Close releases the underlying database handle
+func (ss *SQLiteStorage) Close() error {
+	return ss.db.Close()
+}
+
+// SaveCertificate stores a certificate, replacing any existing one with the same ID
+func (ss *SQLiteStorage) SaveCertificate(cert *models.Certificate) error {
+	data, err := json.Marshal(cert.Data)
+	if err != nil {
+		return err
+	}
+
+	delivery, err := marshalNullableJSON(cert.Delivery, cert.Delivery == nil)
+	if err != nil {
+		return err
+	}
+
+	status := cert.Status
+	if status == "" {
+		status = models.StatusActive
+	}
+
+	_, err = ss.db.Exec(`INSERT INTO certificates (`+certificateColumns+`, created_key)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			email = excluded.email,
+			name = excluded.name,
+			course = excluded.course,
+			completion_date = excluded.completion_date,
+			template_id = excluded.template_id,
+			created_at = excluded.created_at,
+			data = excluded.data,
+			status = excluded.status,
+			revocation_reason = excluded.revocation_reason,
+			revoked_at = excluded.revoked_at,
+			signature = excluded.signature,
+			verification_url = excluded.verification_url,
+			delivery = excluded.delivery,
+			template_version = excluded.template_version,
+			locale = excluded.locale,
+			organization_id = excluded.organization_id,
+			supersedes = excluded.supersedes,
+			superseded_by = excluded.superseded_by,
+			superseded_at = excluded.superseded_at,
+			correction_reason = excluded.correction_reason,
+			created_key = excluded.created_key`,
+		cert.ID, cert.Email, cert.Name, cert.Course,
+		formatTime(cert.CompletionDate), cert.TemplateID, formatTime(cert.CreatedAt), string(data),
+		status, cert.RevocationReason, formatNullableTime(cert.RevokedAt),
+		cert.Signature, cert.VerificationURL, delivery, cert.TemplateVersion, cert.Locale,
+		orgOrDefault(cert.OrganizationID),
+		cert.Supersedes, cert.SupersededBy, formatNullableTime(cert.SupersededAt), cert.CorrectionReason,
+		sortableTime(cert.CreatedAt))
+	return err
+}
+
+// UpdateDelivery replaces the delivery status of a stored certificate
+func (ss *SQLiteStorage) UpdateDelivery(id string, delivery *models.DeliveryStatus) error {
+	value, err := marshalNullableJSON(delivery, delivery == nil)
+	if err != nil {
+		return err
+	}
+
+	result, err := ss.db.Exec(`UPDATE certificates SET delivery = ? WHERE id = ?`, value, id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrCertificateNotFound
+	}
+	return nil
+}
+
+// GetCertificate retrieves a certificate by ID
+func (ss *SQLiteStorage) GetCertificate(id string) (*models.Certificate, error) {
+	row := ss.db.QueryRow(`SELECT `+certificateColumns+` FROM certificates WHERE id = ?`, id)
+
+	cert, err := scanCertificate(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrCertificateNotFound
+	}
+	return cert, err
+}
+
+// GetCertificatesByEmail retrieves the certificates of an organization for an email
+func (ss *SQLiteStorage) GetCertificatesByEmail(orgID, email string) ([]*models.Certificate, error) {
+	rows, err := ss.db.Query(`SELECT `+certificateColumns+`
+		FROM certificates WHERE organization_id = ? AND email = ? ORDER BY created_at`, orgID, email)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	certificates := make([]*models.Certificate, 0)
+	for rows.Next() {
+		cert, err := scanCertificate(rows)
+		if err != nil {
+			return nil, err
+		}
+		certificates = append(certificates, cert)
+	}
+	return certificates, rows.Err()
+}
+
+// certificateSortColumns maps the sort fields of certificates to their
+// columns; created_key holds the creation time in sortableTimeFormat
+var certificateSortColumns = map[string]string{
+	models.SortCreatedAt:      "created_key",
+	models.SortCompletionDate: "completion_date",
+	models.SortName:           "name",
+	models.SortCourse:         "course",
+}
+
+// ListCertificates retrieves a page of the certificates of an organization
+// selected by query. Pages are read with keyset pagination on the sort
+// column and the ID, both covered by indexes.
+func (ss *SQLiteStorage) ListCertificates(orgID string, query *models.CertificateQuery) (*models.CertificatePage, error) {
+	column, ok := certificateSortColumns[query.Sort]
+	if !ok {
+		return nil, fmt.Errorf("unknown sort field: %s", query.Sort)
+	}
+	cursor, err := decodeCursor(query)
+	if err != nil {
+		return nil, err
+	}
+
+	sqlQuery := `SELECT ` + certificateColumns + `, ` + column + ` FROM certificates WHERE organization_id = ?`
+	args := []interface{}{orgID}
+	for _, condition := range []struct {
+		clause string
+		value  interface{}
+		set    bool
+	}{
+		{"course = ?", query.Course, query.Course != ""},
+		{"template_id = ?", query.TemplateID, query.TemplateID != ""},
+		{"status = ?", query.Status, query.Status != ""},
+		{`name LIKE ? ESCAPE '\'`, "%" + escapeLike(query.Name) + "%", query.Name != ""},
+		{"completion_date >= ?", formatTime(query.CompletedFrom.UTC()), !query.CompletedFrom.IsZero()},
+		{"completion_date < ?", formatTime(query.CompletedUntil.UTC()), !query.CompletedUntil.IsZero()},
+		{"created_key >= ?", sortableTime(query.CreatedFrom), !query.CreatedFrom.IsZero()},
+		{"created_key < ?", sortableTime(query.CreatedUntil), !query.CreatedUntil.IsZero()},
+	} {
+		if condition.set {
+			sqlQuery += " AND " + condition.clause
+			args = append(args, condition.value)
+		}
+	}
+
+	direction, after := "ASC", ">"
+	if query.Descending {
+		direction, after = "DESC", "<"
+	}
+	if cursor != nil {
+		sqlQuery += " AND (" + column + " " + after + " ? OR (" + column + " = ? AND id " + after + " ?))"
+		args = append(args, cursor.Value, cursor.Value, cursor.ID)
+	}
+	// One more row than requested tells whether there is a next page
+	sqlQuery += " ORDER BY " + column + " " + direction + ", id " + direction + " LIMIT ?"
+	args = append(args, query.Limit+1)
+
+	rows, err := ss.db.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	page := &models.CertificatePage{Certificates: make([]*models.Certificate, 0)}
+	var lastKey string
+	for rows.Next() {
+		var key string
+		cert, err := scanCertificate(sortKeyScanner{rows, &key})
+		if err != nil {
+			return nil, err
+		}
+		if len(page.Certificates) == query.Limit {
+			page.NextCursor = encodeCursor(query, lastKey, page.Certificates[query.Limit-1].ID)
+			break
+		}
+		page.Certificates = append(page.Certificates, cert)
+		lastKey = key
+	}
+	return page, rows.Err()
+}
+
+// sortKeyScanner reads a certificate row followed by the sort column
+type sortKeyScanner struct {
+	rows *sql.Rows
+	key  *string
+}
+
+// Scan implements rowScanner
+func (s sortKeyScanner) Scan(dest ...interface{}) error {
+	return s.rows.Scan(append(dest, s.key)...)
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern, using \ as the escape
+// character
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
+}
+
+// SaveTemplate stores a template, replacing any existing one with the same ID
+func (ss *SQLiteStorage) SaveTemplate(template *models.Template) error {
+	values, err := templateValues(template)
+	if err != nil {
+		return err
+	}
+
+	_, err = ss.db.Exec(`INSERT INTO templates (`+templateColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(organization_id, id) DO UPDATE SET
+			name = excluded.name,
+			html_template = excluded.html_template,
+			fields = excluded.fields,
+			created_at = excluded.created_at,
+			updated_at = excluded.updated_at,
+			pdf_layout = excluded.pdf_layout,
+			email = excluded.email,
+			version = excluded.version,
+			locale = excluded.locale`,
+		values...)
+	return err
+}
+
+// SaveTemplateVersion stores an immutable template version
+func (ss *SQLiteStorage) SaveTemplateVersion(template *models.Template) error {
+	values, err := templateValues(template)
+	if err != nil {
+		return err
+	}
+
+	_, err = ss.db.Exec(`INSERT OR REPLACE INTO template_versions (`+templateColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, values...)
+	return err
+}
+
+// GetTemplateVersion retrieves a version of a template
+func (ss *SQLiteStorage) GetTemplateVersion(orgID, id string, version int) (*models.Template, error) {
+	row := ss.db.QueryRow(`SELECT `+templateColumns+` FROM template_versions
+		WHERE organization_id = ? AND id = ? AND version = ?`, orgID, id, version)
+
+	template, err := scanTemplate(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTemplateVersionNotFound
+	}
+	return template, err
+}
+
+// GetTemplateVersions retrieves every version of a template, oldest first
+func (ss *SQLiteStorage) GetTemplateVersions(orgID, id string) ([]*models.Template, error) {
+	rows, err := ss.db.Query(`SELECT `+templateColumns+`
+		FROM template_versions WHERE organization_id = ? AND id = ? ORDER BY version`, orgID, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := make([]*models.Template, 0)
+	for rows.Next() {
+		template, err := scanTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, template)
+	}
+	return versions, rows.Err()
+}
+
+// GetTemplate retrieves a template of an organization by ID
+func (ss *SQLiteStorage) GetTemplate(orgID, id string) (*models.Template, error) {
+	row := ss.db.QueryRow(`SELECT `+templateColumns+` FROM templates WHERE organization_id = ? AND id = ?`, orgID, id)
+
+	template, err := scanTemplate(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTemplateNotFound
+	}
+	return template, err
+}
+
+// GetAllTemplates retrieves the templates of an organization
+func (ss *SQLiteStorage) GetAllTemplates(orgID string) ([]*models.Template, error) {
+	rows, err := ss.db.Query(`SELECT `+templateColumns+` FROM templates WHERE organization_id = ? ORDER BY id`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	templates := make([]*models.Template, 0)
+	for rows.Next() {
+		template, err := scanTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, template)
+	}
+	return templates, rows.Err()
+}
+
+// DeleteTemplate removes a template
+func (ss *SQLiteStorage) DeleteTemplate(orgID, id string) error {
+	result, err := ss.db.Exec("DELETE FROM templates WHERE organization_id = ? AND id = ?", orgID, id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrTemplateNotFound
+	}
+	return nil
+}
+
+// SaveAsset stores a template asset, replacing any with the same name
+func (ss *SQLiteStorage) SaveAsset(asset *models.TemplateAsset) error {
+	_, err := ss.db.Exec(`INSERT OR REPLACE INTO assets (organization_id, template_id, name, content_type, size, etag, created_at, data)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		orgOrDefault(asset.OrganizationID), asset.TemplateID, asset.Name, asset.ContentType, asset.Size, asset.ETag, formatTime(asset.CreatedAt), asset.Data)
+	return err
+}
+
+// GetAsset retrieves a template asset with its content
+func (ss *SQLiteStorage) GetAsset(orgID, templateID, name string) (*models.TemplateAsset, error) {
+	row := ss.db.QueryRow(`SELECT organization_id, template_id, name, content_type, size, etag, created_at, data
+		FROM assets WHERE organization_id = ? AND template_id = ? AND name = ?`, orgID, templateID, name)
+
+	asset, err := scanAsset(row, true)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrAssetNotFound
+	}
+	return asset, err
+}
+
+// GetAssets lists the assets of a template without their content, by name
+func (ss *SQLiteStorage) GetAssets(orgID, templateID string) ([]*models.TemplateAsset, error) {
+	rows, err := ss.db.Query(`SELECT organization_id, template_id, name, content_type, size, etag, created_at
+		FROM assets WHERE organization_id = ? AND template_id = ? ORDER BY name`, orgID, templateID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	assets := make([]*models.TemplateAsset, 0)
+	for rows.Next() {
+		asset, err := scanAsset(rows, false)
+		if err != nil {
+			return nil, err
+		}
+		assets = append(assets, asset)
+	}
+	return assets, rows.Err()
+}
+
+// DeleteAsset removes a template asset
+func (ss *SQLiteStorage) DeleteAsset(orgID, templateID, name string) error {
+	result, err := ss.db.Exec("DELETE FROM assets WHERE organization_id = ? AND template_id = ? AND name = ?", orgID, templateID, name)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrAssetNotFound
+	}
+	return nil
+}
+
+// SaveJob stores a batch job, replacing any existing one with the same ID.
+// Progress counters and row errors are kept together in the data column.
+func (ss *SQLiteStorage) SaveJob(job *models.BatchJob) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+
+	_, err = ss.db.Exec(`INSERT INTO jobs (id, status, created_at, data)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			status = excluded.status,
+			data = excluded.data`,
+		job.ID, job.Status, formatTime(job.CreatedAt), string(data))
+	return err
+}
+
+// GetJob retrieves a batch job by ID
+func (ss *SQLiteStorage) GetJob(id string) (*models.BatchJob, error) {
+	var data string
+	err := ss.db.QueryRow("SELECT data FROM jobs WHERE id = ?", id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeJob(id, data)
+}
+
+// GetAllJobs retrieves all batch jobs, oldest first
+func (ss *SQLiteStorage) GetAllJobs() ([]*models.BatchJob, error) {
+	rows, err := ss.db.Query("SELECT id, data FROM jobs ORDER BY created_at")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := make([]*models.BatchJob, 0)
+	for rows.Next() {
+		var id, data string
+		if err := rows.Scan(&id, &data); err != nil {
+			return nil, err
+		}
+		job, err := decodeJob(id, data)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// DeleteJob removes a batch job
+func (ss *SQLiteStorage) DeleteJob(id string) error {
+	result, err := ss.db.Exec("DELETE FROM jobs WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrJobNotFound
+	}
+	return nil
+}
+
+// SaveOrganization stores an organization, replacing any with the same ID
+func (ss *SQLiteStorage) SaveOrganization(org *models.Organization) error {
+	_, err := ss.db.Exec(`INSERT INTO organizations (id, name, created_at) VALUES (?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET name = excluded.name`,
+		org.ID, org.Name, formatTime(org.CreatedAt))
+	return err
+}
+
+// GetOrganization retrieves an organization by ID
+func (ss *SQLiteStorage) GetOrganization(id string) (*models.Organization, error) {
+	row := ss.db.QueryRow("SELECT id, name, created_at FROM organizations WHERE id = ?", id)
+
+	org, err := scanOrganization(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrOrganizationNotFound
+	}
+	return org, err
+}
+
+// GetAllOrganizations retrieves all organizations, by ID
+func (ss *SQLiteStorage) GetAllOrganizations() ([]*models.Organization, error) {
+	rows, err := ss.db.Query("SELECT id, name, created_at FROM organizations ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orgs := make([]*models.Organization, 0)
+	for rows.Next() {
+		org, err := scanOrganization(rows)
+		if err != nil {
+			return nil, err
+		}
+		orgs = append(orgs, org)
+	}
+	return orgs, rows.Err()
+}
+
+// apiKeyColumns lists the api_keys columns in the order read by scanAPIKey
+const apiKeyColumns = `id, organization_id, name, role, prefix, hash, created_at, revoked_at`
+
+// SaveAPIKey stores an API key, replacing any with the same ID
+func (ss *SQLiteStorage) SaveAPIKey(key *models.APIKey) error {
+	_, err := ss.db.Exec(`INSERT OR REPLACE INTO api_keys (`+apiKeyColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		key.ID, key.OrganizationID, key.Name, key.Role, key.Prefix, key.Hash,
+		formatTime(key.CreatedAt), formatNullableTime(key.RevokedAt))
+	return err
+}
+
+// GetAPIKeyByHash retrieves an API key by the hash of the key
+func (ss *SQLiteStorage) GetAPIKeyByHash(hash string) (*models.APIKey, error) {
+	row := ss.db.QueryRow(`SELECT `+apiKeyColumns+` FROM api_keys WHERE hash = ?`, hash)
+
+	key, err := scanAPIKey(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrAPIKeyNotFound
+	}
+	return key, err
+}
+
+// GetAPIKeys retrieves the API keys of an organization, oldest first
+func (ss *SQLiteStorage) GetAPIKeys(orgID string) ([]*models.APIKey, error) {
+	rows, err := ss.db.Query(`SELECT `+apiKeyColumns+`
+		FROM api_keys WHERE organization_id = ? ORDER BY created_at`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := make([]*models.APIKey, 0)
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// scanAPIKey reads an api_keys row selected with apiKeyColumns
+func scanAPIKey(row rowScanner) (*models.APIKey, error) {
+	var key models.APIKey
+	var createdAt string
+	var revokedAt sql.NullString
+	if err := row.Scan(&key.ID, &key.OrganizationID, &key.Name, &key.Role, &key.Prefix, &key.Hash,
+		&createdAt, &revokedAt); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if key.CreatedAt, err = parseTime(createdAt); err != nil {
+		return nil, err
+	}
+	if key.RevokedAt, err = parseNullableTime(revokedAt); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// scanOrganization reads an organization row
+func scanOrganization(row rowScanner) (*models.Organization, error) {
+	var org models.Organization
+	var createdAt string
+	if err := row.Scan(&org.ID, &org.Name, &createdAt); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if org.CreatedAt, err = parseTime(createdAt); err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+// auditColumns lists the audit_log columns in the order read by scanAuditEntry
+const auditColumns = `id, organization_id, actor_id, actor_name, action, target_type, target_id, before, after, created_at`
+
+// SaveAuditEntry stores an audit entry
+func (ss *SQLiteStorage) SaveAuditEntry(entry *models.AuditEntry) error {
+	_, err := ss.db.Exec(`INSERT OR REPLACE INTO audit_log (`+auditColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		entry.ID, entry.OrganizationID, entry.Actor.ID, entry.Actor.Name, entry.Action,
+		entry.TargetType, entry.TargetID, nullableRawJSON(entry.Before), nullableRawJSON(entry.After),
+		sortableTime(entry.Timestamp))
+	return err
+}
+
+// GetAuditEntries retrieves the audit entries of an organization selected
+// by filter, newest first
+func (ss *SQLiteStorage) GetAuditEntries(orgID string, filter *models.AuditFilter) ([]*models.AuditEntry, error) {
+	query := `SELECT ` + auditColumns + ` FROM audit_log WHERE organization_id = ?`
+	args := []interface{}{orgID}
+	for _, condition := range []struct{ column, value string }{
+		{"actor_id", filter.ActorID},
+		{"action", filter.Action},
+		{"target_type", filter.TargetType},
+		{"target_id", filter.TargetID},
+	} {
+		if condition.value != "" {
+			query += " AND " + condition.column + " = ?"
+			args = append(args, condition.value)
+		}
+	}
+	if !filter.Since.IsZero() {
+		query += " AND created_at >= ?"
+		args = append(args, sortableTime(filter.Since))
+	}
+	if !filter.Until.IsZero() {
+		query += " AND created_at < ?"
+		args = append(args, sortableTime(filter.Until))
+	}
+	query += " ORDER BY created_at DESC, rowid DESC"
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := ss.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make([]*models.AuditEntry, 0)
+	for rows.Next() {
+		entry, err := scanAuditEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// scanAuditEntry reads an audit_log row selected with auditColumns
+func scanAuditEntry(row rowScanner) (*models.AuditEntry, error) {
+	var entry models.AuditEntry
+	var before, after sql.NullString
+	var createdAt string
+	if err := row.Scan(&entry.ID, &entry.OrganizationID, &entry.Actor.ID, &entry.Actor.Name, &entry.Action,
+		&entry.TargetType, &entry.TargetID, &before, &after, &createdAt); err != nil {
+		return nil, err
+	}
+
+	if before.Valid {
+		entry.Before = json.RawMessage(before.String)
+	}
+	if after.Valid {
+		entry.After = json.RawMessage(after.String)
+	}
+	var err error
+	if entry.Timestamp, err = parseTime(createdAt); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// nullableRawJSON stores a JSON document, or NULL when it is empty
+func nullableRawJSON(data json.RawMessage) sql.NullString {
+	if len(data) == 0 {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: string(data), Valid: true}
+}
+
+// SaveIdempotencyKey stores an idempotency key, unless the organization
+// already has it
+func (ss *SQLiteStorage) SaveIdempotencyKey(key *models.IdempotencyKey) error {
+	_, err := ss.db.Exec(`INSERT OR IGNORE INTO idempotency_keys
+		(organization_id, key, request_hash, certificate_id, created_at) VALUES (?, ?, ?, ?, ?)`,
+		key.OrganizationID, key.Key, key.RequestHash, key.CertificateID, formatTime(key.CreatedAt))
+	return err
+}
+
+// GetIdempotencyKey retrieves an idempotency key of an organization
+func (ss *SQLiteStorage) GetIdempotencyKey(orgID, key string) (*models.IdempotencyKey, error) {
+	record := models.IdempotencyKey{OrganizationID: orgID, Key: key}
+	var createdAt string
+	err := ss.db.QueryRow(`SELECT request_hash, certificate_id, created_at
+		FROM idempotency_keys WHERE organization_id = ? AND key = ?`, orgID, key).
+		Scan(&record.RequestHash, &record.CertificateID, &createdAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrIdempotencyKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if record.CreatedAt, err = parseTime(createdAt); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// decodeJob parses the data column of a job row
+func decodeJob(id, data string) (*models.BatchJob, error) {
+	var job models.BatchJob
+	if err := json.Unmarshal([]byte(data), &job); err != nil {
+		return nil, fmt.Errorf("invalid data for job %s: %v", id, err)
+	}
+	job.OrganizationID = orgOrDefault(job.OrganizationID)
+	return &job, nil
+}
+
+// scanCertificate reads a certificate row
+func scanCertificate(row rowScanner) (*models.Certificate, error) {
+	var cert models.Certificate
+	var completionDate, createdAt, data string
+	var revokedAt, delivery, supersededAt sql.NullString
+
+	err := row.Scan(&cert.ID, &cert.Email, &cert.Name, &cert.Course,
+		&completionDate, &cert.TemplateID, &createdAt, &data,
+		&cert.Status, &cert.RevocationReason, &revokedAt,
+		&cert.Signature, &cert.VerificationURL, &delivery, &cert.TemplateVersion, &cert.Locale,
+		&cert.OrganizationID,
+		&cert.Supersedes, &cert.SupersededBy, &supersededAt, &cert.CorrectionReason)
+	if err != nil {
+		return nil, err
+	}
+
+	if cert.CompletionDate, err = parseTime(completionDate); err != nil {
+		return nil, err
+	}
+	if cert.CreatedAt, err = parseTime(createdAt); err != nil {
+		return nil, err
+	}
+	if cert.RevokedAt, err = parseNullableTime(revokedAt); err != nil {
+		return nil, err
+	}
+	if cert.SupersededAt, err = parseNullableTime(supersededAt); err != nil {
+		return nil, err
+	}
+	cert.Data = make(map[string]string)
+	if err := json.Unmarshal([]byte(data), &cert.Data); err != nil {
+		return nil, fmt.Errorf("invalid data for certificate %s: %v", cert.ID, err)
+	}
+	if delivery.Valid {
+		cert.Delivery = &models.DeliveryStatus{}
+		if err := json.Unmarshal([]byte(delivery.String), cert.Delivery); err != nil {
+			return nil, fmt.Errorf("invalid delivery for certificate %s: %v", cert.ID, err)
+		}
+	}
+
+	return &cert, nil
+}
+
+// scanTemplate reads a template row
+func scanTemplate(row rowScanner) (*models.Template, error) {
+	var template models.Template
+	var fields string
+	var layout, email sql.NullString
+
+	err := row.Scan(&template.ID, &template.Name, &template.HTMLTemplate,
+		&fields, &template.CreatedAt, &template.UpdatedAt, &layout, &email, &template.Version, &template.Locale,
+		&template.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(fields), &template.Fields); err != nil {
+		return nil, fmt.Errorf("invalid fields for template %s: %v", template.ID, err)
+	}
+	if layout.Valid {
+		template.PDFLayout = &models.PDFLayout{}
+		if err := json.Unmarshal([]byte(layout.String), template.PDFLayout); err != nil {
+			return nil, fmt.Errorf("invalid pdf layout for template %s: %v", template.ID, err)
+		}
+	}
+	if email.Valid {
+		template.Email = &models.EmailTemplate{}
+		if err := json.Unmarshal([]byte(email.String), template.Email); err != nil {
+			return nil, fmt.Errorf("invalid email template for template %s: %v", template.ID, err)
+		}
+	}
+
+	return &template, nil
+}
+
+// scanAsset reads an asset row, including the data column when withData is set
+func scanAsset(row rowScanner, withData bool) (*models.TemplateAsset, error) {
+	var asset models.TemplateAsset
+	var createdAt string
+	dest := []interface{}{&asset.OrganizationID, &asset.TemplateID, &asset.Name, &asset.ContentType, &asset.Size, &asset.ETag, &createdAt}
+	if withData {
+		dest = append(dest, &asset.Data)
+	}
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if asset.CreatedAt, err = parseTime(createdAt); err != nil {
+		return nil, err
+	}
+	return &asset, nil
+}
+
+// templateValues returns the column values of a template in templateColumns order
+func templateValues(template *models.Template) ([]interface{}, error) {
+	fields, err := json.Marshal(template.Fields)
+	if err != nil {
+		return nil, err
+	}
+	layout, err := marshalNullableJSON(template.PDFLayout, template.PDFLayout == nil)
+	if err != nil {
+		return nil, err
+	}
+	email, err := marshalNullableJSON(template.Email, template.Email == nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return []interface{}{template.ID, template.Name, template.HTMLTemplate, string(fields),
+		template.CreatedAt, template.UpdatedAt, layout, email, template.Version, template.Locale,
+		orgOrDefault(template.OrganizationID)}, nil
+}
+
+// formatTime encodes a timestamp for storage in a TEXT column
+func formatTime(t time.Time) string {
+	return t.Format(time.RFC3339Nano)
+}
+
+// parseTime decodes a timestamp written by formatTime
+func parseTime(value string) (time.Time, error) {
+	return time.Parse(time.RFC3339Nano, value)
+}
+
+// formatNullableTime encodes an optional timestamp, storing NULL when unset
+func formatNullableTime(t *time.Time) sql.NullString {
+	if t == nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: formatTime(*t), Valid: true}
+}
+
+// parseNullableTime decodes a timestamp written by formatNullableTime
+func parseNullableTime(value sql.NullString) (*time.Time, error) {
+	if !value.Valid {
+		return nil, nil
+	}
+	t, err := parseTime(value.String)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// marshalNullableJSON encodes value as JSON, storing NULL when isNil is true
+func marshalNullableJSON(value interface{}, isNil bool) (sql.NullString, error) {
+	if isNil {
+		return sql.NullString{}, nil
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: string(encoded), Valid: true}, nil
+}
@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"errors"
+	"time"
+	"vibe-certificados/models"
+)
+
+// Errors returned by Storage implementations when a record does not exist
+var (
+	ErrCertificateNotFound     = errors.New("certificate not found")
+	ErrTemplateNotFound        = errors.New("template not found")
+	ErrTemplateVersionNotFound = errors.New("template version not found")
+	ErrJobNotFound             = errors.New("job not found")
+	ErrAssetNotFound           = errors.New("asset not found")
+	ErrOrganizationNotFound    = errors.New("organization not found")
+	ErrAPIKeyNotFound          = errors.New("api key not found")
+	ErrIdempotencyKeyNotFound  = errors.New("idempotency key not found")
+	ErrCorruptedJournal        = errors.New("journal is corrupted")
+)
+
+// ErrInvalidCursor is returned when a page cursor was not produced by a
+// listing with the same sort order
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Storage defines the persistence operations used by the services.
+// Templates, their versions and assets are identified within an
+// organization; certificates and jobs have global IDs and record their
+// organization, which the services check. Records stored before
+// organizations existed belong to models.DefaultOrganizationID.
+type Storage interface {
+	SaveCertificate(cert *models.Certificate) error
+	GetCertificate(id string) (*models.Certificate, error)
+	// UpdateDelivery replaces only the delivery status of a certificate, so
+	// it never undoes a revocation or correction saved in the meantime
+	UpdateDelivery(id string, delivery *models.DeliveryStatus) error
+	GetCertificatesByEmail(orgID, email string) ([]*models.Certificate, error)
+	// ListCertificates returns a page of the certificates of an
+	// organization selected by query, with query.Sort and query.Limit set
+	ListCertificates(orgID string, query *models.CertificateQuery) (*models.CertificatePage, error)
+
+	SaveTemplate(template *models.Template) error
+	GetTemplate(orgID, id string) (*models.Template, error)
+	GetAllTemplates(orgID string) ([]*models.Template, error)
+	DeleteTemplate(orgID, id string) error
+
+	// Template versions are immutable snapshots kept after the template
+	// itself is updated or deleted, so issued certificates keep their design
+	SaveTemplateVersion(template *models.Template) error
+	GetTemplateVersion(orgID, id string, version int) (*models.Template, error)
+	GetTemplateVersions(orgID, id string) ([]*models.Template, error)
+
+	// Assets are images uploaded for a template. GetAssets lists them
+	// without their content, ordered by name.
+	SaveAsset(asset *models.TemplateAsset) error
+	GetAsset(orgID, templateID, name string) (*models.TemplateAsset, error)
+	GetAssets(orgID, templateID string) ([]*models.TemplateAsset, error)
+	DeleteAsset(orgID, templateID, name string) error
+
+	SaveJob(job *models.BatchJob) error
+	GetJob(id string) (*models.BatchJob, error)
+	GetAllJobs() ([]*models.BatchJob, error)
+	DeleteJob(id string) error
+
+	SaveOrganization(org *models.Organization) error
+	GetOrganization(id string) (*models.Organization, error)
+	GetAllOrganizations() ([]*models.Organization, error)
+
+	// API keys are looked up by the SHA-256 hash of the key. Revoked keys
+	// are kept, with RevokedAt set. GetAPIKeys lists the keys of an
+	// organization, oldest first.
+	SaveAPIKey(key *models.APIKey) error
+	GetAPIKeyByHash(hash string) (*models.APIKey, error)
+	GetAPIKeys(orgID string) ([]*models.APIKey, error)
+
+	// Audit entries are only ever added. GetAuditEntries returns the
+	// entries of an organization selected by filter, newest first.
+	SaveAuditEntry(entry *models.AuditEntry) error
+	GetAuditEntries(orgID string, filter *models.AuditFilter) ([]*models.AuditEntry, error)
+
+	// Idempotency keys are unique within an organization and only ever
+	// added; saving a key that exists keeps the first one
+	SaveIdempotencyKey(key *models.IdempotencyKey) error
+	GetIdempotencyKey(orgID, key string) (*models.IdempotencyKey, error)
+}
+
+// orgOrDefault returns the organization of a record, which is empty for
+// records stored before organizations existed
+func orgOrDefault(orgID string) string {
+	if orgID == "" {
+		return models.DefaultOrganizationID
+	}
+	return orgID
+}
+
+// Supported storage drivers
+const (
+	DriverMemory = "memory"
+	DriverSQLite = "sqlite"
+)
+
+// Options selects and configures a Storage implementation
+type Options struct {
+	Driver     string
+	SQLitePath string
+
+	// DataDir enables journaling for the memory driver when not empty
+	DataDir         string
+	CompactInterval time.Duration
+}
+
+// Open creates the storage selected by opts.Driver
+func Open(opts Options) (Storage, error) {
+	switch opts.Driver {
+	case "", DriverMemory:
+		if opts.DataDir == "" {
+			return NewMemoryStorage(), nil
+		}
+		return NewJournaledMemoryStorage(opts.DataDir, opts.CompactInterval)
+	case DriverSQLite:
+		return NewSQLiteStorage(opts.SQLitePath)
+	default:
+		return nil, errors.New("unknown storage driver: " + opts.Driver)
+	}
+}
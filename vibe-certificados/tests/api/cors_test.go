@@ -0,0 +1,84 @@
+package api_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"vibe-certificados/api"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newCORSRouter(allowedOrigins ...string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(api.CORS(allowedOrigins))
+	router.POST("/api/certificates", func(c *gin.Context) {
+		c.Header("Idempotent-Replayed", "true")
+		c.Status(http.StatusOK)
+	})
+	return router
+}
+
+func TestCORS_Preflight(t *testing.T) {
+	router := newCORSRouter("https://painel.example.com")
+
+	req := httptest.NewRequest(http.MethodOptions, "/api/certificates", nil)
+	req.Header.Set("Origin", "https://painel.example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	req.Header.Set("Access-Control-Request-Headers", "Content-Type, Idempotency-Key, X-API-Key")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d", w.Code)
+	}
+	if origin := w.Header().Get("Access-Control-Allow-Origin"); origin != "https://painel.example.com" {
+		t.Errorf("Expected the origin to be allowed, got %q", origin)
+	}
+	allowedHeaders := w.Header().Get("Access-Control-Allow-Headers")
+	for _, header := range []string{"Content-Type", "Accept-Language", "Idempotency-Key", api.APIKeyHeader} {
+		if !strings.Contains(allowedHeaders, header) {
+			t.Errorf("Expected %s to be allowed, got %q", header, allowedHeaders)
+		}
+	}
+	if methods := w.Header().Get("Access-Control-Allow-Methods"); !strings.Contains(methods, "PATCH") {
+		t.Errorf("Expected PATCH to be allowed, got %q", methods)
+	}
+}
+
+func TestCORS_ExposesResponseHeaders(t *testing.T) {
+	router := newCORSRouter("*")
+
+	req := httptest.NewRequest(http.MethodPost, "/api/certificates", nil)
+	req.Header.Set("Origin", "https://painel.example.com")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	exposed := w.Header().Get("Access-Control-Expose-Headers")
+	for _, header := range []string{"Location", "ETag", "Link", "X-Certificate-Status", "Idempotent-Replayed"} {
+		if !strings.Contains(exposed, header) {
+			t.Errorf("Expected %s to be exposed, got %q", header, exposed)
+		}
+	}
+	if w.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("Expected the handler response, got %v", w.Header())
+	}
+}
+
+func TestCORS_RejectsUnknownOrigins(t *testing.T) {
+	router := newCORSRouter("https://painel.example.com")
+
+	req := httptest.NewRequest(http.MethodOptions, "/api/certificates", nil)
+	req.Header.Set("Origin", "https://other.example.com")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if origin := w.Header().Get("Access-Control-Allow-Origin"); origin != "" {
+		t.Errorf("Expected no allowed origin, got %q", origin)
+	}
+	if vary := w.Header().Get("Vary"); vary != "Origin" {
+		t.Errorf("Expected Vary: Origin, got %q", vary)
+	}
+}
@@ -0,0 +1,26 @@
+package models_test
+
+import (
+	"testing"
+	"vibe-certificados/models"
+)
+
+func TestAPIKey_Allows(t *testing.T) {
+	tests := []struct {
+		role    string
+		allowed []string
+		want    bool
+	}{
+		{models.RoleAdmin, []string{models.RoleIssuer}, true},
+		{models.RoleIssuer, []string{models.RoleIssuer}, true},
+		{models.RoleIssuer, []string{models.RoleTemplateAdmin}, false},
+		{models.RoleReadOnly, models.Roles, true},
+		{models.RoleReadOnly, []string{models.RoleAdmin}, false},
+	}
+	for _, tt := range tests {
+		key := &models.APIKey{Role: tt.role}
+		if got := key.Allows(tt.allowed...); got != tt.want {
+			t.Errorf("Expected %s allowed %v to be %v, got %v", tt.role, tt.allowed, tt.want, got)
+		}
+	}
+}
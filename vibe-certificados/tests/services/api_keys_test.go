@@ -0,0 +1,113 @@
+package services_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"vibe-certificados/models"
+	"vibe-certificados/services"
+	"vibe-certificados/storage"
+)
+
+func TestOrganizationService_APIKeys(t *testing.T) {
+	memStorage := storage.NewMemoryStorage()
+	templateService := services.NewTemplateService(memStorage)
+	orgService := services.NewOrganizationService(memStorage, templateService)
+	created, err := orgService.CreateOrganization(&models.CreateOrganizationRequest{ID: "acme", Name: "Acme"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	issuer, err := orgService.CreateAPIKey("acme", &models.CreateAPIKeyRequest{Name: "ci", Role: models.RoleIssuer})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !strings.HasPrefix(issuer.Key, "vc_") || issuer.Role != models.RoleIssuer {
+		t.Errorf("Expected an issuer key, got %+v", issuer)
+	}
+	if _, err := orgService.CreateAPIKey("acme", &models.CreateAPIKeyRequest{Name: "ci", Role: "owner"}); !errors.Is(err, services.ErrInvalidRole) {
+		t.Errorf("Expected ErrInvalidRole, got %v", err)
+	}
+	if _, err := orgService.CreateAPIKey("acme", &models.CreateAPIKeyRequest{Name: " ", Role: models.RoleReadOnly}); !errors.Is(err, services.ErrAPIKeyNameMissing) {
+		t.Errorf("Expected ErrAPIKeyNameMissing, got %v", err)
+	}
+
+	keys, err := orgService.GetAPIKeys("acme")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(keys) != 2 || keys[0].Role != models.RoleAdmin || keys[1].ID != issuer.ID {
+		t.Fatalf("Expected the admin and the issuer key, got %+v", keys)
+	}
+	admin := keys[0]
+
+	if _, err := orgService.RevokeAPIKey(models.DefaultOrganizationID, issuer.ID); !errors.Is(err, storage.ErrAPIKeyNotFound) {
+		t.Errorf("Expected other organizations not to revoke the key, got %v", err)
+	}
+	if _, err := orgService.RevokeAPIKey("acme", admin.ID); !errors.Is(err, services.ErrLastAdminKey) {
+		t.Errorf("Expected ErrLastAdminKey, got %v", err)
+	}
+
+	revoked, err := orgService.RevokeAPIKey("acme", issuer.ID)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !revoked.IsRevoked() {
+		t.Errorf("Expected the key to be revoked, got %+v", revoked)
+	}
+	if _, err := orgService.RevokeAPIKey("acme", issuer.ID); !errors.Is(err, services.ErrAPIKeyRevoked) {
+		t.Errorf("Expected ErrAPIKeyRevoked, got %v", err)
+	}
+	if _, err := orgService.ResolveAPIKey(issuer.Key); !errors.Is(err, services.ErrAPIKeyRevoked) {
+		t.Errorf("Expected revoked keys not to resolve, got %v", err)
+	}
+	if _, err := orgService.ResolveAPIKey(created.APIKey); err != nil {
+		t.Errorf("Expected the admin key to resolve, got %v", err)
+	}
+}
+
+func TestOrganizationService_LoadOrCreateAdminKey(t *testing.T) {
+	memStorage := storage.NewMemoryStorage()
+	templateService := services.NewTemplateService(memStorage)
+	orgService := services.NewOrganizationService(memStorage, templateService)
+	path := filepath.Join(t.TempDir(), "keys", "admin_api_key")
+
+	if err := orgService.LoadOrCreateAdminKey(path); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Expected the admin key file, got %v", err)
+	}
+	key, err := orgService.ResolveAPIKey(strings.TrimSpace(string(data)))
+	if err != nil {
+		t.Fatalf("Expected the admin key to resolve, got %v", err)
+	}
+	if key.OrganizationID != models.DefaultOrganizationID || key.Role != models.RoleAdmin {
+		t.Errorf("Expected an admin key of the default organization, got %+v", key)
+	}
+
+	// A second start reuses the file; a fresh store registers the key again
+	if err := orgService.LoadOrCreateAdminKey(path); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if keys, _ := orgService.GetAPIKeys(models.DefaultOrganizationID); len(keys) != 1 {
+		t.Errorf("Expected the admin key to be reused, got %d keys", len(keys))
+	}
+
+	fresh := services.NewOrganizationService(storage.NewMemoryStorage(), templateService)
+	if err := fresh.LoadOrCreateAdminKey(path); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := fresh.ResolveAPIKey(strings.TrimSpace(string(data))); err != nil {
+		t.Errorf("Expected the key from the file to be registered, got %v", err)
+	}
+
+	invalid := filepath.Join(t.TempDir(), "admin_api_key")
+	os.WriteFile(invalid, []byte("short\n"), 0o600)
+	if err := orgService.LoadOrCreateAdminKey(invalid); err == nil {
+		t.Error("Expected an invalid admin key to be rejected")
+	}
+}
@@ -0,0 +1,129 @@
+package services_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"vibe-certificados/models"
+	"vibe-certificados/services"
+	"vibe-certificados/storage"
+)
+
+func TestAuditService_RecordsCertificateChanges(t *testing.T) {
+	memStorage := storage.NewMemoryStorage()
+	certService := services.NewCertificateService(memStorage)
+	services.NewTemplateService(memStorage)
+	auditService := services.NewAuditService(memStorage)
+	issuer := models.Actor{ID: "key-1", Name: "ci"}
+
+	req := &models.CertificateRequest{
+		Email:          "maria@example.com",
+		Name:           "Maria",
+		Course:         "Go",
+		CompletionDate: "2024-01-15",
+	}
+	cert, err := certService.CreateCertificate(models.DefaultOrganizationID, issuer, req)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := certService.RevokeCertificate(models.DefaultOrganizationID, models.Actor{ID: "key-2"}, cert.ID, "Wrong name"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	entries, err := auditService.GetEntries(models.DefaultOrganizationID, &models.AuditFilter{TargetID: cert.ID})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 entries, got %d", len(entries))
+	}
+
+	// Newest first
+	revocation, issuance := entries[0], entries[1]
+	if issuance.Action != models.AuditCertificateCreate || issuance.Actor != issuer || issuance.Before != nil {
+		t.Errorf("Expected the issuance by %v, got %+v", issuer, issuance)
+	}
+	if revocation.Action != models.AuditCertificateRevoke || revocation.Actor.ID != "key-2" {
+		t.Errorf("Expected the revocation by key-2, got %+v", revocation)
+	}
+
+	var before, after models.Certificate
+	if err := json.Unmarshal(revocation.Before, &before); err != nil {
+		t.Fatalf("Expected a snapshot before the revocation, got %v", err)
+	}
+	if err := json.Unmarshal(revocation.After, &after); err != nil {
+		t.Fatalf("Expected a snapshot after the revocation, got %v", err)
+	}
+	if before.IsRevoked() || !after.IsRevoked() || after.RevocationReason != "Wrong name" {
+		t.Errorf("Expected the snapshots to show the revocation, got %+v and %+v", before, after)
+	}
+
+	byActor, _ := auditService.GetEntries(models.DefaultOrganizationID, &models.AuditFilter{ActorID: "key-1"})
+	if len(byActor) != 1 || byActor[0].ID != issuance.ID {
+		t.Errorf("Expected the issuance only, got %+v", byActor)
+	}
+	if other, _ := auditService.GetEntries("acme", &models.AuditFilter{}); len(other) != 0 {
+		t.Errorf("Expected no entries in other organizations, got %d", len(other))
+	}
+}
+
+func TestAuditService_RecordsTemplateChanges(t *testing.T) {
+	memStorage := storage.NewMemoryStorage()
+	templateService := services.NewTemplateService(memStorage)
+	auditService := services.NewAuditService(memStorage)
+	admin := models.Actor{ID: "key-1", Name: "designer"}
+
+	// The default template is created by the service itself
+	created, _ := auditService.GetEntries(models.DefaultOrganizationID, &models.AuditFilter{Action: models.AuditTemplateCreate})
+	if len(created) != 1 || created[0].Actor != models.SystemActor || created[0].TargetID != "default" {
+		t.Errorf("Expected the default template to be recorded, got %+v", created)
+	}
+
+	template := &models.Template{ID: "workshop", Name: "Workshop", HTMLTemplate: "<p>{{.Name}}</p>"}
+	if err := templateService.CreateTemplate(models.DefaultOrganizationID, admin, template); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	updated := &models.Template{ID: "workshop", Name: "Workshop", HTMLTemplate: "<h1>{{.Name}}</h1>"}
+	if err := templateService.UpdateTemplate(models.DefaultOrganizationID, admin, updated); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := templateService.RollbackTemplate(models.DefaultOrganizationID, admin, "workshop", 1); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := templateService.UploadAsset(models.DefaultOrganizationID, admin, "workshop", "logo.png", newTestPNG(t)); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := templateService.DeleteTemplate(models.DefaultOrganizationID, admin, "workshop"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	entries, err := auditService.GetEntries(models.DefaultOrganizationID, &models.AuditFilter{ActorID: "key-1"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	actions := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		actions = append(actions, entry.Action)
+	}
+	expected := "template.delete asset.upload template.rollback template.update template.create"
+	if strings.Join(actions, " ") != expected {
+		t.Fatalf("Expected %s, got %v", expected, actions)
+	}
+
+	update := entries[3]
+	if !strings.Contains(string(update.Before), "<p>") || !strings.Contains(string(update.After), "<h1>") {
+		t.Errorf("Expected the update to hold both versions, got %s and %s", update.Before, update.After)
+	}
+	upload := entries[1]
+	if upload.TargetID != "workshop/logo.png" || strings.Contains(string(upload.After), `"data"`) {
+		t.Errorf("Expected the asset metadata without its content, got %s %s", upload.TargetID, upload.After)
+	}
+	if deletion := entries[0]; deletion.Before == nil || deletion.After != nil {
+		t.Errorf("Expected the deletion to hold the template before it, got %+v", deletion)
+	}
+
+	limited, _ := auditService.GetEntries(models.DefaultOrganizationID, &models.AuditFilter{TargetType: models.AuditTargetTemplate, Limit: 2})
+	if len(limited) != 2 || limited[0].Action != models.AuditTemplateDelete {
+		t.Errorf("Expected the 2 newest template entries, got %+v", limited)
+	}
+}
@@ -0,0 +1,344 @@
+package services_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"vibe-certificados/models"
+	"vibe-certificados/services"
+	"vibe-certificados/storage"
+)
+
+func TestCSVReader_MapsColumnsAndKeepsExtraData(t *testing.T) {
+	csvData := `E-mail,Nome,course,completion_date,hours,Instrutor,Obs
+john@example.com,John Doe,Go Programming,2024-01-15,8,Ana,internal note
+jane@example.com,Jane Doe,Go Programming,2024-01-15,,Ana,
+bob@example.com,Bob`
+
+	reader, err := services.NewCSVReader(strings.NewReader(csvData), services.ImportOptions{
+		Mapping: map[string]string{"e-mail": "email", "Nome": "name", "Instrutor": "instructor", "Obs": ""},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	rows, err := services.ReadBatch(reader)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("Expected 3 rows, got %d", len(rows))
+	}
+
+	req := rows[0].Request
+	if req.Email != "john@example.com" || req.Name != "John Doe" || req.TemplateID != "default" {
+		t.Errorf("Expected mapped request fields, got %+v", req)
+	}
+	if len(req.Data) != 2 || req.Data["hours"] != "8" || req.Data["instructor"] != "Ana" {
+		t.Errorf("Expected hours and instructor data, got %v", req.Data)
+	}
+	if _, exists := rows[1].Request.Data["hours"]; exists {
+		t.Error("Expected empty cells to be left out of the data")
+	}
+	if rows[2].Row != 4 || rows[2].Err == nil {
+		t.Errorf("Expected row 4 to fail for missing columns, got %+v", rows[2])
+	}
+}
+
+func TestCSVReader_ReadsSemicolonLatin1Files(t *testing.T) {
+	// "João" and "Gestão" encoded in ISO-8859-1, as exported by spreadsheets
+	csvData := "email;name;course;completion_date\r\njoao@example.com;Jo\xe3o Silva;Gest\xe3o de Projetos;2024-01-15\r\n"
+
+	reader, err := services.NewCSVReader(strings.NewReader(csvData), services.ImportOptions{Delimiter: ';', Encoding: "latin1"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	row, err := reader.Next()
+	if err != nil || row.Err != nil {
+		t.Fatalf("Expected a valid row, got %v / %v", err, row.Err)
+	}
+	if row.Request.Name != "João Silva" || row.Request.Course != "Gestão de Projetos" {
+		t.Errorf("Expected decoded Latin-1 text, got %q and %q", row.Request.Name, row.Request.Course)
+	}
+	if _, err := reader.Next(); err != io.EOF {
+		t.Errorf("Expected io.EOF after the last row, got %v", err)
+	}
+
+	// Read as UTF-8, the same file is reported instead of garbled
+	reader, err = services.NewCSVReader(strings.NewReader(csvData), services.ImportOptions{Delimiter: ';'})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if row, _ := reader.Next(); row.Err == nil {
+		t.Error("Expected an error for a row that is not valid UTF-8")
+	}
+}
+
+func TestCSVReader_RejectsInvalidOptions(t *testing.T) {
+	header := "email,name,course,completion_date\n"
+
+	cases := map[string]services.ImportOptions{
+		"unknown encoding":  {Encoding: "ebcdic"},
+		"invalid delimiter": {Delimiter: '"'},
+		"missing column":    {Mapping: map[string]string{"hours": "duration"}},
+		"duplicate field":   {Mapping: map[string]string{"name": "email"}},
+	}
+	for name, opts := range cases {
+		if _, err := services.NewCSVReader(strings.NewReader(header), opts); err == nil {
+			t.Errorf("Expected an error for %s", name)
+		}
+	}
+
+	// A UTF-8 byte order mark does not end up in the first header
+	if _, err := services.NewCSVReader(strings.NewReader("\ufeff"+header), services.ImportOptions{}); err != nil {
+		t.Errorf("Expected no error for a file with a byte order mark, got %v", err)
+	}
+}
+
+func TestCertificateService_CreateCertificatesFromCSVWithData(t *testing.T) {
+	// Setup
+	memStorage := storage.NewMemoryStorage()
+	templateService := services.NewTemplateService(memStorage)
+	certService := services.NewCertificateService(memStorage)
+
+	if err := templateService.CreateTemplate(models.DefaultOrganizationID, models.SystemActor, newWorkshopTemplate()); err != nil {
+		t.Fatalf("Failed to create template: %v", err)
+	}
+
+	csvData := `email;name;course;completion_date;template_id;Carga Horária;nivel
+john@example.com;John Doe;Go Programming;2024-01-15;workshop;8;advanced
+jane@example.com;Jane Doe;Go Programming;2024-01-15;workshop;;advanced`
+
+	response, err := certService.CreateCertificatesFromFile(models.DefaultOrganizationID, models.SystemActor, strings.NewReader(csvData), services.ImportOptions{
+		Delimiter: ';',
+		Mapping:   map[string]string{"Carga Horária": "hours", "nivel": "level"},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if response.Total != 2 || response.Success != 1 || response.Failed != 1 {
+		t.Fatalf("Expected 1 of 2 rows issued, got %+v", response)
+	}
+
+	cert, err := certService.GetCertificate(models.DefaultOrganizationID, response.CreatedIDs[0])
+	if err != nil {
+		t.Fatalf("Failed to get certificate: %v", err)
+	}
+	if cert.Data["hours"] != "8" || cert.Data["level"] != "advanced" {
+		t.Errorf("Expected hours and level from the CSV, got %v", cert.Data)
+	}
+	if !strings.HasPrefix(response.Errors[0], "Row 3:") {
+		t.Errorf("Expected row 3 to fail for missing hours, got %v", response.Errors)
+	}
+}
+
+// newWorkbook builds an XLSX file with the given sheets, whose rows are XML
+// <row> elements. Cells with style 1 are formatted as dd/mm/yyyy dates.
+func newWorkbook(t *testing.T, sheets map[string]string, order ...string) *bytes.Reader {
+	t.Helper()
+
+	var workbook, rels strings.Builder
+	parts := map[string]string{
+		"xl/sharedStrings.xml": `<sst><si><t>email</t></si><si><r><t>na</t></r><r><t>me</t></r></si><si><t>João</t></si></sst>`,
+		"xl/styles.xml": `<styleSheet><numFmts count="1"><numFmt numFmtId="164" formatCode="dd/mm/yyyy"/></numFmts>` +
+			`<cellXfs count="2"><xf numFmtId="0"/><xf numFmtId="164"/></cellXfs></styleSheet>`,
+	}
+	for i, name := range order {
+		id := string(rune('1' + i))
+		workbook.WriteString(`<sheet name="` + name + `" sheetId="` + id + `" r:id="rId` + id + `"/>`)
+		rels.WriteString(`<Relationship Id="rId` + id + `" Target="worksheets/sheet` + id + `.xml"/>`)
+		parts["xl/worksheets/sheet"+id+".xml"] = `<worksheet><sheetData>` + sheets[name] + `</sheetData></worksheet>`
+	}
+	parts["xl/workbook.xml"] = `<workbook xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>` +
+		workbook.String() + `</sheets></workbook>`
+	parts["xl/_rels/workbook.xml.rels"] = `<Relationships>` + rels.String() + `</Relationships>`
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for name, content := range parts {
+		part, err := archive.Create(name)
+		if err != nil {
+			t.Fatalf("Failed to create workbook: %v", err)
+		}
+		part.Write([]byte(content))
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatalf("Failed to create workbook: %v", err)
+	}
+	return bytes.NewReader(buf.Bytes())
+}
+
+func TestXLSXReader_ReadsNamedSheet(t *testing.T) {
+	participants := `<row r="2"><c r="A2" t="s"><v>0</v></c><c r="B2" t="s"><v>1</v></c>` +
+		`<c r="C2" t="inlineStr"><is><t>course</t></is></c><c r="D2" t="inlineStr"><is><t>Conclusão</t></is></c>` +
+		`<c r="F2" t="inlineStr"><is><t>hours</t></is></c></row>` +
+		`<row r="3"><c r="A3" t="inlineStr"><is><t>joao@example.com</t></is></c><c r="B3" t="s"><v>2</v></c>` +
+		`<c r="C3" t="inlineStr"><is><t>Go Programming</t></is></c><c r="D3" s="1"><v>45306</v></c><c r="F3"><v>8.5</v></c></row>` +
+		`<row r="4"/>` +
+		`<row r="5"><c r="A5" t="inlineStr"><is><t>bob@example.com</t></is></c></row>`
+	workbook := newWorkbook(t, map[string]string{"Notes": "", "Participantes": participants}, "Notes", "Participantes")
+
+	reader, err := services.NewXLSXReader(workbook, services.ImportOptions{
+		Sheet:   "participantes",
+		Mapping: map[string]string{"Conclusão": "completion_date"},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	rows, err := services.ReadBatch(reader)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("Expected 2 rows, got %d", len(rows))
+	}
+
+	req := rows[0].Request
+	if rows[0].Row != 3 || req == nil {
+		t.Fatalf("Expected row 3 to be valid, got %+v", rows[0])
+	}
+	if req.Email != "joao@example.com" || req.Name != "João" || req.Course != "Go Programming" {
+		t.Errorf("Expected shared and inline strings to be read, got %+v", req)
+	}
+	if req.CompletionDate != "2024-01-15" {
+		t.Errorf("Expected the date cell as 2024-01-15, got %s", req.CompletionDate)
+	}
+	if req.Data["hours"] != "8.5" {
+		t.Errorf("Expected hours 8.5, got %v", req.Data)
+	}
+	if rows[1].Row != 5 || rows[1].Err == nil {
+		t.Errorf("Expected row 5 to fail for missing columns, got %+v", rows[1])
+	}
+
+	// The first sheet is read by default, and sheets must exist
+	if _, err := services.NewXLSXReader(newWorkbook(t, map[string]string{"Notes": ""}, "Notes"), services.ImportOptions{}); err == nil {
+		t.Error("Expected an error for an empty first sheet")
+	}
+	if _, err := services.NewXLSXReader(newWorkbook(t, map[string]string{"Notes": ""}, "Notes"), services.ImportOptions{Sheet: "Missing"}); err == nil {
+		t.Error("Expected an error for a missing sheet")
+	}
+	if _, err := services.NewXLSXReader(strings.NewReader("email,name"), services.ImportOptions{}); err == nil {
+		t.Error("Expected an error for a file that is not a workbook")
+	}
+}
+
+func TestXLSXReader_RejectsCellsPastLastColumn(t *testing.T) {
+	header := `<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c>` +
+		`<c r="C1" t="inlineStr"><is><t>course</t></is></c><c r="D1" t="inlineStr"><is><t>completion_date</t></is></c></row>`
+	row := func(ref string) string {
+		return `<row r="2"><c r="A2" t="inlineStr"><is><t>joao@example.com</t></is></c><c r="B2" t="s"><v>2</v></c>` +
+			`<c r="C2" t="inlineStr"><is><t>Go Programming</t></is></c><c r="D2" t="inlineStr"><is><t>2024-01-15</t></is></c>` +
+			`<c r="` + ref + `" t="inlineStr"><is><t>extra</t></is></c></row>`
+	}
+
+	// XFD is the last column of a sheet
+	reader, err := services.NewXLSXReader(newWorkbook(t, map[string]string{"Sheet1": header + row("XFD2")}, "Sheet1"), services.ImportOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	rows, err := services.ReadBatch(reader)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(rows) != 1 || rows[0].Request == nil {
+		t.Fatalf("Expected 1 valid row, got %+v", rows)
+	}
+
+	for _, ref := range []string{"XFE2", "AAAAAAA2", strings.Repeat("Z", 40) + "2"} {
+		reader, err := services.NewXLSXReader(newWorkbook(t, map[string]string{"Sheet1": header + row(ref)}, "Sheet1"), services.ImportOptions{})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if _, err := services.ReadBatch(reader); err == nil {
+			t.Errorf("Expected an error for cell %s", ref)
+		}
+	}
+
+	oversized := `<row r="1"><c r="AAAAAAA1" t="s"><v>0</v></c></row>`
+	if _, err := services.NewXLSXReader(newWorkbook(t, map[string]string{"Sheet1": oversized}, "Sheet1"), services.ImportOptions{}); err == nil {
+		t.Error("Expected an error for a header cell past column XFD")
+	}
+}
+
+func TestJSONLReader_ReadsObjectsPerLine(t *testing.T) {
+	jsonlData := `{"email": "john@example.com", "nome": "John Doe", "course": "Go Programming", "completion_date": "2024-01-15", "hours": 8, "data": {"instructor": "Ana", "online": true}}
+
+{"email": "jane@example.com", "nome": "Jane Doe"}
+[1, 2]
+{"email": "bob@example.com", "nome": "Bob", "course": "Go", "completion_date": "2024-01-15", "tags": ["a"]}
+`
+
+	reader, err := services.NewJSONLReader(strings.NewReader(jsonlData), services.ImportOptions{Mapping: map[string]string{"nome": "name"}})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	rows, err := services.ReadBatch(reader)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(rows) != 4 {
+		t.Fatalf("Expected 4 rows, got %d", len(rows))
+	}
+
+	req := rows[0].Request
+	if req == nil || req.Name != "John Doe" {
+		t.Fatalf("Expected the first line to be valid, got %+v", rows[0])
+	}
+	if req.Data["hours"] != "8" || req.Data["instructor"] != "Ana" || req.Data["online"] != "true" {
+		t.Errorf("Expected hours, instructor and online data, got %v", req.Data)
+	}
+
+	for i, line := range []int{3, 4, 5} {
+		if row := rows[i+1]; row.Row != line || row.Err == nil {
+			t.Errorf("Expected line %d to fail, got %+v", line, row)
+		}
+	}
+	if !strings.Contains(rows[1].Err.Error(), "course") {
+		t.Errorf("Expected the missing fields to be reported, got %v", rows[1].Err)
+	}
+}
+
+func TestDetectBatchFormat(t *testing.T) {
+	cases := []struct {
+		filename, contentType, expected string
+	}{
+		{"alunos.xlsx", "application/octet-stream", services.FormatXLSX},
+		{"export.jsonl", "", services.FormatJSONL},
+		{"export.ndjson", "", services.FormatJSONL},
+		{"alunos.csv", "application/vnd.ms-excel", services.FormatCSV},
+		{"upload", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", services.FormatXLSX},
+		{"upload", "application/x-ndjson; charset=utf-8", services.FormatJSONL},
+		{"upload", "", services.FormatCSV},
+	}
+	for _, c := range cases {
+		if format := services.DetectBatchFormat(c.filename, c.contentType); format != c.expected {
+			t.Errorf("Expected %s for %s (%s), got %s", c.expected, c.filename, c.contentType, format)
+		}
+	}
+}
+
+func TestJobService_SubmitsXLSXFile(t *testing.T) {
+	// Setup
+	memStorage := storage.NewMemoryStorage()
+	_ = services.NewTemplateService(memStorage)
+	certService := services.NewCertificateService(memStorage)
+	jobService := services.NewJobService(memStorage, certService, 1)
+	defer jobService.Close()
+
+	sheet := `<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c>` +
+		`<c r="C1" t="inlineStr"><is><t>course</t></is></c><c r="D1" t="inlineStr"><is><t>date</t></is></c></row>` +
+		`<row r="2"><c r="A2" t="inlineStr"><is><t>joao@example.com</t></is></c><c r="B2" t="s"><v>2</v></c>` +
+		`<c r="C2" t="inlineStr"><is><t>Go Programming</t></is></c><c r="D2" s="1"><v>45306</v></c></row>`
+
+	job, err := jobService.SubmitFile(models.DefaultOrganizationID, models.SystemActor, newWorkbook(t, map[string]string{"Sheet1": sheet}, "Sheet1"),
+		services.ImportOptions{Format: services.FormatXLSX})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	job = waitForJob(t, jobService, job.ID)
+
+	if job.Total != 1 || job.Succeeded != 1 {
+		t.Errorf("Expected 1 certificate issued, got %+v", job)
+	}
+}
@@ -0,0 +1,194 @@
+package services_test
+
+import (
+	"bytes"
+	"encoding/csv"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"vibe-certificados/models"
+	"vibe-certificados/services"
+	"vibe-certificados/storage"
+)
+
+func TestCertificateService_ValidateBatchFile(t *testing.T) {
+	// Setup
+	memStorage := storage.NewMemoryStorage()
+	templateService := services.NewTemplateService(memStorage)
+	certService := services.NewCertificateService(memStorage)
+
+	if err := templateService.CreateTemplate(models.DefaultOrganizationID, models.SystemActor, newWorkshopTemplate()); err != nil {
+		t.Fatalf("Failed to create template: %v", err)
+	}
+
+	csvData := `email,name,course,completion_date,template_id,hours
+john@example.com,John Doe,Go Programming,2024-01-15,workshop,8
+jane@example.com,Jane Doe,Go Programming,15/01/2024,,
+bob@example.com,Bob,Go Programming,2024-01-15,missing,
+not-an-email,Ana,Go Programming,2024-01-15,,
+john@example.com,John Doe,Go Programming,2024-01-15,workshop,4
+maria@example.com,Maria,Go Programming,2024-01-15,workshop,
+pedro@example.com,Pedro`
+
+	report, err := certService.ValidateBatchFile(models.DefaultOrganizationID, strings.NewReader(csvData), services.ImportOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// Repeated rows are issued again without a duplicate policy
+	if report.Total != 7 || report.Valid != 2 || report.Failed != 5 {
+		t.Fatalf("Expected 2 valid and 5 failed rows, got %d valid and %d failed", report.Valid, report.Failed)
+	}
+	expected := map[int]string{
+		3: "completion_date",
+		4: "template not found",
+		5: "email",
+		7: "hours",
+		8: "insufficient columns",
+	}
+	if !report.Rows[4].Valid {
+		t.Errorf("Expected row 6 to be valid, got %q", report.Rows[4].Error)
+	}
+	for _, result := range report.Rows[1:] {
+		if result.Row == 6 {
+			continue
+		}
+		if result.Valid || !strings.Contains(result.Error, expected[result.Row]) {
+			t.Errorf("Expected row %d to fail with %q, got %q", result.Row, expected[result.Row], result.Error)
+		}
+	}
+	if fields := report.Rows[5].Fields; len(fields) != 1 || fields[0].Field != "hours" {
+		t.Errorf("Expected a field error for hours, got %+v", fields)
+	}
+
+	// Nothing is issued
+	page, err := certService.ListCertificates(models.DefaultOrganizationID, &models.CertificateQuery{})
+	if err != nil {
+		t.Fatalf("Failed to list certificates: %v", err)
+	}
+	if len(page.Certificates) != 0 {
+		t.Errorf("Expected no certificates after a dry run, got %d", len(page.Certificates))
+	}
+}
+
+func TestWriteFailedRowsCSV_CanBeResubmitted(t *testing.T) {
+	// Setup
+	memStorage := storage.NewMemoryStorage()
+	_ = services.NewTemplateService(memStorage)
+	certService := services.NewCertificateService(memStorage)
+
+	csvData := `email;Nome;course;Data;Instrutor;Obs
+john@example.com;John Doe;Go Programming;2024-01-15;Ana;
+jane@example.com;Jane Doe;Go Programming;2024-13-01;Ana;late`
+	opts := services.ImportOptions{
+		Delimiter: ';',
+		Mapping:   map[string]string{"Nome": "name", "Data": "completion_date", "Instrutor": "instructor", "Obs": ""},
+	}
+
+	report, err := certService.ValidateBatchFile(models.DefaultOrganizationID, strings.NewReader(csvData), opts)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := services.WriteFailedRowsCSV(&buf, report, opts); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	reader := csv.NewReader(bytes.NewReader(buf.Bytes()))
+	reader.Comma = ';'
+	records, err := reader.ReadAll()
+	if err != nil {
+		t.Fatalf("Expected a valid CSV, got %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Expected the header and 1 failed row, got %v", records)
+	}
+	expected := []string{"import_row", "import_error", "email", "Nome", "course", "Data", "template_id", "locale", "Instrutor", "Obs"}
+	if !slices.Equal(records[0], expected) {
+		t.Errorf("Expected the header %v, got %v", expected, records[0])
+	}
+	if records[1][0] != "3" || !strings.Contains(records[1][1], "completion_date") || records[1][3] != "Jane Doe" {
+		t.Errorf("Expected row 3 annotated with its error, got %v", records[1])
+	}
+
+	// Once fixed, the file is uploaded again with the same options; the
+	// report columns are skipped
+	fixed := strings.Replace(buf.String(), "2024-13-01", "2024-01-13", 1)
+	report, err = certService.ValidateBatchFile(models.DefaultOrganizationID, strings.NewReader(fixed), opts)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if report.Total != 1 || report.Valid != 1 {
+		t.Fatalf("Expected 1 valid row, got %+v", report)
+	}
+	req := report.Rows[0].Request
+	if req.Name != "Jane Doe" || req.CompletionDate != "2024-01-13" {
+		t.Errorf("Expected the fixed request, got %+v", req)
+	}
+	if len(req.Data) != 1 || req.Data["instructor"] != "Ana" {
+		t.Errorf("Expected only the instructor data, got %v", req.Data)
+	}
+}
+
+func TestCertificateService_RejectsInvalidEmail(t *testing.T) {
+	// Setup
+	memStorage := storage.NewMemoryStorage()
+	_ = services.NewTemplateService(memStorage)
+	certService := services.NewCertificateService(memStorage)
+
+	for _, email := range []string{"", "john", "John <john@example.com>"} {
+		_, err := certService.CreateCertificate(models.DefaultOrganizationID, models.SystemActor, &models.CertificateRequest{
+			Email:          email,
+			Name:           "John Doe",
+			Course:         "Go Programming",
+			CompletionDate: "2024-01-15",
+		})
+		if err == nil {
+			t.Errorf("Expected an error for email %q", email)
+		}
+	}
+}
+
+func TestCertificateService_ValidateBatchFileMatchesIssuance(t *testing.T) {
+	// John was issued before; Jane appears twice in the file
+	csvData := `email,name,course,completion_date
+john@example.com,John Doe,Go Programming,2024-01-15
+jane@example.com,Jane Doe,Go Programming,2024-01-15
+jane@example.com,Jane Doe,Go Programming,2024-01-15`
+
+	policies := []string{"", models.DuplicateAllow, models.DuplicateSkip, models.DuplicateReturnExisting, models.DuplicateFail}
+	for _, policy := range policies {
+		t.Run("policy "+policy, func(t *testing.T) {
+			memStorage := storage.NewMemoryStorage()
+			_ = services.NewTemplateService(memStorage)
+			certService := services.NewCertificateService(memStorage)
+			if _, err := certService.CreateCertificate(models.DefaultOrganizationID, models.SystemActor, newCertificateRequest("")); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			opts := services.ImportOptions{OnDuplicate: policy}
+
+			report, err := certService.ValidateBatchFile(models.DefaultOrganizationID, strings.NewReader(csvData), opts)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			response, err := certService.CreateCertificatesFromFile(models.DefaultOrganizationID, models.SystemActor, strings.NewReader(csvData), opts)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			if report.Valid != response.Success || report.Skipped != response.Skipped || report.Failed != response.Failed {
+				t.Errorf("Expected the dry run to match issuance (%d created, %d skipped, %d failed), got %d valid, %d skipped and %d failed",
+					response.Success, response.Skipped, response.Failed, report.Valid, report.Skipped, report.Failed)
+			}
+			for i, result := range report.Rows {
+				failed := slices.ContainsFunc(response.Errors, func(e string) bool {
+					return strings.HasPrefix(e, "Row "+strconv.Itoa(result.Row)+":")
+				})
+				if failed == result.Valid {
+					t.Errorf("Expected row %d to be valid=%v in the dry run, got %v", i+2, !failed, result.Valid)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package services_test
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"vibe-certificados/models"
+	"vibe-certificados/services"
+	"vibe-certificados/storage"
+)
+
+func TestCertificateService_CorrectCertificate(t *testing.T) {
+	// Setup
+	memStorage := storage.NewMemoryStorage()
+	templateService := services.NewTemplateService(memStorage)
+	certService := services.NewCertificateService(memStorage)
+	signer, err := services.LoadOrCreateSigningService(filepath.Join(t.TempDir(), "signing_key.pem"))
+	if err != nil {
+		t.Fatalf("Failed to create signer: %v", err)
+	}
+	certService.SetSigner(signer)
+
+	req := newCertificateRequest("")
+	req.Name = "Jonh Doe"
+	req.Data = map[string]string{"instructor": "Ana", "room": "12"}
+	original, err := certService.CreateCertificate(models.DefaultOrganizationID, models.SystemActor, req)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	name, instructor := "John Doe", "Ana Lima"
+	corrected, err := certService.CorrectCertificate(models.DefaultOrganizationID, models.SystemActor, original.ID, &models.CorrectCertificateRequest{
+		Name:   &name,
+		Data:   map[string]*string{"instructor": &instructor, "room": nil},
+		Reason: "Misspelt name",
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if corrected.ID == original.ID || corrected.Name != "John Doe" || corrected.Course != original.Course || corrected.Email != original.Email {
+		t.Errorf("Expected a new certificate with the corrected name, got %+v", corrected)
+	}
+	if len(corrected.Data) != 1 || corrected.Data["instructor"] != "Ana Lima" {
+		t.Errorf("Expected the data to be patched, got %v", corrected.Data)
+	}
+	if corrected.Supersedes != original.ID || corrected.CorrectionReason != "Misspelt name" || !corrected.IsValid() {
+		t.Errorf("Expected an active certificate superseding %s, got %+v", original.ID, corrected)
+	}
+
+	// The old certificate stays retrievable, pointing at its replacement
+	old, _ := certService.GetCertificate(models.DefaultOrganizationID, original.ID)
+	if !old.IsSuperseded() || old.SupersededBy != corrected.ID || old.SupersededAt == nil || old.Name != "Jonh Doe" {
+		t.Errorf("Expected the old certificate to be superseded, got %+v", old)
+	}
+	result, _ := certService.VerifyCertificate(original.ID)
+	if result.Result != models.VerificationSuperseded || result.SupersededBy != corrected.ID {
+		t.Errorf("Expected verification to report the replacement, got %+v", result)
+	}
+	if result, _ := certService.VerifyCertificate(corrected.ID); result.Result != models.VerificationValid {
+		t.Errorf("Expected the corrected certificate to be valid, got %+v", result)
+	}
+	html, err := templateService.RenderCertificate(old)
+	if err != nil {
+		t.Fatalf("Failed to render certificate: %v", err)
+	}
+	if !strings.Contains(html, corrected.ID) {
+		t.Error("Expected the old certificate to name its replacement")
+	}
+
+	// Only the current certificate can be corrected
+	if _, err := certService.CorrectCertificate(models.DefaultOrganizationID, models.SystemActor, original.ID, &models.CorrectCertificateRequest{Name: &name}); !errors.Is(err, services.ErrCertificateNotCorrectable) {
+		t.Errorf("Expected ErrCertificateNotCorrectable, got %v", err)
+	}
+	if _, err := certService.CorrectCertificate(models.DefaultOrganizationID, models.SystemActor, corrected.ID, &models.CorrectCertificateRequest{Name: &name}); err == nil {
+		t.Error("Expected an error for a correction changing nothing")
+	}
+	if _, err := certService.CorrectCertificate("acme", models.SystemActor, corrected.ID, &models.CorrectCertificateRequest{Name: &name}); !errors.Is(err, storage.ErrCertificateNotFound) {
+		t.Errorf("Expected ErrCertificateNotFound for another organization, got %v", err)
+	}
+
+	entries, _ := memStorage.GetAuditEntries(models.DefaultOrganizationID, &models.AuditFilter{Action: models.AuditCertificateCorrect})
+	if len(entries) != 1 || entries[0].TargetID != original.ID {
+		t.Errorf("Expected the correction to be audited, got %+v", entries)
+	}
+}
+
+func TestCertificateService_CorrectRevokedCertificate(t *testing.T) {
+	// Setup
+	memStorage := storage.NewMemoryStorage()
+	_ = services.NewTemplateService(memStorage)
+	certService := services.NewCertificateService(memStorage)
+
+	cert, err := certService.CreateCertificate(models.DefaultOrganizationID, models.SystemActor, newCertificateRequest(""))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := certService.RevokeCertificate(models.DefaultOrganizationID, models.SystemActor, cert.ID, "Fraud"); err != nil {
+		t.Fatalf("Failed to revoke certificate: %v", err)
+	}
+
+	course := "Advanced Go"
+	if _, err := certService.CorrectCertificate(models.DefaultOrganizationID, models.SystemActor, cert.ID, &models.CorrectCertificateRequest{Course: &course}); !errors.Is(err, services.ErrCertificateNotCorrectable) {
+		t.Errorf("Expected ErrCertificateNotCorrectable, got %v", err)
+	}
+}
+
+func TestCertificateService_CertificateHistory(t *testing.T) {
+	// Setup
+	memStorage := storage.NewMemoryStorage()
+	_ = services.NewTemplateService(memStorage)
+	certService := services.NewCertificateService(memStorage)
+
+	first, err := certService.CreateCertificate(models.DefaultOrganizationID, models.SystemActor, newCertificateRequest(""))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	ids := []string{first.ID}
+	for _, course := range []string{"Go Programing", "Go Programming I"} {
+		corrected, err := certService.CorrectCertificate(models.DefaultOrganizationID, models.SystemActor, ids[len(ids)-1], &models.CorrectCertificateRequest{Course: &course})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		ids = append(ids, corrected.ID)
+	}
+
+	// Every certificate of the chain has the same history
+	for _, id := range ids {
+		history, err := certService.CertificateHistory(models.DefaultOrganizationID, id)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if history.CurrentID != ids[2] || len(history.Certificates) != 3 {
+			t.Fatalf("Expected 3 certificates ending with %s, got %+v", ids[2], history)
+		}
+		for i, cert := range history.Certificates {
+			if cert.ID != ids[i] {
+				t.Errorf("Expected certificate %d to be %s, got %s", i, ids[i], cert.ID)
+			}
+		}
+	}
+
+	if _, err := certService.CertificateHistory(models.DefaultOrganizationID, "missing"); !errors.Is(err, storage.ErrCertificateNotFound) {
+		t.Errorf("Expected ErrCertificateNotFound, got %v", err)
+	}
+}
+
+// failingCorrectionStorage refuses to save corrected certificates
+type failingCorrectionStorage struct {
+	storage.Storage
+}
+
+func (s *failingCorrectionStorage) SaveCertificate(cert *models.Certificate) error {
+	if cert.Supersedes != "" {
+		return errors.New("disk full")
+	}
+	return s.Storage.SaveCertificate(cert)
+}
+
+func TestCertificateService_CorrectCertificateRestoresOldOnFailure(t *testing.T) {
+	memStorage := &failingCorrectionStorage{Storage: storage.NewMemoryStorage()}
+	_ = services.NewTemplateService(memStorage)
+	certService := services.NewCertificateService(memStorage)
+
+	original, _ := certService.CreateCertificate(models.DefaultOrganizationID, models.SystemActor, newCertificateRequest(""))
+	name := "Jane Doe"
+	if _, err := certService.CorrectCertificate(models.DefaultOrganizationID, models.SystemActor, original.ID, &models.CorrectCertificateRequest{Name: &name}); err == nil {
+		t.Fatal("Expected the correction to fail")
+	}
+
+	old, _ := certService.GetCertificate(models.DefaultOrganizationID, original.ID)
+	if !old.IsValid() || old.SupersededBy != "" {
+		t.Errorf("Expected the old certificate to stay active, got %+v", old)
+	}
+	certs, _ := memStorage.GetCertificatesByEmail(models.DefaultOrganizationID, original.Email)
+	if len(certs) != 1 {
+		t.Errorf("Expected no replacement to be stored, got %d certificates", len(certs))
+	}
+}
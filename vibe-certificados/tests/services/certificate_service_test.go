@@ -1,8 +1,10 @@
 package services_test
 
 import (
+	"errors"
 	"strings"
 	"testing"
+	"time"
 	"vibe-certificados/models"
 	"vibe-certificados/services"
 	"vibe-certificados/storage"
@@ -23,7 +25,7 @@ func TestCertificateService_CreateCertificate(t *testing.T) {
 		TemplateID:     "default",
 	}
 
-	cert, err := certService.CreateCertificate(req)
+	cert, err := certService.CreateCertificate(models.DefaultOrganizationID, models.SystemActor, req)
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
 	}
@@ -50,7 +52,7 @@ func TestCertificateService_CreateCertificate(t *testing.T) {
 		TemplateID:     "default",
 	}
 
-	_, err = certService.CreateCertificate(invalidReq)
+	_, err = certService.CreateCertificate(models.DefaultOrganizationID, models.SystemActor, invalidReq)
 	if err == nil {
 		t.Error("Expected error for invalid date format")
 	}
@@ -70,13 +72,13 @@ func TestCertificateService_GetCertificate(t *testing.T) {
 		CompletionDate: "2024-01-15",
 	}
 
-	cert, err := certService.CreateCertificate(req)
+	cert, err := certService.CreateCertificate(models.DefaultOrganizationID, models.SystemActor, req)
 	if err != nil {
 		t.Fatalf("Failed to create certificate: %v", err)
 	}
 
 	// Get the certificate
-	retrieved, err := certService.GetCertificate(cert.ID)
+	retrieved, err := certService.GetCertificate(models.DefaultOrganizationID, cert.ID)
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
 	}
@@ -86,7 +88,7 @@ func TestCertificateService_GetCertificate(t *testing.T) {
 	}
 
 	// Test non-existent certificate
-	_, err = certService.GetCertificate("non-existent")
+	_, err = certService.GetCertificate(models.DefaultOrganizationID, "non-existent")
 	if err == nil {
 		t.Error("Expected error for non-existent certificate")
 	}
@@ -109,14 +111,14 @@ func TestCertificateService_GetCertificatesByEmail(t *testing.T) {
 			CompletionDate: "2024-01-15",
 		}
 
-		_, err := certService.CreateCertificate(req)
+		_, err := certService.CreateCertificate(models.DefaultOrganizationID, models.SystemActor, req)
 		if err != nil {
 			t.Fatalf("Failed to create certificate %d: %v", i, err)
 		}
 	}
 
 	// Get certificates by email
-	certificates, err := certService.GetCertificatesByEmail(email)
+	certificates, err := certService.GetCertificatesByEmail(models.DefaultOrganizationID, email)
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
 	}
@@ -126,7 +128,7 @@ func TestCertificateService_GetCertificatesByEmail(t *testing.T) {
 	}
 
 	// Test empty email
-	emptyCertificates, err := certService.GetCertificatesByEmail("empty@example.com")
+	emptyCertificates, err := certService.GetCertificatesByEmail(models.DefaultOrganizationID, "empty@example.com")
 	if err != nil {
 		t.Fatalf("Expected no error for empty email, got %v", err)
 	}
@@ -136,7 +138,7 @@ func TestCertificateService_GetCertificatesByEmail(t *testing.T) {
 	}
 }
 
-func TestCertificateService_CreateCertificatesFromCSV(t *testing.T) {
+func TestCertificateService_CreateCertificatesFromFile(t *testing.T) {
 	// Setup
 	memStorage := storage.NewMemoryStorage()
 	_ = services.NewTemplateService(memStorage) // Initialize templates
@@ -150,7 +152,7 @@ test3@example.com,Pedro Oliveira,Database Design,2024-01-25`
 
 	reader := strings.NewReader(csvData)
 
-	response, err := certService.CreateCertificatesFromCSV(reader)
+	response, err := certService.CreateCertificatesFromFile(models.DefaultOrganizationID, models.SystemActor, reader, services.ImportOptions{})
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
 	}
@@ -173,8 +175,103 @@ test3@example.com,Pedro Oliveira,Database Design,2024-01-25`
 test@example.com,João Silva`
 
 	invalidReader := strings.NewReader(invalidCSV)
-	_, err = certService.CreateCertificatesFromCSV(invalidReader)
+	_, err = certService.CreateCertificatesFromFile(models.DefaultOrganizationID, models.SystemActor, invalidReader, services.ImportOptions{})
 	if err == nil {
 		t.Error("Expected error for invalid CSV format")
 	}
-}
\ No newline at end of file
+}
+func TestCertificateService_RevokeCertificate(t *testing.T) {
+	// Setup
+	memStorage := storage.NewMemoryStorage()
+	templateService := services.NewTemplateService(memStorage)
+	certService := services.NewCertificateService(memStorage)
+
+	cert, err := certService.CreateCertificate(models.DefaultOrganizationID, models.SystemActor, &models.CertificateRequest{
+		Email:          "test@example.com",
+		Name:           "João Silva",
+		Course:         "Go Programming",
+		CompletionDate: "2024-01-15",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	if cert.Status != models.StatusActive {
+		t.Errorf("Expected status %s, got %s", models.StatusActive, cert.Status)
+	}
+
+	// Reason is mandatory
+	if _, err := certService.RevokeCertificate(models.DefaultOrganizationID, models.SystemActor, cert.ID, "  "); err == nil {
+		t.Error("Expected error for empty revocation reason")
+	}
+
+	revoked, err := certService.RevokeCertificate(models.DefaultOrganizationID, models.SystemActor, cert.ID, "Fraude detectada")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !revoked.IsRevoked() || revoked.RevokedAt == nil {
+		t.Errorf("Expected revoked certificate with timestamp, got %+v", revoked)
+	}
+
+	stored, _ := certService.GetCertificate(models.DefaultOrganizationID, cert.ID)
+	if stored.RevocationReason != "Fraude detectada" {
+		t.Errorf("Expected stored revocation reason, got %q", stored.RevocationReason)
+	}
+
+	// Revoking twice is rejected
+	if _, err := certService.RevokeCertificate(models.DefaultOrganizationID, models.SystemActor, cert.ID, "again"); err == nil {
+		t.Error("Expected error when revoking twice")
+	}
+
+	// Rendered HTML must clearly show the revocation
+	html, err := templateService.RenderCertificate(stored)
+	if err != nil {
+		t.Fatalf("Expected no error rendering, got %v", err)
+	}
+	if !strings.Contains(html, "CERTIFICADO REVOGADO") {
+		t.Error("Expected revoked banner in rendered HTML")
+	}
+}
+
+func TestCertificateService_ListCertificates(t *testing.T) {
+	memStorage := storage.NewMemoryStorage()
+	services.NewTemplateService(memStorage)
+	certService := services.NewCertificateService(memStorage)
+
+	// Fixed creation times, so the order does not depend on the clock
+	for i, name := range []string{"Ana", "Bruno", "Carla"} {
+		cert := models.NewCertificate("turma@example.com", name, "Go", "default", time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC), nil)
+		cert.CreatedAt = time.Date(2024, 3, 1, 9+i, 0, 0, 0, time.UTC)
+		if err := memStorage.SaveCertificate(cert); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	// Newest first by default
+	page, err := certService.ListCertificates(models.DefaultOrganizationID, &models.CertificateQuery{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(page.Certificates) != 3 || page.Certificates[0].Name != "Carla" || page.NextCursor != "" {
+		t.Errorf("Expected the 3 certificates newest first, got %+v", page)
+	}
+
+	page, err = certService.ListCertificates(models.DefaultOrganizationID, &models.CertificateQuery{Sort: models.SortName, Limit: 2})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(page.Certificates) != 2 || page.Certificates[0].Name != "Ana" || page.NextCursor == "" {
+		t.Errorf("Expected a first page of 2 by name, got %+v", page)
+	}
+
+	invalid := []*models.CertificateQuery{
+		{Sort: "email"},
+		{Status: "expired"},
+		{Limit: services.MaxCertificatePageSize + 1},
+		{CreatedFrom: time.Now(), CreatedUntil: time.Now().Add(-time.Hour)},
+	}
+	for _, query := range invalid {
+		if _, err := certService.ListCertificates(models.DefaultOrganizationID, query); !errors.Is(err, services.ErrInvalidCertificateQuery) {
+			t.Errorf("Expected ErrInvalidCertificateQuery for %+v, got %v", query, err)
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package services_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"vibe-certificados/models"
+	"vibe-certificados/services"
+	"vibe-certificados/storage"
+)
+
+// flakyMailer fails a number of times before accepting messages
+type flakyMailer struct {
+	mutex    sync.Mutex
+	failures int
+	sent     []*services.EmailMessage
+}
+
+func (m *flakyMailer) Send(msg *services.EmailMessage) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.failures > 0 {
+		m.failures--
+		return errors.New("connection refused")
+	}
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+// waitForDelivery polls a certificate until its delivery leaves the pending state
+func waitForDelivery(t *testing.T, certService *services.CertificateService, id string) *models.DeliveryStatus {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		cert, err := certService.GetCertificate(models.DefaultOrganizationID, id)
+		if err != nil {
+			t.Fatalf("Failed to get certificate: %v", err)
+		}
+		if cert.Delivery != nil && cert.Delivery.Status != models.DeliveryPending {
+			return cert.Delivery
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Certificate %s was not delivered in time", id)
+	return nil
+}
+
+func newDeliverySetup(t *testing.T, mailer services.Mailer, maxAttempts int) (*services.TemplateService, *services.CertificateService) {
+	t.Helper()
+
+	memStorage := storage.NewMemoryStorage()
+	templateService := services.NewTemplateService(memStorage)
+	certService := services.NewCertificateService(memStorage)
+	pdfService := services.NewPDFService(templateService)
+
+	delivery := services.NewDeliveryService(memStorage, templateService, pdfService, mailer, 1, maxAttempts, time.Millisecond)
+	t.Cleanup(delivery.Close)
+	certService.SetDeliveryService(delivery)
+	return templateService, certService
+}
+
+func TestDeliveryService_SendsCertificateWithFileMailer(t *testing.T) {
+	dir := t.TempDir()
+	mailer, err := services.NewFileMailer(dir, "certificados@example.com")
+	if err != nil {
+		t.Fatalf("Failed to create mailer: %v", err)
+	}
+	templateService, certService := newDeliverySetup(t, mailer, 3)
+
+	templateService.CreateTemplate(models.DefaultOrganizationID, models.SystemActor, &models.Template{
+		ID:           "welcome",
+		Name:         "Welcome",
+		HTMLTemplate: "<p>{{.Name}}</p>",
+		Email:        &models.EmailTemplate{Subject: "Certificado de {{.Name}}", Body: "Curso: {{.Course}}"},
+	})
+
+	cert, err := certService.CreateCertificate(models.DefaultOrganizationID, models.SystemActor, &models.CertificateRequest{
+		Email:          "test@example.com",
+		Name:           "João Silva",
+		Course:         "Go Programming",
+		CompletionDate: "2024-01-15",
+		TemplateID:     "welcome",
+		SendEmail:      true,
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if cert.Delivery == nil || cert.Delivery.Status != models.DeliveryPending {
+		t.Errorf("Expected pending delivery, got %+v", cert.Delivery)
+	}
+
+	delivery := waitForDelivery(t, certService, cert.ID)
+	if delivery.Status != models.DeliverySent || delivery.Attempts != 1 || delivery.SentAt == nil {
+		t.Errorf("Expected sent after 1 attempt, got %+v", delivery)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if len(files) != 1 {
+		t.Fatalf("Expected 1 email file, got %d", len(files))
+	}
+	content, _ := os.ReadFile(files[0])
+	email := string(content)
+	if !strings.Contains(email, "To: <test@example.com>") {
+		t.Error("Expected the certificate email as recipient")
+	}
+	if !strings.Contains(email, "Subject: =?utf-8?q?Certificado_de_Jo=C3=A3o_Silva?=") {
+		t.Error("Expected the template subject")
+	}
+	if !strings.Contains(email, "Curso: Go Programming") {
+		t.Error("Expected the template body")
+	}
+	if !strings.Contains(email, `filename=certificado_`+cert.ID+`.pdf`) {
+		t.Error("Expected the PDF attachment")
+	}
+}
+
+func TestDeliveryService_RetriesFailedSends(t *testing.T) {
+	mailer := &flakyMailer{failures: 2}
+	_, certService := newDeliverySetup(t, mailer, 3)
+
+	cert, err := certService.CreateCertificate(models.DefaultOrganizationID, models.SystemActor, &models.CertificateRequest{
+		Email:          "test@example.com",
+		Name:           "João Silva",
+		Course:         "Go Programming",
+		CompletionDate: "2024-01-15",
+		SendEmail:      true,
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	delivery := waitForDelivery(t, certService, cert.ID)
+	if delivery.Status != models.DeliverySent || delivery.Attempts != 3 {
+		t.Errorf("Expected sent after 3 attempts, got %+v", delivery)
+	}
+}
+
+func TestDeliveryService_MarksFailedAfterMaxAttempts(t *testing.T) {
+	mailer := &flakyMailer{failures: 10}
+	_, certService := newDeliverySetup(t, mailer, 2)
+
+	cert, _ := certService.CreateCertificate(models.DefaultOrganizationID, models.SystemActor, &models.CertificateRequest{
+		Email:          "test@example.com",
+		Name:           "João Silva",
+		Course:         "Go Programming",
+		CompletionDate: "2024-01-15",
+		SendEmail:      true,
+	})
+
+	delivery := waitForDelivery(t, certService, cert.ID)
+	if delivery.Status != models.DeliveryFailed || delivery.Attempts != 2 {
+		t.Errorf("Expected failed after 2 attempts, got %+v", delivery)
+	}
+	if delivery.LastError != "connection refused" {
+		t.Errorf("Expected last error 'connection refused', got %s", delivery.LastError)
+	}
+
+	// Resending starts a new round of attempts
+	mailer.mutex.Lock()
+	mailer.failures = 0
+	mailer.mutex.Unlock()
+	if _, err := certService.SendCertificate(models.DefaultOrganizationID, models.SystemActor, cert.ID); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	delivery = waitForDelivery(t, certService, cert.ID)
+	if delivery.Status != models.DeliverySent {
+		t.Errorf("Expected sent after resending, got %+v", delivery)
+	}
+}
+
+func TestCertificateService_SendEmailRequiresDelivery(t *testing.T) {
+	memStorage := storage.NewMemoryStorage()
+	_ = services.NewTemplateService(memStorage)
+	certService := services.NewCertificateService(memStorage)
+
+	_, err := certService.CreateCertificate(models.DefaultOrganizationID, models.SystemActor, &models.CertificateRequest{
+		Email:          "test@example.com",
+		Name:           "João Silva",
+		Course:         "Go Programming",
+		CompletionDate: "2024-01-15",
+		SendEmail:      true,
+	})
+	if err == nil {
+		t.Error("Expected error when email delivery is not configured")
+	}
+}
+
+// blockingMailer holds every send until it is released
+type blockingMailer struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (m *blockingMailer) Send(msg *services.EmailMessage) error {
+	select {
+	case m.started <- struct{}{}:
+	default:
+	}
+	<-m.release
+	return nil
+}
+
+func TestDeliveryService_KeepsRevocationMadeDuringSend(t *testing.T) {
+	mailer := &blockingMailer{started: make(chan struct{}, 1), release: make(chan struct{})}
+	_, certService := newDeliverySetup(t, mailer, 3)
+
+	cert, err := certService.CreateCertificate(models.DefaultOrganizationID, models.SystemActor, &models.CertificateRequest{
+		Email:          "test@example.com",
+		Name:           "João Silva",
+		Course:         "Go Programming",
+		CompletionDate: "2024-01-15",
+		SendEmail:      true,
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	<-mailer.started
+	if _, err := certService.RevokeCertificate(models.DefaultOrganizationID, models.SystemActor, cert.ID, "issued by mistake"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	close(mailer.release)
+
+	delivery := waitForDelivery(t, certService, cert.ID)
+	if delivery.Status != models.DeliverySent {
+		t.Errorf("Expected sent, got %+v", delivery)
+	}
+	stored, _ := certService.GetCertificate(models.DefaultOrganizationID, cert.ID)
+	if !stored.IsRevoked() {
+		t.Error("Expected the revocation to be kept after the delivery")
+	}
+}
+
+func TestDeliveryService_QueueDoesNotBlockWhenFull(t *testing.T) {
+	mailer := &blockingMailer{started: make(chan struct{}, 1), release: make(chan struct{})}
+	memStorage := storage.NewMemoryStorage()
+	templateService := services.NewTemplateService(memStorage)
+	certService := services.NewCertificateService(memStorage)
+	delivery := services.NewDeliveryService(memStorage, templateService, services.NewPDFService(templateService), mailer, 1, 1, time.Millisecond)
+	certService.SetDeliveryService(delivery)
+	defer delivery.Close()
+	defer close(mailer.release)
+
+	first, _ := certService.CreateCertificate(models.DefaultOrganizationID, models.SystemActor, &models.CertificateRequest{
+		Email:          "first@example.com",
+		Name:           "João Silva",
+		Course:         "Go Programming",
+		CompletionDate: "2024-01-15",
+		SendEmail:      true,
+	})
+	<-mailer.started
+
+	// Fill the queue while the only worker is busy
+	var err error
+	for i := 0; err == nil && i <= 1000; i++ {
+		err = delivery.Queue(first.ID)
+	}
+	if !errors.Is(err, services.ErrDeliveryQueueFull) {
+		t.Fatalf("Expected ErrDeliveryQueueFull, got %v", err)
+	}
+
+	// Issuing still succeeds and leaves the delivery pending
+	cert, err := certService.CreateCertificate(models.DefaultOrganizationID, models.SystemActor, &models.CertificateRequest{
+		Email:          "second@example.com",
+		Name:           "Maria Souza",
+		Course:         "Go Programming",
+		CompletionDate: "2024-01-15",
+		SendEmail:      true,
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if cert.Delivery == nil || cert.Delivery.Status != models.DeliveryPending {
+		t.Errorf("Expected pending delivery, got %+v", cert.Delivery)
+	}
+}
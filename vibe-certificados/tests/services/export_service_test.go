@@ -0,0 +1,184 @@
+package services_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"vibe-certificados/models"
+	"vibe-certificados/services"
+	"vibe-certificados/storage"
+)
+
+func TestExportService_WriteZIP(t *testing.T) {
+	// Setup
+	memStorage := storage.NewMemoryStorage()
+	templateService := services.NewTemplateService(memStorage)
+	certService := services.NewCertificateService(memStorage)
+	pdfService := services.NewPDFService(templateService)
+	jobService := services.NewJobService(memStorage, certService, 2)
+	defer jobService.Close()
+	exportService := services.NewExportService(certService, jobService, templateService, pdfService, 2)
+
+	csvData := `email,name,course,completion_date
+john@example.com,John Doe,Go Programming,2024-01-15
+jane@example.com,Jane Smith,Web/Development,2024-01-20
+john@example.com,John Doe,Go Programming,2024-02-15`
+
+	job, err := jobService.SubmitFile(models.DefaultOrganizationID, models.SystemActor, strings.NewReader(csvData), services.ImportOptions{})
+	if err != nil {
+		t.Fatalf("Failed to submit job: %v", err)
+	}
+	waitForJob(t, jobService, job.ID)
+
+	req := &models.ExportCertificatesRequest{
+		JobID:           job.ID,
+		IncludeHTML:     true,
+		FilenamePattern: "{{.Name}} - {{.Course}}.pdf",
+	}
+	certificates, err := exportService.ResolveCertificates(models.DefaultOrganizationID, req)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(certificates) != 3 {
+		t.Fatalf("Expected 3 certificates, got %d", len(certificates))
+	}
+
+	pattern, err := services.ParseFilenamePattern(req.FilenamePattern)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := exportService.WriteZIP(&buf, certificates, pattern, req.IncludeHTML); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("Expected a valid ZIP, got %v", err)
+	}
+
+	files := make(map[string]bool)
+	for _, file := range archive.File {
+		files[file.Name] = true
+	}
+	expected := []string{
+		"John Doe - Go Programming.pdf",
+		"John Doe - Go Programming.html",
+		"John Doe - Go Programming (2).pdf",
+		"Jane Smith - Web-Development.pdf",
+	}
+	for _, name := range expected {
+		if !files[name] {
+			t.Errorf("Expected %q in the archive, got %v", name, files)
+		}
+	}
+	if len(archive.File) != 6 {
+		t.Errorf("Expected 6 files, got %d", len(archive.File))
+	}
+}
+
+func TestExportService_ResolveCertificates(t *testing.T) {
+	// Setup
+	memStorage := storage.NewMemoryStorage()
+	templateService := services.NewTemplateService(memStorage)
+	certService := services.NewCertificateService(memStorage)
+	pdfService := services.NewPDFService(templateService)
+	jobService := services.NewJobService(memStorage, certService, 1)
+	defer jobService.Close()
+	exportService := services.NewExportService(certService, jobService, templateService, pdfService, 1)
+
+	cert, _ := certService.CreateCertificate(models.DefaultOrganizationID, models.SystemActor, &models.CertificateRequest{
+		Email:          "test@example.com",
+		Name:           "João Silva",
+		Course:         "Go Programming",
+		CompletionDate: "2024-01-15",
+	})
+
+	// IDs and email selecting the same certificate export it once
+	certificates, err := exportService.ResolveCertificates(models.DefaultOrganizationID, &models.ExportCertificatesRequest{
+		IDs:   []string{cert.ID},
+		Email: "test@example.com",
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(certificates) != 1 {
+		t.Errorf("Expected 1 certificate, got %d", len(certificates))
+	}
+
+	if _, err := exportService.ResolveCertificates(models.DefaultOrganizationID, &models.ExportCertificatesRequest{}); err == nil {
+		t.Error("Expected error for an empty selection")
+	}
+	_, err = exportService.ResolveCertificates(models.DefaultOrganizationID, &models.ExportCertificatesRequest{IDs: []string{"missing"}})
+	if !errors.Is(err, storage.ErrCertificateNotFound) {
+		t.Errorf("Expected ErrCertificateNotFound, got %v", err)
+	}
+	_, err = exportService.ResolveCertificates(models.DefaultOrganizationID, &models.ExportCertificatesRequest{JobID: "missing"})
+	if !errors.Is(err, storage.ErrJobNotFound) {
+		t.Errorf("Expected ErrJobNotFound, got %v", err)
+	}
+
+	if _, err := services.ParseFilenamePattern("{{.Name"); err == nil {
+		t.Error("Expected error for an invalid filename pattern")
+	}
+}
+
+func TestExportService_WriteZIP_ConcurrentFilenames(t *testing.T) {
+	// Setup
+	memStorage := storage.NewMemoryStorage()
+	templateService := services.NewTemplateService(memStorage)
+	certService := services.NewCertificateService(memStorage)
+	pdfService := services.NewPDFService(templateService)
+	jobService := services.NewJobService(memStorage, certService, 2)
+	defer jobService.Close()
+	exportService := services.NewExportService(certService, jobService, templateService, pdfService, 8)
+
+	var csvData strings.Builder
+	csvData.WriteString("email,name,course,completion_date\n")
+	for i := 0; i < 16; i++ {
+		fmt.Fprintf(&csvData, "user%d@example.com,User %d,Go Programming,2024-01-15\n", i, i)
+	}
+	job, err := jobService.SubmitFile(models.DefaultOrganizationID, models.SystemActor, strings.NewReader(csvData.String()), services.ImportOptions{})
+	if err != nil {
+		t.Fatalf("Failed to submit job: %v", err)
+	}
+	waitForJob(t, jobService, job.ID)
+
+	certificates, err := exportService.ResolveCertificates(models.DefaultOrganizationID, &models.ExportCertificatesRequest{JobID: job.ID})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// Every file name takes most of the step limit; renders sharing one
+	// counter would push each other over it
+	pattern, err := services.ParseFilenamePattern("{{range $i := 60000}}{{end}}{{.Name}}")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := exportService.WriteZIP(&buf, certificates, pattern, false); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("Expected a valid ZIP, got %v", err)
+	}
+	files := make(map[string]bool)
+	for _, file := range archive.File {
+		files[file.Name] = true
+	}
+	if files["errors.txt"] {
+		t.Errorf("Expected no errors.txt, got %v", files)
+	}
+	for i := 0; i < 16; i++ {
+		if name := fmt.Sprintf("User %d.pdf", i); !files[name] {
+			t.Errorf("Expected %q in the archive, got %v", name, files)
+		}
+	}
+}
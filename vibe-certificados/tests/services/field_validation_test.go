@@ -0,0 +1,157 @@
+package services_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"vibe-certificados/models"
+	"vibe-certificados/services"
+	"vibe-certificados/storage"
+)
+
+func newWorkshopTemplate() *models.Template {
+	return &models.Template{
+		ID:           "workshop",
+		Name:         "Workshop",
+		HTMLTemplate: "<p>{{.Name}} - {{.hours}}h - {{.level}}</p>",
+		Fields: []models.TemplateField{
+			{Name: "name", Type: "string", Required: true},
+			{Name: "hours", Type: "number", Required: true},
+			{Name: "level", Type: "enum", Options: []string{"basic", "advanced"}, Default: "basic"},
+			{Name: "instructor_email", Type: "email"},
+			{Name: "event_url", Type: "url"},
+			{Name: "event_date", Type: "date"},
+			{Name: "credits", Type: "number", Default: float64(2)},
+		},
+	}
+}
+
+func TestCertificateService_ValidatesTemplateFields(t *testing.T) {
+	// Setup
+	memStorage := storage.NewMemoryStorage()
+	templateService := services.NewTemplateService(memStorage)
+	certService := services.NewCertificateService(memStorage)
+
+	if err := templateService.CreateTemplate(models.DefaultOrganizationID, models.SystemActor, newWorkshopTemplate()); err != nil {
+		t.Fatalf("Failed to create template: %v", err)
+	}
+
+	req := &models.CertificateRequest{
+		Email:          "test@example.com",
+		Name:           "João Silva",
+		Course:         "Go Programming",
+		CompletionDate: "2024-01-15",
+		TemplateID:     "workshop",
+		Data: map[string]string{
+			"level":            "expert",
+			"instructor_email": "not-an-email",
+			"event_url":        "ftp://example.com",
+			"event_date":       "15/01/2024",
+		},
+	}
+
+	_, err := certService.CreateCertificate(models.DefaultOrganizationID, models.SystemActor, req)
+	var validation *services.ValidationError
+	if !errors.As(err, &validation) {
+		t.Fatalf("Expected a validation error, got %v", err)
+	}
+
+	expected := map[string]string{
+		"hours":            "is required",
+		"level":            "must be one of basic, advanced",
+		"instructor_email": "must be a valid email address",
+		"event_url":        "must be an http or https URL",
+		"event_date":       "must be a date in YYYY-MM-DD format",
+	}
+	if len(validation.Fields) != len(expected) {
+		t.Errorf("Expected %d field errors, got %+v", len(expected), validation.Fields)
+	}
+	for _, field := range validation.Fields {
+		if expected[field.Field] != field.Message {
+			t.Errorf("Expected %q for %s, got %q", expected[field.Field], field.Field, field.Message)
+		}
+	}
+}
+
+func TestCertificateService_AppliesFieldDefaults(t *testing.T) {
+	// Setup
+	memStorage := storage.NewMemoryStorage()
+	templateService := services.NewTemplateService(memStorage)
+	certService := services.NewCertificateService(memStorage)
+
+	if err := templateService.CreateTemplate(models.DefaultOrganizationID, models.SystemActor, newWorkshopTemplate()); err != nil {
+		t.Fatalf("Failed to create template: %v", err)
+	}
+
+	req := &models.CertificateRequest{
+		Email:          "test@example.com",
+		Name:           "João Silva",
+		Course:         "Go Programming",
+		CompletionDate: "2024-01-15",
+		TemplateID:     "workshop",
+		Data:           map[string]string{"hours": "40"},
+	}
+	cert, err := certService.CreateCertificate(models.DefaultOrganizationID, models.SystemActor, req)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if cert.Data["level"] != "basic" {
+		t.Errorf("Expected default level 'basic', got %s", cert.Data["level"])
+	}
+	if cert.Data["credits"] != "2" {
+		t.Errorf("Expected default credits '2', got %s", cert.Data["credits"])
+	}
+	if _, exists := req.Data["level"]; exists {
+		t.Error("Expected the caller's request to be left untouched")
+	}
+}
+
+func TestJobService_ReportsFieldErrorsPerRow(t *testing.T) {
+	// Setup
+	memStorage := storage.NewMemoryStorage()
+	templateService := services.NewTemplateService(memStorage)
+	certService := services.NewCertificateService(memStorage)
+	jobService := services.NewJobService(memStorage, certService, 1)
+	defer jobService.Close()
+
+	if err := templateService.CreateTemplate(models.DefaultOrganizationID, models.SystemActor, newWorkshopTemplate()); err != nil {
+		t.Fatalf("Failed to create template: %v", err)
+	}
+
+	csvData := `email,name,course,completion_date,template_id
+john@example.com,John Doe,Go Programming,2024-01-15,workshop`
+
+	job, err := jobService.SubmitFile(models.DefaultOrganizationID, models.SystemActor, strings.NewReader(csvData), services.ImportOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	job = waitForJob(t, jobService, job.ID)
+
+	if job.Failed != 1 || len(job.Errors) != 1 {
+		t.Fatalf("Expected 1 failed row, got %+v", job.Errors)
+	}
+	fields := job.Errors[0].Fields
+	if len(fields) != 1 || fields[0].Field != "hours" {
+		t.Errorf("Expected a field error for hours, got %+v", fields)
+	}
+}
+
+func TestTemplateService_RejectsInvalidFieldDefinitions(t *testing.T) {
+	memStorage := storage.NewMemoryStorage()
+	templateService := services.NewTemplateService(memStorage)
+
+	invalid := [][]models.TemplateField{
+		{{Name: "hours", Type: "integer"}},
+		{{Name: "level", Type: "enum"}},
+		{{Name: "hours", Type: "number", Default: "forty"}},
+		{{Name: "x"}, {Name: "x"}},
+		{{Type: "string"}},
+	}
+
+	for i, fields := range invalid {
+		if err := templateService.CreateTemplate(models.DefaultOrganizationID, models.SystemActor, &models.Template{ID: "invalid", Fields: fields}); err == nil {
+			t.Errorf("Expected error for invalid fields %d", i)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package services_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"vibe-certificados/models"
+	"vibe-certificados/services"
+	"vibe-certificados/storage"
+)
+
+func newCertificateRequest(policy string) *models.CertificateRequest {
+	return &models.CertificateRequest{
+		Email:          "john@example.com",
+		Name:           "John Doe",
+		Course:         "Go Programming",
+		CompletionDate: "2024-01-15",
+		OnDuplicate:    policy,
+	}
+}
+
+func TestCertificateService_IdempotencyKey(t *testing.T) {
+	// Setup
+	memStorage := storage.NewMemoryStorage()
+	_ = services.NewTemplateService(memStorage)
+	certService := services.NewCertificateService(memStorage)
+
+	first, outcome, err := certService.IssueCertificate(models.DefaultOrganizationID, models.SystemActor, "order-1", newCertificateRequest(""))
+	if err != nil || outcome != services.IssueCreated {
+		t.Fatalf("Expected a certificate to be created, got %v (%v)", outcome, err)
+	}
+
+	// Retries return the same certificate
+	replayed, outcome, err := certService.IssueCertificate(models.DefaultOrganizationID, models.SystemActor, "order-1", newCertificateRequest(""))
+	if err != nil || outcome != services.IssueReplayed || replayed.ID != first.ID {
+		t.Errorf("Expected certificate %s to be replayed, got %v (%v)", first.ID, outcome, err)
+	}
+
+	// The key cannot be reused for another request
+	other := newCertificateRequest("")
+	other.Name = "Jane Doe"
+	if _, _, err := certService.IssueCertificate(models.DefaultOrganizationID, models.SystemActor, "order-1", other); !errors.Is(err, services.ErrIdempotencyKeyReused) {
+		t.Errorf("Expected ErrIdempotencyKeyReused, got %v", err)
+	}
+
+	// Keys are scoped to the organization
+	if _, _, err := certService.IssueCertificate("acme", models.SystemActor, "order-1", newCertificateRequest("")); err == nil || errors.Is(err, services.ErrIdempotencyKeyReused) {
+		t.Errorf("Expected the key to be unknown to another organization, got %v", err)
+	}
+
+	// Failed requests do not use up their key
+	invalid := newCertificateRequest("")
+	invalid.CompletionDate = "15/01/2024"
+	if _, _, err := certService.IssueCertificate(models.DefaultOrganizationID, models.SystemActor, "order-2", invalid); err == nil {
+		t.Fatal("Expected an error for an invalid completion date")
+	}
+	if _, outcome, err := certService.IssueCertificate(models.DefaultOrganizationID, models.SystemActor, "order-2", other); err != nil || outcome != services.IssueCreated {
+		t.Errorf("Expected a certificate to be created, got %v (%v)", outcome, err)
+	}
+
+	certificates, _ := certService.GetCertificatesByEmail(models.DefaultOrganizationID, "john@example.com")
+	if len(certificates) != 2 {
+		t.Errorf("Expected 2 certificates, got %d", len(certificates))
+	}
+}
+
+func TestCertificateService_DuplicatePolicies(t *testing.T) {
+	// Setup
+	memStorage := storage.NewMemoryStorage()
+	_ = services.NewTemplateService(memStorage)
+	certService := services.NewCertificateService(memStorage)
+
+	first, err := certService.CreateCertificate(models.DefaultOrganizationID, models.SystemActor, newCertificateRequest(""))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	for _, policy := range []string{models.DuplicateSkip, models.DuplicateReturnExisting} {
+		cert, outcome, err := certService.IssueCertificate(models.DefaultOrganizationID, models.SystemActor, "", newCertificateRequest(policy))
+		if err != nil || outcome != services.IssueExisting || cert.ID != first.ID {
+			t.Errorf("Expected %s to return certificate %s, got %v (%v)", policy, first.ID, outcome, err)
+		}
+	}
+
+	_, _, err = certService.IssueCertificate(models.DefaultOrganizationID, models.SystemActor, "", newCertificateRequest(models.DuplicateFail))
+	if !errors.Is(err, services.ErrDuplicateCertificate) || !strings.Contains(err.Error(), first.ID) {
+		t.Errorf("Expected ErrDuplicateCertificate naming %s, got %v", first.ID, err)
+	}
+
+	// Another completion date is another certificate
+	later := newCertificateRequest(models.DuplicateFail)
+	later.CompletionDate = "2024-02-15"
+	if _, outcome, err := certService.IssueCertificate(models.DefaultOrganizationID, models.SystemActor, "", later); err != nil || outcome != services.IssueCreated {
+		t.Errorf("Expected a certificate to be created, got %v (%v)", outcome, err)
+	}
+
+	// allow issues duplicates, as before
+	if _, outcome, err := certService.IssueCertificate(models.DefaultOrganizationID, models.SystemActor, "", newCertificateRequest("")); err != nil || outcome != services.IssueCreated {
+		t.Errorf("Expected a certificate to be created, got %v (%v)", outcome, err)
+	}
+
+	if _, _, err := certService.IssueCertificate(models.DefaultOrganizationID, models.SystemActor, "", newCertificateRequest("ignore")); err == nil {
+		t.Error("Expected an error for an unknown policy")
+	}
+}
+
+func TestCertificateService_IgnoresRevokedDuplicates(t *testing.T) {
+	// Setup
+	memStorage := storage.NewMemoryStorage()
+	_ = services.NewTemplateService(memStorage)
+	certService := services.NewCertificateService(memStorage)
+
+	first, err := certService.CreateCertificate(models.DefaultOrganizationID, models.SystemActor, newCertificateRequest(""))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := certService.RevokeCertificate(models.DefaultOrganizationID, models.SystemActor, first.ID, "Issued by mistake"); err != nil {
+		t.Fatalf("Failed to revoke certificate: %v", err)
+	}
+
+	cert, outcome, err := certService.IssueCertificate(models.DefaultOrganizationID, models.SystemActor, "", newCertificateRequest(models.DuplicateFail))
+	if err != nil || outcome != services.IssueCreated || cert.ID == first.ID {
+		t.Errorf("Expected a new certificate, got %v (%v)", outcome, err)
+	}
+}
+
+func TestCertificateService_SetDuplicateKey(t *testing.T) {
+	// Setup
+	memStorage := storage.NewMemoryStorage()
+	_ = services.NewTemplateService(memStorage)
+	certService := services.NewCertificateService(memStorage)
+
+	for _, fields := range [][]string{{"course"}, {"email", "hours"}} {
+		if err := certService.SetDuplicateKey(fields); err == nil {
+			t.Errorf("Expected an error for duplicate key %v", fields)
+		}
+	}
+	if err := certService.SetDuplicateKey([]string{"email", " Course "}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	first, err := certService.CreateCertificate(models.DefaultOrganizationID, models.SystemActor, newCertificateRequest(""))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// The completion date is no longer part of the key
+	later := newCertificateRequest(models.DuplicateReturnExisting)
+	later.CompletionDate = "2024-02-15"
+	cert, outcome, err := certService.IssueCertificate(models.DefaultOrganizationID, models.SystemActor, "", later)
+	if err != nil || outcome != services.IssueExisting || cert.ID != first.ID {
+		t.Errorf("Expected certificate %s to be returned, got %v (%v)", first.ID, outcome, err)
+	}
+}
+
+func TestCertificateService_BatchReportsSkippedRows(t *testing.T) {
+	// Setup
+	memStorage := storage.NewMemoryStorage()
+	_ = services.NewTemplateService(memStorage)
+	certService := services.NewCertificateService(memStorage)
+	jobService := services.NewJobService(memStorage, certService, 1)
+	defer jobService.Close()
+
+	first, err := certService.CreateCertificate(models.DefaultOrganizationID, models.SystemActor, newCertificateRequest(""))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	csvData := `email,name,course,completion_date
+john@example.com,John Doe,Go Programming,2024-01-15
+jane@example.com,Jane Doe,Go Programming,2024-01-15
+jane@example.com,Jane Doe,Go Programming,2024-01-15`
+
+	// The dry run tells which rows would be skipped
+	opts := services.ImportOptions{OnDuplicate: models.DuplicateReturnExisting}
+	report, err := certService.ValidateBatchFile(models.DefaultOrganizationID, strings.NewReader(csvData), opts)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if report.Valid != 1 || report.Skipped != 2 || report.Failed != 0 {
+		t.Fatalf("Expected 1 valid and 2 skipped rows, got %+v", report)
+	}
+	if !report.Rows[0].Skipped || report.Rows[0].ExistingID != first.ID || !report.Rows[2].Skipped {
+		t.Errorf("Expected rows 2 and 4 to be skipped, got %+v", report.Rows)
+	}
+
+	response, err := certService.CreateCertificatesFromFile(models.DefaultOrganizationID, models.SystemActor, strings.NewReader(csvData), opts)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if response.Success != 1 || response.Skipped != 2 || response.Failed != 0 {
+		t.Errorf("Expected 1 created and 2 skipped rows, got %+v", response)
+	}
+	if len(response.ExistingIDs) != 2 || response.ExistingIDs[0] != first.ID || response.ExistingIDs[1] != response.CreatedIDs[0] {
+		t.Errorf("Expected the existing certificates to be listed, got %v", response.ExistingIDs)
+	}
+
+	// Jobs count them the same way; with fail they are errors
+	rows, err := certService.ParseBatch(strings.NewReader(csvData), services.ImportOptions{OnDuplicate: models.DuplicateFail})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	job, err := jobService.Submit(models.DefaultOrganizationID, models.SystemActor, rows)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	job = waitForJob(t, jobService, job.ID)
+	if job.Failed != 3 || job.Succeeded != 0 || job.Skipped != 0 {
+		t.Errorf("Expected 3 failed rows, got %+v", job)
+	}
+
+	rows, _ = certService.ParseBatch(strings.NewReader(csvData), services.ImportOptions{OnDuplicate: models.DuplicateSkip})
+	job, err = jobService.Submit(models.DefaultOrganizationID, models.SystemActor, rows)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	job = waitForJob(t, jobService, job.ID)
+	if job.Skipped != 3 || job.Succeeded != 0 || len(job.ExistingIDs) != 0 {
+		t.Errorf("Expected 3 skipped rows, got %+v", job)
+	}
+}
@@ -0,0 +1,189 @@
+package services_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+	"vibe-certificados/models"
+	"vibe-certificados/services"
+	"vibe-certificados/storage"
+)
+
+// waitForJob polls a job of the default organization until it finishes
+func waitForJob(t *testing.T, jobService *services.JobService, id string) *models.BatchJob {
+	t.Helper()
+	return waitForOrganizationJob(t, jobService, models.DefaultOrganizationID, id)
+}
+
+// waitForOrganizationJob polls a job of an organization until it finishes
+func waitForOrganizationJob(t *testing.T, jobService *services.JobService, orgID, id string) *models.BatchJob {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := jobService.GetJob(orgID, id)
+		if err != nil {
+			t.Fatalf("Failed to get job: %v", err)
+		}
+		if job.IsFinished() {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Job %s did not finish in time", id)
+	return nil
+}
+
+func TestJobService_ProcessesCSVInBackground(t *testing.T) {
+	// Setup
+	memStorage := storage.NewMemoryStorage()
+	_ = services.NewTemplateService(memStorage)
+	certService := services.NewCertificateService(memStorage)
+	jobService := services.NewJobService(memStorage, certService, 4)
+	defer jobService.Close()
+
+	csvData := `email,name,course,completion_date
+john@example.com,John Doe,Go Programming,2024-01-15
+jane@example.com,Jane Smith,Web Development,20/01/2024
+bob@example.com,Bob Johnson,Data Science,2024-01-25
+alice@example.com,Alice,Go Programming,not-a-date`
+
+	job, err := jobService.SubmitFile(models.DefaultOrganizationID, models.SystemActor, strings.NewReader(csvData), services.ImportOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if job.Total != 4 {
+		t.Errorf("Expected total 4, got %d", job.Total)
+	}
+
+	job = waitForJob(t, jobService, job.ID)
+
+	if job.Status != models.JobCompleted {
+		t.Errorf("Expected status %s, got %s", models.JobCompleted, job.Status)
+	}
+	if job.Processed != 4 || job.Succeeded != 2 || job.Failed != 2 {
+		t.Errorf("Expected 4 processed, 2 succeeded and 2 failed, got %d/%d/%d", job.Processed, job.Succeeded, job.Failed)
+	}
+	if len(job.Errors) != 2 || job.Errors[0].Row != 3 || job.Errors[1].Row != 5 {
+		t.Errorf("Expected errors on rows 3 and 5, got %+v", job.Errors)
+	}
+	for _, id := range job.CreatedIDs {
+		if _, err := certService.GetCertificate(models.DefaultOrganizationID, id); err != nil {
+			t.Errorf("Expected certificate %s to exist, got %v", id, err)
+		}
+	}
+
+	// The finished job stays available until it is expired
+	if err := jobService.ExpireJob(models.DefaultOrganizationID, job.ID); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := jobService.GetJob(models.DefaultOrganizationID, job.ID); !errors.Is(err, storage.ErrJobNotFound) {
+		t.Errorf("Expected ErrJobNotFound after expiring, got %v", err)
+	}
+}
+
+func TestJobService_CancelJob(t *testing.T) {
+	// Setup
+	memStorage := storage.NewMemoryStorage()
+	_ = services.NewTemplateService(memStorage)
+	certService := services.NewCertificateService(memStorage)
+	jobService := services.NewJobService(memStorage, certService, 1)
+	defer jobService.Close()
+
+	var csvData strings.Builder
+	csvData.WriteString("email,name,course,completion_date\n")
+	for i := 0; i < 5000; i++ {
+		csvData.WriteString("john@example.com,John Doe,Go Programming,2024-01-15\n")
+	}
+
+	job, err := jobService.SubmitFile(models.DefaultOrganizationID, models.SystemActor, strings.NewReader(csvData.String()), services.ImportOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	job, err = jobService.CancelJob(models.DefaultOrganizationID, job.ID)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if job.Status != models.JobCancelled {
+		t.Errorf("Expected status %s, got %s", models.JobCancelled, job.Status)
+	}
+	if job.Processed >= job.Total {
+		t.Errorf("Expected cancellation to skip rows, processed %d of %d", job.Processed, job.Total)
+	}
+
+	if _, err := jobService.CancelJob(models.DefaultOrganizationID, job.ID); !errors.Is(err, services.ErrJobFinished) {
+		t.Errorf("Expected ErrJobFinished, got %v", err)
+	}
+}
+
+func TestJobService_MarksUnfinishedJobsAsInterrupted(t *testing.T) {
+	memStorage := storage.NewMemoryStorage()
+	certService := services.NewCertificateService(memStorage)
+
+	// A job left running by a previous process
+	memStorage.SaveJob(&models.BatchJob{ID: "stale", Status: models.JobRunning, Total: 10, CreatedAt: time.Now()})
+
+	jobService := services.NewJobService(memStorage, certService, 1)
+	defer jobService.Close()
+
+	job, err := jobService.GetJob(models.DefaultOrganizationID, "stale")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if job.Status != models.JobInterrupted {
+		t.Errorf("Expected status %s, got %s", models.JobInterrupted, job.Status)
+	}
+}
+
+func TestJobService_RejectsInvalidCSV(t *testing.T) {
+	memStorage := storage.NewMemoryStorage()
+	certService := services.NewCertificateService(memStorage)
+	jobService := services.NewJobService(memStorage, certService, 1)
+	defer jobService.Close()
+
+	if _, err := jobService.SubmitFile(models.DefaultOrganizationID, models.SystemActor, strings.NewReader("email,name\njohn@example.com,John"), services.ImportOptions{}); !errors.Is(err, services.ErrInvalidBatchFile) {
+		t.Errorf("Expected ErrInvalidBatchFile for CSV without required columns, got %v", err)
+	}
+}
+
+func TestJobService_RemovesUploadedFileWhenDone(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TMPDIR", dir)
+
+	memStorage := storage.NewMemoryStorage()
+	_ = services.NewTemplateService(memStorage)
+	certService := services.NewCertificateService(memStorage)
+	jobService := services.NewJobService(memStorage, certService, 2)
+	defer jobService.Close()
+
+	var csvData strings.Builder
+	csvData.WriteString("email,name,course,completion_date\n")
+	for i := 0; i < 50; i++ {
+		fmt.Fprintf(&csvData, "aluno%d@example.com,Aluno %d,Go Programming,2024-01-15\n", i, i)
+	}
+	job, err := jobService.SubmitFile(models.DefaultOrganizationID, models.SystemActor, strings.NewReader(csvData.String()), services.ImportOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if job.Total != 50 {
+		t.Errorf("Expected total 50, got %d", job.Total)
+	}
+
+	job = waitForJob(t, jobService, job.ID)
+	if job.Status != models.JobCompleted || job.Succeeded != 50 {
+		t.Errorf("Expected 50 certificates issued, got %+v", job)
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 0 {
+		t.Errorf("Expected the uploaded file to be removed, got %d files", len(files))
+	}
+
+	// Files rejected when submitted are removed too
+	jobService.SubmitFile(models.DefaultOrganizationID, models.SystemActor, strings.NewReader("email,name\n"), services.ImportOptions{})
+	if files, _ := os.ReadDir(dir); len(files) != 0 {
+		t.Errorf("Expected the rejected file to be removed, got %d files", len(files))
+	}
+}
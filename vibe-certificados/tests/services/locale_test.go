@@ -0,0 +1,163 @@
+package services_test
+
+import (
+	"strings"
+	"testing"
+	"vibe-certificados/models"
+	"vibe-certificados/services"
+	"vibe-certificados/storage"
+)
+
+func TestMatchLocale(t *testing.T) {
+	tests := map[string]string{
+		"en":                     "en",
+		"en-US,en;q=0.9":         "en",
+		"pt":                     "pt-BR",
+		"pt-PT":                  "pt-BR",
+		"es-MX":                  "es",
+		"fr-FR,es;q=0.5":         "es",
+		"fr":                     "",
+		"":                       "",
+		"de-DE,de;q=0.9,*;q=0.1": "",
+	}
+
+	for preferences, expected := range tests {
+		if got := services.MatchLocale(preferences); got != expected {
+			t.Errorf("MatchLocale(%q): expected %q, got %q", preferences, expected, got)
+		}
+	}
+}
+
+func TestCertificateLocale_RendersDefaultTemplate(t *testing.T) {
+	// Setup
+	memStorage := storage.NewMemoryStorage()
+	templateService := services.NewTemplateService(memStorage)
+	certService := services.NewCertificateService(memStorage)
+
+	tests := []struct {
+		locale   string
+		expected []string
+	}{
+		{"", []string{"Certificamos que", "Concluído em: 05/03/2024"}},
+		{"en", []string{"This is to certify that", "Completed on: 03/05/2024", `lang="en"`}},
+		{"es", []string{"Se certifica que", "Finalizado el: 05/03/2024"}},
+	}
+
+	for _, tt := range tests {
+		cert, err := certService.CreateCertificate(models.DefaultOrganizationID, models.SystemActor, &models.CertificateRequest{
+			Email:          "test@example.com",
+			Name:           "João Silva",
+			Course:         "Go Programming",
+			CompletionDate: "2024-03-05",
+			Locale:         tt.locale,
+		})
+		if err != nil {
+			t.Fatalf("Failed to create certificate: %v", err)
+		}
+		if cert.Locale != tt.locale {
+			t.Errorf("Expected locale %q, got %q", tt.locale, cert.Locale)
+		}
+
+		html, err := templateService.RenderCertificate(cert)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		for _, text := range tt.expected {
+			if !strings.Contains(html, text) {
+				t.Errorf("Expected %q in %q rendering", text, tt.locale)
+			}
+		}
+	}
+}
+
+func TestCertificateLocale_TemplateLocaleAndLongDates(t *testing.T) {
+	// Setup
+	memStorage := storage.NewMemoryStorage()
+	templateService := services.NewTemplateService(memStorage)
+	certService := services.NewCertificateService(memStorage)
+
+	err := templateService.CreateTemplate(models.DefaultOrganizationID, models.SystemActor, &models.Template{
+		ID:           "espanol",
+		Name:         "Español",
+		HTMLTemplate: "<p>{{.CompletionDateLong}}</p>",
+		Locale:       "es",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create template: %v", err)
+	}
+
+	cert, err := certService.CreateCertificate(models.DefaultOrganizationID, models.SystemActor, &models.CertificateRequest{
+		Email:          "test@example.com",
+		Name:           "João Silva",
+		Course:         "Go Programming",
+		CompletionDate: "2024-03-05",
+		TemplateID:     "espanol",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+
+	html, _ := templateService.RenderCertificate(cert)
+	if !strings.Contains(html, "<p>5 de marzo de 2024</p>") {
+		t.Errorf("Expected template locale date, got %s", html)
+	}
+
+	// The certificate locale takes precedence over the template's
+	cert.Locale = "pt-BR"
+	html, _ = templateService.RenderCertificate(cert)
+	if !strings.Contains(html, "<p>5 de março de 2024</p>") {
+		t.Errorf("Expected certificate locale date, got %s", html)
+	}
+}
+
+func TestCertificateLocale_RejectsUnsupportedLocale(t *testing.T) {
+	memStorage := storage.NewMemoryStorage()
+	templateService := services.NewTemplateService(memStorage)
+	certService := services.NewCertificateService(memStorage)
+
+	_, err := certService.CreateCertificate(models.DefaultOrganizationID, models.SystemActor, &models.CertificateRequest{
+		Email:          "test@example.com",
+		Name:           "João Silva",
+		Course:         "Go Programming",
+		CompletionDate: "2024-03-05",
+		Locale:         "fr",
+	})
+	if err == nil {
+		t.Error("Expected error for unsupported certificate locale")
+	}
+
+	err = templateService.CreateTemplate(models.DefaultOrganizationID, models.SystemActor, &models.Template{ID: "fr", Name: "Français", HTMLTemplate: "<p></p>", Locale: "fr"})
+	if err == nil {
+		t.Error("Expected error for unsupported template locale")
+	}
+}
+
+func TestDeliveryService_DefaultEmailIsLocalized(t *testing.T) {
+	mailer := &flakyMailer{}
+	_, certService := newDeliverySetup(t, mailer, 1)
+
+	cert, err := certService.CreateCertificate(models.DefaultOrganizationID, models.SystemActor, &models.CertificateRequest{
+		Email:          "test@example.com",
+		Name:           "John Smith",
+		Course:         "Go Programming",
+		CompletionDate: "2024-03-05",
+		SendEmail:      true,
+		Locale:         "en",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	waitForDelivery(t, certService, cert.ID)
+
+	mailer.mutex.Lock()
+	defer mailer.mutex.Unlock()
+	if len(mailer.sent) != 1 {
+		t.Fatalf("Expected 1 email, got %d", len(mailer.sent))
+	}
+	if mailer.sent[0].Subject != "Your certificate: Go Programming" {
+		t.Errorf("Expected English subject, got %q", mailer.sent[0].Subject)
+	}
+	if !strings.HasPrefix(mailer.sent[0].Body, "Hello John Smith,") {
+		t.Errorf("Expected English body, got %q", mailer.sent[0].Body)
+	}
+}
@@ -0,0 +1,154 @@
+package services_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"vibe-certificados/models"
+	"vibe-certificados/services"
+	"vibe-certificados/storage"
+)
+
+func TestOrganizationService_CreateOrganization(t *testing.T) {
+	memStorage := storage.NewMemoryStorage()
+	templateService := services.NewTemplateService(memStorage)
+	orgService := services.NewOrganizationService(memStorage, templateService)
+
+	if _, err := orgService.GetOrganization(models.DefaultOrganizationID); err != nil {
+		t.Fatalf("Expected the default organization to exist, got %v", err)
+	}
+
+	created, err := orgService.CreateOrganization(&models.CreateOrganizationRequest{ID: "acme", Name: "Acme"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !strings.HasPrefix(created.APIKey, "vc_") {
+		t.Errorf("Expected an API key, got %q", created.APIKey)
+	}
+
+	// Each organization gets its own default template
+	template, err := templateService.GetTemplate("acme", "default")
+	if err != nil {
+		t.Fatalf("Expected a default template for acme, got %v", err)
+	}
+	if template.OrganizationID != "acme" {
+		t.Errorf("Expected template of acme, got %s", template.OrganizationID)
+	}
+
+	key, err := orgService.ResolveAPIKey(created.APIKey)
+	if err != nil {
+		t.Fatalf("Expected the key to resolve, got %v", err)
+	}
+	if key.OrganizationID != "acme" || key.Hash == created.APIKey || !strings.HasPrefix(created.APIKey, key.Prefix) {
+		t.Errorf("Expected a hashed key of acme, got %+v", key)
+	}
+	if _, err := orgService.ResolveAPIKey("vc_unknown"); !errors.Is(err, storage.ErrAPIKeyNotFound) {
+		t.Errorf("Expected ErrAPIKeyNotFound, got %v", err)
+	}
+
+	if _, err := orgService.CreateOrganization(&models.CreateOrganizationRequest{ID: "acme", Name: "Again"}); !errors.Is(err, services.ErrOrganizationExists) {
+		t.Errorf("Expected ErrOrganizationExists, got %v", err)
+	}
+	if _, err := orgService.CreateOrganization(&models.CreateOrganizationRequest{ID: "Not A Slug", Name: "Bad"}); !errors.Is(err, services.ErrInvalidOrganizationID) {
+		t.Errorf("Expected ErrInvalidOrganizationID, got %v", err)
+	}
+}
+
+func TestOrganizations_IsolateTemplatesAndCertificates(t *testing.T) {
+	memStorage := storage.NewMemoryStorage()
+	templateService := services.NewTemplateService(memStorage)
+	certService := services.NewCertificateService(memStorage)
+	orgService := services.NewOrganizationService(memStorage, templateService)
+	if _, err := orgService.CreateOrganization(&models.CreateOrganizationRequest{ID: "acme", Name: "Acme"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// The same template ID in two organizations
+	for _, org := range []string{models.DefaultOrganizationID, "acme"} {
+		template := &models.Template{ID: "workshop", Name: "Workshop " + org, HTMLTemplate: "<p>" + org + " {{.Name}}</p>"}
+		if err := templateService.CreateTemplate(org, models.SystemActor, template); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	req := &models.CertificateRequest{
+		Email:          "maria@example.com",
+		Name:           "Maria",
+		Course:         "Go",
+		CompletionDate: "2024-01-15",
+		TemplateID:     "workshop",
+	}
+	cert, err := certService.CreateCertificate("acme", models.SystemActor, req)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if cert.OrganizationID != "acme" {
+		t.Errorf("Expected certificate of acme, got %s", cert.OrganizationID)
+	}
+
+	html, err := templateService.RenderCertificate(cert)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !strings.Contains(html, "acme Maria") {
+		t.Errorf("Expected the template of acme to be used, got %s", html)
+	}
+
+	if _, err := certService.GetCertificate(models.DefaultOrganizationID, cert.ID); !errors.Is(err, storage.ErrCertificateNotFound) {
+		t.Errorf("Expected the certificate to be hidden from other organizations, got %v", err)
+	}
+	if _, err := certService.RevokeCertificate(models.DefaultOrganizationID, models.SystemActor, cert.ID, "fraud"); !errors.Is(err, storage.ErrCertificateNotFound) {
+		t.Errorf("Expected other organizations not to revoke the certificate, got %v", err)
+	}
+	if certs, _ := certService.GetCertificatesByEmail(models.DefaultOrganizationID, "maria@example.com"); len(certs) != 0 {
+		t.Errorf("Expected no certificates in the default organization, got %d", len(certs))
+	}
+	if _, err := certService.GetCertificate("acme", cert.ID); err != nil {
+		t.Errorf("Expected the certificate in acme, got %v", err)
+	}
+
+	if err := templateService.DeleteTemplate("acme", models.SystemActor, "workshop"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := templateService.GetTemplate(models.DefaultOrganizationID, "workshop"); err != nil {
+		t.Errorf("Expected the template of the default organization to remain, got %v", err)
+	}
+}
+
+func TestOrganizations_IsolateJobs(t *testing.T) {
+	memStorage := storage.NewMemoryStorage()
+	templateService := services.NewTemplateService(memStorage)
+	certService := services.NewCertificateService(memStorage)
+	orgService := services.NewOrganizationService(memStorage, templateService)
+	if _, err := orgService.CreateOrganization(&models.CreateOrganizationRequest{ID: "acme", Name: "Acme"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	jobService := services.NewJobService(memStorage, certService, 2)
+	defer jobService.Close()
+
+	csvData := "email,name,course,completion_date\njohn@example.com,John Doe,Go,2024-01-15\n"
+	job, err := jobService.SubmitFile("acme", models.SystemActor, strings.NewReader(csvData), services.ImportOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if _, err := jobService.GetJob(models.DefaultOrganizationID, job.ID); !errors.Is(err, storage.ErrJobNotFound) {
+		t.Errorf("Expected the job to be hidden from other organizations, got %v", err)
+	}
+	if err := jobService.ExpireJob(models.DefaultOrganizationID, job.ID); !errors.Is(err, storage.ErrJobNotFound) {
+		t.Errorf("Expected other organizations not to expire the job, got %v", err)
+	}
+
+	finished := waitForOrganizationJob(t, jobService, "acme", job.ID)
+	if finished.Succeeded != 1 {
+		t.Fatalf("Expected the row to be issued with the templates of acme, got %+v", finished.Errors)
+	}
+
+	cert, err := certService.GetCertificate("acme", finished.CreatedIDs[0])
+	if err != nil || cert.OrganizationID != "acme" {
+		t.Errorf("Expected the certificate of acme, got %+v (%v)", cert, err)
+	}
+	if jobs, _ := jobService.GetAllJobs(models.DefaultOrganizationID); len(jobs) != 0 {
+		t.Errorf("Expected no jobs in the default organization, got %d", len(jobs))
+	}
+}
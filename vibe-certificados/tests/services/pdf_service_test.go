@@ -0,0 +1,143 @@
+package services_test
+
+import (
+	"bytes"
+	"testing"
+	"vibe-certificados/models"
+	"vibe-certificados/services"
+	"vibe-certificados/storage"
+)
+
+func TestPDFService_GeneratePDFUsesTemplateLayout(t *testing.T) {
+	// Setup
+	memStorage := storage.NewMemoryStorage()
+	templateService := services.NewTemplateService(memStorage)
+	certService := services.NewCertificateService(memStorage)
+	pdfService := services.NewPDFService(templateService)
+
+	portrait := &models.Template{
+		ID:           "portrait",
+		Name:         "Portrait",
+		HTMLTemplate: "<p>{{.Name}}</p>",
+		PDFLayout: &models.PDFLayout{
+			Orientation: "P",
+			Border:      &models.PDFBorder{Width: 2, Color: "#764ba2", Margin: 10},
+			Blocks: []models.PDFTextBlock{
+				{Text: "{{.Name}}", Y: 100, Size: 24, Style: "B", Color: "#333333"},
+				{Text: "{{.Course}} - {{.hours}}h", Y: 130, Size: 16, Align: "L", X: 30, Width: 150},
+			},
+		},
+	}
+	if err := templateService.CreateTemplate(models.DefaultOrganizationID, models.SystemActor, portrait); err != nil {
+		t.Fatalf("Failed to create template: %v", err)
+	}
+
+	cert, err := certService.CreateCertificate(models.DefaultOrganizationID, models.SystemActor, &models.CertificateRequest{
+		Email:          "test@example.com",
+		Name:           "João Silva",
+		Course:         "Go Programming",
+		CompletionDate: "2024-01-15",
+		TemplateID:     "portrait",
+		Data:           map[string]string{"hours": "40"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+
+	pdf, err := pdfService.GeneratePDF(cert)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// A4 portrait is 595.28 x 841.89 points
+	if !bytes.Contains(pdf, []byte("/MediaBox [0 0 595.28 841.89]")) {
+		t.Error("Expected a portrait A4 page")
+	}
+
+	// The default template keeps the landscape layout
+	defaultCert, _ := certService.CreateCertificate(models.DefaultOrganizationID, models.SystemActor, &models.CertificateRequest{
+		Email:          "test@example.com",
+		Name:           "João Silva",
+		Course:         "Go Programming",
+		CompletionDate: "2024-01-15",
+	})
+	pdf, err = pdfService.GeneratePDF(defaultCert)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !bytes.Contains(pdf, []byte("/MediaBox [0 0 841.89 595.28]")) {
+		t.Error("Expected a landscape A4 page for the default template")
+	}
+}
+
+func TestTemplateService_RejectsInvalidPDFLayout(t *testing.T) {
+	memStorage := storage.NewMemoryStorage()
+	templateService := services.NewTemplateService(memStorage)
+
+	invalid := []*models.PDFLayout{
+		{Orientation: "X"},
+		{Blocks: []models.PDFTextBlock{{Text: "{{.Name"}}},
+		{Blocks: []models.PDFTextBlock{{Text: "x", Color: "purple"}}},
+		{Blocks: []models.PDFTextBlock{{Text: "x", Font: "Comic Sans"}}},
+		{BackgroundImage: "http://example.com/bg.png"},
+	}
+
+	for i, layout := range invalid {
+		err := templateService.CreateTemplate(models.DefaultOrganizationID, models.SystemActor, &models.Template{ID: "invalid", PDFLayout: layout})
+		if err == nil {
+			t.Errorf("Expected error for invalid layout %d", i)
+		}
+	}
+}
+
+func TestPDFService_EmbedsTrueTypeFontForUnicodeNames(t *testing.T) {
+	// Setup
+	memStorage := storage.NewMemoryStorage()
+	templateService := services.NewTemplateService(memStorage)
+	certService := services.NewCertificateService(memStorage)
+	pdfService := services.NewPDFService(templateService)
+
+	fonts, err := services.LoadFontRegistry("../../fonts", nil)
+	if err != nil {
+		t.Fatalf("Failed to load fonts: %v", err)
+	}
+	if !fonts.HasFamily("DejaVuSansCondensed") {
+		t.Fatalf("Expected DejaVuSansCondensed to be loaded, got %v", fonts.Families())
+	}
+	pdfService.SetFontRegistry(fonts)
+
+	generate := func(name string) []byte {
+		cert, err := certService.CreateCertificate(models.DefaultOrganizationID, models.SystemActor, &models.CertificateRequest{
+			Email:          "test@example.com",
+			Name:           name,
+			Course:         "Go Programming",
+			CompletionDate: "2024-01-15",
+		})
+		if err != nil {
+			t.Fatalf("Failed to create certificate: %v", err)
+		}
+		pdf, err := pdfService.GeneratePDF(cert)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		return pdf
+	}
+
+	// Names outside Windows-1252 switch to the embedded TrueType font
+	pdf := generate("Łukasz Ğüler Жанна")
+	if !bytes.Contains(pdf, []byte("dejavusanscondensed")) {
+		t.Error("Expected DejaVuSansCondensed to be embedded for a Unicode name")
+	}
+
+	// Names the core font can display keep the original layout fonts
+	pdf = generate("João Silva")
+	if bytes.Contains(pdf, []byte("dejavusanscondensed")) {
+		t.Error("Expected core fonts only for a Windows-1252 name")
+	}
+}
+
+func TestLoadFontRegistry_UnknownFallback(t *testing.T) {
+	if _, err := services.LoadFontRegistry("../../fonts", []string{"NotoSansCJK"}); err == nil {
+		t.Error("Expected error for a fallback font that is not in the fonts directory")
+	}
+}
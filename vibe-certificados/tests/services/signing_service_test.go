@@ -0,0 +1,86 @@
+package services_test
+
+import (
+	"path/filepath"
+	"testing"
+	"vibe-certificados/models"
+	"vibe-certificados/services"
+	"vibe-certificados/storage"
+)
+
+func TestSigningService_LoadOrCreate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys", "signing_key.pem")
+
+	created, err := services.LoadOrCreateSigningService(path)
+	if err != nil {
+		t.Fatalf("Expected key to be created, got %v", err)
+	}
+
+	loaded, err := services.LoadOrCreateSigningService(path)
+	if err != nil {
+		t.Fatalf("Expected key to be loaded, got %v", err)
+	}
+
+	if created.PublicKey() != loaded.PublicKey() {
+		t.Error("Expected the same key after reloading")
+	}
+}
+
+func TestCertificateService_VerifyCertificate(t *testing.T) {
+	// Setup
+	memStorage := storage.NewMemoryStorage()
+	_ = services.NewTemplateService(memStorage) // Initialize templates
+	certService := services.NewCertificateService(memStorage)
+
+	signer, err := services.LoadOrCreateSigningService(filepath.Join(t.TempDir(), "signing_key.pem"))
+	if err != nil {
+		t.Fatalf("Failed to create signing key: %v", err)
+	}
+	certService.SetSigner(signer)
+	certService.SetPublicBaseURL("https://certificados.example.com/")
+
+	cert, err := certService.CreateCertificate(models.DefaultOrganizationID, models.SystemActor, &models.CertificateRequest{
+		Email:          "test@example.com",
+		Name:           "João Silva",
+		Course:         "Go Programming",
+		CompletionDate: "2024-01-15",
+		Data:           map[string]string{"hours": "40"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+
+	if cert.Signature == "" {
+		t.Fatal("Expected certificate to be signed")
+	}
+	expectedURL := "https://certificados.example.com/verify/" + cert.ID
+	if cert.VerificationURL != expectedURL {
+		t.Errorf("Expected verification URL %s, got %s", expectedURL, cert.VerificationURL)
+	}
+
+	result, err := certService.VerifyCertificate(cert.ID)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if result.Result != models.VerificationValid {
+		t.Errorf("Expected valid, got %s (%s)", result.Result, result.Message)
+	}
+
+	// Tampered content must not verify
+	tampered := *cert
+	tampered.Data = map[string]string{"hours": "400"}
+	result = certService.VerifySubmittedCertificate(&tampered, cert.Signature)
+	if result.Result != models.VerificationInvalid {
+		t.Errorf("Expected invalid for tampered certificate, got %s", result.Result)
+	}
+
+	// Revocation is reported even though the signature still matches
+	if _, err := certService.RevokeCertificate(models.DefaultOrganizationID, models.SystemActor, cert.ID, "Dados incorretos"); err != nil {
+		t.Fatalf("Failed to revoke certificate: %v", err)
+	}
+	submitted := *cert
+	result = certService.VerifySubmittedCertificate(&submitted, "")
+	if result.Result != models.VerificationRevoked {
+		t.Errorf("Expected revoked, got %s", result.Result)
+	}
+}
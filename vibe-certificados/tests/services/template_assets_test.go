@@ -0,0 +1,211 @@
+package services_test
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+	"vibe-certificados/models"
+	"vibe-certificados/services"
+	"vibe-certificados/storage"
+)
+
+func newTestPNG(t *testing.T) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	for x := 0; x < 4; x++ {
+		img.Set(x, 0, color.RGBA{R: 118, G: 75, B: 162, A: 255})
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("Failed to encode PNG: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func newAssetTemplate(t *testing.T, templateService *services.TemplateService) *models.Template {
+	t.Helper()
+
+	template := &models.Template{
+		ID:           "branded",
+		Name:         "Branded",
+		HTMLTemplate: `<html><body><img src="{{asset "logo.png"}}" alt="logo"><p>{{.Name}}</p></body></html>`,
+	}
+	if err := templateService.CreateTemplate(models.DefaultOrganizationID, models.SystemActor, template); err != nil {
+		t.Fatalf("Failed to create template: %v", err)
+	}
+	return template
+}
+
+func TestTemplateService_UploadAsset(t *testing.T) {
+	// Setup
+	memStorage := storage.NewMemoryStorage()
+	templateService := services.NewTemplateService(memStorage)
+	template := newAssetTemplate(t, templateService)
+
+	if warnings := templateService.AssetWarnings(template); len(warnings) != 1 || !strings.Contains(warnings[0], "logo.png") {
+		t.Errorf("Expected a warning about the missing logo, got %v", warnings)
+	}
+
+	asset, err := templateService.UploadAsset(models.DefaultOrganizationID, models.SystemActor, "branded", "logo.png", newTestPNG(t))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if asset.ContentType != "image/png" {
+		t.Errorf("Expected content type image/png, got %s", asset.ContentType)
+	}
+	if len(asset.ETag) != 64 {
+		t.Errorf("Expected a SHA-256 ETag, got %q", asset.ETag)
+	}
+	if warnings := templateService.AssetWarnings(template); len(warnings) != 0 {
+		t.Errorf("Expected no warnings once uploaded, got %v", warnings)
+	}
+
+	assets, err := templateService.GetAssets(models.DefaultOrganizationID, "branded")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(assets) != 1 || assets[0].Name != "logo.png" || assets[0].Data != nil {
+		t.Errorf("Expected logo.png listed without its content, got %+v", assets)
+	}
+
+	if _, err := templateService.UploadAsset(models.DefaultOrganizationID, models.SystemActor, "branded", "logo.png", newTestPNG(t)); !errors.Is(err, services.ErrAssetExists) {
+		t.Errorf("Expected ErrAssetExists, got %v", err)
+	}
+	if _, err := templateService.UploadAsset(models.DefaultOrganizationID, models.SystemActor, "missing", "logo.png", newTestPNG(t)); !errors.Is(err, storage.ErrTemplateNotFound) {
+		t.Errorf("Expected ErrTemplateNotFound, got %v", err)
+	}
+}
+
+func TestTemplateService_UploadAssetValidation(t *testing.T) {
+	// Setup
+	memStorage := storage.NewMemoryStorage()
+	templateService := services.NewTemplateService(memStorage)
+	newAssetTemplate(t, templateService)
+
+	svg := []byte(`<svg xmlns="http://www.w3.org/2000/svg"><script>alert(1)</script></svg>`)
+	if _, err := templateService.UploadAsset(models.DefaultOrganizationID, models.SystemActor, "branded", "logo.svg", svg); !errors.Is(err, services.ErrAssetType) {
+		t.Errorf("Expected ErrAssetType for SVG, got %v", err)
+	}
+
+	truncated := newTestPNG(t)[:20]
+	if _, err := templateService.UploadAsset(models.DefaultOrganizationID, models.SystemActor, "branded", "broken.png", truncated); !errors.Is(err, services.ErrAssetType) {
+		t.Errorf("Expected ErrAssetType for a truncated PNG, got %v", err)
+	}
+
+	if _, err := templateService.UploadAsset(models.DefaultOrganizationID, models.SystemActor, "branded", "../logo.png", newTestPNG(t)); !errors.Is(err, services.ErrInvalidAssetName) {
+		t.Errorf("Expected ErrInvalidAssetName, got %v", err)
+	}
+
+	templateService.SetMaxAssetSize(10)
+	if _, err := templateService.UploadAsset(models.DefaultOrganizationID, models.SystemActor, "branded", "logo.png", newTestPNG(t)); !errors.Is(err, services.ErrAssetTooLarge) {
+		t.Errorf("Expected ErrAssetTooLarge, got %v", err)
+	}
+}
+
+func TestTemplateService_RenderWithAsset(t *testing.T) {
+	// Setup
+	memStorage := storage.NewMemoryStorage()
+	templateService := services.NewTemplateService(memStorage)
+	certService := services.NewCertificateService(memStorage)
+	pdfService := services.NewPDFService(templateService)
+	newAssetTemplate(t, templateService)
+
+	if _, err := templateService.UploadAsset(models.DefaultOrganizationID, models.SystemActor, "branded", "logo.png", newTestPNG(t)); err != nil {
+		t.Fatalf("Failed to upload asset: %v", err)
+	}
+
+	cert, err := certService.CreateCertificate(models.DefaultOrganizationID, models.SystemActor, &models.CertificateRequest{
+		Email:          "test@example.com",
+		Name:           "João Silva",
+		Course:         "Go Programming",
+		CompletionDate: "2024-01-15",
+		TemplateID:     "branded",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+
+	html, err := templateService.RenderCertificate(cert)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !strings.Contains(html, `src="data:image/png;base64,`) {
+		t.Errorf("Expected the logo embedded as a data URI, got %s", html)
+	}
+
+	// The same image drawn on the PDF
+	layout := services.DefaultPDFLayout()
+	layout.Images = []models.PDFImage{{Asset: "logo.png", X: 20, Y: 10, Width: 30}}
+	err = templateService.UpdateTemplate(models.DefaultOrganizationID, models.SystemActor, &models.Template{
+		ID:           "branded",
+		Name:         "Branded",
+		HTMLTemplate: `<html><body><img src="{{asset "logo.png"}}"><p>{{.Name}}</p></body></html>`,
+		PDFLayout:    layout,
+	})
+	if err != nil {
+		t.Fatalf("Failed to update template: %v", err)
+	}
+	withImage, err := certService.CreateCertificate(models.DefaultOrganizationID, models.SystemActor, &models.CertificateRequest{
+		Email:          "test@example.com",
+		Name:           "João Silva",
+		Course:         "Go Programming",
+		CompletionDate: "2024-01-15",
+		TemplateID:     "branded",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+
+	pdf, err := pdfService.GeneratePDF(withImage)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !bytes.Contains(pdf, []byte("/Subtype /Image")) {
+		t.Error("Expected the PDF to contain the logo image")
+	}
+	plain, err := pdfService.GeneratePDF(cert)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if bytes.Contains(plain, []byte("/Subtype /Image")) {
+		t.Error("Expected the PDF of the first version to have no image")
+	}
+}
+
+func TestTemplateService_DeleteAsset(t *testing.T) {
+	// Setup
+	memStorage := storage.NewMemoryStorage()
+	templateService := services.NewTemplateService(memStorage)
+	newAssetTemplate(t, templateService)
+
+	for _, name := range []string{"logo.png", "unused.png"} {
+		if _, err := templateService.UploadAsset(models.DefaultOrganizationID, models.SystemActor, "branded", name, newTestPNG(t)); err != nil {
+			t.Fatalf("Failed to upload asset: %v", err)
+		}
+	}
+
+	// Version 1 still shows the logo after it is removed from the template
+	err := templateService.UpdateTemplate(models.DefaultOrganizationID, models.SystemActor, &models.Template{
+		ID:           "branded",
+		Name:         "Branded",
+		HTMLTemplate: "<html><body><p>{{.Name}}</p></body></html>",
+	})
+	if err != nil {
+		t.Fatalf("Failed to update template: %v", err)
+	}
+	if err := templateService.DeleteAsset(models.DefaultOrganizationID, models.SystemActor, "branded", "logo.png"); !errors.Is(err, services.ErrAssetInUse) {
+		t.Errorf("Expected ErrAssetInUse, got %v", err)
+	}
+
+	if err := templateService.DeleteAsset(models.DefaultOrganizationID, models.SystemActor, "branded", "unused.png"); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if _, err := templateService.GetAsset(models.DefaultOrganizationID, "branded", "unused.png"); !errors.Is(err, storage.ErrAssetNotFound) {
+		t.Errorf("Expected ErrAssetNotFound, got %v", err)
+	}
+}
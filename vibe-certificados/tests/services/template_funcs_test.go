@@ -0,0 +1,136 @@
+package services_test
+
+import (
+	"strings"
+	"testing"
+	"vibe-certificados/models"
+	"vibe-certificados/services"
+	"vibe-certificados/storage"
+)
+
+// renderWithTemplate creates a template with the given HTML and renders a
+// certificate issued with it
+func renderWithTemplate(t *testing.T, html string, data map[string]string) (string, error) {
+	t.Helper()
+
+	memStorage := storage.NewMemoryStorage()
+	templateService := services.NewTemplateService(memStorage)
+	certService := services.NewCertificateService(memStorage)
+
+	if err := templateService.CreateTemplate(models.DefaultOrganizationID, models.SystemActor, &models.Template{ID: "funcs", Name: "Funcs", HTMLTemplate: html}); err != nil {
+		return "", err
+	}
+	cert, err := certService.CreateCertificate(models.DefaultOrganizationID, models.SystemActor, &models.CertificateRequest{
+		Email:          "test@example.com",
+		Name:           "maria DA silva",
+		Course:         "Go Programming",
+		CompletionDate: "2024-03-05",
+		TemplateID:     "funcs",
+		Data:           data,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	return templateService.RenderCertificate(cert)
+}
+
+func TestTemplateFuncs_Formatting(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		data     map[string]string
+		expected string
+	}{
+		{"long date", `{{formatDate "long" .CompletionDate}}`, nil, "5 de março de 2024"},
+		{"go layout", `{{formatDate "Monday, 02 Jan" .CompletionDate}}`, nil, "terça-feira, 05 mar"},
+		{"iso date", `{{.CompletionDate | formatDate "iso"}}`, nil, "2024-03-05"},
+		{"custom date", `{{formatDate "long" .event_date}}`, map[string]string{"event_date": "2024-12-25"}, "25 de dezembro de 2024"},
+		{"upper", `{{upper .Course}}`, nil, "GO PROGRAMMING"},
+		{"title", `{{title .Name}}`, nil, "Maria da Silva"},
+		{"number", `{{formatNumber 2 .amount}}`, map[string]string{"amount": "1234567.5"}, "1.234.567,50"},
+		{"many decimals", `{{formatNumber 1000 .amount}}`, map[string]string{"amount": "1.5"}, "1,5000000000"},
+		{"negative decimals", `{{formatNumber -3 .amount}}`, map[string]string{"amount": "7.25"}, "7"},
+		{"hours", `{{hours .hours}}`, map[string]string{"hours": "12.5"}, "12,5 horas"},
+		{"one hour", `{{hours .hours}}`, map[string]string{"hours": "1"}, "1 hora"},
+		{"duration", `{{duration .hours}}`, map[string]string{"hours": "1.5"}, "1h30min"},
+		{"go duration", `{{duration .time}}`, map[string]string{"time": "2h45m"}, "2h45min"},
+		{"default", `{{default "Online" .location}}`, nil, "Online"},
+		{"coalesce", `{{coalesce .nickname .Name}}`, nil, "maria DA silva"},
+		{"ternary", `{{ternary "com distinção" "regular" (eq .grade "A")}}`, map[string]string{"grade": "A"}, "com distinção"},
+		{"conditional", `{{if contains "Go" .Course}}golang{{end}}{{if empty .missing}}-{{end}}`, nil, "golang-"},
+		{"unknown message", `{{t "Curso de %s" .Course}}`, nil, "Curso de %s"},
+		{"loop", `{{range $i := 3}}{{$i}}{{end}}`, nil, "012"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			html, err := renderWithTemplate(t, "<p>"+tt.template+"</p>", tt.data)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if !strings.Contains(html, "<p>"+tt.expected+"</p>") {
+				t.Errorf("Expected %q, got %s", tt.expected, html)
+			}
+		})
+	}
+}
+
+func TestTemplateFuncs_Image(t *testing.T) {
+	png := "data:image/png;base64,iVBORw0KGgo="
+
+	html, err := renderWithTemplate(t, `<img src="{{image .logo}}">`, map[string]string{"logo": png})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !strings.Contains(html, `src="`+png+`"`) {
+		t.Errorf("Expected embedded image, got %s", html)
+	}
+
+	html, err = renderWithTemplate(t, `<img src="{{image .logo}}">`, map[string]string{"logo": "data:image/svg+xml;base64,PHN2Zz4="})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if strings.Contains(html, "svg") {
+		t.Errorf("Expected SVG image to be rejected, got %s", html)
+	}
+}
+
+func TestTemplateFuncs_Sandbox(t *testing.T) {
+	memStorage := storage.NewMemoryStorage()
+	templateService := services.NewTemplateService(memStorage)
+
+	templates := map[string]string{
+		"call":          `{{call .Name}}`,
+		"unknown func":  `{{readFile "/etc/passwd"}}`,
+		"output limit":  `{{range 10000000}}0123456789{{end}}`,
+		"silent loop":   `{{range 1000000000}}{{end}}`,
+		"nested loops":  `{{range 100000}}{{range 100000}}{{end}}{{end}}`,
+		"recursion":     `{{define "x"}}{{if lt (len .) 60}}{{template "x" (print . "a")}}{{template "x" (print . "a")}}{{end}}{{end}}{{template "x" ""}}`,
+		"growing text":  `{{define "x"}}{{if lt (len .) 100000000}}{{template "x" (print . .)}}{{end}}{{end}}{{template "x" "ab"}}`,
+		"invalid value": `{{formatNumber 2 .Name}}`,
+	}
+	for name, html := range templates {
+		err := templateService.CreateTemplate(models.DefaultOrganizationID, models.SystemActor, &models.Template{ID: "sandbox", Name: name, HTMLTemplate: html})
+		if err == nil {
+			t.Errorf("Expected %s template to be rejected", name)
+		}
+	}
+}
+
+func TestTemplateFuncs_AvailableInPDFAndEmail(t *testing.T) {
+	memStorage := storage.NewMemoryStorage()
+	templateService := services.NewTemplateService(memStorage)
+
+	layout := services.DefaultPDFLayout()
+	layout.Blocks = append(layout.Blocks, models.PDFTextBlock{Text: `{{formatDate "long" .CompletionDate}}`, Y: 180, Height: 8})
+	err := templateService.CreateTemplate(models.DefaultOrganizationID, models.SystemActor, &models.Template{
+		ID:           "funcs",
+		Name:         "Funcs",
+		HTMLTemplate: "<p>{{.Name}}</p>",
+		PDFLayout:    layout,
+		Email:        &models.EmailTemplate{Subject: "{{upper .Course}}", Body: "{{title .Name}}"},
+	})
+	if err != nil {
+		t.Errorf("Expected template functions in PDF blocks and email, got %v", err)
+	}
+}
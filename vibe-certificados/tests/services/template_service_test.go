@@ -0,0 +1,50 @@
+package services_test
+
+import (
+	"strings"
+	"testing"
+	"vibe-certificados/models"
+	"vibe-certificados/services"
+	"vibe-certificados/storage"
+)
+
+func TestTemplateService_RenderCertificateWithQRCode(t *testing.T) {
+	// Setup
+	memStorage := storage.NewMemoryStorage()
+	templateService := services.NewTemplateService(memStorage)
+	certService := services.NewCertificateService(memStorage)
+	certService.SetPublicBaseURL("https://certificados.example.com")
+
+	cert, err := certService.CreateCertificate(models.DefaultOrganizationID, models.SystemActor, &models.CertificateRequest{
+		Email:          "test@example.com",
+		Name:           "João Silva",
+		Course:         "Go Programming",
+		CompletionDate: "2024-01-15",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+
+	html, err := templateService.RenderCertificate(cert)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if !strings.Contains(html, `src="data:image/png;base64,`) {
+		t.Error("Expected QR code image in rendered HTML")
+	}
+	if !strings.Contains(html, cert.VerificationURL) {
+		t.Error("Expected verification URL in rendered HTML")
+	}
+}
+
+func TestGenerateQRCode(t *testing.T) {
+	png, err := services.GenerateQRCode("https://certificados.example.com/verify/123")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if !strings.HasPrefix(string(png), "\x89PNG") {
+		t.Error("Expected PNG image")
+	}
+}
@@ -0,0 +1,95 @@
+package services_test
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"vibe-certificados/models"
+	"vibe-certificados/services"
+	"vibe-certificados/storage"
+)
+
+func TestTemplateService_RejectsInvalidHTMLTemplate(t *testing.T) {
+	memStorage := storage.NewMemoryStorage()
+	templateService := services.NewTemplateService(memStorage)
+
+	invalid := []string{
+		"<p>{{.Name</p>",
+		"<p>{{if .Name}}unclosed</p>",
+		"<p>{{template \"missing\"}}</p>",
+	}
+	for i, html := range invalid {
+		if err := templateService.CreateTemplate(models.DefaultOrganizationID, models.SystemActor, &models.Template{ID: "invalid", HTMLTemplate: html}); err == nil {
+			t.Errorf("Expected error for invalid template %d", i)
+		}
+	}
+
+	if err := templateService.UpdateTemplate(models.DefaultOrganizationID, models.SystemActor, &models.Template{ID: "default", HTMLTemplate: "{{end}}"}); err == nil {
+		t.Error("Expected error when updating with an invalid template")
+	}
+}
+
+func TestUndeclaredVariables(t *testing.T) {
+	tmpl := &models.Template{
+		HTMLTemplate: `<p>{{.Name}} {{.hours}} {{.hourz}}</p>
+			{{range .items}}{{.Title}} {{$.instructor}}{{end}}
+			{{with .sponsor}}{{.Logo}}{{else}}{{.fallback}}{{end}}`,
+		Fields: []models.TemplateField{{Name: "hours", Type: "number"}},
+		PDFLayout: &models.PDFLayout{
+			Blocks: []models.PDFTextBlock{{Text: "{{.CompletionDateLong}} {{printf \"%s\" .city}}"}},
+		},
+		Email: &models.EmailTemplate{Subject: "{{.Course}}", Body: "{{.greeting}}"},
+	}
+
+	expected := []string{"city", "fallback", "greeting", "hourz", "instructor", "items", "sponsor"}
+	if got := services.UndeclaredVariables(tmpl); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
+
+func TestTemplatePreview(t *testing.T) {
+	// Setup
+	memStorage := storage.NewMemoryStorage()
+	templateService := services.NewTemplateService(memStorage)
+	certService := services.NewCertificateService(memStorage)
+	pdfService := services.NewPDFService(templateService)
+
+	tmpl := &models.Template{
+		ID:           "workshop",
+		HTMLTemplate: "<p>{{.Name}} - {{.hours}}h - {{.level}}</p>",
+		Fields: []models.TemplateField{
+			{Name: "hours", Type: "number"},
+			{Name: "level", Type: "enum", Options: []string{"basic", "advanced"}},
+		},
+	}
+
+	// Unsaved templates can be previewed; missing fields get sample values
+	cert := certService.PreviewCertificate(tmpl, map[string]string{"name": "Ana Souza"})
+	html, err := templateService.PreviewHTML(tmpl, cert)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !strings.Contains(html, "<p>Ana Souza - 40h - basic</p>") {
+		t.Errorf("Expected supplied and sample values in preview, got %s", html)
+	}
+
+	pdf, err := pdfService.PreviewPDF(tmpl, cert)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !bytes.HasPrefix(pdf, []byte("%PDF")) {
+		t.Error("Expected a PDF document")
+	}
+
+	// Previews never create certificates
+	if certs, _ := certService.GetCertificatesByEmail(models.DefaultOrganizationID, cert.Email); len(certs) != 0 {
+		t.Errorf("Expected no stored certificates, got %d", len(certs))
+	}
+
+	// Invalid templates are reported instead of rendered
+	tmpl.HTMLTemplate = "<p>{{.Name</p>"
+	if _, err := templateService.PreviewHTML(tmpl, cert); err == nil {
+		t.Error("Expected error for an invalid template")
+	}
+}
@@ -0,0 +1,266 @@
+package services_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"vibe-certificados/models"
+	"vibe-certificados/services"
+	"vibe-certificados/storage"
+)
+
+func newVersionedTemplate(t *testing.T, templateService *services.TemplateService) *models.Template {
+	t.Helper()
+
+	template := &models.Template{
+		ID:           "versioned",
+		Name:         "Versioned",
+		HTMLTemplate: "<html><body><h1>Original</h1><p>{{.Name}}</p></body></html>",
+	}
+	if err := templateService.CreateTemplate(models.DefaultOrganizationID, models.SystemActor, template); err != nil {
+		t.Fatalf("Failed to create template: %v", err)
+	}
+	return template
+}
+
+func TestTemplateService_UpdateCreatesVersion(t *testing.T) {
+	// Setup
+	memStorage := storage.NewMemoryStorage()
+	templateService := services.NewTemplateService(memStorage)
+	certService := services.NewCertificateService(memStorage)
+
+	template := newVersionedTemplate(t, templateService)
+	if template.Version != 1 {
+		t.Errorf("Expected version 1, got %d", template.Version)
+	}
+
+	cert, err := certService.CreateCertificate(models.DefaultOrganizationID, models.SystemActor, &models.CertificateRequest{
+		Email:          "test@example.com",
+		Name:           "João Silva",
+		Course:         "Go Programming",
+		CompletionDate: "2024-01-15",
+		TemplateID:     "versioned",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	if cert.TemplateVersion != 1 {
+		t.Errorf("Expected template version 1, got %d", cert.TemplateVersion)
+	}
+
+	updated := &models.Template{
+		ID:           "versioned",
+		Name:         "Versioned",
+		HTMLTemplate: "<html><body><h1>Redesigned</h1><p>{{.Name}}</p></body></html>",
+	}
+	if err := templateService.UpdateTemplate(models.DefaultOrganizationID, models.SystemActor, updated); err != nil {
+		t.Fatalf("Failed to update template: %v", err)
+	}
+	if updated.Version != 2 {
+		t.Errorf("Expected version 2, got %d", updated.Version)
+	}
+	if updated.CreatedAt != template.CreatedAt {
+		t.Errorf("Expected created_at %s to be kept, got %s", template.CreatedAt, updated.CreatedAt)
+	}
+
+	// The certificate keeps the design it was issued with
+	html, err := templateService.RenderCertificate(cert)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !strings.Contains(html, "Original") || strings.Contains(html, "Redesigned") {
+		t.Errorf("Expected original design, got %s", html)
+	}
+
+	versions, err := templateService.GetTemplateVersions(models.DefaultOrganizationID, "versioned")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(versions) != 2 {
+		t.Errorf("Expected 2 versions, got %d", len(versions))
+	}
+}
+
+func TestTemplateService_DeletedTemplateStillRenders(t *testing.T) {
+	// Setup
+	memStorage := storage.NewMemoryStorage()
+	templateService := services.NewTemplateService(memStorage)
+	certService := services.NewCertificateService(memStorage)
+
+	newVersionedTemplate(t, templateService)
+	cert, err := certService.CreateCertificate(models.DefaultOrganizationID, models.SystemActor, &models.CertificateRequest{
+		Email:          "test@example.com",
+		Name:           "João Silva",
+		Course:         "Go Programming",
+		CompletionDate: "2024-01-15",
+		TemplateID:     "versioned",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+
+	if err := templateService.DeleteTemplate(models.DefaultOrganizationID, models.SystemActor, "versioned"); err != nil {
+		t.Fatalf("Failed to delete template: %v", err)
+	}
+	if _, err := templateService.RenderCertificate(cert); err != nil {
+		t.Errorf("Expected certificate to render after template deletion, got %v", err)
+	}
+
+	// Recreating the template continues the numbering
+	recreated := newVersionedTemplate(t, templateService)
+	if recreated.Version != 2 {
+		t.Errorf("Expected version 2, got %d", recreated.Version)
+	}
+}
+
+func TestTemplateService_RollbackTemplate(t *testing.T) {
+	// Setup
+	memStorage := storage.NewMemoryStorage()
+	templateService := services.NewTemplateService(memStorage)
+	certService := services.NewCertificateService(memStorage)
+
+	newVersionedTemplate(t, templateService)
+	templateService.UpdateTemplate(models.DefaultOrganizationID, models.SystemActor, &models.Template{
+		ID:           "versioned",
+		Name:         "Versioned",
+		HTMLTemplate: "<html><body><h1>Redesigned</h1><p>{{.Name}}</p></body></html>",
+	})
+
+	restored, err := templateService.RollbackTemplate(models.DefaultOrganizationID, models.SystemActor, "versioned", 1)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if restored.Version != 1 || !strings.Contains(restored.HTMLTemplate, "Original") {
+		t.Errorf("Expected version 1 to be active, got version %d", restored.Version)
+	}
+
+	cert, err := certService.CreateCertificate(models.DefaultOrganizationID, models.SystemActor, &models.CertificateRequest{
+		Email:          "test@example.com",
+		Name:           "João Silva",
+		Course:         "Go Programming",
+		CompletionDate: "2024-01-15",
+		TemplateID:     "versioned",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	if cert.TemplateVersion != 1 {
+		t.Errorf("Expected template version 1, got %d", cert.TemplateVersion)
+	}
+
+	// The next update still gets a new number
+	next := &models.Template{ID: "versioned", Name: "Versioned", HTMLTemplate: "<p>{{.Name}}</p>"}
+	if err := templateService.UpdateTemplate(models.DefaultOrganizationID, models.SystemActor, next); err != nil {
+		t.Fatalf("Failed to update template: %v", err)
+	}
+	if next.Version != 3 {
+		t.Errorf("Expected version 3, got %d", next.Version)
+	}
+
+	if _, err := templateService.RollbackTemplate(models.DefaultOrganizationID, models.SystemActor, "versioned", 9); !errors.Is(err, storage.ErrTemplateVersionNotFound) {
+		t.Errorf("Expected ErrTemplateVersionNotFound, got %v", err)
+	}
+}
+
+func TestTemplateService_DiffTemplateVersions(t *testing.T) {
+	// Setup
+	memStorage := storage.NewMemoryStorage()
+	templateService := services.NewTemplateService(memStorage)
+
+	newVersionedTemplate(t, templateService)
+	templateService.UpdateTemplate(models.DefaultOrganizationID, models.SystemActor, &models.Template{
+		ID:           "versioned",
+		Name:         "Versioned",
+		HTMLTemplate: "<html><body><h1>Redesigned</h1><p>{{.Name}}</p></body></html>",
+	})
+
+	diff, err := templateService.DiffTemplateVersions(models.DefaultOrganizationID, "versioned", 1, 2)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(diff.Changes) != 1 || diff.Changes[0].Field != "html_template" {
+		t.Fatalf("Expected only html_template to change, got %+v", diff.Changes)
+	}
+
+	lines := strings.Join(diff.Changes[0].Diff, "\n")
+	if !strings.Contains(lines, "- <html><body><h1>Original</h1>") || !strings.Contains(lines, "+ <html><body><h1>Redesigned</h1>") {
+		t.Errorf("Expected removed and added lines, got %s", lines)
+	}
+
+	if _, err := templateService.DiffTemplateVersions(models.DefaultOrganizationID, "versioned", 1, 5); !errors.Is(err, storage.ErrTemplateVersionNotFound) {
+		t.Errorf("Expected ErrTemplateVersionNotFound, got %v", err)
+	}
+}
+
+func TestTemplateService_DiffTemplateVersions_LargeChanges(t *testing.T) {
+	// Setup
+	memStorage := storage.NewMemoryStorage()
+	templateService := services.NewTemplateService(memStorage)
+
+	// Every other line changes, too many to compare line by line
+	var original, redesigned strings.Builder
+	original.WriteString("<html><body>\n")
+	redesigned.WriteString("<html><body>\n")
+	for i := 0; i < 1200; i++ {
+		fmt.Fprintf(&original, "<p>Line %d</p>\n", i)
+		if i%2 == 0 {
+			fmt.Fprintf(&redesigned, "<p>Changed %d</p>\n", i)
+		} else {
+			fmt.Fprintf(&redesigned, "<p>Line %d</p>\n", i)
+		}
+	}
+	original.WriteString("<p>{{.Name}}</p></body></html>")
+	redesigned.WriteString("<p>{{.Name}}</p></body></html>")
+
+	if err := templateService.CreateTemplate(models.DefaultOrganizationID, models.SystemActor, &models.Template{
+		ID: "versioned", Name: "Versioned", HTMLTemplate: original.String(),
+	}); err != nil {
+		t.Fatalf("Failed to create template: %v", err)
+	}
+	if err := templateService.UpdateTemplate(models.DefaultOrganizationID, models.SystemActor, &models.Template{
+		ID: "versioned", Name: "Versioned", HTMLTemplate: redesigned.String(),
+	}); err != nil {
+		t.Fatalf("Failed to update template: %v", err)
+	}
+
+	diff, err := templateService.DiffTemplateVersions(models.DefaultOrganizationID, "versioned", 1, 2)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(diff.Changes) != 1 {
+		t.Fatalf("Expected only html_template to change, got %+v", diff.Changes)
+	}
+
+	// The common first and last lines are kept, and the rest is shown as a
+	// removed block followed by an added one
+	lines := diff.Changes[0].Diff
+	if len(lines) != 2*1199+3 {
+		t.Fatalf("Expected %d lines, got %d", 2*1199+3, len(lines))
+	}
+	if lines[0] != "  <html><body>" || lines[len(lines)-2] != "  <p>Line 1199</p>" || lines[len(lines)-1] != "  <p>{{.Name}}</p></body></html>" {
+		t.Errorf("Expected the common lines unchanged, got %q ... %q", lines[0], lines[len(lines)-2:])
+	}
+	if lines[1] != "- <p>Line 0</p>" || lines[1199] != "- <p>Line 1198</p>" || lines[1200] != "+ <p>Changed 0</p>" || lines[2398] != "+ <p>Changed 1198</p>" {
+		t.Errorf("Expected a removed block followed by an added one, got %q, %q, %q, %q", lines[1], lines[1199], lines[1200], lines[2398])
+	}
+}
+
+func TestTemplateService_VersionsLegacyTemplates(t *testing.T) {
+	// Templates stored before versioning have no version
+	memStorage := storage.NewMemoryStorage()
+	memStorage.SaveTemplate(&models.Template{ID: "legacy", Name: "Legacy", HTMLTemplate: "<p>{{.Name}}</p>"})
+
+	templateService := services.NewTemplateService(memStorage)
+
+	template, err := templateService.GetTemplate(models.DefaultOrganizationID, "legacy")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if template.Version != 1 {
+		t.Errorf("Expected version 1, got %d", template.Version)
+	}
+	if _, err := templateService.GetTemplateVersion(models.DefaultOrganizationID, "legacy", 1); err != nil {
+		t.Errorf("Expected version 1 to be stored, got %v", err)
+	}
+}
@@ -0,0 +1,194 @@
+package storage_test
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"vibe-certificados/models"
+	"vibe-certificados/storage"
+)
+
+func TestMemoryStorage_ListCertificates(t *testing.T) {
+	testListCertificates(t, storage.NewMemoryStorage())
+}
+
+func TestSQLiteStorage_ListCertificates(t *testing.T) {
+	testListCertificates(t, newTestSQLiteStorage(t, filepath.Join(t.TempDir(), "test.db")))
+}
+
+// testListCertificates checks filters, sorting and pagination against a
+// storage implementation
+func testListCertificates(t *testing.T, store storage.Storage) {
+	t.Helper()
+
+	created := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	people := []struct{ name, course string }{
+		{"Ana Souza", "Go"},
+		{"Bruno Lima", "Go"},
+		{"Carla Dias", "Rust"},
+		{"Daniel Souza", "Go"},
+		{"Elisa Rocha", "Rust"},
+	}
+	// Saved out of creation order
+	for _, i := range []int{3, 0, 4, 1, 2} {
+		person := people[i]
+		cert := models.NewCertificate(person.name+"@example.com", person.name, person.course, "default",
+			time.Date(2024, 1, 10+i, 0, 0, 0, 0, time.UTC), nil)
+		cert.CreatedAt = created.Add(time.Duration(i) * time.Hour)
+		if i == 4 {
+			cert.Status = models.StatusRevoked
+		}
+		if err := store.SaveCertificate(cert); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	other := newTestCertificate("other@example.com")
+	other.OrganizationID = "acme"
+	store.SaveCertificate(other)
+
+	names := func(page *models.CertificatePage) []string {
+		result := make([]string, 0, len(page.Certificates))
+		for _, cert := range page.Certificates {
+			result = append(result, cert.Name)
+		}
+		return result
+	}
+	list := func(query models.CertificateQuery) *models.CertificatePage {
+		t.Helper()
+		if query.Sort == "" {
+			query.Sort = models.SortCreatedAt
+		}
+		if query.Limit == 0 {
+			query.Limit = 10
+		}
+		page, err := store.ListCertificates(models.DefaultOrganizationID, &query)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		return page
+	}
+	expect := func(page *models.CertificatePage, expected ...string) {
+		t.Helper()
+		got := names(page)
+		if len(got) != len(expected) {
+			t.Fatalf("Expected %v, got %v", expected, got)
+		}
+		for i := range expected {
+			if got[i] != expected[i] {
+				t.Fatalf("Expected %v, got %v", expected, got)
+			}
+		}
+	}
+
+	expect(list(models.CertificateQuery{}), "Ana Souza", "Bruno Lima", "Carla Dias", "Daniel Souza", "Elisa Rocha")
+	expect(list(models.CertificateQuery{Descending: true, Course: "Go"}), "Daniel Souza", "Bruno Lima", "Ana Souza")
+	expect(list(models.CertificateQuery{Name: "souza"}), "Ana Souza", "Daniel Souza")
+	expect(list(models.CertificateQuery{Status: models.StatusActive, Course: "Rust"}), "Carla Dias")
+	expect(list(models.CertificateQuery{Status: models.StatusRevoked}), "Elisa Rocha")
+	expect(list(models.CertificateQuery{Sort: models.SortName, Descending: true, TemplateID: "default", Limit: 2}), "Elisa Rocha", "Daniel Souza")
+	expect(list(models.CertificateQuery{
+		CompletedFrom:  time.Date(2024, 1, 11, 0, 0, 0, 0, time.UTC),
+		CompletedUntil: time.Date(2024, 1, 13, 0, 0, 0, 0, time.UTC),
+	}), "Bruno Lima", "Carla Dias")
+	expect(list(models.CertificateQuery{CreatedFrom: created.Add(3 * time.Hour)}), "Daniel Souza", "Elisa Rocha")
+	expect(list(models.CertificateQuery{CreatedUntil: created.Add(time.Hour)}), "Ana Souza")
+
+	// Walk the pages of a sort with ties, which are broken by ID
+	query := models.CertificateQuery{Sort: models.SortCourse, Limit: 2}
+	seen := make(map[string]bool)
+	var courses []string
+	for pages := 0; ; pages++ {
+		page := list(query)
+		for _, cert := range page.Certificates {
+			if seen[cert.ID] {
+				t.Fatalf("Expected each certificate once, got %s again", cert.Name)
+			}
+			seen[cert.ID] = true
+			courses = append(courses, cert.Course)
+		}
+		if page.NextCursor == "" {
+			if pages != 2 {
+				t.Errorf("Expected 3 pages, got %d", pages+1)
+			}
+			break
+		}
+		query.Cursor = page.NextCursor
+	}
+	if len(seen) != 5 || courses[0] != "Go" || courses[2] != "Go" || courses[3] != "Rust" {
+		t.Errorf("Expected every certificate sorted by course, got %v", courses)
+	}
+
+	// Walk the pages newest first
+	query = models.CertificateQuery{Descending: true, Limit: 2}
+	var newest []string
+	for {
+		page := list(query)
+		newest = append(newest, names(page)...)
+		if page.NextCursor == "" {
+			break
+		}
+		query.Cursor = page.NextCursor
+	}
+	if strings.Join(newest, ", ") != "Elisa Rocha, Daniel Souza, Carla Dias, Bruno Lima, Ana Souza" {
+		t.Errorf("Expected every certificate newest first, got %v", newest)
+	}
+
+	// A cursor only works with the sort order it was produced by
+	first := list(models.CertificateQuery{Limit: 1})
+	_, err := store.ListCertificates(models.DefaultOrganizationID, &models.CertificateQuery{Sort: models.SortName, Limit: 1, Cursor: first.NextCursor})
+	if !errors.Is(err, storage.ErrInvalidCursor) {
+		t.Errorf("Expected ErrInvalidCursor, got %v", err)
+	}
+	_, err = store.ListCertificates(models.DefaultOrganizationID, &models.CertificateQuery{Sort: models.SortCreatedAt, Limit: 1, Cursor: "garbage"})
+	if !errors.Is(err, storage.ErrInvalidCursor) {
+		t.Errorf("Expected ErrInvalidCursor, got %v", err)
+	}
+
+	// Revoking moves a certificate between the status filters
+	revoked := *first.Certificates[0]
+	revoked.Status = models.StatusRevoked
+	if err := store.SaveCertificate(&revoked); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	expect(list(models.CertificateQuery{Status: models.StatusRevoked}), "Ana Souza", "Elisa Rocha")
+	expect(list(models.CertificateQuery{Status: models.StatusActive}), "Bruno Lima", "Carla Dias", "Daniel Souza")
+}
+
+func BenchmarkMemoryStorage_ListCertificates(b *testing.B) {
+	store := storage.NewMemoryStorage()
+	created := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	for i := 0; i < 10000; i++ {
+		cert := models.NewCertificate(fmt.Sprintf("aluno%d@example.com", i), fmt.Sprintf("Aluno %d", i), fmt.Sprintf("Curso %d", i%50), "default",
+			time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC), nil)
+		cert.CreatedAt = created.Add(time.Duration(i) * time.Minute)
+		if i%100 == 0 {
+			cert.Status = models.StatusRevoked
+		}
+		store.SaveCertificate(cert)
+	}
+
+	queries := map[string]models.CertificateQuery{
+		"all":     {},
+		"course":  {Course: "Curso 7"},
+		"status":  {Status: models.StatusRevoked},
+		"name":    {Name: "aluno 12"},
+		"created": {CreatedFrom: created.Add(9000 * time.Minute)},
+		"by name": {Sort: models.SortName},
+	}
+	for name, query := range queries {
+		if query.Sort == "" {
+			query.Sort = models.SortCreatedAt
+		}
+		query.Descending, query.Limit = true, 50
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := store.ListCertificates(models.DefaultOrganizationID, &query); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,423 @@
+package storage_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"vibe-certificados/models"
+	"vibe-certificados/storage"
+)
+
+func newTestCertificate(email string) *models.Certificate {
+	return models.NewCertificate(email, "João Silva", "Go Programming", "default",
+		time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC), nil)
+}
+
+func TestJournaledMemoryStorage_ReplaysAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := storage.NewJournaledMemoryStorage(dir, 0)
+	if err != nil {
+		t.Fatalf("Failed to open journaled storage: %v", err)
+	}
+
+	cert := newTestCertificate("test@example.com")
+	if err := store.SaveCertificate(cert); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	store.SaveTemplate(&models.Template{ID: "custom", Name: "Custom"})
+	store.SaveTemplate(&models.Template{ID: "other", Name: "Other"})
+	if err := store.DeleteTemplate(models.DefaultOrganizationID, "other"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// Simulate a crash: reopen without Close, so only the journal exists
+	reopened, err := storage.NewJournaledMemoryStorage(dir, 0)
+	if err != nil {
+		t.Fatalf("Failed to reopen journaled storage: %v", err)
+	}
+	defer reopened.Close()
+
+	if _, err := reopened.GetCertificate(cert.ID); err != nil {
+		t.Errorf("Expected certificate to be replayed, got %v", err)
+	}
+	if _, err := reopened.GetTemplate(models.DefaultOrganizationID, "custom"); err != nil {
+		t.Errorf("Expected template to be replayed, got %v", err)
+	}
+	if _, err := reopened.GetTemplate(models.DefaultOrganizationID, "other"); err == nil {
+		t.Error("Expected deleted template to stay deleted")
+	}
+}
+
+func TestJournaledMemoryStorage_CompactsIntoSnapshot(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := storage.NewJournaledMemoryStorage(dir, 0)
+	if err != nil {
+		t.Fatalf("Failed to open journaled storage: %v", err)
+	}
+	cert := newTestCertificate("test@example.com")
+	store.SaveCertificate(cert)
+
+	if err := store.Compact(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	info, err := os.Stat(filepath.Join(dir, "journal.log"))
+	if err != nil {
+		t.Fatalf("Expected journal file, got %v", err)
+	}
+	if info.Size() != 0 {
+		t.Errorf("Expected empty journal after compaction, got %d bytes", info.Size())
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	reopened, err := storage.NewJournaledMemoryStorage(dir, 0)
+	if err != nil {
+		t.Fatalf("Failed to reopen journaled storage: %v", err)
+	}
+	defer reopened.Close()
+
+	certificates, _ := reopened.GetCertificatesByEmail(models.DefaultOrganizationID, "test@example.com")
+	if len(certificates) != 1 {
+		t.Errorf("Expected 1 certificate from snapshot, got %d", len(certificates))
+	}
+}
+
+func TestJournaledMemoryStorage_TruncatesCorruptedTail(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := storage.NewJournaledMemoryStorage(dir, 0)
+	if err != nil {
+		t.Fatalf("Failed to open journaled storage: %v", err)
+	}
+	cert := newTestCertificate("test@example.com")
+	store.SaveCertificate(cert)
+
+	journalPath := filepath.Join(dir, "journal.log")
+	valid, _ := os.ReadFile(journalPath)
+
+	// Append a garbage line and a half-written entry
+	f, _ := os.OpenFile(journalPath, os.O_APPEND|os.O_WRONLY, 0o644)
+	f.WriteString("deadbeef {\"op\":\"save_template\"}\n")
+	f.WriteString("0000")
+	f.Close()
+
+	reopened, err := storage.NewJournaledMemoryStorage(dir, 0)
+	if err != nil {
+		t.Fatalf("Expected corrupted tail to be tolerated, got %v", err)
+	}
+
+	if _, err := reopened.GetCertificate(cert.ID); err != nil {
+		t.Errorf("Expected valid entry to be replayed, got %v", err)
+	}
+
+	after, _ := os.ReadFile(journalPath)
+	if string(after) != string(valid) {
+		t.Errorf("Expected journal to be truncated to %d bytes, got %d", len(valid), len(after))
+	}
+
+	// New writes continue after the valid prefix
+	second := newTestCertificate("other@example.com")
+	if err := reopened.SaveCertificate(second); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	final, err := storage.NewJournaledMemoryStorage(dir, 0)
+	if err != nil {
+		t.Fatalf("Failed to reopen journaled storage: %v", err)
+	}
+	defer final.Close()
+	if _, err := final.GetCertificate(second.ID); err != nil {
+		t.Errorf("Expected entry written after truncation to be replayed, got %v", err)
+	}
+}
+
+func TestJournaledMemoryStorage_PersistsAssets(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := storage.NewJournaledMemoryStorage(dir, 0)
+	if err != nil {
+		t.Fatalf("Failed to open journaled storage: %v", err)
+	}
+	for _, name := range []string{"logo.png", "old.png"} {
+		asset := &models.TemplateAsset{TemplateID: "custom", Name: name, ContentType: "image/png", Data: []byte(name)}
+		if err := store.SaveAsset(asset); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	if err := store.Compact(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := store.DeleteAsset(models.DefaultOrganizationID, "custom", "old.png"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// The snapshot holds both assets and the journal the deletion
+	reopened, err := storage.NewJournaledMemoryStorage(dir, 0)
+	if err != nil {
+		t.Fatalf("Failed to reopen journaled storage: %v", err)
+	}
+	defer reopened.Close()
+
+	asset, err := reopened.GetAsset(models.DefaultOrganizationID, "custom", "logo.png")
+	if err != nil {
+		t.Fatalf("Expected asset to be replayed, got %v", err)
+	}
+	if string(asset.Data) != "logo.png" {
+		t.Errorf("Expected asset content to be replayed, got %q", asset.Data)
+	}
+	if _, err := reopened.GetAsset(models.DefaultOrganizationID, "custom", "old.png"); !errors.Is(err, storage.ErrAssetNotFound) {
+		t.Errorf("Expected deleted asset to stay deleted, got %v", err)
+	}
+}
+
+func TestJournaledMemoryStorage_PersistsOrganizations(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := storage.NewJournaledMemoryStorage(dir, 0)
+	if err != nil {
+		t.Fatalf("Failed to open journaled storage: %v", err)
+	}
+	if err := store.SaveOrganization(&models.Organization{ID: "acme", Name: "Acme"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := store.Compact(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	key := &models.APIKey{ID: "k1", OrganizationID: "acme", Name: "ci", Prefix: "vc_abc", Hash: "hash"}
+	if err := store.SaveAPIKey(key); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	template := &models.Template{OrganizationID: "acme", ID: "default", Name: "Acme default"}
+	if err := store.SaveTemplate(template); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	store.Close()
+
+	reopened, err := storage.NewJournaledMemoryStorage(dir, 0)
+	if err != nil {
+		t.Fatalf("Failed to reopen journaled storage: %v", err)
+	}
+	defer reopened.Close()
+
+	if _, err := reopened.GetOrganization("acme"); err != nil {
+		t.Errorf("Expected organization from the snapshot, got %v", err)
+	}
+	// The hash is left out of the API key JSON but must survive the journal
+	if stored, err := reopened.GetAPIKeyByHash("hash"); err != nil || stored.OrganizationID != "acme" {
+		t.Errorf("Expected API key to be replayed, got %+v (%v)", stored, err)
+	}
+	// Keys journaled before roles existed are admin keys
+	if keys, _ := reopened.GetAPIKeys("acme"); len(keys) != 1 || keys[0].Role != models.RoleAdmin {
+		t.Errorf("Expected one admin key of acme, got %+v", keys)
+	}
+	if _, err := reopened.GetTemplate(models.DefaultOrganizationID, "default"); !errors.Is(err, storage.ErrTemplateNotFound) {
+		t.Errorf("Expected the template of acme not to leak into the default organization, got %v", err)
+	}
+	if stored, err := reopened.GetTemplate("acme", "default"); err != nil || stored.Name != "Acme default" {
+		t.Errorf("Expected the template of acme, got %+v (%v)", stored, err)
+	}
+}
+
+func TestJournaledMemoryStorage_PersistsAuditLog(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := storage.NewJournaledMemoryStorage(dir, 0)
+	if err != nil {
+		t.Fatalf("Failed to open journaled storage: %v", err)
+	}
+	for _, id := range []string{"first", "second"} {
+		entry := &models.AuditEntry{ID: id, OrganizationID: models.DefaultOrganizationID, Action: models.AuditCertificateCreate, Timestamp: time.Now()}
+		if err := store.SaveAuditEntry(entry); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if id == "first" {
+			if err := store.Compact(); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+		}
+	}
+
+	// The snapshot holds the first entry and the journal the second
+	reopened, err := storage.NewJournaledMemoryStorage(dir, 0)
+	if err != nil {
+		t.Fatalf("Failed to reopen journaled storage: %v", err)
+	}
+	defer reopened.Close()
+
+	entries, _ := reopened.GetAuditEntries(models.DefaultOrganizationID, &models.AuditFilter{})
+	if len(entries) != 2 || entries[0].ID != "second" || entries[1].ID != "first" {
+		t.Errorf("Expected both entries newest first, got %+v", entries)
+	}
+}
+
+func TestJournaledMemoryStorage_PersistsIdempotencyKeys(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := storage.NewJournaledMemoryStorage(dir, 0)
+	if err != nil {
+		t.Fatalf("Failed to open journaled storage: %v", err)
+	}
+	for _, key := range []string{"order-1", "order-2"} {
+		record := &models.IdempotencyKey{OrganizationID: models.DefaultOrganizationID, Key: key, RequestHash: "hash", CertificateID: "cert-" + key, CreatedAt: time.Now()}
+		if err := store.SaveIdempotencyKey(record); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if key == "order-1" {
+			if err := store.Compact(); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+		}
+	}
+
+	// The snapshot holds the first key and the journal the second
+	reopened, err := storage.NewJournaledMemoryStorage(dir, 0)
+	if err != nil {
+		t.Fatalf("Failed to reopen journaled storage: %v", err)
+	}
+	defer reopened.Close()
+
+	for _, key := range []string{"order-1", "order-2"} {
+		record, err := reopened.GetIdempotencyKey(models.DefaultOrganizationID, key)
+		if err != nil || record.CertificateID != "cert-"+key {
+			t.Errorf("Expected key %s to be restored, got %+v (%v)", key, record, err)
+		}
+	}
+}
+
+func TestJournaledMemoryStorage_RefusesCorruptionBeforeValidEntries(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := storage.NewJournaledMemoryStorage(dir, 0)
+	if err != nil {
+		t.Fatalf("Failed to open journaled storage: %v", err)
+	}
+	store.SaveCertificate(newTestCertificate("first@example.com"))
+	store.Close()
+
+	// A damaged entry followed by a valid one
+	journalPath := filepath.Join(dir, "journal.log")
+	f, _ := os.OpenFile(journalPath, os.O_APPEND|os.O_WRONLY, 0o644)
+	f.WriteString("deadbeef {\"op\":\"save_template\"}\n")
+	f.Close()
+	store, err = storage.NewJournaledMemoryStorage(dir, 0)
+	if err != nil {
+		t.Fatalf("Expected a corrupted tail to be tolerated, got %v", err)
+	}
+	store.Close()
+	f, _ = os.OpenFile(journalPath, os.O_APPEND|os.O_WRONLY, 0o644)
+	f.WriteString("deadbeef {\"op\":\"save_template\"}\n")
+	f.Close()
+	valid, _ := os.ReadFile(journalPath)
+	valid = append(valid, readJournalLine(t, dir, newTestCertificate("second@example.com"))...)
+	os.WriteFile(journalPath, valid, 0o644)
+
+	if _, err := storage.NewJournaledMemoryStorage(dir, 0); !errors.Is(err, storage.ErrCorruptedJournal) {
+		t.Fatalf("Expected ErrCorruptedJournal, got %v", err)
+	}
+	after, _ := os.ReadFile(journalPath)
+	if string(after) != string(valid) {
+		t.Error("Expected the journal to be left untouched")
+	}
+}
+
+// readJournalLine returns the journal line written for saving cert
+func readJournalLine(t *testing.T, parent string, cert *models.Certificate) []byte {
+	t.Helper()
+
+	dir := filepath.Join(parent, "scratch")
+	store, err := storage.NewJournaledMemoryStorage(dir, 0)
+	if err != nil {
+		t.Fatalf("Failed to open journaled storage: %v", err)
+	}
+	defer store.Close()
+	if err := store.SaveCertificate(cert); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	line, _ := os.ReadFile(filepath.Join(dir, "journal.log"))
+	return line
+}
+
+func TestJournaledMemoryStorage_JournalsJobProgress(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := storage.NewJournaledMemoryStorage(dir, 0)
+	if err != nil {
+		t.Fatalf("Failed to open journaled storage: %v", err)
+	}
+	job := &models.BatchJob{ID: "job-1", Status: models.JobRunning, CreatedIDs: []string{}, Errors: []models.RowError{}}
+	if err := store.SaveJob(job); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := store.Compact(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		job.Processed++
+		job.CreatedIDs = append(job.CreatedIDs, fmt.Sprintf("cert-%d", i))
+		if err := store.SaveJob(job); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	job.Errors = append(job.Errors, models.RowError{Row: 5, Error: "bad"})
+	job.Processed++
+	store.SaveJob(job)
+
+	// Each save only journals what it adds
+	journalPath := filepath.Join(dir, "journal.log")
+	journal, _ := os.ReadFile(journalPath)
+	if n := strings.Count(string(journal), "cert-0"); n != 1 {
+		t.Errorf("Expected the first ID to be journaled once, got %d", n)
+	}
+
+	// Replaying the progress over a snapshot that already holds it, as
+	// after a crash during compaction, does not record rows twice
+	if err := store.Compact(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	store.Close()
+	os.WriteFile(journalPath, journal, 0o644)
+
+	reopened, err := storage.NewJournaledMemoryStorage(dir, 0)
+	if err != nil {
+		t.Fatalf("Failed to reopen journaled storage: %v", err)
+	}
+	defer reopened.Close()
+
+	stored, err := reopened.GetJob("job-1")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if stored.Processed != 4 || len(stored.CreatedIDs) != 3 || stored.CreatedIDs[2] != "cert-2" || len(stored.Errors) != 1 {
+		t.Errorf("Expected the job progress to be restored once, got %+v", stored)
+	}
+}
+
+func TestJournaledMemoryStorage_UpdateDelivery(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := storage.NewJournaledMemoryStorage(dir, 0)
+	if err != nil {
+		t.Fatalf("Failed to open journaled storage: %v", err)
+	}
+	testUpdateDelivery(t, store)
+	store.Close()
+
+	reopened, err := storage.NewJournaledMemoryStorage(dir, 0)
+	if err != nil {
+		t.Fatalf("Failed to reopen journaled storage: %v", err)
+	}
+	defer reopened.Close()
+
+	certs, _ := reopened.GetCertificatesByEmail(models.DefaultOrganizationID, "john@example.com")
+	if len(certs) != 1 || !certs[0].IsRevoked() || certs[0].Delivery.Status != models.DeliverySent {
+		t.Errorf("Expected the delivery status to be replayed, got %+v", certs)
+	}
+}
@@ -0,0 +1,486 @@
+package storage_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"vibe-certificados/models"
+	"vibe-certificados/storage"
+)
+
+func newTestSQLiteStorage(t *testing.T, path string) *storage.SQLiteStorage {
+	t.Helper()
+
+	store, err := storage.NewSQLiteStorage(path)
+	if err != nil {
+		t.Fatalf("Failed to open sqlite storage: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestSQLiteStorage_Certificates(t *testing.T) {
+	store := newTestSQLiteStorage(t, filepath.Join(t.TempDir(), "test.db"))
+
+	cert := models.NewCertificate(
+		"test@example.com",
+		"João Silva",
+		"Go Programming",
+		"default",
+		time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC),
+		map[string]string{"instructor": "Prof. Silva"},
+	)
+
+	if err := store.SaveCertificate(cert); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	retrieved, err := store.GetCertificate(cert.ID)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if retrieved.Name != cert.Name {
+		t.Errorf("Expected name %s, got %s", cert.Name, retrieved.Name)
+	}
+	if !retrieved.CompletionDate.Equal(cert.CompletionDate) {
+		t.Errorf("Expected completion date %v, got %v", cert.CompletionDate, retrieved.CompletionDate)
+	}
+	if retrieved.Data["instructor"] != "Prof. Silva" {
+		t.Errorf("Expected instructor 'Prof. Silva', got %s", retrieved.Data["instructor"])
+	}
+
+	// Saving again must not duplicate the certificate
+	if err := store.SaveCertificate(cert); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	byEmail, err := store.GetCertificatesByEmail(models.DefaultOrganizationID, "test@example.com")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(byEmail) != 1 {
+		t.Errorf("Expected 1 certificate, got %d", len(byEmail))
+	}
+
+	_, err = store.GetCertificate("non-existent")
+	if !errors.Is(err, storage.ErrCertificateNotFound) {
+		t.Errorf("Expected ErrCertificateNotFound, got %v", err)
+	}
+}
+
+func TestSQLiteStorage_Templates(t *testing.T) {
+	store := newTestSQLiteStorage(t, filepath.Join(t.TempDir(), "test.db"))
+
+	template := &models.Template{
+		ID:           "custom",
+		Name:         "Custom",
+		HTMLTemplate: "<p>{{.Name}}</p>",
+		Fields: []models.TemplateField{
+			{Name: "name", Type: "string", Required: true},
+		},
+		CreatedAt: "2024-01-15 10:00:00",
+		UpdatedAt: "2024-01-15 10:00:00",
+	}
+
+	if err := store.SaveTemplate(template); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	retrieved, err := store.GetTemplate(models.DefaultOrganizationID, "custom")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if retrieved.HTMLTemplate != template.HTMLTemplate {
+		t.Errorf("Expected html template %s, got %s", template.HTMLTemplate, retrieved.HTMLTemplate)
+	}
+	if len(retrieved.Fields) != 1 || !retrieved.Fields[0].Required {
+		t.Errorf("Expected 1 required field, got %+v", retrieved.Fields)
+	}
+
+	templates, err := store.GetAllTemplates(models.DefaultOrganizationID)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(templates) != 1 {
+		t.Errorf("Expected 1 template, got %d", len(templates))
+	}
+
+	if err := store.DeleteTemplate(models.DefaultOrganizationID, "custom"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := store.DeleteTemplate(models.DefaultOrganizationID, "custom"); !errors.Is(err, storage.ErrTemplateNotFound) {
+		t.Errorf("Expected ErrTemplateNotFound, got %v", err)
+	}
+}
+
+func TestSQLiteStorage_PersistsAcrossReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+
+	store, err := storage.NewSQLiteStorage(path)
+	if err != nil {
+		t.Fatalf("Failed to open sqlite storage: %v", err)
+	}
+	cert := models.NewCertificate("test@example.com", "João Silva", "Go Programming", "default",
+		time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC), nil)
+	if err := store.SaveCertificate(cert); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	store.Close()
+
+	// Reopening runs the migrations again, which must be a no-op
+	reopened := newTestSQLiteStorage(t, path)
+	if _, err := reopened.GetCertificate(cert.ID); err != nil {
+		t.Errorf("Expected certificate to survive reopen, got %v", err)
+	}
+}
+
+func TestSQLiteStorage_Jobs(t *testing.T) {
+	store := newTestSQLiteStorage(t, filepath.Join(t.TempDir(), "test.db"))
+
+	job := &models.BatchJob{
+		ID:         "job-1",
+		Status:     models.JobCompleted,
+		Total:      2,
+		Processed:  2,
+		Succeeded:  1,
+		Failed:     1,
+		Errors:     []models.RowError{{Row: 3, Error: "invalid email"}},
+		CreatedIDs: []string{"cert-1"},
+		CreatedAt:  time.Now(),
+	}
+	if err := store.SaveJob(job); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	retrieved, err := store.GetJob("job-1")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if retrieved.Failed != 1 || len(retrieved.Errors) != 1 || retrieved.Errors[0].Row != 3 {
+		t.Errorf("Expected one error on row 3, got %+v", retrieved.Errors)
+	}
+
+	jobs, err := store.GetAllJobs()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(jobs) != 1 {
+		t.Errorf("Expected 1 job, got %d", len(jobs))
+	}
+
+	if err := store.DeleteJob("job-1"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := store.GetJob("job-1"); !errors.Is(err, storage.ErrJobNotFound) {
+		t.Errorf("Expected ErrJobNotFound, got %v", err)
+	}
+}
+
+func TestSQLiteStorage_TemplateVersions(t *testing.T) {
+	store := newTestSQLiteStorage(t, filepath.Join(t.TempDir(), "test.db"))
+
+	for version := 1; version <= 2; version++ {
+		template := &models.Template{ID: "custom", Name: "Custom", HTMLTemplate: "<p>{{.Name}}</p>", Version: version}
+		if err := store.SaveTemplateVersion(template); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if err := store.SaveTemplate(template); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	current, err := store.GetTemplate(models.DefaultOrganizationID, "custom")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if current.Version != 2 {
+		t.Errorf("Expected active version 2, got %d", current.Version)
+	}
+
+	if err := store.DeleteTemplate(models.DefaultOrganizationID, "custom"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	versions, err := store.GetTemplateVersions(models.DefaultOrganizationID, "custom")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(versions) != 2 || versions[0].Version != 1 || versions[1].Version != 2 {
+		t.Errorf("Expected versions 1 and 2 to outlive the template, got %+v", versions)
+	}
+
+	if _, err := store.GetTemplateVersion(models.DefaultOrganizationID, "custom", 3); !errors.Is(err, storage.ErrTemplateVersionNotFound) {
+		t.Errorf("Expected ErrTemplateVersionNotFound, got %v", err)
+	}
+}
+
+func TestSQLiteStorage_Assets(t *testing.T) {
+	store := newTestSQLiteStorage(t, filepath.Join(t.TempDir(), "test.db"))
+
+	asset := &models.TemplateAsset{
+		TemplateID:  "custom",
+		Name:        "logo.png",
+		ContentType: "image/png",
+		Size:        4,
+		ETag:        "abc",
+		CreatedAt:   time.Now(),
+		Data:        []byte{0x89, 'P', 'N', 'G'},
+	}
+	if err := store.SaveAsset(asset); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	stored, err := store.GetAsset(models.DefaultOrganizationID, "custom", "logo.png")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !bytes.Equal(stored.Data, asset.Data) || stored.ContentType != "image/png" {
+		t.Errorf("Expected the stored asset, got %+v", stored)
+	}
+
+	assets, err := store.GetAssets(models.DefaultOrganizationID, "custom")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(assets) != 1 || assets[0].Data != nil {
+		t.Errorf("Expected one asset listed without content, got %+v", assets)
+	}
+
+	if err := store.DeleteAsset(models.DefaultOrganizationID, "custom", "logo.png"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := store.GetAsset(models.DefaultOrganizationID, "custom", "logo.png"); !errors.Is(err, storage.ErrAssetNotFound) {
+		t.Errorf("Expected ErrAssetNotFound, got %v", err)
+	}
+}
+
+func TestSQLiteStorage_Organizations(t *testing.T) {
+	store := newTestSQLiteStorage(t, filepath.Join(t.TempDir(), "test.db"))
+
+	// Template IDs only need to be unique within an organization
+	for _, org := range []string{models.DefaultOrganizationID, "acme"} {
+		template := &models.Template{OrganizationID: org, ID: "custom", Name: "Custom " + org, HTMLTemplate: "<p>" + org + "</p>"}
+		if err := store.SaveTemplate(template); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	template, err := store.GetTemplate("acme", "custom")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if template.Name != "Custom acme" || template.OrganizationID != "acme" {
+		t.Errorf("Expected the template of acme, got %+v", template)
+	}
+	if err := store.DeleteTemplate("acme", "custom"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := store.GetTemplate(models.DefaultOrganizationID, "custom"); err != nil {
+		t.Errorf("Expected the template of the default organization to remain, got %v", err)
+	}
+
+	cert := newTestCertificate("shared@example.com")
+	cert.OrganizationID = "acme"
+	if err := store.SaveCertificate(cert); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if certs, _ := store.GetCertificatesByEmail(models.DefaultOrganizationID, "shared@example.com"); len(certs) != 0 {
+		t.Errorf("Expected no certificates in the default organization, got %d", len(certs))
+	}
+	if certs, _ := store.GetCertificatesByEmail("acme", "shared@example.com"); len(certs) != 1 || certs[0].OrganizationID != "acme" {
+		t.Errorf("Expected the certificate of acme, got %+v", certs)
+	}
+
+	if err := store.SaveOrganization(&models.Organization{ID: "acme", Name: "Acme", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if org, err := store.GetOrganization("acme"); err != nil || org.Name != "Acme" {
+		t.Errorf("Expected organization acme, got %+v (%v)", org, err)
+	}
+	if _, err := store.GetOrganization("missing"); !errors.Is(err, storage.ErrOrganizationNotFound) {
+		t.Errorf("Expected ErrOrganizationNotFound, got %v", err)
+	}
+
+	key := &models.APIKey{ID: "k1", OrganizationID: "acme", Name: "ci", Prefix: "vc_abc", Hash: "hash", CreatedAt: time.Now()}
+	if err := store.SaveAPIKey(key); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if stored, err := store.GetAPIKeyByHash("hash"); err != nil || stored.OrganizationID != "acme" {
+		t.Errorf("Expected the key of acme, got %+v (%v)", stored, err)
+	}
+	if _, err := store.GetAPIKeyByHash("other"); !errors.Is(err, storage.ErrAPIKeyNotFound) {
+		t.Errorf("Expected ErrAPIKeyNotFound, got %v", err)
+	}
+}
+
+func TestSQLiteStorage_APIKeys(t *testing.T) {
+	store := newTestSQLiteStorage(t, filepath.Join(t.TempDir(), "test.db"))
+
+	created := time.Now().Add(-time.Hour)
+	first := &models.APIKey{ID: "k1", OrganizationID: "acme", Name: "ci", Role: models.RoleIssuer, Prefix: "vc_abc", Hash: "h1", CreatedAt: created}
+	second := &models.APIKey{ID: "k2", OrganizationID: "acme", Name: "viewer", Role: models.RoleReadOnly, Prefix: "vc_def", Hash: "h2", CreatedAt: created.Add(time.Minute)}
+	other := &models.APIKey{ID: "k3", OrganizationID: models.DefaultOrganizationID, Name: "admin", Role: models.RoleAdmin, Prefix: "vc_ghi", Hash: "h3", CreatedAt: created}
+	for _, key := range []*models.APIKey{second, first, other} {
+		if err := store.SaveAPIKey(key); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	revokedAt := time.Now()
+	revoked := *first
+	revoked.RevokedAt = &revokedAt
+	if err := store.SaveAPIKey(&revoked); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	keys, err := store.GetAPIKeys("acme")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(keys) != 2 || keys[0].ID != "k1" || keys[1].ID != "k2" {
+		t.Fatalf("Expected the keys of acme oldest first, got %+v", keys)
+	}
+	if keys[0].Role != models.RoleIssuer || !keys[0].IsRevoked() {
+		t.Errorf("Expected a revoked issuer key, got %+v", keys[0])
+	}
+	if stored, err := store.GetAPIKeyByHash("h2"); err != nil || stored.Role != models.RoleReadOnly || stored.IsRevoked() {
+		t.Errorf("Expected an active read-only key, got %+v (%v)", stored, err)
+	}
+}
+
+func TestSQLiteStorage_AuditLog(t *testing.T) {
+	store := newTestSQLiteStorage(t, filepath.Join(t.TempDir(), "test.db"))
+
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i, action := range []string{models.AuditTemplateCreate, models.AuditCertificateCreate, models.AuditCertificateRevoke} {
+		entry := &models.AuditEntry{
+			ID:             "e" + strconv.Itoa(i),
+			OrganizationID: models.DefaultOrganizationID,
+			Actor:          models.Actor{ID: "key-1", Name: "ci"},
+			Action:         action,
+			TargetType:     strings.SplitN(action, ".", 2)[0],
+			TargetID:       "target",
+			After:          json.RawMessage(`{"step":` + strconv.Itoa(i) + `}`),
+			Timestamp:      start.Add(time.Duration(i) * time.Hour),
+		}
+		if err := store.SaveAuditEntry(entry); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	other := &models.AuditEntry{ID: "other", OrganizationID: "acme", Action: models.AuditTemplateCreate, TargetType: "template", TargetID: "target", Timestamp: start}
+	if err := store.SaveAuditEntry(other); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	entries, err := store.GetAuditEntries(models.DefaultOrganizationID, &models.AuditFilter{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(entries) != 3 || entries[0].ID != "e2" || entries[2].ID != "e0" {
+		t.Fatalf("Expected the 3 entries newest first, got %+v", entries)
+	}
+	if entries[0].Actor.Name != "ci" || string(entries[0].After) != `{"step":2}` || entries[0].Before != nil {
+		t.Errorf("Expected the entry to round-trip, got %+v", entries[0])
+	}
+	if !entries[0].Timestamp.Equal(start.Add(2 * time.Hour)) {
+		t.Errorf("Expected timestamp %v, got %v", start.Add(2*time.Hour), entries[0].Timestamp)
+	}
+
+	certificates, _ := store.GetAuditEntries(models.DefaultOrganizationID, &models.AuditFilter{TargetType: "certificate"})
+	if len(certificates) != 2 {
+		t.Errorf("Expected 2 certificate entries, got %d", len(certificates))
+	}
+	window, _ := store.GetAuditEntries(models.DefaultOrganizationID, &models.AuditFilter{Since: start.Add(time.Hour), Until: start.Add(2 * time.Hour)})
+	if len(window) != 1 || window[0].ID != "e1" {
+		t.Errorf("Expected the entry within the window, got %+v", window)
+	}
+	limited, _ := store.GetAuditEntries(models.DefaultOrganizationID, &models.AuditFilter{ActorID: "key-1", Limit: 1})
+	if len(limited) != 1 || limited[0].ID != "e2" {
+		t.Errorf("Expected the newest entry, got %+v", limited)
+	}
+}
+
+func TestSQLiteStorage_IdempotencyKeys(t *testing.T) {
+	store := newTestSQLiteStorage(t, filepath.Join(t.TempDir(), "test.db"))
+
+	created := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	first := &models.IdempotencyKey{OrganizationID: models.DefaultOrganizationID, Key: "order-1", RequestHash: "h1", CertificateID: "c1", CreatedAt: created}
+	again := &models.IdempotencyKey{OrganizationID: models.DefaultOrganizationID, Key: "order-1", RequestHash: "h2", CertificateID: "c2", CreatedAt: created}
+	for _, key := range []*models.IdempotencyKey{first, again} {
+		if err := store.SaveIdempotencyKey(key); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	stored, err := store.GetIdempotencyKey(models.DefaultOrganizationID, "order-1")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if stored.CertificateID != "c1" || stored.RequestHash != "h1" || !stored.CreatedAt.Equal(created) {
+		t.Errorf("Expected the first key to be kept, got %+v", stored)
+	}
+	if _, err := store.GetIdempotencyKey("acme", "order-1"); !errors.Is(err, storage.ErrIdempotencyKeyNotFound) {
+		t.Errorf("Expected ErrIdempotencyKeyNotFound for another organization, got %v", err)
+	}
+}
+
+func TestSQLiteStorage_CertificateSupersession(t *testing.T) {
+	store := newTestSQLiteStorage(t, filepath.Join(t.TempDir(), "test.db"))
+
+	old := newTestCertificate("john@example.com")
+	corrected := newTestCertificate("john@example.com")
+	corrected.Supersedes = old.ID
+	corrected.CorrectionReason = "Misspelt name"
+	supersededAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	old.Status = models.StatusSuperseded
+	old.SupersededBy = corrected.ID
+	old.SupersededAt = &supersededAt
+	for _, cert := range []*models.Certificate{old, corrected} {
+		if err := store.SaveCertificate(cert); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	stored, err := store.GetCertificate(old.ID)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !stored.IsSuperseded() || stored.SupersededBy != corrected.ID || stored.SupersededAt == nil || !stored.SupersededAt.Equal(supersededAt) {
+		t.Errorf("Expected the supersession to round-trip, got %+v", stored)
+	}
+	if stored, _ := store.GetCertificate(corrected.ID); stored.Supersedes != old.ID || stored.CorrectionReason != "Misspelt name" || stored.SupersededAt != nil {
+		t.Errorf("Expected the correction to round-trip, got %+v", stored)
+	}
+}
+
+func TestSQLiteStorage_UpdateDelivery(t *testing.T) {
+	store := newTestSQLiteStorage(t, filepath.Join(t.TempDir(), "test.db"))
+	testUpdateDelivery(t, store)
+}
+
+// testUpdateDelivery checks that only the delivery status is replaced
+func testUpdateDelivery(t *testing.T, store storage.Storage) {
+	t.Helper()
+
+	cert := newTestCertificate("john@example.com")
+	cert.Delivery = &models.DeliveryStatus{Status: models.DeliveryPending}
+	store.SaveCertificate(cert)
+
+	revoked := *cert
+	revoked.Status = models.StatusRevoked
+	store.SaveCertificate(&revoked)
+
+	if err := store.UpdateDelivery(cert.ID, &models.DeliveryStatus{Status: models.DeliverySent, Attempts: 1}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	stored, _ := store.GetCertificate(cert.ID)
+	if !stored.IsRevoked() || stored.Delivery == nil || stored.Delivery.Status != models.DeliverySent {
+		t.Errorf("Expected a revoked certificate marked sent, got %+v", stored)
+	}
+
+	if err := store.UpdateDelivery("missing", &models.DeliveryStatus{}); !errors.Is(err, storage.ErrCertificateNotFound) {
+		t.Errorf("Expected ErrCertificateNotFound, got %v", err)
+	}
+}